@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/auth"
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/limits"
+	"github.com/n0madic/go-chatmock/internal/models"
+)
+
+// maxClockSkew is the largest local/upstream clock difference tolerated before
+// JWT expiry checks (which drive token refresh) become unreliable.
+const maxClockSkew = 2 * time.Minute
+
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+	doctorSkip = "skip"
+)
+
+type doctorCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type doctorReport struct {
+	OK     bool          `json:"ok"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+// doctorDeps abstracts everything the checks touch so tests can stub them.
+type doctorDeps struct {
+	readAuthFile  func() (*auth.AuthFile, error)
+	effectiveAuth func() (accessToken, accountID string, err error)
+	refreshModels func() ([]models.RemoteModel, error)
+	loadLimits    func() *limits.StoredSnapshot
+	serverTime    func() (time.Time, error)
+	listen        func(addr string) error
+	now           func() time.Time
+}
+
+func defaultDoctorDeps() doctorDeps {
+	tm := auth.NewTokenManager(config.ClientID(), config.TokenURL())
+	return doctorDeps{
+		readAuthFile:  auth.ReadAuthFile,
+		effectiveAuth: tm.GetEffectiveAuth,
+		refreshModels: func() ([]models.RemoteModel, error) {
+			return models.NewRegistry(tm).Refresh()
+		},
+		loadLimits: limits.LoadSnapshot,
+		serverTime: upstreamServerTime,
+		listen: func(addr string) error {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			return ln.Close()
+		},
+		now: time.Now,
+	}
+}
+
+func cmdDoctor() int {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	host := fs.String("host", "127.0.0.1", "Bind host to check")
+	port := fs.Int("port", 8000, "Listen port to check")
+	jsonOut := fs.Bool("json", false, "Output the report as JSON")
+	fs.Parse(os.Args[2:])
+
+	report := runDoctor(defaultDoctorDeps(), net.JoinHostPort(*host, strconv.Itoa(*port)))
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printDoctorText(os.Stdout, report)
+	}
+	if !report.OK {
+		return 1
+	}
+	return 0
+}
+
+// runDoctor executes every check in order. Checks that depend on credentials
+// are skipped when the user is not signed in.
+func runDoctor(deps doctorDeps, listenAddr string) doctorReport {
+	var checks []doctorCheck
+	add := func(c doctorCheck) { checks = append(checks, c) }
+
+	af, err := deps.readAuthFile()
+	signedIn := err == nil && af != nil && af.Tokens.AccessToken+af.Tokens.RefreshToken != ""
+	if signedIn {
+		add(doctorCheck{Name: "auth file", Status: doctorPass, Critical: true, Detail: "found in " + auth.HomeDir()})
+	} else {
+		add(doctorCheck{Name: "auth file", Status: doctorFail, Critical: true, Detail: "not signed in; run: go-chatmock login"})
+	}
+
+	if signedIn {
+		add(checkTokenValidity(af, deps.now()))
+		add(checkTokenRefresh(deps))
+		add(checkModelsEndpoint(deps))
+	} else {
+		for _, name := range []string{"access token", "token refresh", "models endpoint"} {
+			add(doctorCheck{Name: name, Status: doctorSkip, Critical: true, Detail: "requires sign-in"})
+		}
+	}
+
+	add(checkClockSkew(deps))
+	add(checkListen(deps, listenAddr))
+	add(checkUsageLimits(deps))
+
+	report := doctorReport{OK: true, Checks: checks}
+	for _, c := range checks {
+		if c.Critical && c.Status == doctorFail {
+			report.OK = false
+		}
+	}
+	return report
+}
+
+func checkTokenValidity(af *auth.AuthFile, now time.Time) doctorCheck {
+	c := doctorCheck{Name: "access token", Critical: true}
+	exp, ok := tokenExpiry(af.Tokens.AccessToken)
+	switch {
+	case af.Tokens.AccessToken == "":
+		c.Status, c.Detail = doctorWarn, "missing; will be obtained via refresh token"
+	case !ok:
+		c.Status, c.Detail = doctorPass, "present (no expiry claim)"
+	case exp.After(now):
+		c.Status, c.Detail = doctorPass, "valid until "+exp.UTC().Format(time.RFC3339)
+	case af.Tokens.RefreshToken != "":
+		c.Status, c.Detail = doctorWarn, "expired at "+exp.UTC().Format(time.RFC3339)+"; will be refreshed"
+	default:
+		c.Status, c.Detail = doctorFail, "expired and no refresh token; run: go-chatmock login"
+	}
+	return c
+}
+
+func checkTokenRefresh(deps doctorDeps) doctorCheck {
+	c := doctorCheck{Name: "token refresh", Critical: true}
+	accessToken, _, err := deps.effectiveAuth()
+	if err != nil || accessToken == "" {
+		c.Status, c.Detail = doctorFail, "no usable access token; run: go-chatmock login"
+		return c
+	}
+	if exp, ok := tokenExpiry(accessToken); ok && !exp.After(deps.now()) {
+		c.Status, c.Detail = doctorFail, "refresh failed; access token is still expired"
+		return c
+	}
+	c.Status, c.Detail = doctorPass, "effective access token available"
+	return c
+}
+
+func checkModelsEndpoint(deps doctorDeps) doctorCheck {
+	c := doctorCheck{Name: "models endpoint", Critical: true}
+	mods, err := deps.refreshModels()
+	if err != nil {
+		c.Status, c.Detail = doctorFail, err.Error()
+		return c
+	}
+	c.Status, c.Detail = doctorPass, fmt.Sprintf("%d models available", len(mods))
+	return c
+}
+
+func checkClockSkew(deps doctorDeps) doctorCheck {
+	c := doctorCheck{Name: "clock skew"}
+	remote, err := deps.serverTime()
+	if err != nil {
+		c.Status, c.Detail = doctorWarn, "could not determine upstream time: "+err.Error()
+		return c
+	}
+	skew := deps.now().Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	skew = skew.Round(time.Second)
+	if skew > maxClockSkew {
+		c.Status, c.Detail = doctorWarn, fmt.Sprintf("local clock differs from upstream by %s; token expiry checks may misfire", skew)
+		return c
+	}
+	c.Status, c.Detail = doctorPass, fmt.Sprintf("within %s of upstream", skew)
+	return c
+}
+
+// checkListen only warns when the address is taken: doctor is often run
+// while the server itself is listening there.
+func checkListen(deps doctorDeps, addr string) doctorCheck {
+	c := doctorCheck{Name: "listen address"}
+	if err := deps.listen(addr); err != nil {
+		c.Status, c.Detail = doctorWarn, fmt.Sprintf("cannot bind %s (is the server already running?): %v", addr, err)
+		return c
+	}
+	c.Status, c.Detail = doctorPass, addr+" is free"
+	return c
+}
+
+func checkUsageLimits(deps doctorDeps) doctorCheck {
+	c := doctorCheck{Name: "usage limits"}
+	stored := deps.loadLimits()
+	if stored == nil {
+		c.Status, c.Detail = doctorSkip, "no usage snapshot yet"
+		return c
+	}
+	for _, w := range []*limits.RateLimitWindow{stored.Snapshot.Primary, stored.Snapshot.Secondary} {
+		if w != nil && w.UsedPercent >= 100 {
+			c.Status, c.Detail = doctorWarn, "a usage limit window is exhausted"
+			return c
+		}
+	}
+	c.Status, c.Detail = doctorPass, "last updated "+formatLocalDateTime(stored.CapturedAt)
+	return c
+}
+
+func tokenExpiry(token string) (time.Time, bool) {
+	claims, err := auth.ParseJWTClaims(token)
+	if err != nil {
+		return time.Time{}, false
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+// upstreamServerTime reads the Date header of the ChatGPT backend. Any status is
+// fine; only the header matters.
+func upstreamServerTime() (time.Time, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Head(config.ModelsURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+	resp.Body.Close()
+	return http.ParseTime(resp.Header.Get("Date"))
+}
+
+func printDoctorText(w io.Writer, report doctorReport) {
+	fmt.Fprintln(w, "\U0001FA7A ChatMock doctor")
+	for _, c := range report.Checks {
+		icon := map[string]string{
+			doctorPass: "\u2705",
+			doctorWarn: "\u26A0\uFE0F ",
+			doctorFail: "\u274C",
+			doctorSkip: "\u23ED\uFE0F ",
+		}[c.Status]
+		fmt.Fprintf(w, "  %s %-16s %s\n", icon, c.Name, c.Detail)
+	}
+	fmt.Fprintln(w)
+	if report.OK {
+		fmt.Fprintln(w, "All critical checks passed.")
+	} else {
+		fmt.Fprintln(w, "One or more critical checks failed.")
+	}
+}
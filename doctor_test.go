@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/auth"
+	"github.com/n0madic/go-chatmock/internal/limits"
+	"github.com/n0madic/go-chatmock/internal/models"
+)
+
+var doctorNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testJWT(claims map[string]any) string {
+	enc := base64.RawURLEncoding
+	payload, _ := json.Marshal(claims)
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + ".sig"
+}
+
+func stubDoctorDeps() doctorDeps {
+	return doctorDeps{
+		readAuthFile:  func() (*auth.AuthFile, error) { return nil, auth.ErrNoCredentials },
+		effectiveAuth: func() (string, string, error) { return "", "", auth.ErrNoCredentials },
+		refreshModels: func() ([]models.RemoteModel, error) { return nil, errors.New("unexpected call") },
+		loadLimits:    func() *limits.StoredSnapshot { return nil },
+		serverTime:    func() (time.Time, error) { return doctorNow.Add(3 * time.Second), nil },
+		listen:        func(string) error { return nil },
+		now:           func() time.Time { return doctorNow },
+	}
+}
+
+func findCheck(t *testing.T, report doctorReport, name string) doctorCheck {
+	t.Helper()
+	for _, c := range report.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("check %q missing from report %+v", name, report.Checks)
+	return doctorCheck{}
+}
+
+func TestDoctorSignedIn(t *testing.T) {
+	token := testJWT(map[string]any{"exp": float64(doctorNow.Add(time.Hour).Unix())})
+	deps := stubDoctorDeps()
+	deps.readAuthFile = func() (*auth.AuthFile, error) {
+		return &auth.AuthFile{Tokens: auth.TokenData{AccessToken: token, RefreshToken: "rt"}}, nil
+	}
+	deps.effectiveAuth = func() (string, string, error) { return token, "acct", nil }
+	deps.refreshModels = func() ([]models.RemoteModel, error) {
+		return []models.RemoteModel{{Slug: "gpt-5"}, {Slug: "gpt-5-codex"}}, nil
+	}
+
+	report := runDoctor(deps, "127.0.0.1:8000")
+	if !report.OK {
+		t.Fatalf("expected OK report, got %+v", report.Checks)
+	}
+	for _, name := range []string{"auth file", "access token", "token refresh", "models endpoint", "clock skew", "listen address"} {
+		if c := findCheck(t, report, name); c.Status != doctorPass {
+			t.Errorf("%s: got %s (%s), want pass", name, c.Status, c.Detail)
+		}
+	}
+	if c := findCheck(t, report, "models endpoint"); !strings.Contains(c.Detail, "2 models") {
+		t.Errorf("models detail: got %q", c.Detail)
+	}
+
+	var buf bytes.Buffer
+	printDoctorText(&buf, report)
+	if !strings.Contains(buf.String(), "All critical checks passed.") {
+		t.Errorf("text report missing success line:\n%s", buf.String())
+	}
+}
+
+func TestDoctorSignedOut(t *testing.T) {
+	deps := stubDoctorDeps()
+	deps.serverTime = func() (time.Time, error) { return doctorNow.Add(-10 * time.Minute), nil }
+
+	report := runDoctor(deps, "127.0.0.1:8000")
+	if report.OK {
+		t.Fatal("signed-out report should not be OK")
+	}
+	if c := findCheck(t, report, "auth file"); c.Status != doctorFail {
+		t.Errorf("auth file: got %s, want fail", c.Status)
+	}
+	for _, name := range []string{"access token", "token refresh", "models endpoint"} {
+		if c := findCheck(t, report, name); c.Status != doctorSkip {
+			t.Errorf("%s: got %s, want skip", name, c.Status)
+		}
+	}
+	if c := findCheck(t, report, "clock skew"); c.Status != doctorWarn {
+		t.Errorf("clock skew: got %s, want warn for 10m drift", c.Status)
+	}
+
+	var buf bytes.Buffer
+	printDoctorText(&buf, report)
+	out := buf.String()
+	if !strings.Contains(out, "go-chatmock login") || !strings.Contains(out, "critical checks failed") {
+		t.Errorf("text report missing login hint or failure line:\n%s", out)
+	}
+}
+
+func TestDoctorExpiredTokenWithoutRefreshFails(t *testing.T) {
+	token := testJWT(map[string]any{"exp": float64(doctorNow.Add(-time.Hour).Unix())})
+	deps := stubDoctorDeps()
+	deps.readAuthFile = func() (*auth.AuthFile, error) {
+		return &auth.AuthFile{Tokens: auth.TokenData{AccessToken: token}}, nil
+	}
+	deps.effectiveAuth = func() (string, string, error) { return token, "", nil }
+	deps.refreshModels = func() ([]models.RemoteModel, error) { return nil, errors.New("models endpoint returned HTTP 401") }
+
+	report := runDoctor(deps, "127.0.0.1:8000")
+	if report.OK {
+		t.Fatal("expired credentials should fail the report")
+	}
+	for _, name := range []string{"access token", "token refresh", "models endpoint"} {
+		if c := findCheck(t, report, name); c.Status != doctorFail {
+			t.Errorf("%s: got %s (%s), want fail", name, c.Status, c.Detail)
+		}
+	}
+}
+
+func TestDoctorBusyListenAddressOnlyWarns(t *testing.T) {
+	token := testJWT(map[string]any{"exp": float64(doctorNow.Add(time.Hour).Unix())})
+	deps := stubDoctorDeps()
+	deps.readAuthFile = func() (*auth.AuthFile, error) {
+		return &auth.AuthFile{Tokens: auth.TokenData{AccessToken: token, RefreshToken: "rt"}}, nil
+	}
+	deps.effectiveAuth = func() (string, string, error) { return token, "acct", nil }
+	deps.refreshModels = func() ([]models.RemoteModel, error) { return []models.RemoteModel{{Slug: "gpt-5"}}, nil }
+	deps.listen = func(string) error { return errors.New("address already in use") }
+
+	report := runDoctor(deps, "127.0.0.1:8000")
+	if c := findCheck(t, report, "listen address"); c.Status != doctorWarn || c.Critical {
+		t.Errorf("listen address: got status %s critical %v, want a non-critical warn", c.Status, c.Critical)
+	}
+	if !report.OK {
+		t.Errorf("a busy listen address alone should not fail the report: %+v", report.Checks)
+	}
+}
@@ -5,6 +5,7 @@ go 1.24.0
 require (
 	github.com/google/uuid v1.6.0
 	github.com/openai/openai-go/v3 v3.23.0
+	golang.org/x/crypto v0.45.0
 	golang.org/x/oauth2 v0.35.0
 )
 
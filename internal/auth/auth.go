@@ -36,41 +36,63 @@ func HomeDir() string {
 	return filepath.Join(home, ".chatgpt-local")
 }
 
+// AuthFilePath returns the path WriteAuthFile writes to: CHATGPT_LOCAL_AUTH_FILE
+// when set, otherwise auth.json in HomeDir.
+func AuthFilePath() string {
+	if p := os.Getenv("CHATGPT_LOCAL_AUTH_FILE"); p != "" {
+		return p
+	}
+	return filepath.Join(HomeDir(), "auth.json")
+}
+
 // ReadAuthFile searches known locations for auth.json.
 // Locations are checked in priority order: environment variable overrides first
 // (to support CI/container deployments), then the default home directories.
 // The .codex path is included for compatibility with the official Codex CLI,
 // which writes auth.json there; users who have already logged in via the CLI
 // do not need to run `go-chatmock login` separately.
+// CHATGPT_LOCAL_AUTH_FILE, when set, is the only location consulted.
+// Encrypted files are decrypted with CHATGPT_LOCAL_AUTH_KEY.
 func ReadAuthFile() (*AuthFile, error) {
-	home, _ := os.UserHomeDir()
-	candidates := []string{
-		os.Getenv("CHATGPT_LOCAL_HOME"),
-		os.Getenv("CODEX_HOME"),
-		filepath.Join(home, ".chatgpt-local"),
-		filepath.Join(home, ".codex"),
-	}
-	for _, base := range candidates {
-		if base == "" {
-			continue
+	var candidates []string
+	if p := os.Getenv("CHATGPT_LOCAL_AUTH_FILE"); p != "" {
+		candidates = []string{p}
+	} else {
+		home, _ := os.UserHomeDir()
+		for _, base := range []string{
+			os.Getenv("CHATGPT_LOCAL_HOME"),
+			os.Getenv("CODEX_HOME"),
+			filepath.Join(home, ".chatgpt-local"),
+			filepath.Join(home, ".codex"),
+		} {
+			if base != "" {
+				candidates = append(candidates, filepath.Join(base, "auth.json"))
+			}
 		}
-		p := filepath.Join(base, "auth.json")
+	}
+	for _, p := range candidates {
 		data, err := os.ReadFile(p)
 		if err != nil {
 			continue
 		}
-		var af AuthFile
-		if err := json.Unmarshal(data, &af); err != nil {
+		af, encrypted, err := decodeAuthFile(data)
+		if err != nil {
+			if encrypted {
+				// Do not fall back to another location past a file we cannot open.
+				return nil, fmt.Errorf("%w (%s: %v)", ErrNoCredentials, p, err)
+			}
 			continue
 		}
-		return &af, nil
+		return af, nil
 	}
 	return nil, ErrNoCredentials
 }
 
-// WriteAuthFile persists the auth data to the home directory with 0600 permissions.
+// WriteAuthFile persists the auth data to AuthFilePath with 0600 permissions.
+// When CHATGPT_LOCAL_AUTH_KEY is set the file is encrypted at rest.
 func WriteAuthFile(af *AuthFile) error {
-	dir := HomeDir()
+	p := AuthFilePath()
+	dir := filepath.Dir(p)
 	if err := os.MkdirAll(dir, 0o700); err != nil {
 		return fmt.Errorf("unable to create auth home directory %s: %w", dir, err)
 	}
@@ -78,7 +100,11 @@ func WriteAuthFile(af *AuthFile) error {
 	if err != nil {
 		return err
 	}
-	p := filepath.Join(dir, "auth.json")
+	if secret := authSecret(); secret != nil {
+		if data, err = sealAuthFile(data, secret); err != nil {
+			return fmt.Errorf("unable to encrypt auth file: %w", err)
+		}
+	}
 	return os.WriteFile(p, data, 0o600)
 }
 
@@ -113,6 +139,13 @@ type TokenManager struct {
 	tokenURL   string
 	cachedAuth *AuthFile
 	cachedAt   time.Time
+	now        func() time.Time
+
+	// seenAuth and lastAccountID track the account of the previous call so a
+	// credential change (e.g. `login` while serving) can be reported.
+	seenAuth      bool
+	lastAccountID string
+	onAuthChange  []func()
 }
 
 // NewTokenManager creates a new token manager with the given OAuth config.
@@ -120,16 +153,75 @@ func NewTokenManager(clientID, tokenURL string) *TokenManager {
 	return &TokenManager{
 		clientID: clientID,
 		tokenURL: tokenURL,
+		now:      time.Now,
 	}
 }
 
+// OnAuthChange registers fn to run, on its own goroutine, whenever the
+// credentials switch to a different account than the previous call saw,
+// including a first login after the server started without credentials.
+func (tm *TokenManager) OnAuthChange(fn func()) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.onAuthChange = append(tm.onAuthChange, fn)
+}
+
 // GetEffectiveAuth returns the access token and account ID, refreshing if needed.
 func (tm *TokenManager) GetEffectiveAuth() (accessToken, accountID string, err error) {
+	accessToken, accountID, _, err = tm.recordEffectiveAuth(false)
+	return accessToken, accountID, err
+}
+
+// Reload drops the cached credentials and reads them again, as after a
+// `login` while serving, reporting whether they now belong to another account
+// (which notifies the OnAuthChange listeners).
+func (tm *TokenManager) Reload() (accountID string, changed bool, err error) {
+	_, accountID, changed, err = tm.recordEffectiveAuth(true)
+	return accountID, changed, err
+}
+
+// recordEffectiveAuth loads the credentials and compares their account with
+// the previous call's under the same lock, so concurrent callers observe
+// account changes in load order and a switch is reported once.
+func (tm *TokenManager) recordEffectiveAuth(reload bool) (accessToken, accountID string, changed bool, err error) {
+	tm.mu.Lock()
+	if reload {
+		tm.cachedAuth = nil
+	}
+	accessToken, accountID, err = tm.effectiveAuthLocked()
+	changed = tm.seenAuth && accountID != "" && accountID != tm.lastAccountID
+	if accountID != "" || !tm.seenAuth {
+		tm.seenAuth, tm.lastAccountID = true, accountID
+	}
+	var listeners []func()
+	if changed {
+		listeners = append(listeners, tm.onAuthChange...)
+	}
+	tm.mu.Unlock()
+
+	if changed {
+		slog.Info("auth.account_changed", "listeners", len(listeners))
+	}
+	for _, fn := range listeners {
+		go fn()
+	}
+	return accessToken, accountID, changed, err
+}
+
+// PeekEffectiveAuth is GetEffectiveAuth for health probes: it loads (and if
+// needed refreshes) the credentials but does not record the account, so it
+// never notifies OnAuthChange listeners or their model refresh.
+func (tm *TokenManager) PeekEffectiveAuth() (accessToken, accountID string, err error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
+	return tm.effectiveAuthLocked()
+}
 
+// effectiveAuthLocked is GetEffectiveAuth without the account bookkeeping.
+// Caller must hold mu.
+func (tm *TokenManager) effectiveAuthLocked() (accessToken, accountID string, err error) {
 	var af *AuthFile
-	if tm.cachedAuth != nil && time.Since(tm.cachedAt) < authCacheTTL {
+	if tm.cachedAuth != nil && tm.now().Sub(tm.cachedAt) < authCacheTTL {
 		af = tm.cachedAuth
 	} else {
 		af, err = ReadAuthFile()
@@ -137,7 +229,7 @@ func (tm *TokenManager) GetEffectiveAuth() (accessToken, accountID string, err e
 			return "", "", ErrNoCredentials
 		}
 		tm.cachedAuth = af
-		tm.cachedAt = time.Now()
+		tm.cachedAt = tm.now()
 	}
 
 	accessToken = af.Tokens.AccessToken
@@ -175,7 +267,7 @@ func (tm *TokenManager) GetEffectiveAuth() (accessToken, accountID string, err e
 					slog.Error("unable to persist refreshed auth tokens", "error", err)
 				}
 				tm.cachedAuth = af
-				tm.cachedAt = time.Now()
+				tm.cachedAt = tm.now()
 			}
 		}
 	}
@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -111,3 +115,126 @@ func TestShouldRefreshAccessToken(t *testing.T) {
 		t.Error("far future token should not need refresh")
 	}
 }
+
+func TestEncryptedAuthFileRoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("CHATGPT_LOCAL_HOME", tmpDir)
+	t.Setenv("CHATGPT_LOCAL_AUTH_KEY", "correct horse battery staple")
+
+	af := &AuthFile{Tokens: TokenData{AccessToken: "access.tok.en", RefreshToken: "refresh_token", AccountID: "acct_123"}}
+	if err := WriteAuthFile(af); err != nil {
+		t.Fatalf("WriteAuthFile failed: %v", err)
+	}
+	raw, err := os.ReadFile(filepath.Join(tmpDir, "auth.json"))
+	if err != nil {
+		t.Fatalf("read auth.json: %v", err)
+	}
+	if strings.Contains(string(raw), "refresh_token\"") || strings.Contains(string(raw), "access.tok.en") {
+		t.Fatalf("encrypted auth file leaks tokens:\n%s", raw)
+	}
+	var env encryptedAuthFile
+	if err := json.Unmarshal(raw, &env); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	if env.KDF != "scrypt" || len(env.Salt) != authSaltSize {
+		t.Errorf("envelope kdf %q with %d-byte salt, want scrypt with %d", env.KDF, len(env.Salt), authSaltSize)
+	}
+	if err := WriteAuthFile(af); err != nil {
+		t.Fatalf("second WriteAuthFile failed: %v", err)
+	}
+	var env2 encryptedAuthFile
+	raw2, _ := os.ReadFile(filepath.Join(tmpDir, "auth.json"))
+	if err := json.Unmarshal(raw2, &env2); err != nil {
+		t.Fatalf("decode second envelope: %v", err)
+	}
+	if bytes.Equal(env.Salt, env2.Salt) {
+		t.Error("each write should use a fresh salt")
+	}
+
+	got, err := ReadAuthFile()
+	if err != nil {
+		t.Fatalf("ReadAuthFile with key: %v", err)
+	}
+	if got.Tokens != af.Tokens {
+		t.Errorf("tokens: got %+v, want %+v", got.Tokens, af.Tokens)
+	}
+
+	t.Setenv("CHATGPT_LOCAL_AUTH_KEY", "")
+	if _, err := ReadAuthFile(); !errors.Is(err, ErrNoCredentials) || !strings.Contains(err.Error(), "CHATGPT_LOCAL_AUTH_KEY") {
+		t.Errorf("ReadAuthFile without key: got %v, want ErrNoCredentials naming CHATGPT_LOCAL_AUTH_KEY", err)
+	}
+
+	t.Setenv("CHATGPT_LOCAL_AUTH_KEY", "wrong key")
+	if _, err := ReadAuthFile(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("ReadAuthFile with wrong key: got %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestPlaintextAuthFileLoadsWithKeySet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "custom-auth.json")
+	t.Setenv("CHATGPT_LOCAL_AUTH_FILE", path)
+	t.Setenv("CHATGPT_LOCAL_AUTH_KEY", "")
+
+	af := &AuthFile{Tokens: TokenData{AccessToken: "plain", AccountID: "acct_1"}}
+	if err := WriteAuthFile(af); err != nil {
+		t.Fatalf("WriteAuthFile failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(path); !strings.Contains(string(raw), `"plain"`) {
+		t.Fatalf("expected a plaintext file at %s, got:\n%s", path, raw)
+	}
+
+	t.Setenv("CHATGPT_LOCAL_AUTH_KEY", "some key")
+	got, err := ReadAuthFile()
+	if err != nil {
+		t.Fatalf("ReadAuthFile: %v", err)
+	}
+	if got.Tokens.AccessToken != "plain" {
+		t.Errorf("access token: got %q, want plain", got.Tokens.AccessToken)
+	}
+}
+
+func TestAuthChangeNotifiesOnceAfterCacheExpiry(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := WriteAuthFile(&AuthFile{Tokens: TokenData{AccessToken: "tok-a", AccountID: "acct-a"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	now := time.Now()
+	tm := NewTokenManager("", "")
+	tm.now = func() time.Time { return now }
+	notified := make(chan struct{}, 8)
+	tm.OnAuthChange(func() { notified <- struct{}{} })
+
+	if _, acct, err := tm.GetEffectiveAuth(); err != nil || acct != "acct-a" {
+		t.Fatalf("GetEffectiveAuth = %q, %v", acct, err)
+	}
+	if err := WriteAuthFile(&AuthFile{Tokens: TokenData{AccessToken: "tok-b", AccountID: "acct-b"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	if _, acct, _ := tm.GetEffectiveAuth(); acct != "acct-a" {
+		t.Fatalf("cached account = %q, want acct-a until the cache expires", acct)
+	}
+
+	now = now.Add(authCacheTTL)
+	if _, acct, _ := tm.PeekEffectiveAuth(); acct != "acct-b" {
+		t.Fatalf("peeked account = %q, want acct-b", acct)
+	}
+	for range 3 {
+		if _, acct, _ := tm.GetEffectiveAuth(); acct != "acct-b" {
+			t.Fatalf("account = %q, want acct-b", acct)
+		}
+	}
+	if _, changed, err := tm.Reload(); err != nil || changed {
+		t.Fatalf("Reload of the same account: changed=%v err=%v", changed, err)
+	}
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("account change was not notified")
+	}
+	select {
+	case <-notified:
+		t.Fatal("account change notified more than once")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
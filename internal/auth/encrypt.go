@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// authFileVersionEncrypted marks an auth file whose tokens are sealed with
+// AES-256-GCM. Plaintext files carry no version field and still load.
+const authFileVersionEncrypted = 2
+
+const authCipher = "aes-256-gcm"
+
+// The AES key is derived from CHATGPT_LOCAL_AUTH_KEY with scrypt and a random
+// per-file salt, so a low-entropy secret is not a cheap offline guess.
+const (
+	authKDF         = "scrypt"
+	authSaltSize    = 16
+	authScryptN     = 1 << 15
+	authScryptR     = 8
+	authScryptP     = 1
+	authScryptBytes = 32
+)
+
+// encryptedAuthFile is the on-disk envelope for an encrypted auth file.
+type encryptedAuthFile struct {
+	Version    int    `json:"version"`
+	Cipher     string `json:"cipher"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// authSecret returns CHATGPT_LOCAL_AUTH_KEY, or nil when encryption at rest is
+// not configured.
+func authSecret() []byte {
+	secret := strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_AUTH_KEY"))
+	if secret == "" {
+		return nil
+	}
+	return []byte(secret)
+}
+
+// lastAuthKey memoizes the most recent derivation: readiness probes re-read
+// the auth file, and scrypt is deliberately slow.
+var lastAuthKey struct {
+	mu           sync.Mutex
+	secret, salt string
+	key          []byte
+}
+
+// deriveAuthKey stretches secret into an AES-256 key with scrypt.
+func deriveAuthKey(secret, salt []byte) ([]byte, error) {
+	lastAuthKey.mu.Lock()
+	defer lastAuthKey.mu.Unlock()
+	if lastAuthKey.key != nil && lastAuthKey.secret == string(secret) && lastAuthKey.salt == string(salt) {
+		return lastAuthKey.key, nil
+	}
+	key, err := scrypt.Key(secret, salt, authScryptN, authScryptR, authScryptP, authScryptBytes)
+	if err != nil {
+		return nil, err
+	}
+	lastAuthKey.secret, lastAuthKey.salt, lastAuthKey.key = string(secret), string(salt), key
+	return key, nil
+}
+
+func newAuthGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealAuthFile encrypts the JSON-encoded auth data into a versioned envelope
+// under a key derived from secret and a fresh salt.
+func sealAuthFile(plain, secret []byte) ([]byte, error) {
+	salt := make([]byte, authSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveAuthKey(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newAuthGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(encryptedAuthFile{
+		Version:    authFileVersionEncrypted,
+		Cipher:     authCipher,
+		KDF:        authKDF,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plain, nil),
+	}, "", "  ")
+}
+
+// decodeAuthFile parses auth file contents in either the plaintext or the
+// encrypted format, reporting whether the file was encrypted.
+func decodeAuthFile(data []byte) (*AuthFile, bool, error) {
+	var env encryptedAuthFile
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, false, err
+	}
+	encrypted := env.Version >= authFileVersionEncrypted
+	if encrypted {
+		if env.Version != authFileVersionEncrypted || env.Cipher != authCipher || env.KDF != authKDF {
+			return nil, true, fmt.Errorf("unsupported auth file format (version %d, cipher %q, kdf %q)", env.Version, env.Cipher, env.KDF)
+		}
+		secret := authSecret()
+		if secret == nil {
+			return nil, true, errors.New("auth file is encrypted; set CHATGPT_LOCAL_AUTH_KEY")
+		}
+		if len(env.Salt) != authSaltSize {
+			return nil, true, errors.New("auth file has an invalid salt")
+		}
+		key, err := deriveAuthKey(secret, env.Salt)
+		if err != nil {
+			return nil, true, err
+		}
+		gcm, err := newAuthGCM(key)
+		if err != nil {
+			return nil, true, err
+		}
+		if len(env.Nonce) != gcm.NonceSize() {
+			return nil, true, errors.New("auth file has an invalid nonce")
+		}
+		plain, err := gcm.Open(nil, env.Nonce, env.Ciphertext, nil)
+		if err != nil {
+			return nil, true, errors.New("unable to decrypt auth file; check CHATGPT_LOCAL_AUTH_KEY")
+		}
+		data = plain
+	}
+	var af AuthFile
+	if err := json.Unmarshal(data, &af); err != nil {
+		return nil, encrypted, err
+	}
+	return &af, encrypted, nil
+}
@@ -0,0 +1,61 @@
+package codec
+
+import "github.com/n0madic/go-chatmock/internal/stream"
+
+// chatAnnotation converts a Responses output_text annotation to the chat
+// completions shape, where a URL citation's fields are nested under
+// url_citation. Other annotation types are passed through unchanged.
+func chatAnnotation(ann map[string]any) any {
+	if ann["type"] != "url_citation" {
+		return ann
+	}
+	citation := map[string]any{}
+	for _, key := range []string{"url", "title", "start_index", "end_index"} {
+		if v, ok := ann[key]; ok {
+			citation[key] = v
+		}
+	}
+	return map[string]any{"type": "url_citation", "url_citation": citation}
+}
+
+func chatAnnotations(anns []map[string]any) []any {
+	if len(anns) == 0 {
+		return nil
+	}
+	out := make([]any, len(anns))
+	for i, ann := range anns {
+		out[i] = chatAnnotation(ann)
+	}
+	return out
+}
+
+// anthropicCitation converts a Responses URL citation to an Anthropic
+// web_search_result_location citation; cited_text is the span of text the
+// annotation's indices cover. It reports false for other annotation types.
+func anthropicCitation(ann map[string]any, text string) (map[string]any, bool) {
+	if ann["type"] != "url_citation" {
+		return nil, false
+	}
+	citation := map[string]any{
+		"type":  "web_search_result_location",
+		"url":   stream.StringFromAny(ann["url"]),
+		"title": stream.StringFromAny(ann["title"]),
+	}
+	start, okStart := ann["start_index"].(float64)
+	end, okEnd := ann["end_index"].(float64)
+	runes := []rune(text)
+	if okStart && okEnd && start >= 0 && start <= end && int(end) <= len(runes) {
+		citation["cited_text"] = string(runes[int(start):int(end)])
+	}
+	return citation, true
+}
+
+func anthropicCitations(anns []map[string]any, text string) []any {
+	var out []any
+	for _, ann := range anns {
+		if citation, ok := anthropicCitation(ann, text); ok {
+			out = append(out, citation)
+		}
+	}
+	return out
+}
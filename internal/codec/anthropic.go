@@ -24,7 +24,7 @@ func (e *AnthropicEncoder) WriteStreamHeaders(w http.ResponseWriter, statusCode
 }
 
 func (e *AnthropicEncoder) StreamTranslator(w http.ResponseWriter, model string, opts StreamOpts) Translator {
-	return &anthropicStreamTranslator{w: w, model: model}
+	return &anthropicStreamTranslator{w: w, model: model, opts: opts}
 }
 
 func (e *AnthropicEncoder) WriteCollected(w http.ResponseWriter, statusCode int, resp *CollectedResponse, model string) {
@@ -36,8 +36,9 @@ func (e *AnthropicEncoder) WriteCollected(w http.ResponseWriter, statusCode int,
 	var content []types.AnthropicContentOut
 	if resp.FullText != "" {
 		content = append(content, types.AnthropicContentOut{
-			Type: "text",
-			Text: resp.FullText,
+			Type:      "text",
+			Text:      resp.FullText,
+			Citations: anthropicCitations(resp.Annotations, resp.FullText),
 		})
 	}
 
@@ -64,6 +65,7 @@ func (e *AnthropicEncoder) WriteCollected(w http.ResponseWriter, statusCode int,
 	if sawToolUse {
 		stopReason = "tool_use"
 	}
+	stopReason = anthropicStopReason(resp.IncompleteReason, stopReason)
 
 	result := types.AnthropicMessageResponse{
 		ID:           resp.ResponseID,
@@ -86,6 +88,7 @@ func (e *AnthropicEncoder) WriteError(w http.ResponseWriter, statusCode int, mes
 type anthropicStreamTranslator struct {
 	w     http.ResponseWriter
 	model string
+	opts  StreamOpts
 
 	messageID      string
 	started        bool
@@ -95,6 +98,8 @@ type anthropicStreamTranslator struct {
 	sawToolUse     bool
 	toolArgs       map[string]any
 	toolArgDeltas  map[string]string
+	blockText      strings.Builder // text of the open text block, for cited_text
+	annotations    stream.Annotations
 
 	flusher    http.Flusher
 	writeEvent func(event string, payload any) bool
@@ -122,15 +127,20 @@ func (t *anthropicStreamTranslator) Translate(reader *stream.Reader) {
 		return true
 	}
 
+	var readErr error
 	for {
 		evt, err := reader.Next()
 		if err != nil {
+			readErr = err
 			break
 		}
 
 		if id := responseIDFromData(evt.Data); id != "" {
 			t.messageID = id
 		}
+		if added := t.annotations.Observe(evt); len(added) > 0 {
+			t.writeCitations(added)
+		}
 
 		switch evt.Type {
 		case "response.output_item.added":
@@ -154,19 +164,10 @@ func (t *anthropicStreamTranslator) Translate(reader *stream.Reader) {
 		case "response.output_text.delta":
 			t.startIfNeeded()
 			if !t.textBlockOpen {
-				t.textBlockOpen = true
-				t.textBlockIndex = t.nextBlockIndex
-				t.nextBlockIndex++
-				_ = t.writeEvent("content_block_start", map[string]any{
-					"type":  "content_block_start",
-					"index": t.textBlockIndex,
-					"content_block": types.AnthropicContentOut{
-						Type: "text",
-						Text: "",
-					},
-				})
+				t.openTextBlock()
 			}
 			delta, _ := evt.Data["delta"].(string)
+			t.blockText.WriteString(delta)
 			_ = t.writeEvent("content_block_delta", map[string]any{
 				"type":  "content_block_delta",
 				"index": t.textBlockIndex,
@@ -202,12 +203,12 @@ func (t *anthropicStreamTranslator) Translate(reader *stream.Reader) {
 			})
 			return
 
-		case "response.completed":
+		case "response.completed", "response.incomplete":
 			t.startIfNeeded()
 			t.closeTextBlock()
 
 			usage := stream.ExtractUsageFromEvent(evt.Data)
-			u := types.AnthropicUsage{}
+			u := types.AnthropicUsage{InputTokens: t.opts.InputTokensEstimate}
 			if usage != nil {
 				u.InputTokens = usage.PromptTokens
 				u.OutputTokens = usage.CompletionTokens
@@ -217,6 +218,7 @@ func (t *anthropicStreamTranslator) Translate(reader *stream.Reader) {
 			if t.sawToolUse {
 				stopReason = "tool_use"
 			}
+			stopReason = anthropicStopReason(stream.IncompleteReasonFromEvent(evt.Data), stopReason)
 			_ = t.writeEvent("message_delta", map[string]any{
 				"type": "message_delta",
 				"delta": map[string]any{
@@ -248,10 +250,10 @@ func (t *anthropicStreamTranslator) Translate(reader *stream.Reader) {
 	_ = t.writeEvent("message_delta", map[string]any{
 		"type": "message_delta",
 		"delta": map[string]any{
-			"stop_reason":   "end_turn",
+			"stop_reason":   anthropicStopReason(StreamEndReason(readErr), "end_turn"),
 			"stop_sequence": nil,
 		},
-		"usage": types.AnthropicUsage{},
+		"usage": types.AnthropicUsage{InputTokens: t.opts.InputTokensEstimate},
 	})
 	_ = t.writeEvent("message_stop", map[string]any{"type": "message_stop"})
 }
@@ -271,7 +273,7 @@ func (t *anthropicStreamTranslator) startIfNeeded() {
 			Content:      []types.AnthropicContentOut{},
 			StopReason:   nil,
 			StopSequence: nil,
-			Usage:        types.AnthropicUsage{},
+			Usage:        types.AnthropicUsage{InputTokens: t.opts.InputTokensEstimate},
 		},
 	})
 	_ = t.writeEvent("ping", map[string]any{
@@ -279,6 +281,47 @@ func (t *anthropicStreamTranslator) startIfNeeded() {
 	})
 }
 
+func (t *anthropicStreamTranslator) openTextBlock() {
+	t.textBlockOpen = true
+	t.blockText.Reset()
+	t.textBlockIndex = t.nextBlockIndex
+	t.nextBlockIndex++
+	_ = t.writeEvent("content_block_start", map[string]any{
+		"type":  "content_block_start",
+		"index": t.textBlockIndex,
+		"content_block": types.AnthropicContentOut{
+			Type: "text",
+			Text: "",
+		},
+	})
+}
+
+// writeCitations sends annotations as citations_delta events on the open text
+// block. Annotations that only arrive on the finished message item, after its
+// text block closed, go on a new empty text block instead of being dropped;
+// their cited_text still comes from the text of the block they refer to.
+func (t *anthropicStreamTranslator) writeCitations(anns []map[string]any) {
+	citations := anthropicCitations(anns, t.blockText.String())
+	if len(citations) == 0 {
+		return
+	}
+	opened := !t.textBlockOpen
+	if opened {
+		t.startIfNeeded()
+		t.openTextBlock()
+	}
+	for _, citation := range citations {
+		_ = t.writeEvent("content_block_delta", map[string]any{
+			"type":  "content_block_delta",
+			"index": t.textBlockIndex,
+			"delta": map[string]any{"type": "citations_delta", "citation": citation},
+		})
+	}
+	if opened {
+		t.closeTextBlock()
+	}
+}
+
 func (t *anthropicStreamTranslator) closeTextBlock() {
 	if !t.textBlockOpen {
 		return
@@ -0,0 +1,138 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+// sseReader builds a stream.Reader over the given upstream SSE data payloads.
+func sseReader(events ...string) *stream.Reader {
+	var b strings.Builder
+	for _, e := range events {
+		b.WriteString("data: ")
+		b.WriteString(e)
+		b.WriteString("\n\n")
+	}
+	return stream.NewReader(io.NopCloser(strings.NewReader(b.String())))
+}
+
+// anthropicEvents parses the translator output into (event, payload) pairs.
+func anthropicEvents(t *testing.T, body string) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line[6:]), &m); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestAnthropicMessageStartCarriesEstimatedInputTokens(t *testing.T) {
+	rec := httptest.NewRecorder()
+	enc := &AnthropicEncoder{}
+	tr := enc.StreamTranslator(rec, "claude-test", StreamOpts{InputTokensEstimate: 42})
+	tr.Translate(sseReader(
+		`{"type":"response.output_text.delta","delta":"hi"}`,
+		`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":57,"output_tokens":3}}}`,
+	))
+
+	events := anthropicEvents(t, rec.Body.String())
+	if len(events) == 0 || events[0]["type"] != "message_start" {
+		t.Fatalf("first event should be message_start, got %v", events)
+	}
+	msg, _ := events[0]["message"].(map[string]any)
+	usage, _ := msg["usage"].(map[string]any)
+	if got := stream.Int64FromAny(usage["input_tokens"]); got != 42 {
+		t.Errorf("message_start input_tokens: got %d, want 42", got)
+	}
+
+	var delta map[string]any
+	for _, e := range events {
+		if e["type"] == "message_delta" {
+			delta = e
+		}
+	}
+	if delta == nil {
+		t.Fatal("missing message_delta")
+	}
+	final, _ := delta["usage"].(map[string]any)
+	if got := stream.Int64FromAny(final["input_tokens"]); got != 57 {
+		t.Errorf("message_delta input_tokens: got %d, want upstream 57", got)
+	}
+}
+
+func TestAnthropicStreamCitationsFromAnnotations(t *testing.T) {
+	const ann = `{"type":"url_citation","url":"https://go.dev/doc/go1.24","title":"Go 1.24 Release Notes","start_index":0,"end_index":7}`
+	for name, events := range map[string][]string{
+		"annotation event": {
+			`{"type":"response.output_text.delta","delta":"Go 1.24 is out."}`,
+			`{"type":"response.output_text.annotation.added","annotation":` + ann + `}`,
+			`{"type":"response.output_text.done"}`,
+			`{"type":"response.completed","response":{"id":"resp_1"}}`,
+		},
+		"finished item only": {
+			`{"type":"response.output_text.delta","delta":"Go 1.24 is out."}`,
+			`{"type":"response.output_text.done"}`,
+			`{"type":"response.output_item.done","item":{"type":"message","content":[{"type":"output_text","text":"Go 1.24 is out.","annotations":[` + ann + `]}]}}`,
+			`{"type":"response.completed","response":{"id":"resp_1"}}`,
+		},
+	} {
+		rec := httptest.NewRecorder()
+		tr := (&AnthropicEncoder{}).StreamTranslator(rec, "claude-test", StreamOpts{})
+		tr.Translate(sseReader(events...))
+
+		var citation map[string]any
+		open := map[any]bool{}
+		for _, evt := range anthropicEvents(t, rec.Body.String()) {
+			switch evt["type"] {
+			case "content_block_start":
+				open[evt["index"]] = true
+			case "content_block_stop":
+				delete(open, evt["index"])
+			}
+			if delta, _ := evt["delta"].(map[string]any); delta["type"] == "citations_delta" {
+				if !open[evt["index"]] {
+					t.Errorf("%s: citations_delta on a closed block %v", name, evt["index"])
+				}
+				citation, _ = delta["citation"].(map[string]any)
+			}
+		}
+		if citation["type"] != "web_search_result_location" || citation["url"] != "https://go.dev/doc/go1.24" || citation["cited_text"] != "Go 1.24" {
+			t.Errorf("%s: citations_delta: got %v", name, citation)
+		}
+	}
+}
+
+func TestAnthropicIdleTimeoutStopsAsMaxTokens(t *testing.T) {
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("data: {\"type\":\"response.output_text.delta\",\"delta\":\"Partial\"}\n\n")) //nolint:errcheck
+	rec := httptest.NewRecorder()
+	tr := (&AnthropicEncoder{}).StreamTranslator(rec, "claude-test", StreamOpts{})
+	tr.Translate(stream.NewReader(stream.NewIdleTimeoutBody(pr, 50*time.Millisecond)))
+
+	events := anthropicEvents(t, rec.Body.String())
+	var stopReason any
+	for _, evt := range events {
+		if delta, _ := evt["delta"].(map[string]any); evt["type"] == "message_delta" {
+			stopReason = delta["stop_reason"]
+		}
+	}
+	if stopReason != "max_tokens" || events[len(events)-1]["type"] != "message_stop" {
+		t.Errorf("want stop_reason max_tokens then message_stop, got %v", events)
+	}
+}
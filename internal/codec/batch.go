@@ -0,0 +1,139 @@
+package codec
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+// batchFlushBytes flushes a batch early once this much output is pending.
+const batchFlushBytes = 32 << 10
+
+// BatchWriter coalesces the per-chunk Flush calls of a streaming response
+// (--sse-flush-interval). Flush only marks output as pending; pending output
+// is flushed on a timer, once batchFlushBytes accumulate, and immediately
+// around tool-call boundaries and the end of the stream (see Observe). Stop
+// must be called once the stream is written. A nil *BatchWriter is a no-op.
+type BatchWriter struct {
+	http.ResponseWriter
+
+	mu      sync.Mutex
+	flusher http.Flusher
+	pending int
+	dirty   bool
+	urgent  bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// StartBatchWriter wraps w so its flushes are batched every interval. It
+// returns nil when interval is not positive or w cannot flush.
+func StartBatchWriter(w http.ResponseWriter, interval time.Duration) *BatchWriter {
+	flusher, ok := w.(http.Flusher)
+	if interval <= 0 || !ok {
+		return nil
+	}
+	b := &BatchWriter{
+		ResponseWriter: w,
+		flusher:        flusher,
+		stop:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	go b.loop(interval)
+	return b
+}
+
+func (b *BatchWriter) loop(interval time.Duration) {
+	defer close(b.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			if b.dirty {
+				b.flushLocked()
+			}
+			b.mu.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *BatchWriter) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, err := b.ResponseWriter.Write(p)
+	b.pending += n
+	return n, err
+}
+
+// Flush flushes at once when output is urgent or the batch is full, and
+// otherwise leaves it for the timer.
+func (b *BatchWriter) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.urgent || b.pending >= batchFlushBytes {
+		b.flushLocked()
+		return
+	}
+	b.dirty = true
+}
+
+func (b *BatchWriter) flushLocked() {
+	b.flusher.Flush()
+	b.pending = 0
+	b.dirty = false
+}
+
+// Observe marks the output written for evt as urgent when evt completes a
+// tool call or ends the response, so clients see it without the batching
+// delay. It is meant as a stream.Reader event hook.
+func (b *BatchWriter) Observe(evt *stream.Event) {
+	if b == nil {
+		return
+	}
+	urgent := false
+	switch evt.Type {
+	case "response.completed", "response.incomplete", "response.failed":
+		urgent = true
+	case "response.output_item.done":
+		item, _ := evt.Data["item"].(map[string]any)
+		switch item["type"] {
+		case "function_call", "custom_tool_call", "web_search_call":
+			urgent = true
+		}
+	}
+	b.mu.Lock()
+	b.urgent = urgent
+	b.mu.Unlock()
+}
+
+// Stop flushes any pending output and ends the batching timer.
+func (b *BatchWriter) Stop() {
+	if b == nil {
+		return
+	}
+	close(b.stop)
+	<-b.stopped
+	b.mu.Lock()
+	if b.dirty {
+		b.flushLocked()
+	}
+	b.mu.Unlock()
+}
+
+// BatchFlushes wraps w in a BatchWriter fed by reader's events when interval
+// is positive. It returns the writer to stream to and a function that must be
+// called once the stream is written.
+func BatchFlushes(w http.ResponseWriter, reader *stream.Reader, interval time.Duration) (http.ResponseWriter, func()) {
+	b := StartBatchWriter(w, interval)
+	if b == nil {
+		return w, func() {}
+	}
+	reader.OnEvent(b.Observe)
+	return b, b.Stop
+}
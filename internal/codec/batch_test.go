@@ -0,0 +1,59 @@
+package codec
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingRecorder counts the flushes that reach the client.
+type countingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *countingRecorder) Flush() { r.flushes++ }
+
+func TestBatchWriterReducesFlushes(t *testing.T) {
+	events := make([]string, 0, 52)
+	for i := range 50 {
+		events = append(events, fmt.Sprintf(`{"type":"response.output_text.delta","delta":"w%d "}`, i))
+	}
+	events = append(events,
+		`{"type":"response.output_item.done","item":{"type":"function_call","call_id":"call_1","name":"lookup","arguments":"{}"}}`,
+		`{"type":"response.completed","response":{"id":"resp_1"}}`)
+
+	plain := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	(&ChatEncoder{}).StreamTranslator(plain, "gpt-5", StreamOpts{}).Translate(sseReader(events...))
+
+	batched := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	reader := sseReader(events...)
+	out, stop := BatchFlushes(batched, reader, time.Hour)
+	(&ChatEncoder{}).StreamTranslator(out, "gpt-5", StreamOpts{}).Translate(reader)
+	stop()
+
+	if got, want := batched.Body.String(), plain.Body.String(); got != want {
+		t.Fatalf("batched output differs:\ngot  %s\nwant %s", got, want)
+	}
+	// Deltas wait for the timer; the tool call and the stream end flush at once.
+	if batched.flushes >= plain.flushes || batched.flushes == 0 {
+		t.Errorf("flushes: batched %d, per-chunk %d", batched.flushes, plain.flushes)
+	}
+
+	timed := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	bw := StartBatchWriter(timed, 10*time.Millisecond)
+	fmt.Fprint(bw, "data: {}\n\n")
+	bw.Flush()
+	time.Sleep(50 * time.Millisecond)
+	bw.Stop()
+	if timed.flushes != 1 {
+		t.Errorf("timer flushes: got %d, want 1", timed.flushes)
+	}
+
+	out, stop = BatchFlushes(plain, reader, 0)
+	stop()
+	if out != plain {
+		t.Error("a zero interval should leave the writer unwrapped")
+	}
+}
@@ -2,6 +2,7 @@ package codec
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/n0madic/go-chatmock/internal/stream"
 	"github.com/n0madic/go-chatmock/internal/types"
@@ -16,6 +17,7 @@ const (
 	FormatTextCompletions
 	FormatAnthropic
 	FormatOllama
+	FormatGemini
 )
 
 // StreamOpts carries per-request streaming configuration to encoders.
@@ -23,20 +25,49 @@ type StreamOpts struct {
 	ReasoningCompat string
 	IncludeUsage    bool
 	CreatedAt       string // Ollama: RFC3339 timestamp for NDJSON chunks
+	// InputTokensEstimate is a local prompt-size estimate reported before the
+	// upstream usage is known (Anthropic message_start).
+	InputTokensEstimate int64
+	// RepairToolArgs repairs malformed tool-call argument JSON (--repair-tool-args).
+	RepairToolArgs bool
+	// RenumberOutputIndices rewrites output_index values to be contiguous
+	// from zero in the Responses stream (--renumber-output-indices).
+	RenumberOutputIndices bool
+	// ResponsesUsage controls the usage block of the streamed
+	// response.completed (client include: ["usage"]).
+	ResponsesUsage stream.UsageMode
+	// Heartbeat is the silence after which a synthetic response.in_progress
+	// is sent on the Responses stream; zero disables it (--responses-heartbeat).
+	Heartbeat time.Duration
+	// SystemFingerprint is reported on chunks and response objects when set
+	// (--system-fingerprint).
+	SystemFingerprint string
+	// IncludeThoughts streams reasoning as Gemini thought parts
+	// (generationConfig.thinkingConfig.includeThoughts).
+	IncludeThoughts bool
 }
 
 // CollectedResponse holds a fully-assembled non-streaming upstream response.
 type CollectedResponse struct {
 	ResponseID       string
 	FullText         string
+	Refusal          string // refusal content part text, surfaced as message.refusal
 	ReasoningSummary string
 	ReasoningFull    string
 	ToolCalls        []types.ToolCall
+	Annotations      []map[string]any // output_text annotations (citations), Responses shape
 	OutputItems      []types.ResponsesOutputItem
 	Usage            *types.Usage
 	ErrorMessage     string
+	// IncompleteReason is set when upstream stopped early (response.incomplete),
+	// e.g. stream.IncompleteContentFilter.
+	IncompleteReason string
+	// TextLogprobs is set for legacy completions that requested logprobs.
+	TextLogprobs *types.TextLogprobs
 	// RawResponse is the full upstream response object for passthrough formats.
 	RawResponse map[string]any
+	// SystemFingerprint is reported on the response when set (--system-fingerprint).
+	SystemFingerprint string
 }
 
 // Translator is the streaming translation interface. Implementations read
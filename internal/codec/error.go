@@ -7,9 +7,13 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/n0madic/go-chatmock/internal/stream"
 	"github.com/n0madic/go-chatmock/internal/types"
 )
 
+// LoginHint tells the user how to recover from an upstream auth failure.
+const LoginHint = "run: go-chatmock login"
+
 // WriteJSON writes a JSON response.
 func WriteJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
@@ -46,6 +50,58 @@ func WriteOllamaError(w http.ResponseWriter, status int, message string) {
 	WriteJSON(w, status, map[string]string{"error": message})
 }
 
+// WriteGeminiError writes a Google API error envelope.
+func WriteGeminiError(w http.ResponseWriter, status int, message string) {
+	slog.Error("request failed", "status", status, "error", message)
+	WriteJSON(w, status, types.GeminiErrorResponse{Error: types.GeminiErrorBody{
+		Code:    status,
+		Message: message,
+		Status:  geminiErrorStatus(status),
+	}})
+}
+
+// geminiErrorStatus is the canonical Google status name for an HTTP status.
+func geminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	}
+	return "INTERNAL"
+}
+
+// WithLoginHint appends LoginHint to an auth-failure message.
+func WithLoginHint(message string) string {
+	if strings.Contains(message, LoginHint) {
+		return message
+	}
+	return message + " (" + LoginHint + ")"
+}
+
+// WriteStreamError reports a failure that happened before any upstream events
+// arrived as the protocol's own streamed error event, by feeding a synthesized
+// response.failed through enc's stream translator.
+func WriteStreamError(w http.ResponseWriter, enc Encoder, statusCode int, message string) {
+	slog.Error("request failed", "status", statusCode, "error", message)
+	evt, _ := json.Marshal(map[string]any{
+		"type":     "response.failed",
+		"response": map[string]any{"error": map[string]any{"message": message}},
+	})
+	enc.WriteStreamHeaders(w, statusCode)
+	enc.StreamTranslator(w, "", StreamOpts{}).Translate(stream.NewReader(strings.NewReader("data: " + string(evt) + "\n\n")))
+}
+
 // FormatUpstreamError formats an error from the upstream response.
 func FormatUpstreamError(statusCode int, rawBody []byte) string {
 	status := fmt.Sprintf("%d", statusCode)
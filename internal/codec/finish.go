@@ -0,0 +1,108 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+// DeprecationHeader is the --legacy-model-target response header; its value
+// explains which legacy model was remapped to which.
+const DeprecationHeader = "X-Chatmock-Deprecation"
+
+// SetDeprecationHeader sets DeprecationHeader on w when notice is non-empty.
+// It must be called before the response body is written.
+func SetDeprecationHeader(w http.ResponseWriter, notice string) {
+	if notice != "" {
+		w.Header().Set(DeprecationHeader, notice)
+	}
+}
+
+// TruncatedHeader is the --truncation-notice response header; its value is
+// the reason the output was cut short.
+const TruncatedHeader = "X-Chatmock-Truncated"
+
+// chatFinishReason maps an upstream incomplete reason to a chat/text
+// finish_reason, falling back to def for a normal completion.
+func chatFinishReason(incomplete, def string) string {
+	switch incomplete {
+	case stream.IncompleteContentFilter:
+		return "content_filter"
+	case stream.IncompleteMaxOutputTokens, stream.IncompleteIdleTimeout:
+		return "length"
+	}
+	return def
+}
+
+// anthropicStopReason maps an upstream incomplete reason to an Anthropic
+// stop_reason, falling back to def for a normal completion.
+func anthropicStopReason(incomplete, def string) string {
+	switch incomplete {
+	case stream.IncompleteContentFilter:
+		return "refusal"
+	case stream.IncompleteMaxOutputTokens, stream.IncompleteIdleTimeout:
+		return "max_tokens"
+	}
+	return def
+}
+
+// geminiFinishReason maps an upstream incomplete reason to a Gemini
+// candidate finishReason; a normal completion is "STOP".
+func geminiFinishReason(incomplete string) string {
+	switch incomplete {
+	case stream.IncompleteContentFilter:
+		return "SAFETY"
+	case stream.IncompleteMaxOutputTokens, stream.IncompleteIdleTimeout:
+		return "MAX_TOKENS"
+	}
+	return "STOP"
+}
+
+// TruncationReason maps an upstream incomplete reason to the value reported in
+// TruncatedHeader, or "" when the response completed normally.
+func TruncationReason(incomplete string) string {
+	if incomplete == stream.IncompleteMaxOutputTokens {
+		return "max_tokens"
+	}
+	return incomplete
+}
+
+// SetTruncatedHeader sets TruncatedHeader on w when the response was cut
+// short. It must be called before the response body is written.
+func SetTruncatedHeader(w http.ResponseWriter, incomplete string) {
+	if reason := TruncationReason(incomplete); reason != "" {
+		w.Header().Set(TruncatedHeader, reason)
+	}
+}
+
+// StreamEndReason returns the incomplete reason for a stream whose reader
+// failed with err before the terminal event: stream.IncompleteIdleTimeout
+// when upstream went silent (--upstream-idle-timeout),
+// stream.IncompleteMaxOutputTokens when --server-max-output-tokens cut it
+// short, otherwise "".
+func StreamEndReason(err error) string {
+	switch {
+	case errors.Is(err, stream.ErrIdleTimeout):
+		return stream.IncompleteIdleTimeout
+	case errors.Is(err, stream.ErrOutputTokenLimit):
+		return stream.IncompleteMaxOutputTokens
+	}
+	return ""
+}
+
+// IncompleteEvent returns the data of a synthesized response.incomplete event
+// that closes a Responses stream cut short for reason.
+func IncompleteEvent(responseID, reason string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type": "response.incomplete",
+		"response": map[string]any{
+			"id":                 responseID,
+			"object":             "response",
+			"status":             "incomplete",
+			"incomplete_details": map[string]any{"reason": reason},
+		},
+	})
+	return data
+}
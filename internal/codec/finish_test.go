@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+const contentFilterIncomplete = `{"type":"response.incomplete","response":{"id":"resp_cf","status":"incomplete","incomplete_details":{"reason":"content_filter"}}}`
+
+func TestContentFilterStopMappedAcrossRoutes(t *testing.T) {
+	text := `{"type":"response.output_text.delta","delta":"I can"}`
+
+	rec := httptest.NewRecorder()
+	(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{}).Translate(sseReader(text, contentFilterIncomplete))
+	if body := rec.Body.String(); !strings.Contains(body, `"finish_reason":"content_filter"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("chat stream: expected content_filter finish_reason:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	(&AnthropicEncoder{}).StreamTranslator(rec, "claude", StreamOpts{}).Translate(sseReader(text, contentFilterIncomplete))
+	var stopReason any
+	for _, evt := range anthropicEvents(t, rec.Body.String()) {
+		if evt["type"] == "message_delta" {
+			stopReason = evt["delta"].(map[string]any)["stop_reason"]
+		}
+	}
+	if stopReason != "refusal" {
+		t.Errorf("anthropic stream: stop_reason got %v, want refusal", stopReason)
+	}
+
+	rec = httptest.NewRecorder()
+	(&ResponsesEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{}).Translate(sseReader(text, contentFilterIncomplete, `{"type":"response.output_text.delta","delta":"late"}`))
+	body := rec.Body.String()
+	if !strings.Contains(body, `"reason":"content_filter"`) || strings.Contains(body, "late") || strings.Count(body, "[DONE]") != 1 {
+		t.Errorf("responses stream: expected incomplete event to end the stream:\n%s", body)
+	}
+
+	// Collected responses.
+	collected := &CollectedResponse{ResponseID: "resp_cf", FullText: "I can", IncompleteReason: "content_filter", RawResponse: map[string]any{"_reasoning_compat": "think-tags"}}
+	rec = httptest.NewRecorder()
+	(&ChatEncoder{}).WriteCollected(rec, 200, collected, "gpt-5")
+	if !strings.Contains(rec.Body.String(), `"finish_reason":"content_filter"`) {
+		t.Errorf("chat collected: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	(&AnthropicEncoder{}).WriteCollected(rec, 200, collected, "claude")
+	if !strings.Contains(rec.Body.String(), `"stop_reason":"refusal"`) {
+		t.Errorf("anthropic collected: %s", rec.Body.String())
+	}
+
+	collected.RawResponse = nil
+	rec = httptest.NewRecorder()
+	(&ResponsesEncoder{}).WriteCollected(rec, 200, collected, "gpt-5")
+	var resp map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &resp) //nolint:errcheck
+	details, _ := resp["incomplete_details"].(map[string]any)
+	if resp["status"] != "incomplete" || details["reason"] != "content_filter" {
+		t.Errorf("responses collected: %s", rec.Body.String())
+	}
+}
+
+func TestOllamaIdleTimeoutDoneReasonLength(t *testing.T) {
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("data: {\"type\":\"response.output_text.delta\",\"delta\":\"Partial\"}\n\n")) //nolint:errcheck
+	rec := httptest.NewRecorder()
+	(&OllamaEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{}).Translate(stream.NewReader(stream.NewIdleTimeoutBody(pr, 50*time.Millisecond)))
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	var last map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatalf("last line: %v (%s)", err, rec.Body.String())
+	}
+	if last["done"] != true || last["done_reason"] != "length" {
+		t.Errorf("want a done chunk with done_reason length, got %v", last)
+	}
+}
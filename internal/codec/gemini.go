@@ -0,0 +1,211 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// GeminiEncoder encodes responses in the Gemini generateContent format.
+// Streams use the alt=sse shape: one "data: {...}" response chunk per event.
+type GeminiEncoder struct{}
+
+func (e *GeminiEncoder) WriteStreamHeaders(w http.ResponseWriter, statusCode int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(statusCode)
+}
+
+func (e *GeminiEncoder) StreamTranslator(w http.ResponseWriter, model string, opts StreamOpts) Translator {
+	return &geminiStreamTranslator{w: w, model: model, opts: opts}
+}
+
+func (e *GeminiEncoder) WriteCollected(w http.ResponseWriter, statusCode int, resp *CollectedResponse, model string) {
+	if resp.ErrorMessage != "" {
+		WriteGeminiError(w, http.StatusBadGateway, resp.ErrorMessage)
+		return
+	}
+	var parts []types.GeminiPart
+	if thought := joinNonEmpty(resp.ReasoningSummary, resp.ReasoningFull); thought != "" {
+		parts = append(parts, types.GeminiPart{Text: thought, Thought: true})
+	}
+	if resp.FullText != "" {
+		parts = append(parts, types.GeminiPart{Text: resp.FullText})
+	}
+	for _, tc := range resp.ToolCalls {
+		parts = append(parts, geminiFunctionCallPart(tc.ID, tc.Function.Name, tc.Function.Arguments))
+	}
+	WriteJSON(w, statusCode, geminiResponse(resp.ResponseID, model, parts, geminiFinishReason(resp.IncompleteReason), geminiUsage(resp.Usage)))
+}
+
+func (e *GeminiEncoder) WriteError(w http.ResponseWriter, statusCode int, message string) {
+	WriteGeminiError(w, statusCode, message)
+}
+
+// geminiStreamTranslator translates upstream SSE into Gemini response chunks.
+type geminiStreamTranslator struct {
+	w     http.ResponseWriter
+	model string
+	opts  StreamOpts
+
+	responseID  string
+	tb          *stream.ToolBuffer
+	flusher     http.Flusher
+	writeFailed bool
+}
+
+func (t *geminiStreamTranslator) Translate(reader *stream.Reader) {
+	flusher, ok := t.w.(http.Flusher)
+	if !ok {
+		return
+	}
+	t.flusher = flusher
+	t.tb = stream.NewToolBuffer()
+
+	gotEvents := false
+	var readErr error
+	for !t.writeFailed {
+		evt, err := reader.Next()
+		if err != nil {
+			readErr = err
+			break
+		}
+		gotEvents = true
+		if id := stream.ResponseIDFromEvent(evt.Data); id != "" {
+			t.responseID = id
+		}
+
+		switch evt.Type {
+		case "response.output_item.added":
+			item, _ := evt.Data["item"].(map[string]any)
+			if itemType, _ := item["type"].(string); itemType == "function_call" {
+				t.tb.OnOutputItemAdded(item)
+			}
+		case "response.function_call_arguments.delta":
+			t.tb.OnArgumentsDelta(evt.Data)
+		case "response.function_call_arguments.done":
+			t.tb.OnArgumentsDone(evt.Data)
+		case "response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+			if delta, _ := evt.Data["delta"].(string); delta != "" && t.opts.IncludeThoughts {
+				t.writeParts([]types.GeminiPart{{Text: delta, Thought: true}}, "", nil)
+			}
+		case "response.output_text.delta":
+			if delta, _ := evt.Data["delta"].(string); delta != "" {
+				t.writeParts([]types.GeminiPart{{Text: delta}}, "", nil)
+			}
+		case "response.output_item.done":
+			item, _ := evt.Data["item"].(map[string]any)
+			if stream.IsEmptyToolArgs(item["arguments"]) {
+				if args, ok := t.tb.ResolveArgs(item); ok {
+					item["arguments"] = stream.SerializeToolArgs(args, false, t.opts.RepairToolArgs)
+				}
+			}
+			if tc, ok := stream.FunctionToolCallFromOutputItem(item); ok {
+				t.writeParts([]types.GeminiPart{geminiFunctionCallPart(tc.ID, tc.Function.Name, tc.Function.Arguments)}, "", nil)
+			}
+		case "response.failed":
+			msg := stream.ResponseErrorMessageFromEvent(evt.Data)
+			if msg == "" {
+				msg = "response.failed"
+			}
+			t.write(types.GeminiErrorResponse{Error: types.GeminiErrorBody{
+				Code: http.StatusBadGateway, Message: msg, Status: geminiErrorStatus(http.StatusBadGateway),
+			}})
+			return
+		case "response.completed", "response.incomplete":
+			finish := geminiFinishReason(stream.IncompleteReasonFromEvent(evt.Data))
+			t.writeParts(nil, finish, geminiUsage(stream.ExtractUsageFromEvent(evt.Data)))
+			return
+		}
+	}
+
+	if !gotEvents {
+		t.write(types.GeminiErrorResponse{Error: types.GeminiErrorBody{
+			Code: http.StatusBadGateway, Message: "upstream returned empty response", Status: geminiErrorStatus(http.StatusBadGateway),
+		}})
+		return
+	}
+	t.writeParts(nil, geminiFinishReason(StreamEndReason(readErr)), nil)
+}
+
+func (t *geminiStreamTranslator) writeParts(parts []types.GeminiPart, finish string, usage *types.GeminiUsageMetadata) {
+	t.write(geminiResponse(t.responseID, t.model, parts, finish, usage))
+}
+
+func (t *geminiStreamTranslator) write(v any) {
+	if t.writeFailed {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal SSE chunk", "error", err)
+		return
+	}
+	if _, err := fmt.Fprintf(t.w, "data: %s\n\n", data); err != nil {
+		slog.Debug("client disconnected during SSE write", "error", err)
+		t.writeFailed = true
+		return
+	}
+	t.flusher.Flush()
+}
+
+func geminiResponse(responseID, model string, parts []types.GeminiPart, finish string, usage *types.GeminiUsageMetadata) types.GeminiGenerateContentResponse {
+	if parts == nil {
+		parts = []types.GeminiPart{}
+	}
+	return types.GeminiGenerateContentResponse{
+		Candidates: []types.GeminiCandidate{{
+			Content:      types.GeminiContent{Role: "model", Parts: parts},
+			FinishReason: finish,
+		}},
+		UsageMetadata: usage,
+		ModelVersion:  model,
+		ResponseID:    responseID,
+	}
+}
+
+// geminiFunctionCallPart builds a functionCall part; Gemini carries arguments
+// as an object rather than a JSON string.
+func geminiFunctionCallPart(callID, name, arguments string) types.GeminiPart {
+	args := map[string]any{}
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			slog.Warn("gemini.function_call.invalid_arguments", "name", name, "error", err)
+		}
+	}
+	return types.GeminiPart{FunctionCall: &types.GeminiFunctionCall{ID: callID, Name: name, Args: args}}
+}
+
+// geminiUsage converts upstream usage to usageMetadata. Gemini counts
+// thoughts separately from candidates, so reasoning tokens are split out.
+func geminiUsage(u *types.Usage) *types.GeminiUsageMetadata {
+	if u == nil {
+		return nil
+	}
+	var thoughts int64
+	if u.CompletionTokensDetails != nil {
+		thoughts = u.CompletionTokensDetails.ReasoningTokens
+	}
+	return &types.GeminiUsageMetadata{
+		PromptTokenCount:     u.PromptTokens,
+		CandidatesTokenCount: u.CompletionTokens - thoughts,
+		TotalTokenCount:      u.TotalTokens,
+		ThoughtsTokenCount:   thoughts,
+	}
+}
+
+func joinNonEmpty(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, "\n\n")
+}
@@ -0,0 +1,57 @@
+package codec
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestGeminiStreamTranslatesTextAndFunctionCalls(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&GeminiEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{IncludeThoughts: true}).Translate(sseReader(
+		`{"type":"response.reasoning_summary_text.delta","delta":"hmm"}`,
+		`{"type":"response.output_text.delta","delta":"Checking."}`,
+		`{"type":"response.output_item.added","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup"}}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{\"q\":\"x\"}"}`,
+		`{"type":"response.output_item.done","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup","arguments":""}}`,
+		`{"type":"response.completed","response":{"id":"resp_1","usage":{"input_tokens":10,"output_tokens":6,"total_tokens":16,"output_tokens_details":{"reasoning_tokens":2}}}}`,
+	))
+
+	var chunks []types.GeminiGenerateContentResponse
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var chunk types.GeminiGenerateContentResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("unmarshal chunk %s: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) != 4 {
+		t.Fatalf("expected 4 chunks, got %d:\n%s", len(chunks), rec.Body.String())
+	}
+	if p := chunks[0].Candidates[0].Content.Parts[0]; !p.Thought || p.Text != "hmm" {
+		t.Errorf("first chunk should be a thought part: %+v", p)
+	}
+	if p := chunks[1].Candidates[0].Content.Parts[0]; p.Thought || p.Text != "Checking." {
+		t.Errorf("second chunk should be answer text: %+v", p)
+	}
+	fc := chunks[2].Candidates[0].Content.Parts[0].FunctionCall
+	if fc == nil || fc.ID != "call_1" || fc.Name != "lookup" || !reflect.DeepEqual(fc.Args, map[string]any{"q": "x"}) {
+		t.Errorf("third chunk should carry the buffered function call: %+v", fc)
+	}
+	last := chunks[3]
+	if last.Candidates[0].FinishReason != "STOP" || last.ResponseID != "resp_1" {
+		t.Errorf("last chunk should finish with STOP: %+v", last)
+	}
+	want := &types.GeminiUsageMetadata{PromptTokenCount: 10, CandidatesTokenCount: 4, TotalTokenCount: 16, ThoughtsTokenCount: 2}
+	if !reflect.DeepEqual(last.UsageMetadata, want) {
+		t.Errorf("usageMetadata: got %+v, want %+v", last.UsageMetadata, want)
+	}
+}
@@ -0,0 +1,122 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+// Heartbeat writes a synthetic response.in_progress event whenever a
+// Responses stream has been silent for its interval (--responses-heartbeat).
+// It needs the response object from response.created or response.in_progress
+// and stops for good once any other event arrives. Writers of the same stream
+// must hold Lock while writing. A nil *Heartbeat is a no-op.
+type Heartbeat struct {
+	mu       sync.Mutex
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+	last     time.Time
+	response map[string]any
+	done     bool
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// StartHeartbeat starts a heartbeat on w. It returns nil when interval is not
+// positive.
+func StartHeartbeat(w io.Writer, flusher http.Flusher, interval time.Duration) *Heartbeat {
+	if interval <= 0 {
+		return nil
+	}
+	h := &Heartbeat{
+		w:        w,
+		flusher:  flusher,
+		interval: interval,
+		last:     time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go h.loop()
+	return h
+}
+
+func (h *Heartbeat) loop() {
+	defer close(h.stopped)
+	ticker := time.NewTicker(max(h.interval/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.mu.Lock()
+			if !h.done && h.response != nil && time.Since(h.last) >= h.interval {
+				h.writeLocked()
+				h.last = time.Now()
+			}
+			h.mu.Unlock()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+func (h *Heartbeat) writeLocked() {
+	data, err := json.Marshal(map[string]any{
+		"type":     "response.in_progress",
+		"response": h.response,
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(h.w, "event: response.in_progress\ndata: %s\n\n", data)
+	h.flusher.Flush()
+}
+
+// Lock serializes a stream write with heartbeat writes.
+func (h *Heartbeat) Lock() {
+	if h != nil {
+		h.mu.Lock()
+	}
+}
+
+// Unlock releases Lock.
+func (h *Heartbeat) Unlock() {
+	if h != nil {
+		h.mu.Unlock()
+	}
+}
+
+// Observe records an upstream event; call it with the lock held.
+func (h *Heartbeat) Observe(evt *stream.Event) {
+	if h == nil || h.done {
+		return
+	}
+	h.last = time.Now()
+	switch evt.Type {
+	case "response.created", "response.in_progress":
+		if resp, ok := evt.Data["response"].(map[string]any); ok {
+			snapshot := make(map[string]any, len(resp))
+			for k, v := range resp {
+				snapshot[k] = v
+			}
+			snapshot["status"] = "in_progress"
+			h.response = snapshot
+		}
+	default:
+		h.done = true
+	}
+}
+
+// Stop ends the heartbeat and waits for its goroutine to exit.
+func (h *Heartbeat) Stop() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.stopped
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/n0madic/go-chatmock/internal/reasoning"
 	"github.com/n0madic/go-chatmock/internal/stream"
 	"github.com/n0madic/go-chatmock/internal/types"
 )
@@ -35,7 +36,7 @@ func (e *OllamaEncoder) WriteCollected(w http.ResponseWriter, statusCode int, re
 			compat = c
 		}
 	}
-	if compat == "" || compat == "think-tags" {
+	if openMark, closeMark, ok := reasoning.ContentMarkers(compat); ok {
 		var parts []string
 		if resp.ReasoningSummary != "" {
 			parts = append(parts, resp.ReasoningSummary)
@@ -51,7 +52,7 @@ func (e *OllamaEncoder) WriteCollected(w http.ResponseWriter, statusCode int, re
 				}
 				rtxt.WriteString(p)
 			}
-			fullText = "<think>" + rtxt.String() + "</think>" + fullText
+			fullText = openMark + rtxt.String() + closeMark + fullText
 		}
 	}
 
@@ -67,12 +68,21 @@ func (e *OllamaEncoder) WriteCollected(w http.ResponseWriter, statusCode int, re
 		CreatedAt:      createdAt,
 		Message:        types.OllamaMessage{Role: "assistant", Content: fullText, ToolCalls: resp.ToolCalls},
 		Done:           true,
-		DoneReason:     "stop",
+		DoneReason:     ollamaDoneReason(resp.IncompleteReason),
 		OllamaFakeEval: types.OllamaFakeEvalDefaults,
 	}
 	WriteJSON(w, statusCode, chunk)
 }
 
+// ollamaDoneReason maps an incomplete reason to Ollama's done_reason: any
+// truncation (max output tokens, an idle upstream) reports "length".
+func ollamaDoneReason(incomplete string) string {
+	if incomplete != "" {
+		return "length"
+	}
+	return "stop"
+}
+
 func (e *OllamaEncoder) WriteError(w http.ResponseWriter, statusCode int, message string) {
 	WriteOllamaError(w, statusCode, message)
 }
@@ -94,6 +104,7 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 	if compat == "" {
 		compat = "think-tags"
 	}
+	openMark, closeMark, _ := reasoning.ContentMarkers(compat)
 
 	thinkOpen := false
 	thinkClosed := false
@@ -101,6 +112,7 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 	pendingSummaryParagraph := false
 
 	createdAt := t.opts.CreatedAt
+	var incomplete string
 
 	writeMsg := func(content string, done bool) {
 		chunk := types.OllamaStreamChunk{
@@ -110,6 +122,7 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 			Done:      done,
 		}
 		if done {
+			chunk.DoneReason = ollamaDoneReason(incomplete)
 			chunk.OllamaFakeEval = types.OllamaFakeEvalDefaults
 		}
 		data, _ := json.Marshal(chunk)
@@ -121,13 +134,14 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 	for {
 		evt, err := reader.Next()
 		if err != nil {
+			incomplete = StreamEndReason(err)
 			break
 		}
 		gotEvents = true
 
 		switch evt.Type {
 		case "response.reasoning_summary_part.added":
-			if compat == "think-tags" || compat == "o3" {
+			if compat == "think-tags" || compat == "inline" || compat == "o3" {
 				if sawAnySummary {
 					pendingSummaryParagraph = true
 				} else {
@@ -146,9 +160,12 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 				if deltaTxt != "" {
 					writeMsg(deltaTxt, false)
 				}
-			case "think-tags":
+			case "think-tags", "inline":
+				if deltaTxt == "" {
+					break
+				}
 				if !thinkOpen && !thinkClosed {
-					writeMsg("<think>", false)
+					writeMsg(openMark, false)
 					thinkOpen = true
 				}
 				if thinkOpen && !thinkClosed {
@@ -164,8 +181,8 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 
 		case "response.output_text.delta":
 			delta, _ := evt.Data["delta"].(string)
-			if compat == "think-tags" && thinkOpen && !thinkClosed {
-				writeMsg("</think>", false)
+			if thinkOpen && !thinkClosed {
+				writeMsg(closeMark, false)
 				thinkOpen = false
 				thinkClosed = true
 			}
@@ -173,9 +190,12 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 				writeMsg(delta, false)
 			}
 
-		case "response.completed":
-			if compat == "think-tags" && thinkOpen && !thinkClosed {
-				writeMsg("</think>", false)
+		case "response.completed", "response.incomplete":
+			if evt.Type == "response.incomplete" {
+				incomplete = stream.IncompleteReasonFromEvent(evt.Data)
+			}
+			if thinkOpen && !thinkClosed {
+				writeMsg(closeMark, false)
 			}
 			writeMsg("", true)
 			return
@@ -195,8 +215,8 @@ func (t *ollamaStreamTranslator) Translate(reader *stream.Reader) {
 		flusher.Flush()
 		return
 	}
-	if compat == "think-tags" && thinkOpen && !thinkClosed {
-		writeMsg("</think>", false)
+	if thinkOpen && !thinkClosed {
+		writeMsg(closeMark, false)
 	}
 	writeMsg("", true)
 }
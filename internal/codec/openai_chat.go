@@ -32,10 +32,14 @@ func (e *ChatEncoder) WriteCollected(w http.ResponseWriter, statusCode int, resp
 		WriteOpenAIError(w, http.StatusBadGateway, resp.ErrorMessage)
 		return
 	}
-	message := types.ChatResponseMsg{Role: "assistant", Content: resp.FullText}
+	message := types.ChatResponseMsg{Role: "assistant", Refusal: resp.Refusal}
+	if resp.FullText != "" || resp.Refusal == "" {
+		message.Content = types.StringPtr(resp.FullText)
+	}
 	if len(resp.ToolCalls) > 0 {
 		message.ToolCalls = resp.ToolCalls
 	}
+	message.Annotations = chatAnnotations(resp.Annotations)
 	reasoning.ApplyReasoningToMessage(&message, resp.ReasoningSummary, resp.ReasoningFull, resp.RawResponse["_reasoning_compat"].(string))
 	completion := types.ChatCompletionResponse{
 		ID:      resp.ResponseID,
@@ -43,13 +47,24 @@ func (e *ChatEncoder) WriteCollected(w http.ResponseWriter, statusCode int, resp
 		Created: 0, // caller fills in
 		Model:   model,
 		Choices: []types.ChatChoice{
-			{Index: 0, Message: message, FinishReason: types.StringPtr("stop")},
+			{Index: 0, Message: message, FinishReason: types.StringPtr(chatCollectedFinishReason(resp))},
 		},
-		Usage: resp.Usage,
+		Usage:             resp.Usage,
+		SystemFingerprint: resp.SystemFingerprint,
 	}
 	WriteJSON(w, statusCode, completion)
 }
 
+// chatCollectedFinishReason applies the streaming rule to a collected
+// response: "tool_calls" when it carries function calls, otherwise the mapped
+// incomplete reason or "stop".
+func chatCollectedFinishReason(resp *CollectedResponse) string {
+	if len(resp.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return chatFinishReason(resp.IncompleteReason, "stop")
+}
+
 func (e *ChatEncoder) WriteError(w http.ResponseWriter, statusCode int, message string) {
 	WriteOpenAIError(w, statusCode, message)
 }
@@ -63,15 +78,21 @@ type chatStreamTranslator struct {
 	responseID              string
 	thinkOpen               bool
 	thinkClosed             bool
+	thinkOpenMark           string // opens reasoning in content (think-tags, inline)
+	thinkCloseMark          string
 	sentStopChunk           bool
+	sawToolCall             bool // a function call was emitted this turn
+	sentRole                bool
 	sawAnySummary           bool
 	pendingSummaryParagraph bool
 	upstreamUsage           *types.Usage
 
-	wsState     map[string]map[string]any
-	wsIndex     map[string]int
-	wsNextIndex int
-	hiddenText  map[string]bool
+	sawRefusal  bool
+	annotations stream.Annotations
+
+	wsState    map[string]map[string]any
+	toolIndex  map[string]int // tool_calls index per call id, shared by all tool types
+	hiddenText map[string]bool
 
 	tb          *stream.ToolBuffer
 	writeChunk  func(any)
@@ -90,9 +111,10 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 	if t.compat == "" {
 		t.compat = "think-tags"
 	}
+	t.thinkOpenMark, t.thinkCloseMark, _ = reasoning.ContentMarkers(t.compat)
 	t.responseID = "chatcmpl-stream"
 	t.wsState = map[string]map[string]any{}
-	t.wsIndex = map[string]int{}
+	t.toolIndex = map[string]int{}
 	t.hiddenText = map[string]bool{}
 	t.tb = stream.NewToolBuffer()
 
@@ -100,6 +122,17 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 		if t.writeFailed {
 			return
 		}
+		if c, ok := chunk.(types.ChatCompletionChunk); ok {
+			if t.opts.SystemFingerprint != "" {
+				c.SystemFingerprint = t.opts.SystemFingerprint
+			}
+			// Like OpenAI, only the first chunk announces the assistant role.
+			if !t.sentRole && len(c.Choices) > 0 {
+				c.Choices[0].Delta.Role = "assistant"
+				t.sentRole = true
+			}
+			chunk = c
+		}
 		data, err := json.Marshal(chunk)
 		if err != nil {
 			slog.Error("failed to marshal SSE chunk", "error", err)
@@ -126,12 +159,14 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 	}
 
 	gotEvents := false
+	var readErr error
 	for {
 		if t.writeFailed {
 			break
 		}
 		evt, err := reader.Next()
 		if err != nil {
+			readErr = err
 			break
 		}
 		gotEvents = true
@@ -145,7 +180,10 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 		}
 
 		if strings.Contains(kind, "web_search_call") {
-			t.handleWebSearchEvent(kind, evt.Data)
+			t.handleWebSearchEvent(evt.Data)
+		}
+		if added := t.annotations.Observe(evt); len(added) > 0 {
+			t.writeChunk(t.makeDelta(types.ChatDelta{Annotations: chatAnnotations(added)}))
 		}
 
 		switch kind {
@@ -161,16 +199,29 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 				continue
 			}
 			delta, _ := evt.Data["delta"].(string)
-			if t.compat == "think-tags" && t.thinkOpen && !t.thinkClosed {
-				t.writeChunk(t.makeDelta(types.ChatDelta{Content: "</think>"}))
+			if t.thinkOpen && !t.thinkClosed {
+				t.writeChunk(t.makeDelta(types.ChatDelta{Content: t.thinkCloseMark}))
 				t.thinkOpen = false
 				t.thinkClosed = true
 			}
 			t.writeChunk(t.makeDelta(types.ChatDelta{Content: delta}))
+		case "response.refusal.delta":
+			delta, _ := evt.Data["delta"].(string)
+			if delta != "" {
+				t.sawRefusal = true
+				t.writeChunk(t.makeDelta(types.ChatDelta{Refusal: delta}))
+			}
 		case "response.output_item.done":
+			if !t.sawRefusal {
+				item, _ := evt.Data["item"].(map[string]any)
+				if refusal := stream.RefusalFromOutputItem(item); refusal != "" {
+					t.sawRefusal = true
+					t.writeChunk(t.makeDelta(types.ChatDelta{Refusal: refusal}))
+				}
+			}
 			t.handleOutputItemDone(evt.Data)
 		case "response.reasoning_summary_part.added":
-			if t.compat == "think-tags" || t.compat == "o3" {
+			if t.compat == "think-tags" || t.compat == "inline" || t.compat == "o3" {
 				if t.sawAnySummary {
 					t.pendingSummaryParagraph = true
 				} else {
@@ -193,20 +244,14 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 				}
 			}
 			t.writeChunk(types.ErrorResponse{Error: types.ErrorDetail{Message: errMsg}})
-		case "response.completed":
+		case "response.completed", "response.incomplete":
 			t.upstreamUsage = stream.ExtractUsageFromEvent(evt.Data)
-			if t.compat == "think-tags" && t.thinkOpen && !t.thinkClosed {
-				t.writeChunk(t.makeDelta(types.ChatDelta{Content: "</think>"}))
+			if t.thinkOpen && !t.thinkClosed {
+				t.writeChunk(t.makeDelta(types.ChatDelta{Content: t.thinkCloseMark}))
 				t.thinkOpen = false
 				t.thinkClosed = true
 			}
-			if !t.sentStopChunk {
-				t.writeChunk(types.ChatCompletionChunk{
-					ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
-					Choices: []types.ChatChunkChoice{{Index: 0, Delta: types.ChatDelta{}, FinishReason: types.StringPtr("stop")}},
-				})
-				t.sentStopChunk = true
-			}
+			t.writeStopChunk(stream.IncompleteReasonFromEvent(evt.Data))
 			if t.opts.IncludeUsage && t.upstreamUsage != nil {
 				t.writeChunk(types.ChatCompletionChunk{
 					ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
@@ -224,18 +269,32 @@ func (t *chatStreamTranslator) Translate(reader *stream.Reader) {
 		t.writeDone()
 		return
 	}
-	if t.compat == "think-tags" && t.thinkOpen && !t.thinkClosed {
-		t.writeChunk(t.makeDelta(types.ChatDelta{Content: "</think>"}))
-	}
-	if !t.sentStopChunk {
-		t.writeChunk(types.ChatCompletionChunk{
-			ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
-			Choices: []types.ChatChunkChoice{{Index: 0, Delta: types.ChatDelta{}, FinishReason: types.StringPtr("stop")}},
-		})
+	if t.thinkOpen && !t.thinkClosed {
+		t.writeChunk(t.makeDelta(types.ChatDelta{Content: t.thinkCloseMark}))
 	}
+	t.writeStopChunk(StreamEndReason(readErr))
 	t.writeDone()
 }
 
+// writeStopChunk sends the turn's single finish_reason chunk. As with OpenAI,
+// "tool_calls" wins whenever a function call was emitted, even if text or an
+// incomplete reason followed; otherwise the incomplete reason maps as usual
+// and a normal completion is "stop".
+func (t *chatStreamTranslator) writeStopChunk(incomplete string) {
+	if t.sentStopChunk {
+		return
+	}
+	finish := chatFinishReason(incomplete, "stop")
+	if t.sawToolCall {
+		finish = "tool_calls"
+	}
+	t.writeChunk(types.ChatCompletionChunk{
+		ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
+		Choices: []types.ChatChunkChoice{{Index: 0, Delta: types.ChatDelta{}, FinishReason: types.StringPtr(finish)}},
+	})
+	t.sentStopChunk = true
+}
+
 func (t *chatStreamTranslator) makeDelta(delta types.ChatDelta) types.ChatCompletionChunk {
 	return types.ChatCompletionChunk{
 		ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
@@ -243,8 +302,13 @@ func (t *chatStreamTranslator) makeDelta(delta types.ChatDelta) types.ChatComple
 	}
 }
 
-func (t *chatStreamTranslator) handleWebSearchEvent(kind string, data map[string]any) {
+func (t *chatStreamTranslator) handleWebSearchEvent(data map[string]any) {
 	callID, _ := data["item_id"].(string)
+	if callID == "" {
+		if item, ok := data["item"].(map[string]any); ok {
+			callID, _ = item["id"].(string)
+		}
+	}
 	if callID == "" {
 		callID = "ws_call"
 	}
@@ -255,12 +319,8 @@ func (t *chatStreamTranslator) handleWebSearchEvent(kind string, data map[string
 	if item, ok := data["item"].(map[string]any); ok {
 		mergeWebSearchParams(t.wsState[callID], item)
 	}
-	argsStr := stream.SerializeToolArgs(t.wsState[callID], true)
-	if _, ok := t.wsIndex[callID]; !ok {
-		t.wsIndex[callID] = t.wsNextIndex
-		t.wsNextIndex++
-	}
-	idx := t.wsIndex[callID]
+	argsStr := stream.SerializeToolArgs(t.wsState[callID], true, t.opts.RepairToolArgs)
+	idx := t.toolCallIndex(callID)
 	t.writeChunk(types.ChatCompletionChunk{
 		ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
 		Choices: []types.ChatChunkChoice{{
@@ -272,12 +332,18 @@ func (t *chatStreamTranslator) handleWebSearchEvent(kind string, data map[string
 			FinishReason: nil,
 		}},
 	})
-	if strings.HasSuffix(kind, ".completed") || strings.HasSuffix(kind, ".done") {
-		t.writeChunk(types.ChatCompletionChunk{
-			ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
-			Choices: []types.ChatChunkChoice{{Index: 0, Delta: types.ChatDelta{}, FinishReason: types.StringPtr("tool_calls")}},
-		})
+}
+
+// toolCallIndex returns the tool_calls index for a call id. Clients accumulate
+// tool calls by index, so web search and function calls draw from one
+// monotonic sequence and a call keeps its index for all of its chunks.
+func (t *chatStreamTranslator) toolCallIndex(callID string) int {
+	idx, ok := t.toolIndex[callID]
+	if !ok {
+		idx = len(t.toolIndex)
+		t.toolIndex[callID] = idx
 	}
+	return idx
 }
 
 func (t *chatStreamTranslator) handleOutputItemAdded(data map[string]any) {
@@ -339,14 +405,10 @@ func (t *chatStreamTranslator) handleOutputItemDone(data map[string]any) {
 		argsSource = map[string]any{}
 	}
 
-	argsStr := stream.SerializeToolArgs(argsSource, itemType == "web_search_call")
-	if _, ok := t.wsIndex[callID]; !ok {
-		t.wsIndex[callID] = t.wsNextIndex
-		t.wsNextIndex++
-	}
-	idx := t.wsIndex[callID]
+	argsStr := stream.SerializeToolArgs(argsSource, itemType == "web_search_call", t.opts.RepairToolArgs)
 
 	if callID != "" && name != "" {
+		idx := t.toolCallIndex(callID)
 		t.writeChunk(types.ChatCompletionChunk{
 			ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
 			Choices: []types.ChatChunkChoice{{
@@ -358,11 +420,11 @@ func (t *chatStreamTranslator) handleOutputItemDone(data map[string]any) {
 				FinishReason: nil,
 			}},
 		})
-		t.writeChunk(types.ChatCompletionChunk{
-			ID: t.responseID, Object: "chat.completion.chunk", Created: 0, Model: t.model,
-			Choices: []types.ChatChunkChoice{{Index: 0, Delta: types.ChatDelta{}, FinishReason: types.StringPtr("tool_calls")}},
-		})
-		t.sentStopChunk = true
+		// Web search runs upstream, so only function calls need the client
+		// to act and turn the finish reason into "tool_calls".
+		if itemType == "function_call" {
+			t.sawToolCall = true
+		}
 	}
 }
 
@@ -387,9 +449,14 @@ func (t *chatStreamTranslator) handleReasoningDelta(kind string, data map[string
 					Content: []types.ReasoningPart{{Type: "text", Text: deltaTxt}},
 				}}, FinishReason: nil}},
 		})
-	case "think-tags":
+	case "think-tags", "inline":
+		// Open the block only for real reasoning text; empty deltas (seen from
+		// non-reasoning models) would otherwise leave an empty <think></think>.
+		if deltaTxt == "" {
+			return
+		}
 		if !t.thinkOpen && !t.thinkClosed {
-			t.writeChunk(t.makeDelta(types.ChatDelta{Content: "<think>"}))
+			t.writeChunk(t.makeDelta(types.ChatDelta{Content: t.thinkOpenMark}))
 			t.thinkOpen = true
 		}
 		if t.thinkOpen && !t.thinkClosed {
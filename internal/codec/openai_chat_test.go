@@ -0,0 +1,212 @@
+package codec
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestThinkTagsStreamWithoutReasoningEmitsNoTags(t *testing.T) {
+	const (
+		summaryPart  = `{"type":"response.reasoning_summary_part.added","item_id":"rs_1"}`
+		emptySummary = `{"type":"response.reasoning_summary_text.delta","item_id":"rs_1","delta":""}`
+		text         = `{"type":"response.output_text.delta","delta":"Hello"}`
+		completed    = `{"type":"response.completed","response":{"id":"resp_1"}}`
+	)
+	streams := map[string][]string{
+		"plain text":          {text, completed},
+		"empty reasoning":     {summaryPart, emptySummary, text, completed},
+		"no completed event":  {emptySummary, text},
+		"reasoning item only": {summaryPart, emptySummary, completed},
+	}
+	encoders := map[string]Encoder{"chat": &ChatEncoder{}, "ollama": &OllamaEncoder{}}
+	for encName, enc := range encoders {
+		for name, events := range streams {
+			rec := httptest.NewRecorder()
+			enc.StreamTranslator(rec, "gpt-5", StreamOpts{ReasoningCompat: "think-tags"}).Translate(sseReader(events...))
+			if body := rec.Body.String(); strings.Contains(body, "think") {
+				t.Errorf("%s/%s: stray think tag in output:\n%s", encName, name, body)
+			}
+		}
+	}
+
+	// Real reasoning still gets exactly one balanced block.
+	rec := httptest.NewRecorder()
+	(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{ReasoningCompat: "think-tags"}).Translate(sseReader(
+		`{"type":"response.reasoning_summary_text.delta","delta":"hmm"}`, text, completed))
+	body := rec.Body.String()
+	if strings.Count(body, `\u003cthink\u003e`) != 1 || strings.Count(body, `\u003c/think\u003e`) != 1 {
+		t.Errorf("reasoning stream should open and close one think block:\n%s", body)
+	}
+}
+
+func TestChatStreamToolCallIndicesStable(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{}).Translate(sseReader(
+		`{"type":"response.output_item.added","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup"}}`,
+		`{"type":"response.web_search_call.in_progress","item_id":"ws_1"}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"{\"q\":"}`,
+		`{"type":"response.web_search_call.searching","item_id":"ws_1","query":"weather"}`,
+		`{"type":"response.function_call_arguments.delta","item_id":"fc_1","delta":"\"x\"}"}`,
+		`{"type":"response.output_item.done","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup","arguments":"{\"q\":\"x\"}"}}`,
+		`{"type":"response.web_search_call.in_progress","item":{"type":"web_search_call","id":"ws_2"}}`,
+		`{"type":"response.web_search_call.completed","item_id":"ws_1"}`,
+		`{"type":"response.output_item.done","item":{"type":"web_search_call","id":"ws_1"}}`,
+		`{"type":"response.output_item.done","item":{"type":"function_call","id":"fc_2","call_id":"call_2","name":"lookup","arguments":"{}"}}`,
+		`{"type":"response.output_item.done","item":{"type":"web_search_call","id":"ws_2"}}`,
+		`{"type":"response.completed","response":{"id":"resp_1"}}`,
+	))
+
+	indices := map[string]int{}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk types.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("unmarshal chunk %s: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			for _, tc := range choice.Delta.ToolCalls {
+				if idx, seen := indices[tc.ID]; seen && idx != tc.Index {
+					t.Errorf("%s: index changed from %d to %d", tc.ID, idx, tc.Index)
+				}
+				indices[tc.ID] = tc.Index
+			}
+		}
+	}
+	want := map[string]int{"ws_1": 0, "call_1": 1, "ws_2": 2, "call_2": 3}
+	if !reflect.DeepEqual(indices, want) {
+		t.Errorf("tool call indices: got %v, want %v", indices, want)
+	}
+}
+
+func TestChatStreamRoleOnlyInFirstChunk(t *testing.T) {
+	streams := map[string][]string{
+		"text": {
+			`{"type":"response.output_text.delta","delta":"Hel"}`,
+			`{"type":"response.output_text.delta","delta":"lo"}`,
+			`{"type":"response.completed","response":{"id":"resp_1"}}`,
+		},
+		"tool call": {
+			`{"type":"response.output_item.done","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup","arguments":"{}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1"}}`,
+		},
+	}
+	for name, events := range streams {
+		rec := httptest.NewRecorder()
+		(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{IncludeUsage: true}).Translate(sseReader(events...))
+
+		var roles []string
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+			var chunk types.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				t.Fatalf("%s: unmarshal chunk %s: %v", name, data, err)
+			}
+			roles = append(roles, chunk.Choices[0].Delta.Role)
+		}
+		if len(roles) < 2 || roles[0] != "assistant" {
+			t.Fatalf("%s: first chunk should carry the assistant role, got %q", name, roles)
+		}
+		for i, role := range roles[1:] {
+			if role != "" {
+				t.Errorf("%s: chunk %d repeats role %q", name, i+1, role)
+			}
+		}
+	}
+}
+
+func TestChatStreamSingleToolCallsFinishReason(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{}).Translate(sseReader(
+		`{"type":"response.output_text.delta","delta":"Let me check."}`,
+		`{"type":"response.output_item.done","item":{"type":"function_call","id":"fc_1","call_id":"call_1","name":"lookup","arguments":"{}"}}`,
+		`{"type":"response.output_item.done","item":{"type":"web_search_call","id":"ws_1"}}`,
+		`{"type":"response.output_text.delta","delta":" Done."}`,
+		`{"type":"response.completed","response":{"id":"resp_1"}}`,
+	))
+
+	var finishes []string
+	var last types.ChatCompletionChunk
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk types.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("unmarshal chunk %s: %v", data, err)
+		}
+		if fr := chunk.Choices[0].FinishReason; fr != nil {
+			finishes = append(finishes, *fr)
+		}
+		last = chunk
+	}
+	if !reflect.DeepEqual(finishes, []string{"tool_calls"}) {
+		t.Errorf("finish reasons: got %q, want a single tool_calls", finishes)
+	}
+	if fr := last.Choices[0].FinishReason; fr == nil || *fr != "tool_calls" {
+		t.Errorf("last chunk should carry the finish reason, got %+v", last)
+	}
+
+	// Web search alone runs upstream and still finishes with stop.
+	rec = httptest.NewRecorder()
+	(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{}).Translate(sseReader(
+		`{"type":"response.web_search_call.completed","item_id":"ws_1"}`,
+		`{"type":"response.output_text.delta","delta":"Sunny."}`,
+		`{"type":"response.completed","response":{"id":"resp_1"}}`,
+	))
+	if body := rec.Body.String(); strings.Count(body, `"finish_reason":"`) != 1 || !strings.Contains(body, `"finish_reason":"stop"`) {
+		t.Errorf("web search stream should finish once with stop:\n%s", body)
+	}
+}
+
+func TestInlineCompatPutsReasoningInContent(t *testing.T) {
+	const want = "Reasoning: weigh it\n\nAnswer: 42"
+
+	rec := httptest.NewRecorder()
+	(&ChatEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{ReasoningCompat: "inline"}).Translate(sseReader(
+		`{"type":"response.reasoning_summary_text.delta","delta":"weigh "}`,
+		`{"type":"response.reasoning_summary_text.delta","delta":"it"}`,
+		`{"type":"response.output_text.delta","delta":"42"}`,
+		`{"type":"response.completed","response":{"id":"resp_1"}}`,
+	))
+	var content strings.Builder
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk types.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("unmarshal chunk %s: %v", data, err)
+		}
+		if chunk.Choices[0].Delta.Reasoning != nil {
+			t.Errorf("inline mode should not emit a reasoning field: %s", data)
+		}
+		content.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if content.String() != want {
+		t.Errorf("streamed content: got %q, want %q", content.String(), want)
+	}
+
+	collected := &CollectedResponse{ResponseID: "resp_1", FullText: "42", ReasoningSummary: "weigh it", RawResponse: map[string]any{"_reasoning_compat": "inline"}}
+	rec = httptest.NewRecorder()
+	(&ChatEncoder{}).WriteCollected(rec, 200, collected, "gpt-5")
+	var resp types.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal collected: %v", err)
+	}
+	if got := resp.Choices[0].Message.Content; got == nil || *got != want {
+		t.Errorf("collected content: got %v, want %q", got, want)
+	}
+}
@@ -21,7 +21,16 @@ func (e *ResponsesEncoder) WriteStreamHeaders(w http.ResponseWriter, statusCode
 }
 
 func (e *ResponsesEncoder) StreamTranslator(w http.ResponseWriter, model string, opts StreamOpts) Translator {
-	return &responsesStreamTranslator{w: w}
+	t := &responsesStreamTranslator{w: w}
+	if opts.ResponsesUsage != stream.UsageVerbatim {
+		t.usage = &stream.UsageShaper{Mode: opts.ResponsesUsage, InputTokens: opts.InputTokensEstimate}
+	}
+	if opts.RenumberOutputIndices {
+		t.renumber = &stream.OutputRenumberer{}
+	}
+	t.heartbeat = opts.Heartbeat
+	t.fingerprint = opts.SystemFingerprint
+	return t
 }
 
 func (e *ResponsesEncoder) WriteCollected(w http.ResponseWriter, statusCode int, resp *CollectedResponse, model string) {
@@ -30,9 +39,14 @@ func (e *ResponsesEncoder) WriteCollected(w http.ResponseWriter, statusCode int,
 		return
 	}
 
-	// If we have a raw response from upstream, pass it through with model patched.
-	if resp.RawResponse != nil {
+	// If we have the raw response object from upstream, pass it through with
+	// model patched. The normalized pipeline sets only "_" markers, which do
+	// not make a response object.
+	if resp.RawResponse != nil && resp.RawResponse["id"] != nil {
 		resp.RawResponse["model"] = model
+		if resp.SystemFingerprint != "" {
+			resp.RawResponse["system_fingerprint"] = resp.SystemFingerprint
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(statusCode)
 		json.NewEncoder(w).Encode(resp.RawResponse)
@@ -41,16 +55,37 @@ func (e *ResponsesEncoder) WriteCollected(w http.ResponseWriter, statusCode int,
 
 	// Fallback: assemble from collected output items.
 	result := types.ResponsesResponse{
-		ID:        resp.ResponseID,
-		Object:    "response",
-		CreatedAt: time.Now().Unix(),
-		Model:     model,
-		Output:    resp.OutputItems,
-		Status:    "completed",
+		ID:                resp.ResponseID,
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Model:             model,
+		Output:            resp.OutputItems,
+		Status:            "completed",
+		Usage:             responsesUsage(resp.Usage),
+		SystemFingerprint: resp.SystemFingerprint,
+	}
+	if resp.IncompleteReason != "" {
+		result.Status = "incomplete"
+		result.IncompleteDetails = &types.IncompleteDetails{Reason: resp.IncompleteReason}
 	}
 	WriteJSON(w, statusCode, result)
 }
 
+// responsesUsage converts collected usage to the Responses API shape.
+func responsesUsage(u *types.Usage) *types.ResponsesUsage {
+	if u == nil {
+		return nil
+	}
+	out := &types.ResponsesUsage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+		out.InputTokensDetails = &types.ResponsesUsageInputDetails{CachedTokens: u.PromptTokensDetails.CachedTokens}
+	}
+	if u.CompletionTokensDetails != nil && u.CompletionTokensDetails.ReasoningTokens > 0 {
+		out.OutputTokensDetails = &types.ResponsesUsageOutputDetails{ReasoningTokens: u.CompletionTokensDetails.ReasoningTokens}
+	}
+	return out
+}
+
 func (e *ResponsesEncoder) WriteError(w http.ResponseWriter, statusCode int, message string) {
 	WriteOpenAIError(w, statusCode, message)
 }
@@ -59,6 +94,12 @@ func (e *ResponsesEncoder) WriteError(w http.ResponseWriter, statusCode int, mes
 // Responses API SSE, so events are forwarded as-is with [DONE] appended.
 type responsesStreamTranslator struct {
 	w http.ResponseWriter
+	// renumber makes output_index values contiguous; nil when renumbering
+	// is disabled.
+	renumber    *stream.OutputRenumberer
+	usage       *stream.UsageShaper
+	heartbeat   time.Duration
+	fingerprint string
 }
 
 func (t *responsesStreamTranslator) Translate(reader *stream.Reader) {
@@ -67,30 +108,50 @@ func (t *responsesStreamTranslator) Translate(reader *stream.Reader) {
 		return
 	}
 
+	hb := StartHeartbeat(t.w, flusher, t.heartbeat)
 	gotEvents := false
+	var responseID string
+	var readErr error
 	for {
 		evt, err := reader.Next()
 		if err != nil {
+			readErr = err
 			break
 		}
 		gotEvents = true
+		if id := stream.ResponseIDFromEvent(evt.Data); id != "" {
+			responseID = id
+		}
 
+		hb.Lock()
+		hb.Observe(evt)
 		if evt.Type != "" {
 			fmt.Fprintf(t.w, "event: %s\n", evt.Type)
 		}
+		stream.SetSystemFingerprint(evt, t.fingerprint)
+		t.usage.Apply(evt)
+		if t.renumber != nil {
+			t.renumber.Apply(evt)
+		}
 		fmt.Fprintf(t.w, "data: %s\n\n", evt.Raw)
 		flusher.Flush()
+		hb.Unlock()
 
-		if evt.Type == "response.completed" || evt.Type == "response.failed" {
+		if evt.Type == "response.completed" || evt.Type == "response.failed" || evt.Type == "response.incomplete" {
+			hb.Stop()
 			fmt.Fprint(t.w, "data: [DONE]\n\n")
 			flusher.Flush()
 			return
 		}
 	}
+	hb.Stop()
 
 	if !gotEvents {
 		fmt.Fprint(t.w, "data: {\"type\":\"response.failed\",\"response\":{\"error\":{\"message\":\"upstream returned empty response\"}}}\n\n")
 		flusher.Flush()
+	} else if reason := StreamEndReason(readErr); reason != "" {
+		fmt.Fprintf(t.w, "event: response.incomplete\ndata: %s\n\n", IncompleteEvent(responseID, reason))
+		flusher.Flush()
 	}
 	fmt.Fprint(t.w, "data: [DONE]\n\n")
 	flusher.Flush()
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+func TestResponsesHeartbeatDuringUpstreamSilence(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_hb\",\"object\":\"response\",\"status\":\"queued\"}}\n\n") //nolint:errcheck
+		time.Sleep(150 * time.Millisecond)
+		io.WriteString(pw, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\n\n") //nolint:errcheck
+		time.Sleep(150 * time.Millisecond)
+		io.WriteString(pw, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_hb\"}}\n\n") //nolint:errcheck
+		pw.Close()
+	}()
+
+	rec := httptest.NewRecorder()
+	(&ResponsesEncoder{}).StreamTranslator(rec, "gpt-5", StreamOpts{Heartbeat: 20 * time.Millisecond}).Translate(stream.NewReader(pr))
+
+	body := rec.Body.String()
+	beats := 0
+	outputAt := strings.Index(body, "response.output_text.delta")
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || !strings.Contains(data, "response.in_progress") {
+			continue
+		}
+		beats++
+		var evt struct {
+			Type     string         `json:"type"`
+			Response map[string]any `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			t.Fatalf("heartbeat is not valid JSON: %q", data)
+		}
+		if evt.Type != "response.in_progress" || evt.Response["id"] != "resp_hb" || evt.Response["status"] != "in_progress" {
+			t.Errorf("malformed heartbeat: %s", data)
+		}
+	}
+	if beats == 0 {
+		t.Fatalf("expected at least one response.in_progress heartbeat:\n%s", body)
+	}
+	if strings.LastIndex(body, "response.in_progress") > outputAt {
+		t.Errorf("heartbeat sent after output started:\n%s", body)
+	}
+}
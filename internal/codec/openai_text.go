@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"unicode/utf8"
 
 	"github.com/n0madic/go-chatmock/internal/stream"
 	"github.com/n0madic/go-chatmock/internal/types"
@@ -29,18 +30,52 @@ func (e *TextEncoder) WriteCollected(w http.ResponseWriter, statusCode int, resp
 		WriteOpenAIError(w, http.StatusBadGateway, resp.ErrorMessage)
 		return
 	}
+	var logprobs any
+	if resp.TextLogprobs != nil {
+		logprobs = resp.TextLogprobs
+	}
 	completion := types.TextCompletionResponse{
 		ID:     resp.ResponseID,
 		Object: "text_completion",
 		Model:  model,
 		Choices: []types.TextChoice{
-			{Index: 0, Text: resp.FullText, FinishReason: types.StringPtr("stop"), Logprobs: nil},
+			{Index: 0, Text: resp.FullText, FinishReason: types.StringPtr(chatFinishReason(resp.IncompleteReason, "stop")), Logprobs: logprobs},
 		},
 		Usage: resp.Usage,
 	}
 	WriteJSON(w, statusCode, completion)
 }
 
+// BuildTextLogprobs converts upstream token logprobs into the legacy
+// completions shape, keeping at most top alternatives per token. The slices
+// are never nil so a request without upstream logprobs still gets the
+// structure. Offsets count characters from the start of the completion.
+func BuildTextLogprobs(tokens []types.TokenLogprob, top int) *types.TextLogprobs {
+	out := &types.TextLogprobs{
+		Tokens:        make([]string, 0, len(tokens)),
+		TokenLogprobs: make([]float64, 0, len(tokens)),
+		TopLogprobs:   make([]map[string]float64, 0, len(tokens)),
+		TextOffset:    make([]int, 0, len(tokens)),
+	}
+	offset := 0
+	for _, tok := range tokens {
+		out.Tokens = append(out.Tokens, tok.Token)
+		out.TokenLogprobs = append(out.TokenLogprobs, tok.Logprob)
+		out.TextOffset = append(out.TextOffset, offset)
+		offset += utf8.RuneCountInString(tok.Token)
+
+		alts := make(map[string]float64, top)
+		for i, alt := range tok.TopLogprobs {
+			if i >= top {
+				break
+			}
+			alts[alt.Token] = alt.Logprob
+		}
+		out.TopLogprobs = append(out.TopLogprobs, alts)
+	}
+	return out
+}
+
 func (e *TextEncoder) WriteError(w http.ResponseWriter, statusCode int, message string) {
 	WriteOpenAIError(w, statusCode, message)
 }
@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+func writeTextLogprobs(t *testing.T, resp *CollectedResponse) map[string]any {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	(&TextEncoder{}).WriteCollected(rec, 200, resp, "gpt-5")
+	var out struct {
+		Choices []struct {
+			Logprobs map[string]any `json:"logprobs"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || len(out.Choices) != 1 {
+		t.Fatalf("decode completion: %v (%s)", err, rec.Body.String())
+	}
+	return out.Choices[0].Logprobs
+}
+
+func TestTextCompletionLogprobsShape(t *testing.T) {
+	delta := map[string]any{}
+	json.Unmarshal([]byte(`{"type":"response.output_text.delta","delta":"Hi there","logprobs":[
+		{"token":"Hi","logprob":-0.1,"top_logprobs":[{"token":"Hi","logprob":-0.1},{"token":"Hello","logprob":-2.5},{"token":"Hey","logprob":-3}]},
+		{"token":" there","logprob":-0.7,"top_logprobs":[{"token":" there","logprob":-0.7}]}]}`), &delta) //nolint:errcheck
+	tokens := stream.TokenLogprobsFromEvent(delta)
+
+	got := writeTextLogprobs(t, &CollectedResponse{ResponseID: "cmpl", FullText: "Hi there", TextLogprobs: BuildTextLogprobs(tokens, 2)})
+	want := map[string]any{
+		"tokens":         []any{"Hi", " there"},
+		"token_logprobs": []any{-0.1, -0.7},
+		"top_logprobs":   []any{map[string]any{"Hi": -0.1, "Hello": -2.5}, map[string]any{" there": -0.7}},
+		"text_offset":    []any{float64(0), float64(2)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("logprobs: got %v, want %v", got, want)
+	}
+
+	empty := writeTextLogprobs(t, &CollectedResponse{FullText: "Hi", TextLogprobs: BuildTextLogprobs(nil, 1)})
+	for _, key := range []string{"tokens", "token_logprobs", "top_logprobs", "text_offset"} {
+		if v, ok := empty[key].([]any); !ok || len(v) != 0 {
+			t.Errorf("requested without upstream logprobs: %s got %v, want []", key, empty[key])
+		}
+	}
+
+	if got := writeTextLogprobs(t, &CollectedResponse{FullText: "Hi"}); got != nil {
+		t.Errorf("not requested: logprobs got %v, want null", got)
+	}
+}
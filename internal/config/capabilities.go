@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Capabilities is per-model metadata that operators maintain in
+// --capabilities-file. Unset fields keep the registry or static default.
+type Capabilities struct {
+	ContextWindow   int      `json:"context_window,omitempty"`
+	MaxOutputTokens int      `json:"max_output_tokens,omitempty"`
+	ReasoningLevels []string `json:"reasoning_levels,omitempty"`
+	WebSearch       *bool    `json:"web_search,omitempty"`
+	SamplingParams  *bool    `json:"sampling_params,omitempty"`
+}
+
+// SupportsWebSearch reports whether the default web_search tool may be added
+// for the model (unset means supported).
+func (c Capabilities) SupportsWebSearch() bool {
+	return c.WebSearch == nil || *c.WebSearch
+}
+
+// SupportsSamplingParams reports whether temperature and top_p may be
+// forwarded upstream for the model (unset means supported).
+func (c Capabilities) SupportsSamplingParams() bool {
+	return c.SamplingParams == nil || *c.SamplingParams
+}
+
+// CapabilityTable maps lower-case model slugs to capability overrides.
+type CapabilityTable map[string]Capabilities
+
+// LoadCapabilities reads a capability table from a JSON file of the form
+// {"gpt-5": {"context_window": 400000, "reasoning_levels": ["low", "high"]}}.
+func LoadCapabilities(path string) (CapabilityTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]Capabilities
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse capabilities %s: %w", path, err)
+	}
+	t := make(CapabilityTable, len(raw))
+	for slug, caps := range raw {
+		if caps.ContextWindow < 0 || caps.MaxOutputTokens < 0 {
+			return nil, fmt.Errorf("capabilities %s: %q has a negative token limit", path, slug)
+		}
+		levels := make([]string, 0, len(caps.ReasoningLevels))
+		for _, lvl := range caps.ReasoningLevels {
+			lvl = strings.ToLower(strings.TrimSpace(lvl))
+			if !reasoningEfforts[lvl] {
+				return nil, fmt.Errorf("capabilities %s: %q has unknown reasoning level %q", path, slug, lvl)
+			}
+			levels = append(levels, lvl)
+		}
+		caps.ReasoningLevels = levels
+		t[capabilityKey(slug)] = caps
+	}
+	return t, nil
+}
+
+// For returns the entry for model, matched on the slug without any ":tag"
+// suffix. It is the zero value (all defaults) when the model has no entry or
+// the table is nil.
+func (t CapabilityTable) For(model string) Capabilities {
+	return t[capabilityKey(model)]
+}
+
+func capabilityKey(model string) string {
+	key := strings.ToLower(strings.TrimSpace(model))
+	return strings.SplitN(key, ":", 2)[0]
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capabilities.json")
+	data := `{"GPT-5.1": {"context_window": 272000, "max_output_tokens": 4096, "reasoning_levels": ["High"], "web_search": false}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	caps, err := LoadCapabilities(path)
+	if err != nil {
+		t.Fatalf("LoadCapabilities: %v", err)
+	}
+	c := caps.For("gpt-5.1:latest")
+	if c.ContextWindow != 272000 || c.SupportsWebSearch() || !c.SupportsSamplingParams() || len(c.ReasoningLevels) != 1 || c.ReasoningLevels[0] != "high" {
+		t.Errorf("For(gpt-5.1:latest): got %+v", c)
+	}
+	if c := CapabilityTable(nil).For("gpt-5"); c.ContextWindow != 0 || !c.SupportsWebSearch() {
+		t.Errorf("a nil table should report defaults, got %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"gpt-5": {"reasoning_levels": ["extreme"]}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCapabilities(path); err == nil {
+		t.Error("expected an unknown reasoning level to be rejected")
+	}
+}
+
+func TestOutputTokenLimitUsesModelMaxOutputTokens(t *testing.T) {
+	cfg := &ServerConfig{Capabilities: CapabilityTable{"gpt-5.1": {MaxOutputTokens: 4096}}}
+	for _, tt := range []struct {
+		serverMax int
+		model     string
+		requested int
+		want      int
+	}{
+		{0, "gpt-5", 0, 0},
+		{0, "gpt-5", 100, 0},
+		{0, "gpt-5.1", 0, 4096},
+		{0, "gpt-5.1", 100, 100},
+		{2048, "gpt-5.1", 0, 2048},
+		{8192, "gpt-5.1", 0, 4096},
+		{8192, "gpt-5", 10000, 8192},
+	} {
+		cfg.ServerMaxOutputTokens = tt.serverMax
+		if got := cfg.OutputTokenLimit(tt.model, tt.requested); got != tt.want {
+			t.Errorf("OutputTokenLimit(%q, %d) with server max %d = %d, want %d", tt.model, tt.requested, tt.serverMax, got, tt.want)
+		}
+	}
+}
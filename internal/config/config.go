@@ -1,8 +1,16 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/pricing"
 )
 
 const (
@@ -11,24 +19,85 @@ const (
 	ResponsesURL        = "https://chatgpt.com/backend-api/codex/responses"
 	ModelsURL           = "https://chatgpt.com/backend-api/codex/models"
 	OllamaVersionString = "0.12.10"
+
+	// DefaultRequestIDHeader is the default correlation-ID header.
+	DefaultRequestIDHeader = "X-Request-Id"
 )
 
 // ServerConfig holds all server configuration.
 type ServerConfig struct {
-	Host                  string
-	Port                  int
-	Verbose               bool
-	Debug                 bool
-	AccessToken           string
-	ReasoningEffort       string
-	ReasoningSummary      string
-	ReasoningCompat       string
-	DebugModel            string
-	ExposeReasoningModels bool
-	DefaultWebSearch      bool
-	ResponseFormat        string
-	BaseInstructions      string
-	CodexInstructions     string
+	Host                      string
+	Port                      int
+	Verbose                   bool
+	Debug                     bool
+	LogRedact                 string
+	RedactReasoning           bool
+	EnableMetrics             bool
+	GzipSSE                   bool
+	AccessToken               string
+	ReasoningEffort           string
+	ReasoningEffortByModel    map[string]string // --reasoning-effort-model; see ReasoningEffortFor
+	ReasoningSummary          string
+	ReasoningCompat           string
+	DebugModel                string
+	DefaultModel              string
+	LegacyModelTarget         string
+	EmbeddingsPassthroughURL  string
+	ExposeReasoningModels     bool
+	DefaultWebSearch          bool
+	ResponseFormat            string
+	StateSweepInterval        time.Duration
+	StateConversationCapacity int
+	StateConversationTTL      time.Duration
+	StateSpillDir             string
+	MaxConversationAge        time.Duration
+	AllowedIncludes           string
+	ReportUpstreamModel       bool
+	SSEFlushInterval          time.Duration
+	AckToolResults            bool
+	StripEmptyToolResults     bool
+	StrictTools               bool
+	StrictSamplingParams      bool
+	EmitSystemFingerprint     bool
+	ForwardObfuscation        bool
+	ResponsesHeartbeat        time.Duration
+	UpstreamIdleTimeout       time.Duration
+	StartupTimeout            time.Duration
+	EnforceToolChoice         string
+	CanonicalToolNames        bool
+	RepairToolArgs            bool
+	MaxSSEEventSize           int
+	MaxParallelToolCalls      int
+	MaxUpstreamAttempts       int
+	MaxConcurrentRequests     int
+	MaxConcurrentBacklog      int // negative: same as MaxConcurrentRequests
+	ServerMaxOutputTokens     int
+	RenumberOutputIndices     bool
+	RequestIDHeader           string
+	Warmup                    bool
+	OmitPromptWithoutTools    bool
+	RequireJSONContentType    bool
+	NoJSONNewlineFallback     bool
+	EmitCostHeader            bool
+	CostPriceTable            string
+	CostPrices                pricing.Table // loaded from CostPriceTable when EmitCostHeader is set
+	CapabilitiesFile          string
+	Capabilities              CapabilityTable // loaded from CapabilitiesFile
+	TruncationNotice          bool
+	EmptyResponseBehavior     string
+	TLSCertFile               string
+	TLSKeyFile                string
+	TLSMinVersion             string
+	TLSCipherSuites           string
+	OllamaVersion             string
+	PromptMap                 string
+	PromptRules               []PromptRule // parsed from PromptMap; checked before DefaultPromptRules
+	ModelTemperatureDefault   string
+	ModelTemperatureOverride  string
+	TemperatureDefaults       []TemperatureRule // parsed from ModelTemperatureDefault
+	TemperatureOverrides      []TemperatureRule // parsed from ModelTemperatureOverride
+	BaseInstructions          string
+	CodexInstructions         string
 }
 
 // ClientID returns the OAuth client ID from env or default.
@@ -53,28 +122,172 @@ func TokenURL() string {
 }
 
 // DefaultFromEnv creates a ServerConfig with defaults from environment variables.
+// Malformed numeric values fall back to their defaults; use LoadFromEnv to
+// have them reported.
 func DefaultFromEnv() *ServerConfig {
-	return &ServerConfig{
-		Host:                  "127.0.0.1",
-		Port:                  8000,
-		Debug:                 envBool("CHATGPT_LOCAL_DEBUG"),
-		AccessToken:           strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_ACCESS_TOKEN")),
-		ReasoningEffort:       envOrDefault("CHATGPT_LOCAL_REASONING_EFFORT", "medium"),
-		ReasoningSummary:      envOrDefault("CHATGPT_LOCAL_REASONING_SUMMARY", "auto"),
-		ReasoningCompat:       envOrDefault("CHATGPT_LOCAL_REASONING_COMPAT", "think-tags"),
-		DebugModel:            os.Getenv("CHATGPT_LOCAL_DEBUG_MODEL"),
-		ExposeReasoningModels: envBool("CHATGPT_LOCAL_EXPOSE_REASONING_MODELS"),
-		DefaultWebSearch:      envBool("CHATGPT_LOCAL_ENABLE_WEB_SEARCH"),
-		ResponseFormat:        envOrDefault("CHATGPT_LOCAL_RESPONSE_FORMAT", "route"),
+	cfg, _ := LoadFromEnv()
+	return cfg
+}
+
+// LoadFromEnv is DefaultFromEnv that also returns the malformed integer and
+// duration variables it fell back on, joined into one error.
+func LoadFromEnv() (*ServerConfig, error) {
+	var env envNumbers
+	cfg := &ServerConfig{
+		Host:                      "127.0.0.1",
+		Port:                      8000,
+		Debug:                     envBool("CHATGPT_LOCAL_DEBUG"),
+		LogRedact:                 envOrDefault("CHATGPT_LOCAL_LOG_REDACT", "none"),
+		RedactReasoning:           envBool("CHATGPT_LOCAL_REDACT_REASONING_IN_LOGS"),
+		EnableMetrics:             envBool("CHATGPT_LOCAL_ENABLE_METRICS"),
+		GzipSSE:                   envBool("CHATGPT_LOCAL_GZIP_SSE"),
+		AccessToken:               strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_ACCESS_TOKEN")),
+		ReasoningEffort:           envOrDefault("CHATGPT_LOCAL_REASONING_EFFORT", "medium"),
+		ReasoningSummary:          envOrDefault("CHATGPT_LOCAL_REASONING_SUMMARY", "auto"),
+		ReasoningCompat:           envOrDefault("CHATGPT_LOCAL_REASONING_COMPAT", "think-tags"),
+		DebugModel:                os.Getenv("CHATGPT_LOCAL_DEBUG_MODEL"),
+		DefaultModel:              strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_DEFAULT_MODEL")),
+		LegacyModelTarget:         strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_LEGACY_MODEL_TARGET")),
+		EmbeddingsPassthroughURL:  strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_EMBEDDINGS_PASSTHROUGH_URL")),
+		ExposeReasoningModels:     envBool("CHATGPT_LOCAL_EXPOSE_REASONING_MODELS"),
+		DefaultWebSearch:          envBool("CHATGPT_LOCAL_ENABLE_WEB_SEARCH"),
+		ResponseFormat:            envOrDefault("CHATGPT_LOCAL_RESPONSE_FORMAT", "route"),
+		StateSweepInterval:        env.duration("CHATGPT_LOCAL_STATE_SWEEP_INTERVAL", 30*time.Second),
+		EnforceToolChoice:         envOrDefault("CHATGPT_LOCAL_ENFORCE_TOOL_CHOICE", "off"),
+		CanonicalToolNames:        envBool("CHATGPT_LOCAL_CANONICAL_TOOL_NAMES"),
+		Warmup:                    envBool("CHATGPT_LOCAL_WARMUP"),
+		OmitPromptWithoutTools:    envBool("CHATGPT_LOCAL_OMIT_PROMPT_WITHOUT_TOOLS"),
+		RequireJSONContentType:    envBool("CHATGPT_LOCAL_REQUIRE_JSON_CONTENT_TYPE"),
+		NoJSONNewlineFallback:     envBool("CHATGPT_LOCAL_NO_JSON_NEWLINE_FALLBACK"),
+		RequestIDHeader:           envOrDefault("CHATGPT_LOCAL_REQUEST_ID_HEADER", DefaultRequestIDHeader),
+		RenumberOutputIndices:     envBool("CHATGPT_LOCAL_RENUMBER_OUTPUT_INDICES"),
+		MaxSSEEventSize:           env.int("CHATGPT_LOCAL_MAX_SSE_EVENT_SIZE", 16<<20),
+		RepairToolArgs:            envBool("CHATGPT_LOCAL_REPAIR_TOOL_ARGS"),
+		MaxParallelToolCalls:      env.int("CHATGPT_LOCAL_MAX_PARALLEL_TOOL_CALLS", 0),
+		MaxUpstreamAttempts:       env.int("CHATGPT_LOCAL_MAX_UPSTREAM_ATTEMPTS", 0),
+		MaxConcurrentRequests:     env.int("CHATGPT_LOCAL_MAX_CONCURRENT_REQUESTS", 0),
+		MaxConcurrentBacklog:      env.int("CHATGPT_LOCAL_MAX_CONCURRENT_BACKLOG", -1),
+		ServerMaxOutputTokens:     env.int("CHATGPT_LOCAL_SERVER_MAX_OUTPUT_TOKENS", 0),
+		EmitCostHeader:            envBool("CHATGPT_LOCAL_EMIT_COST_HEADER"),
+		CostPriceTable:            os.Getenv("CHATGPT_LOCAL_COST_PRICE_TABLE"),
+		CapabilitiesFile:          os.Getenv("CHATGPT_LOCAL_CAPABILITIES_FILE"),
+		PromptMap:                 os.Getenv("CHATGPT_LOCAL_PROMPT_MAP"),
+		ModelTemperatureDefault:   os.Getenv("CHATGPT_LOCAL_MODEL_TEMPERATURE_DEFAULT"),
+		ModelTemperatureOverride:  os.Getenv("CHATGPT_LOCAL_MODEL_TEMPERATURE_OVERRIDE"),
+		TruncationNotice:          envBool("CHATGPT_LOCAL_TRUNCATION_NOTICE"),
+		EmptyResponseBehavior:     envOrDefault("CHATGPT_LOCAL_EMPTY_RESPONSE_BEHAVIOR", "retry"),
+		TLSCertFile:               os.Getenv("CHATGPT_LOCAL_TLS_CERT"),
+		TLSKeyFile:                os.Getenv("CHATGPT_LOCAL_TLS_KEY"),
+		TLSMinVersion:             envOrDefault("CHATGPT_LOCAL_TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites:           os.Getenv("CHATGPT_LOCAL_TLS_CIPHER_SUITES"),
+		ResponsesHeartbeat:        env.duration("CHATGPT_LOCAL_RESPONSES_HEARTBEAT", 0),
+		UpstreamIdleTimeout:       env.duration("CHATGPT_LOCAL_UPSTREAM_IDLE_TIMEOUT", 0),
+		StartupTimeout:            env.duration("CHATGPT_LOCAL_STARTUP_TIMEOUT", 0),
+		OllamaVersion:             envOrDefault("CHATGPT_LOCAL_OLLAMA_VERSION", OllamaVersionString),
+		StateConversationCapacity: env.int("CHATGPT_LOCAL_STATE_CONVERSATION_CAPACITY", 10000),
+		StateConversationTTL:      env.duration("CHATGPT_LOCAL_STATE_CONVERSATION_TTL", 60*time.Minute),
+		StateSpillDir:             strings.TrimSpace(os.Getenv("CHATGPT_LOCAL_STATE_SPILL_DIR")),
+		MaxConversationAge:        env.duration("CHATGPT_LOCAL_MAX_CONVERSATION_AGE", 0),
+		AllowedIncludes:           os.Getenv("CHATGPT_LOCAL_ALLOWED_INCLUDES"),
+		ReportUpstreamModel:       envBool("CHATGPT_LOCAL_REPORT_UPSTREAM_MODEL"),
+		SSEFlushInterval:          env.duration("CHATGPT_LOCAL_SSE_FLUSH_INTERVAL", 0),
+		AckToolResults:            envBool("CHATGPT_LOCAL_ACK_TOOL_RESULTS"),
+		StripEmptyToolResults:     envBool("CHATGPT_LOCAL_STRIP_EMPTY_TOOL_RESULTS"),
+		StrictTools:               envBool("CHATGPT_LOCAL_STRICT_TOOLS"),
+		StrictSamplingParams:      envBool("CHATGPT_LOCAL_STRICT_SAMPLING_PARAMS"),
+		EmitSystemFingerprint:     envBool("CHATGPT_LOCAL_SYSTEM_FINGERPRINT"),
+		ForwardObfuscation:        envBool("CHATGPT_LOCAL_FORWARD_OBFUSCATION"),
+	}
+	return cfg, errors.Join(env.errs...)
+}
+
+// ModelOrDefault returns the client's model name, or --default-model when the
+// client omitted it. Unlike DebugModel it never overrides an explicit model.
+func (c *ServerConfig) ModelOrDefault(name string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	return c.DefaultModel
+}
+
+// ResponseModel returns the model name reported in responses: the client's
+// requested name, or the normalized upstream slug when none was requested or
+// --report-upstream-model is set.
+func (c *ServerConfig) ResponseModel(requested, upstream string) string {
+	if c.ReportUpstreamModel || strings.TrimSpace(requested) == "" {
+		return upstream
 	}
+	return requested
+}
+
+// OutputTokenLimit returns the output token limit enforced on a response
+// from model: the smaller of --server-max-output-tokens and the model's
+// --capabilities-file max_output_tokens, lowered to the client's own max when
+// that is smaller. 0 means no limit is enforced.
+func (c *ServerConfig) OutputTokenLimit(model string, requested int) int {
+	limit := c.ServerMaxOutputTokens
+	if modelMax := c.Capabilities.For(model).MaxOutputTokens; modelMax > 0 && (limit <= 0 || modelMax < limit) {
+		limit = modelMax
+	}
+	if limit <= 0 {
+		return 0
+	}
+	if requested > 0 && requested < limit {
+		return requested
+	}
+	return limit
+}
+
+// SystemFingerprint returns the system_fingerprint reported for model with
+// --system-fingerprint, or "" when it is off. It hashes the settings that shape
+// the upstream request (model, reasoning defaults, the embedded prompt and the
+// Codex client version), so it only changes when the effective config does.
+func (c *ServerConfig) SystemFingerprint(model string) string {
+	if !c.EmitSystemFingerprint {
+		return ""
+	}
+	h := sha256.New()
+	for _, part := range []string{
+		model,
+		c.ReasoningEffortFor(model),
+		c.ReasoningSummary,
+		c.ReasoningCompat,
+		c.InstructionsForModel(model),
+		CodexClientVersion,
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return "fp_" + hex.EncodeToString(h.Sum(nil))[:10]
+}
+
+// IncludeAllowed reports whether an include value may be forwarded upstream
+// under --allowed-includes (comma-separated). An empty allowlist permits all.
+func (c *ServerConfig) IncludeAllowed(value string) bool {
+	if strings.TrimSpace(c.AllowedIncludes) == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(c.AllowedIncludes, ",") {
+		if strings.TrimSpace(allowed) == value {
+			return true
+		}
+	}
+	return false
 }
 
 // InstructionsForModel returns the appropriate instructions for a given model name.
 func (c *ServerConfig) InstructionsForModel(model string) string {
-	if strings.HasPrefix(model, "gpt-5-codex") ||
-		strings.HasPrefix(model, "gpt-5.1-codex") ||
-		strings.HasPrefix(model, "gpt-5.2-codex") ||
-		strings.HasPrefix(model, "gpt-5.3-codex") {
+	prompt := PromptBase
+	for _, rules := range [][]PromptRule{c.PromptRules, DefaultPromptRules} {
+		if i := matchPromptRule(rules, model); i >= 0 {
+			prompt = rules[i].Prompt
+			break
+		}
+	}
+	switch prompt {
+	case PromptNone:
+		return ""
+	case PromptCodex:
 		if c.CodexInstructions != "" {
 			return c.CodexInstructions
 		}
@@ -82,6 +295,25 @@ func (c *ServerConfig) InstructionsForModel(model string) string {
 	return c.BaseInstructions
 }
 
+func matchPromptRule(rules []PromptRule, model string) int {
+	for i, r := range rules {
+		if r.matches(model) {
+			return i
+		}
+	}
+	return -1
+}
+
+// InstructionsForRequest returns the embedded prompt for a request that has no
+// client instructions. With --omit-prompt-without-tools, tool-less requests
+// are treated as plain chat and get no embedded prompt.
+func (c *ServerConfig) InstructionsForRequest(model string, hasTools bool) string {
+	if c.OmitPromptWithoutTools && !hasTools {
+		return ""
+	}
+	return c.InstructionsForModel(model)
+}
+
 func envOrDefault(key, defaultVal string) string {
 	if v := os.Getenv(key); v != "" {
 		return strings.ToLower(strings.TrimSpace(v))
@@ -93,3 +325,33 @@ func envBool(key string) bool {
 	v := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
 	return v == "1" || v == "true" || v == "yes" || v == "on"
 }
+
+// envNumbers parses numeric environment variables, remembering malformed
+// values instead of silently falling back to the default.
+type envNumbers struct {
+	errs []error
+}
+
+func (e *envNumbers) int(key string, defaultVal int) int {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: not an integer", key, v))
+			return defaultVal
+		}
+		return n
+	}
+	return defaultVal
+}
+
+func (e *envNumbers) duration(key string, defaultVal time.Duration) time.Duration {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("invalid %s %q: not a duration", key, v))
+			return defaultVal
+		}
+		return d
+	}
+	return defaultVal
+}
@@ -228,3 +228,99 @@ func TestInstructionsForModelEmptyCodex(t *testing.T) {
 		t.Errorf("expected base instructions when CodexInstructions is empty, got %q", got)
 	}
 }
+
+// TestInstructionsForModelPromptMap verifies that configured rules are checked
+// before the built-in codex rules.
+func TestInstructionsForModelPromptMap(t *testing.T) {
+	rules, err := ParsePromptMap("gpt-5-pro=codex, gpt-6*=none, gpt-5.1-codex-mini=base")
+	if err != nil {
+		t.Fatalf("ParsePromptMap: %v", err)
+	}
+	cfg := &ServerConfig{
+		BaseInstructions:  "base",
+		CodexInstructions: "codex",
+		PromptRules:       rules,
+	}
+
+	for model, want := range map[string]string{
+		"gpt-5-pro":          "codex",
+		"gpt-5-pro-high":     "base",
+		"gpt-6":              "",
+		"gpt-6-mini":         "",
+		"gpt-5.1-codex-mini": "base",
+		"gpt-5.1-codex":      "codex",
+		"gpt-4o":             "base",
+	} {
+		if got := cfg.InstructionsForModel(model); got != want {
+			t.Errorf("InstructionsForModel(%q): got %q, want %q", model, got, want)
+		}
+	}
+}
+
+// TestParsePromptMapRejectsInvalidEntries verifies malformed --prompt-map values.
+func TestParsePromptMapRejectsInvalidEntries(t *testing.T) {
+	for _, s := range []string{"gpt-5", "=codex", "*=codex", "gpt-5=unknown"} {
+		if _, err := ParsePromptMap(s); err == nil {
+			t.Errorf("ParsePromptMap(%q): expected an error", s)
+		}
+	}
+	if rules, err := ParsePromptMap(""); err != nil || len(rules) != 0 {
+		t.Errorf("ParsePromptMap(\"\"): got %v, %v; want no rules", rules, err)
+	}
+}
+
+// TestOutputTokenLimitBoundsClientMax verifies --server-max-output-tokens is
+// an upper bound that a smaller client max lowers further.
+func TestOutputTokenLimitBoundsClientMax(t *testing.T) {
+	cfg := &ServerConfig{ServerMaxOutputTokens: 100}
+	for requested, want := range map[int]int{0: 100, 50: 50, 100: 100, 5000: 100} {
+		if got := cfg.OutputTokenLimit("gpt-5", requested); got != want {
+			t.Errorf("OutputTokenLimit(%d): got %d, want %d", requested, got, want)
+		}
+	}
+	if got := (&ServerConfig{}).OutputTokenLimit("gpt-5", 50); got != 0 {
+		t.Errorf("OutputTokenLimit without a server cap: got %d, want 0", got)
+	}
+}
+
+// TestRemapLegacyModel verifies only legacy OpenAI names are remapped, and
+// only when --legacy-model-target is set.
+func TestRemapLegacyModel(t *testing.T) {
+	cfg := &ServerConfig{LegacyModelTarget: "gpt-5"}
+	for name, want := range map[string]string{
+		"gpt-3.5-turbo": "gpt-5", "gpt-4": "gpt-5", "GPT-4o-mini": "gpt-5", "gpt-4:latest": "gpt-5",
+		"gpt-5.1": "gpt-5.1", "gpt-5-codex": "gpt-5-codex", "codex-mini-latest": "codex-mini-latest",
+	} {
+		got, notice := cfg.RemapLegacyModel(name)
+		if got != want || (notice != "") != (got != name) {
+			t.Errorf("RemapLegacyModel(%q): got %q, %q; want %q", name, got, notice, want)
+		}
+	}
+	if got, notice := (&ServerConfig{}).RemapLegacyModel("gpt-4"); got != "gpt-4" || notice != "" {
+		t.Errorf("RemapLegacyModel without a target: got %q, %q", got, notice)
+	}
+}
+
+// TestParseReasoningEffortMap verifies --reasoning-effort-model parsing and
+// the fallthrough to --reasoning-effort for unlisted models.
+func TestParseReasoningEffortMap(t *testing.T) {
+	m, err := ParseReasoningEffortMap(nil, "gpt-5-codex=high, GPT-5.1=Low")
+	if err != nil {
+		t.Fatalf("ParseReasoningEffortMap: %v", err)
+	}
+	m, err = ParseReasoningEffortMap(m, "gpt-5.1=xhigh")
+	if err != nil {
+		t.Fatalf("ParseReasoningEffortMap (repeat): %v", err)
+	}
+	cfg := &ServerConfig{ReasoningEffort: "medium", ReasoningEffortByModel: m}
+	for model, want := range map[string]string{"gpt-5-codex": "high", "gpt-5.1": "xhigh", "gpt-5": "medium"} {
+		if got := cfg.ReasoningEffortFor(model); got != want {
+			t.Errorf("ReasoningEffortFor(%q): got %q, want %q", model, got, want)
+		}
+	}
+	for _, s := range []string{"gpt-5", "=high", "gpt-5=extreme"} {
+		if _, err := ParseReasoningEffortMap(nil, s); err == nil {
+			t.Errorf("ParseReasoningEffortMap(%q): expected an error", s)
+		}
+	}
+}
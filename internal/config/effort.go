@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// reasoningEfforts are the effort levels accepted in per-model overrides.
+var reasoningEfforts = map[string]bool{"minimal": true, "low": true, "medium": true, "high": true, "xhigh": true}
+
+// ParseReasoningEffortMap adds the comma-separated "model=effort" pairs of s
+// (--reasoning-effort-model, CHATGPT_LOCAL_REASONING_BY_MODEL) to dst,
+// allocating it when nil. Model names are matched case-insensitively, and a
+// later pair for the same model replaces an earlier one.
+func ParseReasoningEffortMap(dst map[string]string, s string) (map[string]string, error) {
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, effort, ok := strings.Cut(entry, "=")
+		model = strings.ToLower(strings.TrimSpace(model))
+		effort = strings.ToLower(strings.TrimSpace(effort))
+		if !ok || model == "" {
+			return dst, fmt.Errorf("invalid reasoning effort entry %q; expected model=effort", entry)
+		}
+		if !reasoningEfforts[effort] {
+			return dst, fmt.Errorf("invalid effort in entry %q; expected minimal, low, medium, high or xhigh", entry)
+		}
+		if dst == nil {
+			dst = map[string]string{}
+		}
+		dst[model] = effort
+	}
+	return dst, nil
+}
+
+// ReasoningEffortFor returns the default reasoning effort for model: its
+// --reasoning-effort-model entry when one exists, otherwise the global
+// --reasoning-effort. Request-level reasoning still takes precedence.
+func (c *ServerConfig) ReasoningEffortFor(model string) string {
+	if effort, ok := c.ReasoningEffortByModel[strings.ToLower(strings.TrimSpace(model))]; ok {
+		return effort
+	}
+	return c.ReasoningEffort
+}
+
+// EnvReasoningEffortByModel parses CHATGPT_LOCAL_REASONING_BY_MODEL. On a
+// malformed entry it returns the pairs before it together with the error, so
+// serve can report the problem instead of silently dropping the rest.
+func EnvReasoningEffortByModel() (map[string]string, error) {
+	return ParseReasoningEffortMap(nil, os.Getenv("CHATGPT_LOCAL_REASONING_BY_MODEL"))
+}
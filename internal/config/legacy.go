@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// legacyModelPrefixes match the OpenAI model names that predate the Codex
+// backend and never appear in its registry.
+var legacyModelPrefixes = []string{"gpt-3.5", "gpt-4", "chatgpt-4o", "text-davinci-", "davinci-", "babbage-"}
+
+// IsLegacyModel reports whether name is a well-known legacy OpenAI model
+// such as gpt-3.5-turbo, gpt-4 or gpt-4o. An Ollama ":tag" suffix is ignored.
+func IsLegacyModel(name string) bool {
+	base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(name)), ":")
+	for _, prefix := range legacyModelPrefixes {
+		if strings.HasPrefix(base, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemapLegacyModel replaces a legacy OpenAI model name with
+// --legacy-model-target and returns the deprecation notice to report to the
+// client. Other names, or every name when no target is set, are returned
+// unchanged with an empty notice.
+func (c *ServerConfig) RemapLegacyModel(name string) (model, notice string) {
+	if c.LegacyModelTarget == "" || !IsLegacyModel(name) {
+		return name, ""
+	}
+	return c.LegacyModelTarget, fmt.Sprintf("model %q is deprecated; served by %q instead", strings.TrimSpace(name), c.LegacyModelTarget)
+}
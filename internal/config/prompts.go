@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the embedded prompts that a PromptRule can select.
+const (
+	PromptBase  = "base"
+	PromptCodex = "codex"
+	PromptNone  = "none"
+)
+
+// PromptRule maps a model slug to a named embedded prompt. Pattern matches the
+// slug exactly, or as a prefix when it ends in "*".
+type PromptRule struct {
+	Pattern string
+	Prompt  string
+}
+
+// DefaultPromptRules select the Codex prompt for the Codex model families;
+// anything unmatched gets the base prompt.
+var DefaultPromptRules = []PromptRule{
+	{Pattern: "gpt-5-codex*", Prompt: PromptCodex},
+	{Pattern: "gpt-5.1-codex*", Prompt: PromptCodex},
+	{Pattern: "gpt-5.2-codex*", Prompt: PromptCodex},
+	{Pattern: "gpt-5.3-codex*", Prompt: PromptCodex},
+}
+
+func (r PromptRule) matches(model string) bool {
+	return patternMatches(r.Pattern, model)
+}
+
+// patternMatches reports whether model equals pattern, or starts with it
+// when pattern ends in "*".
+func patternMatches(pattern, model string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(model, prefix)
+	}
+	return model == pattern
+}
+
+// ParsePromptMap parses a --prompt-map value of comma-separated
+// "pattern=prompt" pairs, e.g. "gpt-5-pro=codex,gpt-6*=base".
+func ParsePromptMap(s string) ([]PromptRule, error) {
+	var rules []PromptRule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, prompt, ok := strings.Cut(entry, "=")
+		pattern, prompt = strings.TrimSpace(pattern), strings.ToLower(strings.TrimSpace(prompt))
+		if !ok || pattern == "" || pattern == "*" {
+			return nil, fmt.Errorf("invalid prompt map entry %q; expected pattern=prompt", entry)
+		}
+		switch prompt {
+		case PromptBase, PromptCodex, PromptNone:
+		default:
+			return nil, fmt.Errorf("unknown prompt %q in entry %q; expected base, codex, or none", prompt, entry)
+		}
+		rules = append(rules, PromptRule{Pattern: pattern, Prompt: prompt})
+	}
+	return rules, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Temperature range accepted by the Responses API.
+const (
+	TemperatureMin = 0.0
+	TemperatureMax = 2.0
+)
+
+// TemperatureRule maps a model slug to a sampling temperature. Pattern
+// matches like a PromptRule pattern: exactly, or as a prefix ending in "*".
+type TemperatureRule struct {
+	Pattern string
+	Value   float64
+}
+
+// ParseTemperatureMap parses a --model-temperature-default or
+// --model-temperature-override value of comma-separated "pattern=value"
+// pairs, e.g. "gpt-5=1,gpt-5-codex*=0.2".
+func ParseTemperatureMap(s string) ([]TemperatureRule, error) {
+	var rules []TemperatureRule
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, value, ok := strings.Cut(entry, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" || pattern == "*" {
+			return nil, fmt.Errorf("invalid temperature entry %q; expected pattern=value", entry)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < TemperatureMin || v > TemperatureMax {
+			return nil, fmt.Errorf("invalid temperature in entry %q; expected a number from %g to %g", entry, TemperatureMin, TemperatureMax)
+		}
+		rules = append(rules, TemperatureRule{Pattern: pattern, Value: v})
+	}
+	return rules, nil
+}
+
+// ModelTemperature returns the temperature the proxy sends for model, if
+// any: an override rule always applies, a default rule only when the client
+// set no temperature of its own. Only the /v1/responses passthrough forwards
+// temperature, so it is the only caller.
+func (c *ServerConfig) ModelTemperature(model string, clientSet bool) (float64, bool) {
+	if i := matchTemperatureRule(c.TemperatureOverrides, model); i >= 0 {
+		return c.TemperatureOverrides[i].Value, true
+	}
+	if clientSet {
+		return 0, false
+	}
+	if i := matchTemperatureRule(c.TemperatureDefaults, model); i >= 0 {
+		return c.TemperatureDefaults[i].Value, true
+	}
+	return 0, false
+}
+
+func matchTemperatureRule(rules []TemperatureRule, model string) int {
+	for i, r := range rules {
+		if patternMatches(r.Pattern, model) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,313 @@
+// Package metrics collects request, upstream and token counters and serves
+// them in the Prometheus text exposition format (--enable-metrics).
+//
+// Recording is a no-op until Enable is called, so instrumented code paths cost
+// nothing when metrics are off.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var enabled atomic.Bool
+
+// Enable turns on recording for the process.
+func Enable() { enabled.Store(true) }
+
+// Enabled reports whether metrics are being recorded.
+func Enabled() bool { return enabled.Load() }
+
+// latencyBuckets are the upstream_latency_seconds histogram bounds. Upstream
+// latency is time to response headers, which for reasoning models can run
+// well past the default Prometheus buckets.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var modelLabels = []string{"requested_model", "upstream_model"}
+
+var (
+	requestTotal = newCounter("chatmock_request_total",
+		"Client requests by endpoint and response status.",
+		"endpoint", "status", "requested_model", "upstream_model")
+	upstreamResponses = newCounter("chatmock_upstream_responses_total",
+		"Upstream calls by HTTP status; status \"error\" means no response was received.",
+		"status", "requested_model", "upstream_model")
+	upstreamRetries = newCounter("chatmock_upstream_retries_total",
+		"Upstream retries by strategy (responses_tools, store, truncation, tool_choice, empty_response).",
+		"strategy", "requested_model", "upstream_model")
+	tokensPrompt = newCounter("chatmock_tokens_prompt_total",
+		"Prompt tokens reported by upstream usage.", modelLabels...)
+	tokensCompletion = newCounter("chatmock_tokens_completion_total",
+		"Completion tokens reported by upstream usage.", modelLabels...)
+	upstreamLatency = newHistogram("chatmock_upstream_latency_seconds",
+		"Time from sending an upstream request to receiving its response headers.",
+		latencyBuckets, modelLabels...)
+)
+
+type requestModelsKey struct{}
+
+// requestModels holds the model labels of one client request. Handlers fill
+// it in once the model is resolved; upstream calls made later read it.
+type requestModels struct {
+	mu        sync.Mutex
+	requested string
+	upstream  string
+}
+
+// WithRequest returns a context that carries the model labels for one client
+// request, to be set with SetModels.
+func WithRequest(ctx context.Context) context.Context {
+	if !Enabled() || ctx.Value(requestModelsKey{}) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, requestModelsKey{}, &requestModels{})
+}
+
+// OtherModel is the model label for requests whose model did not pass
+// validation and for requested names that are not a spelling of the upstream
+// model, so label cardinality is bounded by the model registry rather than by
+// client input.
+const OtherModel = "other"
+
+// modelEfforts are the reasoning-effort suffixes a requested model name may
+// carry on top of its upstream model (gpt-5-high, gpt-5:low).
+var modelEfforts = []string{"minimal", "low", "medium", "high", "xhigh"}
+
+// SetModels records the client-requested model and the normalized upstream
+// model for the request carried by ctx. validated reports whether upstream
+// passed the registry check (or is the configured debug model); unvalidated
+// requests are labelled OtherModel for both.
+func SetModels(ctx context.Context, requested, upstream string, validated bool) {
+	m, ok := ctx.Value(requestModelsKey{}).(*requestModels)
+	if !ok {
+		return
+	}
+	if !validated {
+		requested, upstream = OtherModel, OtherModel
+	} else {
+		requested = requestedLabel(requested, upstream)
+	}
+	m.mu.Lock()
+	m.requested, m.upstream = requested, upstream
+	m.mu.Unlock()
+}
+
+// requestedLabel keeps requested only when it names upstream, optionally with
+// a reasoning-effort suffix; anything else becomes OtherModel.
+func requestedLabel(requested, upstream string) string {
+	name := strings.ToLower(strings.TrimSpace(requested))
+	if name == strings.ToLower(upstream) {
+		return name
+	}
+	for _, sep := range []string{"-", "_", ":"} {
+		for _, effort := range modelEfforts {
+			if name == strings.ToLower(upstream)+sep+effort {
+				return name
+			}
+		}
+	}
+	return OtherModel
+}
+
+func models(ctx context.Context) (requested, upstream string) {
+	m, ok := ctx.Value(requestModelsKey{}).(*requestModels)
+	if !ok {
+		return "", ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requested, m.upstream
+}
+
+// ObserveRequest counts a finished client request.
+func ObserveRequest(ctx context.Context, endpoint string, status int) {
+	if !Enabled() {
+		return
+	}
+	requested, upstream := models(ctx)
+	requestTotal.add(1, endpoint, strconv.Itoa(status), requested, upstream)
+}
+
+// ObserveUpstream records one physical upstream call: its latency and status.
+// status 0 means the call failed before a response arrived.
+func ObserveUpstream(ctx context.Context, status int, latency time.Duration) {
+	if !Enabled() {
+		return
+	}
+	requested, upstream := models(ctx)
+	code := "error"
+	if status > 0 {
+		code = strconv.Itoa(status)
+	}
+	upstreamResponses.add(1, code, requested, upstream)
+	upstreamLatency.observe(latency.Seconds(), requested, upstream)
+}
+
+// ObserveRetry counts an upstream retry made by the named strategy.
+func ObserveRetry(ctx context.Context, strategy string) {
+	if !Enabled() {
+		return
+	}
+	requested, upstream := models(ctx)
+	upstreamRetries.add(1, strategy, requested, upstream)
+}
+
+// ObserveTokens adds upstream-reported token usage.
+func ObserveTokens(ctx context.Context, prompt, completion int) {
+	if !Enabled() {
+		return
+	}
+	requested, upstream := models(ctx)
+	if prompt > 0 {
+		tokensPrompt.add(float64(prompt), requested, upstream)
+	}
+	if completion > 0 {
+		tokensCompletion.add(float64(completion), requested, upstream)
+	}
+}
+
+// Handler serves GET /metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+}
+
+// WriteText writes every metric in the Prometheus text exposition format.
+func WriteText(w io.Writer) {
+	requestTotal.write(w)
+	upstreamResponses.write(w)
+	upstreamLatency.write(w)
+	upstreamRetries.write(w)
+	tokensPrompt.write(w)
+	tokensCompletion.write(w)
+}
+
+type counter struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	return &counter{name: name, help: help, labels: labels, values: map[string]float64{}}
+}
+
+func (c *counter) add(v float64, values ...string) {
+	key := labelString(c.labels, values)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s{%s} %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	name, help string
+	labels     []string
+	bounds     []float64
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	buckets []uint64 // cumulative counts per bound
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(name, help string, bounds []float64, labels ...string) *histogram {
+	return &histogram{name: name, help: help, labels: labels, bounds: bounds, series: map[string]*histogramSeries{}}
+}
+
+func (h *histogram) observe(v float64, values ...string) {
+	key := labelString(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{buckets: make([]uint64, len(h.bounds))}
+		h.series[key] = s
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", h.name, key, formatFloat(bound), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, key, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, key, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, key, s.count)
+	}
+}
+
+// labelString renders name="value" pairs; it doubles as the series key.
+func labelString(names, values []string) string {
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
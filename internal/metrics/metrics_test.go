@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTextFormatsSeries(t *testing.T) {
+	c := newCounter("test_total", "Test counter.", "endpoint", "requested_model")
+	c.add(1, "/v1/chat/completions", `odd"model`)
+	c.add(2, "/v1/chat/completions", `odd"model`)
+	h := newHistogram("test_seconds", "Test histogram.", []float64{0.5, 1}, "upstream_model")
+	h.observe(0.2, "gpt-5")
+	h.observe(3, "gpt-5")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	h.write(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_total counter\n",
+		`test_total{endpoint="/v1/chat/completions",requested_model="odd\"model"} 3` + "\n",
+		"# TYPE test_seconds histogram\n",
+		`test_seconds_bucket{upstream_model="gpt-5",le="0.5"} 1` + "\n",
+		`test_seconds_bucket{upstream_model="gpt-5",le="1"} 1` + "\n",
+		`test_seconds_bucket{upstream_model="gpt-5",le="+Inf"} 2` + "\n",
+		`test_seconds_sum{upstream_model="gpt-5"} 3.2` + "\n",
+		`test_seconds_count{upstream_model="gpt-5"} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestObserveUsesRequestModels(t *testing.T) {
+	Enable()
+	ctx := WithRequest(context.Background())
+	SetModels(ctx, "gpt-5-high", "gpt-5-metrics-test", true)
+	ObserveRetry(ctx, "store")
+	ObserveUpstream(ctx, 0, 10*time.Millisecond)
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		`chatmock_upstream_retries_total{strategy="store",requested_model="other",upstream_model="gpt-5-metrics-test"}`,
+		`chatmock_upstream_responses_total{status="error",requested_model="other",upstream_model="gpt-5-metrics-test"}`,
+		`chatmock_upstream_latency_seconds_count{requested_model="other",upstream_model="gpt-5-metrics-test"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSetModelsBoundsLabels(t *testing.T) {
+	Enable()
+	for _, tc := range []struct {
+		requested, upstream string
+		validated           bool
+		wantRequested       string
+		wantUpstream        string
+	}{
+		{"gpt-5", "gpt-5", true, "gpt-5", "gpt-5"},
+		{"GPT-5-High", "gpt-5", true, "gpt-5-high", "gpt-5"},
+		{"gpt-5:low", "gpt-5", true, "gpt-5:low", "gpt-5"},
+		{"claude-sonnet-4-5-20250929", "gpt-5", true, OtherModel, "gpt-5"},
+		{"made-up-model-123", "made-up-model-123", false, OtherModel, OtherModel},
+	} {
+		ctx := WithRequest(context.Background())
+		SetModels(ctx, tc.requested, tc.upstream, tc.validated)
+		requested, upstream := models(ctx)
+		if requested != tc.wantRequested || upstream != tc.wantUpstream {
+			t.Errorf("SetModels(%q, %q, %v) labels = %q, %q; want %q, %q",
+				tc.requested, tc.upstream, tc.validated, requested, upstream, tc.wantRequested, tc.wantUpstream)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/config"
+)
 
 // DefaultModel is the canonical model name used when the client does not
 // specify one. Centralised here so all fallback paths reference a single value.
@@ -71,10 +75,10 @@ var modelMapping = map[string]string{
 	"gpt-5.1-codex-mini":   "gpt-5.1-codex-mini",
 }
 
-var effortSuffixes = []string{"minimal", "low", "medium", "high", "xhigh"}
-
-// NormalizeModelName maps model aliases to canonical names and strips effort suffixes.
-func NormalizeModelName(name, debugModel string) string {
+// NormalizeModelName maps model aliases to canonical names and strips the
+// effort suffix from variant slugs of the available models (see
+// SplitEffortVariant).
+func NormalizeModelName(name, debugModel string, available []RemoteModel) string {
 	if debugModel != "" {
 		return strings.TrimSpace(debugModel)
 	}
@@ -82,24 +86,52 @@ func NormalizeModelName(name, debugModel string) string {
 		return DefaultModel
 	}
 	base := strings.TrimSpace(strings.SplitN(name, ":", 2)[0])
+	base, _ = SplitEffortVariant(base, available)
+
+	if mapped, ok := modelMapping[base]; ok {
+		return mapped
+	}
+	return base
+}
 
-	// Strip effort suffixes
-	lowered := strings.ToLower(base)
+// SplitEffortVariant splits an effort-variant slug such as "gpt-5-high" or
+// "gpt-5_medium" into its base model and effort. The suffix is only split
+// when the base (or its alias target) is an available model that lists the
+// effort among its supported reasoning levels, so a model whose real name
+// merely ends in a level-like token is returned unchanged with no effort.
+func SplitEffortVariant(name string, available []RemoteModel) (base, effort string) {
+	lowered := strings.ToLower(name)
 	for _, sep := range []string{"-", "_"} {
-		for _, effort := range effortSuffixes {
-			suffix := sep + effort
-			if strings.HasSuffix(lowered, suffix) {
-				base = base[:len(base)-len(suffix)]
-				lowered = strings.ToLower(base)
-				break
-			}
+		idx := strings.LastIndex(lowered, sep)
+		if idx <= 0 {
+			continue
+		}
+		candidate, suffix := name[:idx], lowered[idx+1:]
+		if supportsEffort(available, candidate, suffix) {
+			return candidate, suffix
 		}
 	}
+	return name, ""
+}
 
+func supportsEffort(available []RemoteModel, base, effort string) bool {
+	slugs := []string{strings.ToLower(base)}
 	if mapped, ok := modelMapping[base]; ok {
-		return mapped
+		slugs = append(slugs, mapped)
 	}
-	return base
+	for _, m := range available {
+		for _, slug := range slugs {
+			if !strings.EqualFold(m.Slug, slug) {
+				continue
+			}
+			for _, lvl := range m.SupportedReasoningLevels {
+				if strings.EqualFold(lvl.Effort, effort) {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
 
 // AllowedEfforts returns the set of valid reasoning effort levels for a model.
@@ -110,13 +142,22 @@ func NormalizeModelName(name, debugModel string) string {
 // The restricted sets per model reflect actual upstream support: gpt-5.1 does
 // not accept "minimal" or "xhigh", while gpt-5.2 drops "minimal". Sending an
 // unsupported effort level causes the upstream to return a 400 error.
-func AllowedEfforts(model string) map[string]bool {
+// A --capabilities-file reasoning_levels entry in caps replaces these.
+func AllowedEfforts(model string, caps config.CapabilityTable) map[string]bool {
 	base := strings.ToLower(strings.TrimSpace(model))
 	if base == "" {
 		return defaultEfforts()
 	}
 	normalized := strings.SplitN(base, ":", 2)[0]
 
+	if levels := caps.For(normalized).ReasoningLevels; len(levels) > 0 {
+		allowed := make(map[string]bool, len(levels))
+		for _, lvl := range levels {
+			allowed[lvl] = true
+		}
+		return allowed
+	}
+
 	if strings.HasPrefix(normalized, "gpt-5.2") {
 		return map[string]bool{"low": true, "medium": true, "high": true, "xhigh": true}
 	}
@@ -1,6 +1,10 @@
 package models
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/config"
+)
 
 func TestNormalizeModelName(t *testing.T) {
 	tests := []struct {
@@ -30,7 +34,7 @@ func TestNormalizeModelName(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NormalizeModelName(tt.input, tt.debugModel)
+			got := NormalizeModelName(tt.input, tt.debugModel, StaticFallback())
 			if got != tt.want {
 				t.Errorf("NormalizeModelName(%q, %q) = %q, want %q", tt.input, tt.debugModel, got, tt.want)
 			}
@@ -38,6 +42,40 @@ func TestNormalizeModelName(t *testing.T) {
 	}
 }
 
+func TestSplitEffortVariant(t *testing.T) {
+	available := []RemoteModel{
+		{Slug: "gpt-5", SupportedReasoningLevels: []ReasoningLevel{{Effort: "low"}, {Effort: "high"}}},
+		{Slug: "gpt-5.1-codex-mini"},
+	}
+	tests := []struct {
+		input      string
+		wantBase   string
+		wantEffort string
+		wantNorm   string
+	}{
+		{"gpt-5-high", "gpt-5", "high", "gpt-5"},
+		{"gpt5-low", "gpt5", "low", "gpt-5"},
+		{"gpt-5_high", "gpt-5", "high", "gpt-5"},
+		// gpt-5 does not advertise minimal, so this is not a variant.
+		{"gpt-5-minimal", "gpt-5-minimal", "", "gpt-5-minimal"},
+		// A real model name that happens to end in a level token.
+		{"o4-mini-high", "o4-mini-high", "", "o4-mini-high"},
+		{"gpt-5.1-codex-mini-high", "gpt-5.1-codex-mini-high", "", "gpt-5.1-codex-mini-high"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			base, effort := SplitEffortVariant(tt.input, available)
+			if base != tt.wantBase || effort != tt.wantEffort {
+				t.Errorf("SplitEffortVariant(%q) = (%q, %q), want (%q, %q)", tt.input, base, effort, tt.wantBase, tt.wantEffort)
+			}
+			if got := NormalizeModelName(tt.input, "", available); got != tt.wantNorm {
+				t.Errorf("NormalizeModelName(%q) = %q, want %q", tt.input, got, tt.wantNorm)
+			}
+		})
+	}
+}
+
 func TestAllowedEfforts(t *testing.T) {
 	tests := []struct {
 		model    string
@@ -52,7 +90,7 @@ func TestAllowedEfforts(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.model, func(t *testing.T) {
-			efforts := AllowedEfforts(tt.model)
+			efforts := AllowedEfforts(tt.model, nil)
 			for _, e := range tt.contains {
 				if !efforts[e] {
 					t.Errorf("AllowedEfforts(%q) should contain %q", tt.model, e)
@@ -67,6 +105,31 @@ func TestAllowedEfforts(t *testing.T) {
 	}
 }
 
+func TestCapabilitiesOverrideReasoningLevels(t *testing.T) {
+	caps := config.CapabilityTable{"gpt-5.1": {ReasoningLevels: []string{"high"}}}
+	if got := AllowedEfforts("gpt-5.1", caps); len(got) != 1 || !got["high"] {
+		t.Errorf("AllowedEfforts(gpt-5.1): got %v, want only high", got)
+	}
+	if got := AllowedEfforts("gpt-5.2", caps); !got["xhigh"] || got["minimal"] {
+		t.Errorf("AllowedEfforts(gpt-5.2) should keep the static default, got %v", got)
+	}
+
+	r := &Registry{Capabilities: caps, models: []RemoteModel{
+		{Slug: "gpt-5.1", SupportedReasoningLevels: []ReasoningLevel{{Effort: "low"}, {Effort: "medium"}}},
+		{Slug: "gpt-5", SupportedReasoningLevels: []ReasoningLevel{{Effort: "low"}}},
+	}}
+	mods := r.Cached()
+	if levels := mods[0].SupportedReasoningLevels; len(levels) != 1 || levels[0].Effort != "high" {
+		t.Errorf("Cached should apply the capabilities levels, got %v", levels)
+	}
+	if levels := r.models[0].SupportedReasoningLevels; len(levels) != 2 {
+		t.Errorf("the registry's own list must stay untouched, got %v", levels)
+	}
+	if base, effort := SplitEffortVariant("gpt-5.1-high", mods); base != "gpt-5.1" || effort != "high" {
+		t.Errorf("SplitEffortVariant(gpt-5.1-high) = %q, %q; want the capabilities level", base, effort)
+	}
+}
+
 func TestModelCatalog(t *testing.T) {
 	ids := ModelCatalog(false)
 	if len(ids) != 10 {
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -8,8 +9,10 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/n0madic/go-chatmock/internal/auth"
@@ -19,6 +22,10 @@ import (
 // cacheTTL is how long to cache the remote model list before background refresh.
 const cacheTTL = 5 * time.Minute
 
+// startupRetryInterval spaces the background fetches retried while the
+// registry is still empty after the blocking first fetch failed.
+const startupRetryInterval = 30 * time.Second
+
 // ReasoningLevel represents a supported reasoning effort level for a model.
 type ReasoningLevel struct {
 	Effort      string `json:"effort"`
@@ -62,6 +69,24 @@ type Registry struct {
 	models    []RemoteModel
 	lastFetch time.Time
 	etag      string
+
+	// authRefreshPending coalesces auth-change refreshes queued behind fetchMu.
+	authRefreshPending atomic.Bool
+
+	// startupFailed records that the blocking first fetch failed, so later
+	// calls on an empty registry return the fallback at once while
+	// startupRetrying coalesces the background retries.
+	startupFailed   atomic.Bool
+	startupRetrying atomic.Bool
+
+	// StartupTimeout bounds the synchronous fetch made when the registry is
+	// still empty; on expiry GetModels falls back to the disk cache or static
+	// catalog (--startup-timeout). Zero waits indefinitely.
+	StartupTimeout time.Duration
+
+	// Capabilities replaces the reasoning levels of the models it lists in
+	// everything GetModels, Refresh and Cached return (--capabilities-file).
+	Capabilities config.CapabilityTable
 }
 
 // modelsCachePath is a function variable so tests can override where warm cache
@@ -82,17 +107,24 @@ var modelsCachePath = func() string {
 	return filepath.Join(home, ".codex", "models_cache.json")
 }
 
+// modelsHTTPClient performs the models fetch; tests replace it to simulate an
+// unhealthy upstream.
+var modelsHTTPClient = http.DefaultClient
+
 // NewRegistry creates a model registry backed by the given token manager and
 // preloads models from a local Codex cache file when available.
 func NewRegistry(tm *auth.TokenManager) *Registry {
 	r := &Registry{tm: tm}
-	loaded, missing := r.loadFromDiskCache()
-	if !loaded && missing && tm != nil {
+	if tm != nil {
+		tm.OnAuthChange(r.refreshAfterAuthChange)
+	}
+	loaded, rebuild := r.loadFromDiskCache()
+	if !loaded && rebuild && tm != nil {
 		go func() {
 			r.fetchMu.Lock()
 			defer r.fetchMu.Unlock()
-			if err := r.doFetch(); err != nil {
-				slog.Warn("initial models refresh failed after missing cache", "error", err)
+			if err := r.doFetch(context.Background()); err != nil {
+				slog.Warn("initial models refresh failed after missing or corrupt cache", "error", err)
 			}
 		}()
 	}
@@ -101,34 +133,38 @@ func NewRegistry(tm *auth.TokenManager) *Registry {
 
 // GetModels returns the cached remote model list, refreshing if needed.
 // If no cache is available, first call blocks to fetch. On stale cache, refreshes
-// in background and returns the cached value immediately. Falls back to the static
-// catalog if the remote fetch fails or produces an empty list.
+// in background and returns the cached value immediately. If the remote fetch
+// fails, the disk cache is used even when stale, then the static catalog;
+// while the registry stays empty, later calls return that fallback at once and
+// retry the fetch in the background.
 func (r *Registry) GetModels() []RemoteModel {
+	return r.withCapabilities(r.getModels())
+}
+
+func (r *Registry) getModels() []RemoteModel {
 	r.mu.RLock()
 	age := time.Since(r.lastFetch)
 	cached := r.models
 	r.mu.RUnlock()
 
 	if len(cached) == 0 {
+		if r.startupFailed.Load() {
+			r.retryStartupFetch()
+			return r.fallbackModels()
+		}
 		// First call — synchronous fetch with deduplication.
 		r.fetchMu.Lock()
 		r.mu.RLock()
 		cached = r.models
 		r.mu.RUnlock()
-		if len(cached) == 0 {
-			if err := r.doFetch(); err != nil {
-				slog.Warn("models fetch failed, using static fallback", "error", err)
+		if len(cached) == 0 && !r.startupFailed.Load() {
+			if err := r.startupFetch(); err != nil {
+				slog.Warn("models fetch failed, using cached or static fallback", "error", err)
+				r.startupFailed.Store(true)
 			}
-			r.mu.RLock()
-			cached = r.models
-			r.mu.RUnlock()
 		}
 		r.fetchMu.Unlock()
-
-		if len(cached) == 0 {
-			return StaticFallback()
-		}
-		return cached
+		return r.fallbackModels()
 	}
 
 	if age >= cacheTTL {
@@ -136,7 +172,7 @@ func (r *Registry) GetModels() []RemoteModel {
 		go func() {
 			r.fetchMu.Lock()
 			defer r.fetchMu.Unlock()
-			if err := r.doFetch(); err != nil {
+			if err := r.doFetch(context.Background()); err != nil {
 				slog.Warn("background models refresh failed", "error", err)
 			}
 		}()
@@ -145,19 +181,136 @@ func (r *Registry) GetModels() []RemoteModel {
 	return cached
 }
 
+// fallbackModels returns the models in memory or the disk cache, else the
+// static catalog.
+func (r *Registry) fallbackModels() []RemoteModel {
+	if mods := r.modelsOrDiskCache(); len(mods) > 0 {
+		return mods
+	}
+	return StaticFallback()
+}
+
+// retryStartupFetch retries the failed first fetch in the background, at most
+// one at a time and no more often than startupRetryInterval.
+func (r *Registry) retryStartupFetch() {
+	if !r.startupRetrying.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		r.fetchMu.Lock()
+		err := r.doFetch(context.Background())
+		r.fetchMu.Unlock()
+		if err == nil {
+			r.startupRetrying.Store(false)
+			return
+		}
+		slog.Warn("models fetch retry failed", "error", err)
+		time.AfterFunc(startupRetryInterval, func() { r.startupRetrying.Store(false) })
+	}()
+}
+
+// startupFetch runs the blocking first fetch, bounded by StartupTimeout.
+// Caller must hold fetchMu.
+func (r *Registry) startupFetch() error {
+	ctx := context.Background()
+	if r.StartupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.StartupTimeout)
+		defer cancel()
+	}
+	return r.doFetch(ctx)
+}
+
 // Refresh forces an immediate synchronous fetch and returns the result.
-// Returns the fetched models on success, or the static fallback on error.
+// Returns the fetched models on success; on error, the last-known models from
+// memory or disk, or the static fallback.
 func (r *Registry) Refresh() ([]RemoteModel, error) {
 	r.fetchMu.Lock()
 	defer r.fetchMu.Unlock()
-	err := r.doFetch()
+	err := r.doFetch(context.Background())
+	result := r.modelsOrDiskCache()
+	if len(result) == 0 {
+		return r.withCapabilities(StaticFallback()), err
+	}
+	return r.withCapabilities(result), err
+}
+
+// refreshAfterAuthChange refetches the model list when the credentials switch
+// to another account, whose entitlements may differ. The fetch goes through
+// fetchMu like every other, and changes arriving while one is already queued
+// are coalesced into it.
+func (r *Registry) refreshAfterAuthChange() {
+	if !r.authRefreshPending.CompareAndSwap(false, true) {
+		return
+	}
+	r.fetchMu.Lock()
+	defer r.fetchMu.Unlock()
+	r.authRefreshPending.Store(false)
+
+	// The ETag belongs to the previous account's list.
+	r.mu.Lock()
+	r.etag = ""
+	r.mu.Unlock()
+	if err := r.doFetch(context.Background()); err != nil {
+		slog.Warn("models refresh after auth change failed", "error", err)
+	}
+}
+
+// modelsOrDiskCache returns the in-memory models, reloading the disk cache
+// when memory is empty (e.g. the cache was written after startup). Caller
+// must hold fetchMu.
+func (r *Registry) modelsOrDiskCache() []RemoteModel {
 	r.mu.RLock()
-	result := r.models
+	mods := r.models
 	r.mu.RUnlock()
-	if len(result) == 0 {
-		return StaticFallback(), err
+	if len(mods) > 0 {
+		return mods
+	}
+	if loaded, _ := r.loadFromDiskCache(); !loaded {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.models
+}
+
+// Cached returns the models already held in memory, or the static catalog
+// when the registry is empty or nil. Unlike GetModels it never fetches, so it
+// is safe on the request path for model-name parsing.
+func (r *Registry) Cached() []RemoteModel {
+	if r == nil {
+		return StaticFallback()
+	}
+	r.mu.RLock()
+	mods := r.models
+	r.mu.RUnlock()
+	if len(mods) == 0 {
+		mods = StaticFallback()
+	}
+	return r.withCapabilities(mods)
+}
+
+// withCapabilities returns mods with the reasoning levels of r.Capabilities
+// applied, copying the list only when an entry changes it.
+func (r *Registry) withCapabilities(mods []RemoteModel) []RemoteModel {
+	var out []RemoteModel
+	for i, m := range mods {
+		levels := r.Capabilities.For(m.Slug).ReasoningLevels
+		if len(levels) == 0 {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(mods)
+		}
+		out[i].SupportedReasoningLevels = make([]ReasoningLevel, 0, len(levels))
+		for _, lvl := range levels {
+			out[i].SupportedReasoningLevels = append(out[i].SupportedReasoningLevels, ReasoningLevel{Effort: lvl})
+		}
+	}
+	if out == nil {
+		return mods
 	}
-	return result, err
+	return out
 }
 
 // IsPopulated reports whether the registry has remote data (not just static fallback).
@@ -197,14 +350,14 @@ func (r *Registry) IsKnownModel(slug string) (bool, string) {
 
 // doFetch performs the actual HTTP GET to the models endpoint with ETag caching.
 // Caller must hold fetchMu.
-func (r *Registry) doFetch() error {
+func (r *Registry) doFetch(ctx context.Context) error {
 	accessToken, accountID, err := r.tm.GetEffectiveAuth()
 	if err != nil || accessToken == "" {
 		return fmt.Errorf("no credentials available")
 	}
 
 	url := fmt.Sprintf("%s?client_version=%s", config.ModelsURL, config.CodexClientVersion)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
@@ -221,7 +374,7 @@ func (r *Registry) doFetch() error {
 		req.Header.Set("If-None-Match", etag)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := modelsHTTPClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("models fetch failed: %w", err)
 	}
@@ -249,6 +402,11 @@ func (r *Registry) doFetch() error {
 		return fmt.Errorf("failed to parse models response: %w", err)
 	}
 
+	if len(mr.Models) == 0 {
+		// Keep the last-known list rather than replacing it with nothing.
+		return fmt.Errorf("models endpoint returned an empty list")
+	}
+
 	newEtag := resp.Header.Get("ETag")
 
 	r.mu.Lock()
@@ -294,7 +452,10 @@ func (r *Registry) saveToDiskCache() {
 	}
 }
 
-func (r *Registry) loadFromDiskCache() (loaded bool, missing bool) {
+// loadFromDiskCache loads the warm cache into memory. rebuild reports that the
+// file is missing or was corrupt (and has been moved aside), so a fetch
+// should recreate it.
+func (r *Registry) loadFromDiskCache() (loaded bool, rebuild bool) {
 	path := modelsCachePath()
 	if path == "" {
 		return false, true
@@ -310,7 +471,8 @@ func (r *Registry) loadFromDiskCache() (loaded bool, missing bool) {
 
 	var cache diskModelsCache
 	if err := json.Unmarshal(data, &cache); err != nil {
-		return false, false
+		quarantineCorruptCache(path, err)
+		return false, true
 	}
 	if len(cache.Models) == 0 {
 		return false, false
@@ -335,6 +497,20 @@ func (r *Registry) loadFromDiskCache() (loaded bool, missing bool) {
 	return true, false
 }
 
+// quarantineCorruptCache renames an unparseable cache file to <path>.corrupt
+// (removing it if the rename fails) so it is rebuilt by the next fetch.
+func quarantineCorruptCache(path string, cause error) {
+	aside := path + ".corrupt"
+	if err := os.Rename(path, aside); err != nil {
+		if rmErr := os.Remove(path); rmErr != nil {
+			slog.Warn("models cache is corrupt and could not be removed", "path", path, "error", cause, "remove_error", rmErr)
+			return
+		}
+		aside = ""
+	}
+	slog.Warn("models cache is corrupt; rebuilding from upstream", "path", path, "moved_to", aside, "error", cause)
+}
+
 // StaticFallback converts the static catalog to a []RemoteModel slice.
 // It is used when credentials are unavailable or the upstream is unreachable,
 // so the /v1/models endpoint and model validation still return useful results
@@ -2,10 +2,17 @@ package models
 
 import (
 	"encoding/json"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/n0madic/go-chatmock/internal/auth"
 )
 
 func TestNewRegistryLoadsDiskCache(t *testing.T) {
@@ -110,3 +117,233 @@ func TestNewRegistryIgnoresInvalidDiskCache(t *testing.T) {
 		t.Fatal("expected empty registry for invalid cache JSON")
 	}
 }
+
+type statusTransport struct {
+	status int
+	body   string
+}
+
+func (s statusTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: s.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(s.body)),
+		Request:    r,
+	}, nil
+}
+
+func TestGetModelsFallsBackToStaleDiskCacheWhenLiveFetchFails(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "models_cache.json")
+	origPath, origClient := modelsCachePath, modelsHTTPClient
+	modelsCachePath = func() string { return path }
+	defer func() { modelsCachePath, modelsHTTPClient = origPath, origClient }()
+
+	for _, tt := range []struct {
+		name      string
+		transport statusTransport
+	}{
+		{name: "server error", transport: statusTransport{status: http.StatusServiceUnavailable, body: `{"detail":"down"}`}},
+		{name: "empty list", transport: statusTransport{status: http.StatusOK, body: `{"models":[]}`}},
+	} {
+		// A week-old cache written after the registry started.
+		stale := `{"fetched_at":"` + time.Now().Add(-7*24*time.Hour).UTC().Format(time.RFC3339Nano) + `","models":[{"slug":"gpt-disk","visibility":"list"}]}`
+		if err := os.WriteFile(path, []byte(stale), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		modelsHTTPClient = &http.Client{Transport: tt.transport}
+		r := &Registry{tm: auth.NewTokenManager("", "")}
+
+		mods := r.GetModels()
+		if len(mods) != 1 || mods[0].Slug != "gpt-disk" {
+			t.Errorf("%s: GetModels got %+v, want the disk cache model", tt.name, mods)
+		}
+		if mods, err := r.Refresh(); err == nil || len(mods) != 1 || mods[0].Slug != "gpt-disk" {
+			t.Errorf("%s: Refresh got %+v (err %v), want disk cache model and an error", tt.name, mods, err)
+		}
+	}
+}
+
+func TestNewRegistryRebuildsCorruptDiskCache(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "models_cache.json")
+	origPath, origClient := modelsCachePath, modelsHTTPClient
+	modelsCachePath = func() string { return path }
+	modelsHTTPClient = &http.Client{Transport: statusTransport{status: http.StatusOK, body: `{"models":[{"slug":"gpt-live","visibility":"list"}]}`}}
+	defer func() { modelsCachePath, modelsHTTPClient = origPath, origClient }()
+
+	if err := os.WriteFile(path, []byte(`{"fetched_at":"2025-01-01T00:00:00Z","models":[{"slug":`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r := NewRegistry(auth.NewTokenManager("", ""))
+	deadline := time.Now().Add(2 * time.Second)
+	for !r.IsPopulated() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !r.IsPopulated() {
+		t.Fatal("expected a background fetch to repopulate the registry")
+	}
+	r.fetchMu.Lock() // wait for the fetch goroutine to finish writing the cache
+	r.fetchMu.Unlock()
+
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("corrupt cache should be moved aside: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "gpt-live") {
+		t.Errorf("cache should be rebuilt from the fetch, got %q (err %v)", data, err)
+	}
+}
+
+type countingTransport struct {
+	calls atomic.Int32
+	body  string
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.calls.Add(1)
+	return statusTransport{status: http.StatusOK, body: c.body}.RoundTrip(r)
+}
+
+func TestAuthChangeTriggersSingleRefresh(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok-a", AccountID: "acct-a"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	origPath, origClient := modelsCachePath, modelsHTTPClient
+	modelsCachePath = func() string { return "" }
+	transport := &countingTransport{body: `{"models":[{"slug":"gpt-new-account","visibility":"list"}]}`}
+	modelsHTTPClient = &http.Client{Transport: transport}
+	defer func() { modelsCachePath, modelsHTTPClient = origPath, origClient }()
+
+	tm := auth.NewTokenManager("", "")
+	r := &Registry{tm: tm, models: []RemoteModel{{Slug: "gpt-old-account"}}, lastFetch: time.Now()}
+	tm.OnAuthChange(r.refreshAfterAuthChange)
+
+	if _, _, err := tm.GetEffectiveAuth(); err != nil {
+		t.Fatalf("GetEffectiveAuth: %v", err)
+	}
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok-b", AccountID: "acct-b"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var changes atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, changed, _ := tm.Reload(); changed {
+				changes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := changes.Load(); got != 1 {
+		t.Fatalf("Reload reported the account change %d times, want 1", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for transport.calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	r.fetchMu.Lock()
+	r.fetchMu.Unlock()
+
+	if got := transport.calls.Load(); got != 1 {
+		t.Fatalf("models fetches after auth change: got %d, want 1", got)
+	}
+	if mods := r.GetModels(); len(mods) != 1 || mods[0].Slug != "gpt-new-account" {
+		t.Errorf("registry should hold the new account's models, got %+v", mods)
+	}
+}
+
+// hangingTransport blocks until the request context is cancelled.
+type hangingTransport struct{}
+
+func (hangingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+}
+
+func TestStartupTimeoutFallsBackToStaticModels(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	origPath, origClient := modelsCachePath, modelsHTTPClient
+	modelsCachePath = func() string { return filepath.Join(t.TempDir(), "models_cache.json") }
+	modelsHTTPClient = &http.Client{Transport: hangingTransport{}}
+	defer func() { modelsCachePath, modelsHTTPClient = origPath, origClient }()
+
+	r := &Registry{tm: auth.NewTokenManager("", ""), StartupTimeout: 50 * time.Millisecond}
+	done := make(chan []RemoteModel, 1)
+	go func() { done <- r.GetModels() }()
+	select {
+	case mods := <-done:
+		if len(mods) != len(StaticFallback()) || r.IsPopulated() {
+			t.Errorf("expected the static fallback, got %d models (populated %v)", len(mods), r.IsPopulated())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetModels did not return within the startup timeout")
+	}
+}
+
+// flakyTransport fails every models fetch until healthy is set.
+type flakyTransport struct {
+	calls   atomic.Int32
+	healthy atomic.Bool
+}
+
+func (f *flakyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.calls.Add(1)
+	if f.healthy.Load() {
+		return statusTransport{status: http.StatusOK, body: `{"models":[{"slug":"gpt-live","visibility":"list"}]}`}.RoundTrip(r)
+	}
+	return statusTransport{status: http.StatusServiceUnavailable, body: `{"detail":"down"}`}.RoundTrip(r)
+}
+
+func TestFailedStartupFetchRetriesInBackground(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	origPath, origClient := modelsCachePath, modelsHTTPClient
+	modelsCachePath = func() string { return "" }
+	transport := &flakyTransport{}
+	modelsHTTPClient = &http.Client{Transport: transport}
+	defer func() { modelsCachePath, modelsHTTPClient = origPath, origClient }()
+
+	r := &Registry{tm: auth.NewTokenManager("", "")}
+	if mods := r.GetModels(); len(mods) != len(StaticFallback()) || transport.calls.Load() != 1 {
+		t.Fatalf("first call: got %d models after %d fetches, want the static fallback after 1", len(mods), transport.calls.Load())
+	}
+
+	// Later calls answer at once and share a single background retry.
+	transport.healthy.Store(true)
+	for range 5 {
+		if mods := r.GetModels(); len(mods) == 0 {
+			t.Fatal("GetModels returned no models while retrying")
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !r.IsPopulated() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.fetchMu.Lock()
+	r.fetchMu.Unlock()
+	if got := transport.calls.Load(); got != 2 {
+		t.Errorf("models fetches: got %d, want the failed first fetch and one retry", got)
+	}
+	if mods := r.GetModels(); len(mods) != 1 || mods[0].Slug != "gpt-live" {
+		t.Errorf("registry should hold the retried fetch, got %+v", mods)
+	}
+}
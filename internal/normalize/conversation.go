@@ -1,6 +1,9 @@
 package normalize
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 // ExtractConversationID reads a stable conversation identifier from the request payload.
 func ExtractConversationID(raw map[string]any) string {
@@ -21,3 +24,21 @@ func ExtractConversationID(raw map[string]any) string {
 	}
 	return ""
 }
+
+// ExtractMetadata returns the request's metadata object as strings, the form
+// OpenAI stores and filters by. Non-string values are formatted with %v.
+func ExtractMetadata(raw map[string]any) map[string]string {
+	md, ok := raw["metadata"].(map[string]any)
+	if !ok || len(md) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(md))
+	for k, v := range md {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		} else if v != nil {
+			out[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return out
+}
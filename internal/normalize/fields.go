@@ -0,0 +1,82 @@
+package normalize
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/stream"
+)
+
+// knownRequestFields lists the top-level chat and Responses request fields
+// the proxy handles, maps, or deliberately drops. Anything else is reported by
+// UnknownFields so OpenAI API additions show up in verbose logs.
+var knownRequestFields = map[string]bool{
+	// Shared
+	"model": true, "stream": true, "stream_options": true, "tools": true, "tool_choice": true,
+	"parallel_tool_calls": true, "reasoning": true, "store": true, "metadata": true, "user": true,
+	"temperature": true, "top_p": true, "top_logprobs": true, "service_tier": true,
+	"prompt_cache_key": true, "safety_identifier": true,
+	// Chat completions
+	"messages": true, "prompt": true, "max_tokens": true, "max_completion_tokens": true, "n": true,
+	"stop": true, "presence_penalty": true, "frequency_penalty": true, "logit_bias": true, "logprobs": true,
+	"seed": true, "response_format": true, "reasoning_effort": true, "responses_tools": true,
+	"responses_tool_choice": true, "functions": true, "function_call": true,
+	// Responses
+	"input": true, "instructions": true, "include": true, "text": true, "previous_response_id": true,
+	"conversation": true, "max_output_tokens": true, "max_tool_calls": true, "truncation": true,
+	"prompt_cache_retention": true, "background": true,
+	// Conversation ids read by ExtractConversationID
+	"cursorConversationId": true, "conversation_id": true, "conversationId": true,
+}
+
+// UnknownFields returns the sorted top-level keys of raw that the proxy does
+// not recognize.
+func UnknownFields(raw map[string]any) []string {
+	var unknown []string
+	for key := range raw {
+		if !knownRequestFields[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// FilterIncludes drops include values not permitted by --allowed-includes and
+// returns them separately for logging. The local "usage" value is always kept;
+// a nil include stays nil.
+func FilterIncludes(cfg *config.ServerConfig, include []string) (kept, dropped []string) {
+	if include == nil {
+		return nil, nil
+	}
+	kept = make([]string, 0, len(include))
+	for _, inc := range include {
+		if inc == stream.IncludeUsage || cfg.IncludeAllowed(inc) {
+			kept = append(kept, inc)
+		} else {
+			dropped = append(dropped, inc)
+		}
+	}
+	return kept, dropped
+}
+
+// RequestedMaxOutputTokens returns the client's output token limit from
+// max_output_tokens, max_completion_tokens or the older max_tokens, or 0.
+func RequestedMaxOutputTokens(raw map[string]any) int {
+	for _, key := range []string{"max_output_tokens", "max_completion_tokens", "max_tokens"} {
+		if n := stream.Int64FromAny(raw[key]); n > 0 {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+// SafetyIdentifier returns the end-user identifier forwarded upstream as
+// safety_identifier, falling back to the deprecated user field it replaces.
+func SafetyIdentifier(raw map[string]any) string {
+	if id := strings.TrimSpace(stringFromAny(raw["safety_identifier"])); id != "" {
+		return id
+	}
+	return strings.TrimSpace(stringFromAny(raw["user"]))
+}
@@ -90,8 +90,7 @@ func parseMessagesCandidate(raw map[string]any, route string) parsedInputCandida
 			Items: items, Instructions: instructions, Messages: len(msgs),
 		}
 	default:
-		normalized := append([]types.ChatMessage(nil), msgs...)
-		ConvertSystemToUser(normalized)
+		normalized := ConvertSystemToUser(msgs)
 		items := transform.ChatMessagesToResponsesInput(normalized)
 		return parsedInputCandidate{
 			Present: true, Valid: true, Usable: len(items) > 0,
@@ -191,19 +190,32 @@ func ExtractSystemTextFromChatContent(content any) (string, bool) {
 	}
 }
 
-// ConvertSystemToUser converts the first system message to user role.
-func ConvertSystemToUser(messages []types.ChatMessage) {
-	for i, m := range messages {
-		if m.Role == "system" {
-			messages[i] = types.ChatMessage{Role: "user", Content: m.Content}
-			if i > 0 {
-				msg := messages[i]
-				copy(messages[1:i+1], messages[:i])
-				messages[0] = msg
-			}
-			return
+// ConvertSystemToUser hoists every system message to the front of the
+// conversation as user role. Text-only system messages are concatenated into a
+// single leading message; the rest keep their content and relative order.
+func ConvertSystemToUser(messages []types.ChatMessage) []types.ChatMessage {
+	var texts []string
+	var hoisted, rest []types.ChatMessage
+	for _, m := range messages {
+		if m.Role != "system" {
+			rest = append(rest, m)
+			continue
 		}
+		if txt, ok := ExtractSystemTextFromChatContent(m.Content); ok {
+			texts = append(texts, txt)
+			continue
+		}
+		hoisted = append(hoisted, types.ChatMessage{Role: "user", Content: m.Content})
+	}
+	if len(texts) == 0 && len(hoisted) == 0 {
+		return messages
+	}
+	out := make([]types.ChatMessage, 0, len(hoisted)+len(rest)+1)
+	if len(texts) > 0 {
+		out = append(out, types.ChatMessage{Role: "user", Content: strings.Join(texts, "\n\n")})
 	}
+	out = append(out, hoisted...)
+	return append(out, rest...)
 }
 
 // ParseResponsesInputFromRaw parses input from raw JSON value.
@@ -0,0 +1,44 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeInputChatHoistsAllSystemMessages(t *testing.T) {
+	raw := map[string]any{
+		"messages": []any{
+			map[string]any{"role": "system", "content": "You are terse."},
+			map[string]any{"role": "user", "content": "hello"},
+			map[string]any{"role": "assistant", "content": "hi"},
+			map[string]any{"role": "system", "content": "Reply in French."},
+			map[string]any{"role": "user", "content": "how are you?"},
+		},
+	}
+	items, instructions, _, source, _, _, nerr := NormalizeInput(raw, "chat", "")
+	if nerr != nil {
+		t.Fatalf("unexpected error: %+v", nerr)
+	}
+	if source != "messages" || instructions != "" {
+		t.Errorf("source/instructions: got %q/%q, want messages/\"\"", source, instructions)
+	}
+	if len(items) != 4 {
+		t.Fatalf("items: got %d, want 4 (%+v)", len(items), items)
+	}
+	first := items[0]
+	if first.Role != "user" || len(first.Content) != 1 {
+		t.Fatalf("first item: got %+v", first)
+	}
+	text := first.Content[0].Text
+	if !strings.Contains(text, "You are terse.") || !strings.Contains(text, "Reply in French.") {
+		t.Errorf("hoisted system text: got %q, want both system messages", text)
+	}
+	if strings.Index(text, "terse") > strings.Index(text, "French") {
+		t.Errorf("hoisted system text out of order: %q", text)
+	}
+	for i, want := range []string{"hello", "hi", "how are you?"} {
+		if got := items[i+1].Content[0].Text; got != want {
+			t.Errorf("item %d: got %q, want %q", i+1, got, want)
+		}
+	}
+}
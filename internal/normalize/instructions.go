@@ -8,6 +8,8 @@ import (
 )
 
 // ComposeInstructions builds the final instructions string for a request.
+// With noDefault the embedded prompt is never used, leaving only client or
+// previously stored instructions.
 func ComposeInstructions(
 	cfg *config.ServerConfig,
 	store *state.Store,
@@ -16,6 +18,8 @@ func ComposeInstructions(
 	clientInstructions string,
 	inputSystemInstructions string,
 	previousResponseID string,
+	hasTools bool,
+	noDefault bool,
 ) string {
 	client := joinNonEmpty("\n\n", strings.TrimSpace(clientInstructions), strings.TrimSpace(inputSystemInstructions))
 
@@ -25,10 +29,10 @@ func ComposeInstructions(
 		}
 	}
 
-	if client != "" {
+	if client != "" || noDefault {
 		return client
 	}
-	return strings.TrimSpace(cfg.InstructionsForModel(model))
+	return strings.TrimSpace(cfg.InstructionsForRequest(model, hasTools))
 }
 
 func joinNonEmpty(sep string, parts ...string) string {
@@ -1,7 +1,10 @@
 package normalize
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -9,14 +12,21 @@ import (
 	"github.com/n0madic/go-chatmock/internal/models"
 	"github.com/n0madic/go-chatmock/internal/reasoning"
 	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/transform"
 	"github.com/n0madic/go-chatmock/internal/types"
 )
 
 // Enrich normalizes a raw request body into a CanonicalRequest.
-func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.Store) (*types.CanonicalRequest, *NormalizeError) {
-	raw, chatReq, responsesReq, err := decodeUniversalBody(body)
+// available is the model list consulted to split effort-variant slugs, and
+// noDefaultInstructions leaves out the embedded prompt (see ComposeInstructions).
+func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.Store, available []models.RemoteModel, noDefaultInstructions bool) (*types.CanonicalRequest, *NormalizeError) {
+	raw, chatReq, responsesReq, err := decodeUniversalBody(body, !cfg.NoJSONNewlineFallback)
 	if err != nil {
-		return nil, &NormalizeError{StatusCode: http.StatusBadRequest, Message: "Invalid JSON body"}
+		msg := "Invalid JSON body"
+		if cfg.NoJSONNewlineFallback {
+			msg += ": " + describeJSONError(body, err)
+		}
+		return nil, &NormalizeError{StatusCode: http.StatusBadRequest, Message: msg}
 	}
 
 	requestedModel := strings.TrimSpace(chatReq.Model)
@@ -26,7 +36,8 @@ func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.St
 	if requestedModel == "" {
 		requestedModel = stringFromAny(raw["model"])
 	}
-	model := models.NormalizeModelName(requestedModel, cfg.DebugModel)
+	requestedModel, deprecation := cfg.RemapLegacyModel(cfg.ModelOrDefault(requestedModel))
+	model := models.NormalizeModelName(requestedModel, cfg.DebugModel, available)
 
 	inputItems, inputSystemInstructions, messagesCount, inputSource, usedPromptFallback, usedInputFallback, ierr := NormalizeInput(raw, route, chatReq.Prompt)
 	if ierr != nil {
@@ -34,10 +45,17 @@ func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.St
 	}
 
 	conversationID := ExtractConversationID(raw)
+	var metadata map[string]string
+	if route == "responses" {
+		metadata = ExtractMetadata(raw)
+	}
 	previousResponseID := strings.TrimSpace(responsesReq.PreviousResponseID)
 	autoPreviousResponseID := false
+	lostContextResponseID := ""
 	if previousResponseID == "" && conversationID != "" {
-		if mappedID, ok := store.GetConversationLatest(conversationID); ok {
+		if mappedID, expired := store.ResolveConversation(conversationID, cfg.MaxConversationAge); expired {
+			lostContextResponseID = mappedID
+		} else if mappedID != "" {
 			previousResponseID = mappedID
 			autoPreviousResponseID = true
 		}
@@ -56,6 +74,14 @@ func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.St
 		}
 	}
 
+	if cfg.StripEmptyToolResults {
+		FillEmptyToolOutputs(inputItems)
+	}
+	toolResultAcks := 0
+	if cfg.AckToolResults {
+		inputItems, toolResultAcks = AckToolResults(inputItems)
+	}
+
 	reasoningOverrides := chatReq.Reasoning
 	if route == "responses" && responsesReq.Reasoning != nil {
 		reasoningOverrides = responsesReq.Reasoning
@@ -63,7 +89,10 @@ func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.St
 	if reasoningOverrides == nil {
 		reasoningOverrides = responsesReq.Reasoning
 	}
-	reasoningParam := buildReasoningWithModelFallback(cfg, requestedModel, model, reasoningOverrides)
+	if reasoning.IsExplicitNull(raw) {
+		reasoningOverrides = &types.ReasoningParam{Effort: reasoning.EffortNone}
+	}
+	reasoningParam := buildReasoningWithModelFallback(cfg, requestedModel, model, reasoningOverrides, available)
 
 	responseFormat := route
 	if cfg.ResponseFormat == "input" && inputSource == "input" {
@@ -82,29 +111,52 @@ func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.St
 	if inputSource == "input" {
 		toolFormat = "responses"
 	}
-	tools, baseTools, hadResponsesTools, defaultWebSearchApplied, terr := NormalizeTools(raw, toolFormat, chatReq, responsesReq, toolChoice, cfg.DefaultWebSearch)
+	if cfg.StrictTools {
+		rawTools, _ := raw["tools"].([]any)
+		if nerr := ValidateRawToolNames(rawTools); nerr != nil {
+			return nil, nerr
+		}
+	}
+	tools, baseTools, hadResponsesTools, defaultWebSearchApplied, terr := NormalizeTools(raw, toolFormat, chatReq, responsesReq, toolChoice, cfg.DefaultWebSearch && cfg.Capabilities.For(model).SupportsWebSearch())
 	if terr != nil {
 		return nil, terr
 	}
+	var toolNameMap map[string]string
+	if cfg.CanonicalToolNames {
+		toolChoice, toolNameMap = CanonicalizeToolNames([][]types.ResponsesTool{tools, baseTools}, inputItems, toolChoice)
+	}
 
-	instructions := ComposeInstructions(cfg, store, route, model, strings.TrimSpace(responsesReq.Instructions), inputSystemInstructions, previousResponseID)
+	textFormat, ferr := pickTextFormat(raw, chatReq)
+	if ferr != nil {
+		return nil, &NormalizeError{StatusCode: http.StatusBadRequest, Message: ferr.Error()}
+	}
+	truncation, nerr := Truncation(raw)
+	if nerr != nil {
+		return nil, nerr
+	}
+
+	instructions := ComposeInstructions(cfg, store, route, model, strings.TrimSpace(responsesReq.Instructions), inputSystemInstructions, previousResponseID, len(tools) > 0, noDefaultInstructions)
 
 	storeForUpstream, storeForced := state.NormalizeStoreForUpstream(responsesReq.Store)
 
 	stream := false
+	streamSet := false
 	if v, ok := raw["stream"].(bool); ok {
-		stream = v
+		stream, streamSet = v, true
 	} else {
 		stream = chatReq.Stream || responsesReq.Stream
 	}
 	includeUsage := chatReq.StreamOptions != nil && chatReq.StreamOptions.IncludeUsage
+	include, droppedIncludes := FilterIncludes(cfg, responsesReq.Include)
 
 	return &types.CanonicalRequest{
 		ResponseFormat:          responseFormat,
 		RequestedModel:          requestedModel,
 		Model:                   model,
 		Stream:                  stream,
+		StreamSet:               streamSet,
 		IncludeUsage:            includeUsage,
+		MaxOutputTokens:         RequestedMaxOutputTokens(raw),
 		InputItems:              inputItems,
 		Instructions:            instructions,
 		InputSource:             inputSource,
@@ -114,29 +166,48 @@ func Enrich(body []byte, route string, cfg *config.ServerConfig, store *state.St
 		HadResponsesTools:       hadResponsesTools,
 		ToolChoice:              toolChoice,
 		ParallelToolCalls:       parallelToolCalls,
+		ToolNameMap:             toolNameMap,
 		PreviousResponseID:      previousResponseID,
 		ConversationID:          conversationID,
+		Metadata:                metadata,
+		DeprecationNotice:       deprecation,
 		AutoPreviousResponseID:  autoPreviousResponseID,
-		Include:                 responsesReq.Include,
+		Include:                 include,
+		TextFormat:              textFormat,
+		Truncation:              truncation,
 		ReasoningParam:          reasoningParam,
 		StoreRequested:          responsesReq.Store,
 		StoreForUpstream:        storeForUpstream,
 		StoreForced:             storeForced,
+		SessionID:               strings.TrimSpace(stringFromAny(raw["prompt_cache_key"])),
+		SafetyIdentifier:        SafetyIdentifier(raw),
 		UsedPromptFallback:      usedPromptFallback,
 		UsedInputFallback:       usedInputFallback,
 		DefaultWebSearchApplied: defaultWebSearchApplied,
+		UnknownFields:           UnknownFields(raw),
+		LostContextResponseID:   lostContextResponseID,
+		DroppedIncludes:         droppedIncludes,
+		RequestedN:              chatReq.N,
+		HasStreamOptions:        raw["stream_options"] != nil,
+		ToolResultAcks:          toolResultAcks,
 	}, nil
 }
 
-func decodeUniversalBody(body []byte) (map[string]any, types.ChatCompletionRequest, types.ResponsesRequest, error) {
+// decodeUniversalBody decodes a chat or Responses request body. With
+// escapeFallback, a body that fails to parse is retried with raw control
+// characters inside strings escaped (see --no-json-newline-fallback).
+func decodeUniversalBody(body []byte, escapeFallback bool) (map[string]any, types.ChatCompletionRequest, types.ResponsesRequest, error) {
 	decoded := body
 	var raw map[string]any
 	if err := json.Unmarshal(decoded, &raw); err != nil {
-		cleaned := strings.ReplaceAll(strings.ReplaceAll(string(body), "\r", ""), "\n", "")
-		if err := json.Unmarshal([]byte(cleaned), &raw); err != nil {
+		if !escapeFallback {
+			return nil, types.ChatCompletionRequest{}, types.ResponsesRequest{}, err
+		}
+		cleaned := escapeControlCharsInStrings(body)
+		if err := json.Unmarshal(cleaned, &raw); err != nil {
 			return nil, types.ChatCompletionRequest{}, types.ResponsesRequest{}, err
 		}
-		decoded = []byte(cleaned)
+		decoded = cleaned
 	}
 	var chatReq types.ChatCompletionRequest
 	_ = json.Unmarshal(decoded, &chatReq)
@@ -145,6 +216,67 @@ func decodeUniversalBody(body []byte) (map[string]any, types.ChatCompletionReque
 	return raw, chatReq, responsesReq, nil
 }
 
+// describeJSONError formats a decode error with the line and column of the
+// offending byte, counted from 1.
+func describeJSONError(body []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset < 1 {
+		return err.Error()
+	}
+	before := body[:min(int(syntaxErr.Offset)-1, len(body))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("%s at line %d, column %d", err, line, column)
+}
+
+// escapeControlCharsInStrings escapes raw control characters (literal newlines,
+// tabs, ...) that appear inside JSON string values, leaving everything outside
+// strings untouched. Clients that hand-build payloads sometimes embed them.
+func escapeControlCharsInStrings(body []byte) []byte {
+	out := make([]byte, 0, len(body)+16)
+	inString, escaped := false, false
+	for _, c := range body {
+		switch {
+		case !inString:
+			if c == '"' {
+				inString = true
+			}
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			inString = false
+		case c < 0x20:
+			switch c {
+			case '\n':
+				out = append(out, '\\', 'n')
+			case '\r':
+				out = append(out, '\\', 'r')
+			case '\t':
+				out = append(out, '\\', 't')
+			default:
+				out = append(out, fmt.Sprintf("\\u%04x", c)...)
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// pickTextFormat reads the structured-output directive from a chat
+// response_format or a Responses-style text.format.
+func pickTextFormat(raw map[string]any, chatReq types.ChatCompletionRequest) (map[string]any, error) {
+	if chatReq.ResponseFormat != nil {
+		return transform.ResponseFormatToTextFormat(chatReq.ResponseFormat)
+	}
+	if text, ok := raw["text"].(map[string]any); ok {
+		return transform.ResponseFormatToTextFormat(text["format"])
+	}
+	return nil, nil
+}
+
 func pickToolChoice(route string, chatReq types.ChatCompletionRequest, responsesReq types.ResponsesRequest) any {
 	var toolChoice any
 	if route == "chat" {
@@ -172,13 +304,16 @@ func buildReasoningWithModelFallback(
 	requestedModel string,
 	normalizedModel string,
 	reasoningOverrides *types.ReasoningParam,
+	available []models.RemoteModel,
 ) *types.ReasoningParam {
 	if reasoningOverrides == nil {
-		reasoningOverrides = reasoning.ExtractFromModelName(requestedModel)
+		reasoningOverrides = reasoning.ExtractFromModelName(requestedModel, available)
 	}
 	return reasoning.BuildReasoningParam(
 		cfg.ReasoningEffort,
 		cfg.ReasoningSummary,
+		cfg.ReasoningEffortByModel,
+		cfg.Capabilities,
 		reasoningOverrides,
 		normalizedModel,
 	)
@@ -0,0 +1,173 @@
+package normalize
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/state"
+)
+
+func TestDecodeUniversalBodyPreservesLiteralNewlinesInStrings(t *testing.T) {
+	body := []byte("{\n  \"model\": \"gpt-5\",\r\n  \"messages\": [{\"role\": \"user\", \"content\": \"line one\nline two\ttabbed\"}]\n}")
+
+	raw, chatReq, _, err := decodeUniversalBody(body, true)
+	if err != nil {
+		t.Fatalf("decodeUniversalBody: %v", err)
+	}
+	if raw["model"] != "gpt-5" {
+		t.Fatalf("model = %v", raw["model"])
+	}
+	if len(chatReq.Messages) != 1 {
+		t.Fatalf("messages = %d, want 1", len(chatReq.Messages))
+	}
+	if got, want := chatReq.Messages[0].Content, "line one\nline two\ttabbed"; got != want {
+		t.Fatalf("content = %q, want %q", got, want)
+	}
+}
+
+func TestOmitPromptWithoutTools(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	cfg := &config.ServerConfig{BaseInstructions: "embedded prompt", OmitPromptWithoutTools: true, ReasoningEffort: "medium", ReasoningSummary: "auto"}
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"plain chat", `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`, ""},
+		{"with tools", `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}}]}`, "embedded prompt"},
+		{"client instructions", `{"model":"gpt-5","instructions":"be brief","messages":[{"role":"user","content":"hi"}]}`, "be brief"},
+	}
+	for _, tt := range tests {
+		req, nerr := Enrich([]byte(tt.body), "chat", cfg, store, nil, false)
+		if nerr != nil {
+			t.Fatalf("%s: %s", tt.name, nerr.Message)
+		}
+		if req.Instructions != tt.want {
+			t.Errorf("%s: instructions got %q, want %q", tt.name, req.Instructions, tt.want)
+		}
+	}
+
+	cfg.OmitPromptWithoutTools = false
+	req, _ := Enrich([]byte(tests[0].body), "chat", cfg, store, nil, false)
+	if req.Instructions != "embedded prompt" {
+		t.Errorf("option off: instructions got %q", req.Instructions)
+	}
+}
+
+func TestUnknownFieldsReportsUnrecognizedKeys(t *testing.T) {
+	raw := map[string]any{"model": "gpt-5", "input": "hi", "safety_identifier": "u", "verbosity_hint": 1, "a_new_field": true}
+	if got := UnknownFields(raw); !reflect.DeepEqual(got, []string{"a_new_field", "verbosity_hint"}) {
+		t.Errorf("UnknownFields got %v", got)
+	}
+}
+
+func TestDefaultModelWhenModelOmitted(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	cfg := &config.ServerConfig{DefaultModel: "gpt-5.1-codex", ReasoningEffort: "medium", ReasoningSummary: "auto"}
+
+	tests := []struct {
+		name  string
+		route string
+		body  string
+		want  string
+	}{
+		{"chat without model", "chat", `{"messages":[{"role":"user","content":"hi"}]}`, "gpt-5.1-codex"},
+		{"responses without model", "responses", `{"input":"hi"}`, "gpt-5.1-codex"},
+		{"explicit model wins", "chat", `{"model":"gpt-5.2","messages":[{"role":"user","content":"hi"}]}`, "gpt-5.2"},
+	}
+	for _, tt := range tests {
+		req, nerr := Enrich([]byte(tt.body), tt.route, cfg, store, nil, false)
+		if nerr != nil {
+			t.Fatalf("%s: %s", tt.name, nerr.Message)
+		}
+		if req.Model != tt.want {
+			t.Errorf("%s: model got %q, want %q", tt.name, req.Model, tt.want)
+		}
+	}
+
+	cfg.DefaultModel = ""
+	req, _ := Enrich([]byte(tests[0].body), "chat", cfg, store, nil, false)
+	if req.Model != "gpt-5" {
+		t.Errorf("no default configured: model got %q, want gpt-5", req.Model)
+	}
+}
+
+func TestNoJSONNewlineFallbackReportsParseError(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	cfg := &config.ServerConfig{ReasoningEffort: "medium", ReasoningSummary: "auto"}
+	body := []byte("{\"model\":\"gpt-5\",\n\"messages\":[{\"role\":\"user\",\"content\":\"one\ntwo\"}]}")
+
+	if _, nerr := Enrich(body, "chat", cfg, store, nil, false); nerr != nil {
+		t.Fatalf("fallback on: %s", nerr.Message)
+	}
+
+	cfg.NoJSONNewlineFallback = true
+	_, nerr := Enrich(body, "chat", cfg, store, nil, false)
+	if nerr == nil {
+		t.Fatal("fallback off: want an error for the raw newline in content")
+	}
+	want := `Invalid JSON body: invalid character '\n' in string at line 2, column 42`
+	if nerr.StatusCode != 400 || nerr.Message != want {
+		t.Errorf("got %d %q, want 400 %q", nerr.StatusCode, nerr.Message, want)
+	}
+}
+
+func TestStrictToolsRejectsNamelessFunctionTool(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	cfg := &config.ServerConfig{ReasoningEffort: "medium", ReasoningSummary: "auto", StrictTools: true}
+
+	nameless := `{"model":"gpt-5","input":"hi","tools":[{"type":"function","name":"ok","parameters":{"type":"object"}},{"type":"function","parameters":{"type":"object"}}]}`
+	_, nerr := Enrich([]byte(nameless), "responses", cfg, store, nil, false)
+	if nerr == nil || nerr.StatusCode != 400 || !strings.Contains(nerr.Message, "tools[1]") || !strings.Contains(nerr.Message, "missing a name") {
+		t.Fatalf("strict mode: got %+v, want a 400 naming tools[1]", nerr)
+	}
+
+	// Chat-style tools carry the name under function and are accepted.
+	chat := `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}}]}`
+	if _, nerr := Enrich([]byte(chat), "chat", cfg, store, nil, false); nerr != nil {
+		t.Errorf("chat-style tool rejected: %s", nerr.Message)
+	}
+
+	cfg.StrictTools = false
+	req, nerr := Enrich([]byte(nameless), "responses", cfg, store, nil, false)
+	if nerr != nil {
+		t.Fatalf("lenient mode: %s", nerr.Message)
+	}
+	if len(req.Tools) != 1 || req.Tools[0].Name != "ok" {
+		t.Errorf("lenient mode should drop the nameless tool: %+v", req.Tools)
+	}
+}
+
+func TestPreviousResponseIDResolvesSpilledEntry(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, 1, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	if err := store.SetSpillDir(t.TempDir()); err != nil {
+		t.Fatalf("SetSpillDir: %v", err)
+	}
+	cfg := &config.ServerConfig{ReasoningEffort: "medium", ReasoningSummary: "auto"}
+
+	first, nerr := Enrich([]byte(`{"model":"gpt-5","input":"remember the number 42"}`), "responses", cfg, store, nil, false)
+	if nerr != nil {
+		t.Fatalf("first turn: %s", nerr.Message)
+	}
+	store.PutContext("resp_a", first.InputItems)
+	store.PutContext("resp_b", first.InputItems) // evicts resp_a to disk at capacity 1
+	if store.Len() != 1 {
+		t.Fatalf("store len = %d, want 1", store.Len())
+	}
+
+	req, nerr := Enrich([]byte(`{"model":"gpt-5","input":"which number?","previous_response_id":"resp_a"}`), "responses", cfg, store, nil, false)
+	if nerr != nil {
+		t.Fatalf("previous_response_id of an evicted entry: %s", nerr.Message)
+	}
+	if len(req.InputItems) != 2 || req.InputItems[0].Content[0].Text != "remember the number 42" {
+		t.Errorf("input items = %+v; want the spilled context before the new turn", req.InputItems)
+	}
+}
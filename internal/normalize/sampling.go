@@ -0,0 +1,61 @@
+package normalize
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/n0madic/go-chatmock/internal/config"
+)
+
+// Documented ranges of top_p and the penalties; temperature uses
+// config.TemperatureMin and config.TemperatureMax.
+const (
+	TopPMin    = 0.0
+	TopPMax    = 1.0
+	PenaltyMin = -2.0
+	PenaltyMax = 2.0
+)
+
+// samplingRanges lists the numeric sampling params forwarded upstream with
+// their accepted range.
+var samplingRanges = []struct {
+	field    string
+	min, max float64
+}{
+	{"temperature", config.TemperatureMin, config.TemperatureMax},
+	{"top_p", TopPMin, TopPMax},
+	{"frequency_penalty", PenaltyMin, PenaltyMax},
+	{"presence_penalty", PenaltyMin, PenaltyMax},
+}
+
+// ClampRawSampling clamps numeric sampling params in a raw request body to
+// their range in place. It returns the original values of the fields that
+// were adjusted.
+func ClampRawSampling(raw map[string]any) map[string]float64 {
+	var adjusted map[string]float64
+	for _, r := range samplingRanges {
+		v, ok := raw[r.field].(float64)
+		if !ok || (v >= r.min && v <= r.max) {
+			continue
+		}
+		if adjusted == nil {
+			adjusted = make(map[string]float64)
+		}
+		adjusted[r.field] = v
+		raw[r.field] = min(max(v, r.min), r.max)
+	}
+	return adjusted
+}
+
+// ValidateRawSampling rejects the first numeric sampling param outside its
+// range with a 400 (--strict-sampling-params).
+func ValidateRawSampling(raw map[string]any) *NormalizeError {
+	for _, r := range samplingRanges {
+		v, ok := raw[r.field].(float64)
+		if ok && (v < r.min || v > r.max) {
+			msg := fmt.Sprintf("%s must be between %g and %g, got %g", r.field, r.min, r.max, v)
+			return &NormalizeError{StatusCode: http.StatusBadRequest, Message: msg}
+		}
+	}
+	return nil
+}
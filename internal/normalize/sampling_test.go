@@ -0,0 +1,59 @@
+package normalize
+
+import "testing"
+
+func TestClampRawSampling(t *testing.T) {
+	tests := []struct {
+		field   string
+		in      float64
+		want    float64
+		clamped bool
+	}{
+		{"temperature", 0.7, 0.7, false},
+		{"temperature", -0.5, 0, true},
+		{"temperature", 3, 2, true},
+		{"top_p", 1, 1, false},
+		{"top_p", -1, TopPMin, true},
+		{"top_p", 1.5, TopPMax, true},
+		{"frequency_penalty", 0.5, 0.5, false},
+		{"frequency_penalty", -2, -2, false},
+		{"frequency_penalty", -3.5, PenaltyMin, true},
+		{"presence_penalty", 2, 2, false},
+		{"presence_penalty", 7, PenaltyMax, true},
+	}
+	for _, tt := range tests {
+		raw := map[string]any{tt.field: tt.in}
+		adjusted := ClampRawSampling(raw)
+		if got := raw[tt.field].(float64); got != tt.want {
+			t.Errorf("%s=%v: got %v, want %v", tt.field, tt.in, got, tt.want)
+		}
+		orig, ok := adjusted[tt.field]
+		if ok != tt.clamped {
+			t.Errorf("%s=%v: clamped reported %v, want %v", tt.field, tt.in, ok, tt.clamped)
+		}
+		if ok && orig != tt.in {
+			t.Errorf("%s=%v: original got %v", tt.field, tt.in, orig)
+		}
+
+		nerr := ValidateRawSampling(map[string]any{tt.field: tt.in})
+		if (nerr != nil) != tt.clamped {
+			t.Errorf("%s=%v: strict error got %v, want rejected=%v", tt.field, tt.in, nerr, tt.clamped)
+		}
+		if nerr != nil && nerr.StatusCode != 400 {
+			t.Errorf("%s=%v: strict status got %d, want 400", tt.field, tt.in, nerr.StatusCode)
+		}
+	}
+}
+
+func TestClampRawSamplingIgnoresMissingAndNonNumeric(t *testing.T) {
+	raw := map[string]any{"presence_penalty": "high"}
+	if adjusted := ClampRawSampling(raw); adjusted != nil {
+		t.Errorf("expected no adjustments, got %v", adjusted)
+	}
+	if _, ok := raw["frequency_penalty"]; ok {
+		t.Error("missing field should not be added")
+	}
+	if nerr := ValidateRawSampling(raw); nerr != nil {
+		t.Errorf("non-numeric value should be left to upstream, got %v", nerr)
+	}
+}
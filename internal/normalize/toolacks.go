@@ -0,0 +1,39 @@
+package normalize
+
+import "github.com/n0madic/go-chatmock/internal/types"
+
+// ToolResultAckText is the assistant message inserted by AckToolResults.
+const ToolResultAckText = "Tool results received."
+
+// AckToolResults inserts a minimal assistant message between a tool output and
+// a user message that follows it directly, so models that lose track of tool
+// loops see each round closed before the next user turn. Tool outputs followed
+// by anything else are left alone. It returns the items and the number of
+// acknowledgements inserted.
+func AckToolResults(items []types.ResponsesInputItem) ([]types.ResponsesInputItem, int) {
+	var out []types.ResponsesInputItem
+	added := 0
+	for i, item := range items {
+		out = append(out, item)
+		if !isToolOutputItem(item) || i+1 >= len(items) {
+			continue
+		}
+		if next := items[i+1]; next.Type != "message" || next.Role != "user" {
+			continue
+		}
+		out = append(out, types.ResponsesInputItem{
+			Type:    "message",
+			Role:    "assistant",
+			Content: []types.ResponsesContent{{Type: "output_text", Text: ToolResultAckText}},
+		})
+		added++
+	}
+	if added == 0 {
+		return items, 0
+	}
+	return out, added
+}
+
+func isToolOutputItem(item types.ResponsesInputItem) bool {
+	return item.Type == "function_call_output" || item.Type == "custom_tool_call_output"
+}
@@ -0,0 +1,44 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestAckToolResults(t *testing.T) {
+	user := func(text string) types.ResponsesInputItem {
+		return types.ResponsesInputItem{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: text}}}
+	}
+	items := []types.ResponsesInputItem{
+		user("weather in Paris and Rome?"),
+		{Type: "function_call", Name: "weather", CallID: "call_1"},
+		{Type: "function_call", Name: "weather", CallID: "call_2"},
+		{Type: "function_call_output", CallID: "call_1", Output: "sunny"},
+		// A second output follows: no acknowledgement yet.
+		{Type: "function_call_output", CallID: "call_2", Output: "rainy"},
+		user("and Berlin?"),
+		{Type: "function_call", Name: "weather", CallID: "call_3"},
+		{Type: "function_call_output", CallID: "call_3", Output: "cloudy"},
+		// Already answered by the assistant: left alone.
+		{Type: "message", Role: "assistant", Content: []types.ResponsesContent{{Type: "output_text", Text: "Cloudy."}}},
+		user("thanks"),
+		{Type: "custom_tool_call_output", CallID: "call_4", Output: "ok"},
+	}
+
+	got, added := AckToolResults(items)
+	if added != 1 || len(got) != len(items)+1 {
+		t.Fatalf("added %d (len %d), want 1 acknowledgement", added, len(got))
+	}
+	ack := got[5]
+	if ack.Type != "message" || ack.Role != "assistant" || len(ack.Content) != 1 || ack.Content[0].Type != "output_text" || ack.Content[0].Text != ToolResultAckText {
+		t.Errorf("acknowledgement: got %+v", ack)
+	}
+	if got[4].CallID != "call_2" || got[6].Role != "user" {
+		t.Errorf("acknowledgement must sit between call_2's output and the user turn: %+v", got[4:7])
+	}
+
+	if _, added := AckToolResults(got); added != 0 {
+		t.Errorf("already acknowledged input: added %d, want 0", added)
+	}
+}
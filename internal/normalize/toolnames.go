@@ -0,0 +1,122 @@
+package normalize
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// maxToolNameLen is the longest function name the upstream accepts.
+const maxToolNameLen = 64
+
+// CanonicalToolName rewrites name to the upstream pattern ^[a-zA-Z0-9_-]{1,64}$
+// by replacing every other character with an underscore.
+func CanonicalToolName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	out := b.String()
+	if len(out) > maxToolNameLen {
+		out = out[:maxToolNameLen]
+	}
+	return out
+}
+
+// CanonicalizeToolNames rewrites function/custom tool names that the upstream
+// would reject, in the tool lists, function_call history items, and a named
+// tool_choice. It returns the updated tool_choice and a map from the upstream
+// name back to the client's original name (nil when nothing was renamed).
+func CanonicalizeToolNames(toolLists [][]types.ResponsesTool, input []types.ResponsesInputItem, toolChoice any) (any, map[string]string) {
+	// Names that are already valid keep their spelling; renamed tools must not
+	// collide with them or with each other.
+	taken := make(map[string]bool)
+	for _, tools := range toolLists {
+		for _, t := range tools {
+			if isNamedTool(t.Type) && t.Name != "" && CanonicalToolName(t.Name) == t.Name {
+				taken[t.Name] = true
+			}
+		}
+	}
+
+	forward := make(map[string]string)
+	assign := func(name string) string {
+		if mapped, ok := forward[name]; ok {
+			return mapped
+		}
+		base := CanonicalToolName(name)
+		if base == name {
+			return name
+		}
+		canon := base
+		for i := 2; taken[canon]; i++ {
+			suffix := fmt.Sprintf("_%d", i)
+			canon = base
+			if len(canon)+len(suffix) > maxToolNameLen {
+				canon = canon[:maxToolNameLen-len(suffix)]
+			}
+			canon += suffix
+		}
+		taken[canon] = true
+		forward[name] = canon
+		return canon
+	}
+
+	for _, tools := range toolLists {
+		for i := range tools {
+			if isNamedTool(tools[i].Type) && tools[i].Name != "" {
+				tools[i].Name = assign(tools[i].Name)
+			}
+		}
+	}
+	for i := range input {
+		if (input[i].Type == "function_call" || input[i].Type == "custom_tool_call") && input[i].Name != "" {
+			input[i].Name = assign(input[i].Name)
+		}
+	}
+	toolChoice = canonicalToolChoice(toolChoice, assign)
+
+	if len(forward) == 0 {
+		return toolChoice, nil
+	}
+	reverse := make(map[string]string, len(forward))
+	for orig, canon := range forward {
+		reverse[canon] = orig
+	}
+	return toolChoice, reverse
+}
+
+func isNamedTool(typ string) bool {
+	return typ == "function" || typ == "custom"
+}
+
+func canonicalToolChoice(toolChoice any, assign func(string) string) any {
+	tc, ok := toolChoice.(map[string]any)
+	if !ok {
+		return toolChoice
+	}
+	out := make(map[string]any, len(tc))
+	for k, v := range tc {
+		out[k] = v
+	}
+	if name, _ := out["name"].(string); name != "" {
+		out["name"] = assign(name)
+	}
+	if fn, ok := out["function"].(map[string]any); ok {
+		fnCopy := make(map[string]any, len(fn))
+		for k, v := range fn {
+			fnCopy[k] = v
+		}
+		if name, _ := fnCopy["name"].(string); name != "" {
+			fnCopy["name"] = assign(name)
+		}
+		out["function"] = fnCopy
+	}
+	return out
+}
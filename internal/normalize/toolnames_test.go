@@ -0,0 +1,44 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestCanonicalizeToolNames(t *testing.T) {
+	tools := []types.ResponsesTool{
+		{Type: "function", Name: "weather.get"},
+		{Type: "function", Name: "weather_get"},
+		{Type: "function", Name: "search"},
+	}
+	input := []types.ResponsesInputItem{
+		{Type: "function_call", Name: "weather.get", CallID: "call_1"},
+	}
+	choice := map[string]any{"type": "function", "name": "weather.get"}
+
+	gotChoice, names := CanonicalizeToolNames([][]types.ResponsesTool{tools}, input, choice)
+
+	if tools[0].Name != "weather_get_2" {
+		t.Errorf("dotted tool: got %q, want weather_get_2 (weather_get is taken)", tools[0].Name)
+	}
+	if tools[1].Name != "weather_get" || tools[2].Name != "search" {
+		t.Errorf("valid names must be kept: got %q, %q", tools[1].Name, tools[2].Name)
+	}
+	if input[0].Name != "weather_get_2" {
+		t.Errorf("function_call input: got %q, want weather_get_2", input[0].Name)
+	}
+	if got := gotChoice.(map[string]any)["name"]; got != "weather_get_2" {
+		t.Errorf("tool_choice name: got %v, want weather_get_2", got)
+	}
+	if choice["name"] != "weather.get" {
+		t.Errorf("caller's tool_choice must not be mutated: got %v", choice["name"])
+	}
+	if len(names) != 1 || names["weather_get_2"] != "weather.get" {
+		t.Errorf("reverse map: got %v", names)
+	}
+
+	if _, none := CanonicalizeToolNames([][]types.ResponsesTool{{{Type: "function", Name: "ok"}}}, nil, "auto"); none != nil {
+		t.Errorf("no renames should return a nil map, got %v", none)
+	}
+}
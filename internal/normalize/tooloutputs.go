@@ -0,0 +1,63 @@
+package normalize
+
+import (
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// EmptyToolOutputPlaceholder is sent in place of a blank tool output when
+// --strip-empty-tool-results is set.
+const EmptyToolOutputPlaceholder = "(no output)"
+
+// FillEmptyToolOutputs replaces blank tool outputs with
+// EmptyToolOutputPlaceholder in place. The items are kept, so every call
+// still has its output. It returns the number of outputs replaced.
+func FillEmptyToolOutputs(items []types.ResponsesInputItem) int {
+	filled := 0
+	for i := range items {
+		if isToolOutputItem(items[i]) && strings.TrimSpace(items[i].Output) == "" {
+			items[i].Output = EmptyToolOutputPlaceholder
+			filled++
+		}
+	}
+	return filled
+}
+
+// FillRawEmptyToolOutputs applies FillEmptyToolOutputs to the input of a raw
+// Responses request body, which holds either decoded JSON or restored items.
+func FillRawEmptyToolOutputs(raw map[string]any) int {
+	switch input := raw["input"].(type) {
+	case []types.ResponsesInputItem:
+		return FillEmptyToolOutputs(input)
+	case []any:
+		filled := 0
+		for _, v := range input {
+			item, ok := v.(map[string]any)
+			if !ok {
+				continue
+			}
+			if typ, _ := item["type"].(string); typ != "function_call_output" && typ != "custom_tool_call_output" {
+				continue
+			}
+			if isBlankRawOutput(item["output"]) {
+				item["output"] = EmptyToolOutputPlaceholder
+				filled++
+			}
+		}
+		return filled
+	}
+	return 0
+}
+
+func isBlankRawOutput(v any) bool {
+	switch out := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(out) == ""
+	case []any:
+		return len(out) == 0
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package normalize
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -46,6 +47,10 @@ func NormalizeTools(
 		}
 	}
 
+	if nerr := ValidateToolSchemas(primary); nerr != nil {
+		return nil, nil, false, false, nerr
+	}
+
 	extraTools, err := parseExplicitResponsesTools(chatReq.ResponsesTools)
 	if err != nil {
 		return nil, nil, false, false, &NormalizeError{
@@ -90,6 +95,63 @@ func parseExplicitResponsesTools(responsesTools []any) ([]types.ResponsesTool, e
 	return out, nil
 }
 
+// ValidateRawToolNames rejects function and custom tools that carry no name
+// in either the Responses (top-level name) or Chat (function.name) shape
+// (--strict-tools). Without it such tools are silently dropped.
+func ValidateRawToolNames(rawTools []any) *NormalizeError {
+	for i, raw := range rawTools {
+		m, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		ttype := strings.TrimSpace(stringFromAny(m["type"]))
+		if ttype != "function" && ttype != "custom" {
+			continue
+		}
+		name := stringFromAny(m["name"])
+		if fn, ok := m["function"].(map[string]any); ok && strings.TrimSpace(name) == "" {
+			name = stringFromAny(fn["name"])
+		}
+		if strings.TrimSpace(name) == "" {
+			return &NormalizeError{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("Invalid tool tools[%d]: %s tool is missing a name", i, ttype),
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateAnthropicToolNames is ValidateRawToolNames for Anthropic tools,
+// which are all custom tools and carry no type.
+func ValidateAnthropicToolNames(tools []types.AnthropicTool) *NormalizeError {
+	for i, t := range tools {
+		if strings.TrimSpace(t.Name) == "" {
+			return &NormalizeError{
+				StatusCode: http.StatusBadRequest,
+				Message:    fmt.Sprintf("Invalid tool tools[%d]: tool is missing a name", i),
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateGeminiToolNames is ValidateRawToolNames for Gemini function
+// declarations.
+func ValidateGeminiToolNames(tools []types.GeminiTool) *NormalizeError {
+	for i, tool := range tools {
+		for j, fn := range tool.FunctionDeclarations {
+			if strings.TrimSpace(fn.Name) == "" {
+				return &NormalizeError{
+					StatusCode: http.StatusBadRequest,
+					Message:    fmt.Sprintf("Invalid tool tools[%d].functionDeclarations[%d]: function declaration is missing a name", i, j),
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func sanitizeResponsesTools(in []types.ResponsesTool) []types.ResponsesTool {
 	if len(in) == 0 {
 		return nil
@@ -0,0 +1,216 @@
+package normalize
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// jsonSchemaTypes are the primitive type names JSON Schema accepts.
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Keywords whose value is a map of named subschemas, a single subschema, or a
+// list of subschemas.
+var (
+	schemaMapKeywords = []string{"$defs", "definitions", "properties", "patternProperties", "dependentSchemas"}
+	schemaOneKeywords = []string{"items", "additionalItems", "additionalProperties", "unevaluatedItems",
+		"unevaluatedProperties", "contains", "propertyNames", "not", "if", "then", "else"}
+	schemaListKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems"}
+)
+
+// ValidateToolSchemas checks that every function tool's parameters are a
+// well-formed JSON Schema object whose local $ref pointers (into $defs,
+// definitions or elsewhere in the schema) resolve. Schemas are forwarded
+// unchanged; the first problem is returned as a 400 naming the tool, instead
+// of the opaque rejection upstream would send.
+func ValidateToolSchemas(tools []types.ResponsesTool) *NormalizeError {
+	for _, t := range tools {
+		if t.Type != "function" || t.Parameters == nil {
+			continue
+		}
+		if err := validateParametersSchema(t.Parameters); err != nil {
+			return toolSchemaError(t.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateRawToolSchemas is ValidateToolSchemas for the raw tools array of a
+// /v1/responses passthrough body.
+func ValidateRawToolSchemas(rawTools []any) *NormalizeError {
+	for _, raw := range rawTools {
+		m, ok := raw.(map[string]any)
+		if !ok || m["type"] != "function" || m["parameters"] == nil {
+			continue
+		}
+		if err := validateParametersSchema(m["parameters"]); err != nil {
+			return toolSchemaError(stringFromAny(m["name"]), err)
+		}
+	}
+	return nil
+}
+
+func toolSchemaError(name string, err error) *NormalizeError {
+	return &NormalizeError{
+		StatusCode: http.StatusBadRequest,
+		Message:    fmt.Sprintf("Invalid parameters schema for tool %q: %v", name, err),
+	}
+}
+
+func validateParametersSchema(params any) error {
+	root, ok := params.(map[string]any)
+	if !ok {
+		return fmt.Errorf("parameters must be a JSON object")
+	}
+	if typ, ok := root["type"]; ok && typ != "object" {
+		return fmt.Errorf(`parameters must have "type": "object"`)
+	}
+	return validateSchemaNode(root, root, "#")
+}
+
+func validateSchemaNode(root map[string]any, node any, at string) error {
+	if _, ok := node.(bool); ok {
+		return nil
+	}
+	schema, ok := node.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s must be a schema object", at)
+	}
+
+	switch typ := schema["type"].(type) {
+	case nil:
+	case string:
+		if !jsonSchemaTypes[typ] {
+			return fmt.Errorf("%s has unknown type %q", at, typ)
+		}
+	case []any:
+		for _, t := range typ {
+			if s, _ := t.(string); !jsonSchemaTypes[s] {
+				return fmt.Errorf("%s has unknown type %v", at, t)
+			}
+		}
+	default:
+		return fmt.Errorf("%s/type must be a string or an array of strings", at)
+	}
+
+	if ref, ok := schema["$ref"]; ok {
+		s, _ := ref.(string)
+		if err := resolveSchemaRef(root, s); err != nil {
+			return fmt.Errorf("%s/$ref %q %v", at, s, err)
+		}
+	}
+
+	if req, ok := schema["required"]; ok {
+		list, ok := req.([]any)
+		if !ok {
+			return fmt.Errorf("%s/required must be an array of strings", at)
+		}
+		for _, r := range list {
+			if _, ok := r.(string); !ok {
+				return fmt.Errorf("%s/required must be an array of strings", at)
+			}
+		}
+	}
+	if enum, ok := schema["enum"]; ok {
+		if _, ok := enum.([]any); !ok {
+			return fmt.Errorf("%s/enum must be an array", at)
+		}
+	}
+
+	for _, key := range schemaMapKeywords {
+		v, ok := schema[key]
+		if !ok {
+			continue
+		}
+		children, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s/%s must be an object", at, key)
+		}
+		for name, child := range children {
+			if err := validateSchemaNode(root, child, at+"/"+key+"/"+escapePointerToken(name)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range schemaOneKeywords {
+		v, ok := schema[key]
+		if !ok {
+			continue
+		}
+		// Draft-07 tuple form: "items": [schema, ...].
+		if list, isList := v.([]any); isList && key == "items" {
+			for i, child := range list {
+				if err := validateSchemaNode(root, child, at+"/items/"+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := validateSchemaNode(root, v, at+"/"+key); err != nil {
+			return err
+		}
+	}
+	for _, key := range schemaListKeywords {
+		v, ok := schema[key]
+		if !ok {
+			continue
+		}
+		list, ok := v.([]any)
+		if !ok || len(list) == 0 {
+			return fmt.Errorf("%s/%s must be a non-empty array", at, key)
+		}
+		for i, child := range list {
+			if err := validateSchemaNode(root, child, at+"/"+key+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSchemaRef checks that ref is a local JSON pointer ("#" or "#/...")
+// that resolves within root. Remote references cannot be fetched upstream.
+func resolveSchemaRef(root map[string]any, ref string) error {
+	if ref == "#" {
+		return nil
+	}
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return fmt.Errorf("is not a local reference (only #/... pointers are supported)")
+	}
+	var cur any = root
+	for _, token := range strings.Split(pointer, "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return fmt.Errorf("does not resolve")
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return fmt.Errorf("does not resolve")
+			}
+			cur = node[i]
+		default:
+			return fmt.Errorf("does not resolve")
+		}
+	}
+	switch cur.(type) {
+	case map[string]any, bool:
+		return nil
+	}
+	return fmt.Errorf("does not point to a schema")
+}
+
+func escapePointerToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
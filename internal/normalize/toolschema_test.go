@@ -0,0 +1,40 @@
+package normalize
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestValidateToolSchemas(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		params  string
+		wantErr string
+	}{
+		{name: "defs ref", params: `{"type":"object","properties":{"a":{"$ref":"#/$defs/A"}},"$defs":{"A":{"type":"string"}}}`},
+		{name: "definitions ref", params: `{"type":"object","properties":{"a":{"$ref":"#/definitions/A"}},"definitions":{"A":{"type":["string","null"]}}}`},
+		{name: "escaped pointer", params: `{"type":"object","properties":{"a":{"$ref":"#/$defs/a~1b"}},"$defs":{"a/b":true}}`},
+		{name: "root ref", params: `{"type":"object","properties":{"self":{"$ref":"#"}}}`},
+		{name: "missing def", params: `{"type":"object","properties":{"a":{"$ref":"#/$defs/B"}},"$defs":{"A":{}}}`, wantErr: `#/properties/a/$ref "#/$defs/B" does not resolve`},
+		{name: "remote ref", params: `{"type":"object","properties":{"a":{"$ref":"https://example.com/a.json"}}}`, wantErr: "is not a local reference"},
+		{name: "non-object root", params: `{"type":"array"}`, wantErr: `must have "type": "object"`},
+		{name: "bad type", params: `{"type":"object","properties":{"a":{"type":"text"}}}`, wantErr: `#/properties/a has unknown type "text"`},
+		{name: "bad required", params: `{"type":"object","required":"a"}`, wantErr: "#/required must be an array of strings"},
+		{name: "empty anyOf", params: `{"type":"object","properties":{"a":{"anyOf":[]}}}`, wantErr: "#/properties/a/anyOf must be a non-empty array"},
+	} {
+		var params any
+		if err := json.Unmarshal([]byte(tt.params), &params); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		nerr := ValidateToolSchemas([]types.ResponsesTool{{Type: "function", Name: "lookup", Parameters: params}})
+		switch {
+		case tt.wantErr == "" && nerr != nil:
+			t.Errorf("%s: unexpected error %s", tt.name, nerr.Message)
+		case tt.wantErr != "" && (nerr == nil || !strings.Contains(nerr.Message, tt.wantErr) || !strings.Contains(nerr.Message, `"lookup"`)):
+			t.Errorf("%s: got %v, want an error naming the tool containing %q", tt.name, nerr, tt.wantErr)
+		}
+	}
+}
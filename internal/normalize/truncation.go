@@ -0,0 +1,65 @@
+package normalize
+
+import (
+	"net/http"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// Truncation returns the request's truncation mode: "auto", "disabled", or ""
+// when unset. Any other value is a 400.
+func Truncation(raw map[string]any) (string, *NormalizeError) {
+	switch mode := stringFromAny(raw["truncation"]); mode {
+	case "", "auto", "disabled":
+		return mode, nil
+	default:
+		return "", &NormalizeError{StatusCode: http.StatusBadRequest, Message: `truncation must be "auto" or "disabled"`}
+	}
+}
+
+// TrimHistory drops the older half of the conversation history for a
+// truncation: "auto" request that overflowed the context window. Leading
+// system and developer messages and the latest turn (the last user message
+// and everything after it) are kept, and the cut ends on a user message so
+// calls stay paired with their outputs. It returns the trimmed items and the
+// number dropped, 0 when there is no history left to drop.
+func TrimHistory(items []types.ResponsesInputItem) ([]types.ResponsesInputItem, int) {
+	start := 0
+	for start < len(items) && isMessageFrom(items[start], "system", "developer") {
+		start++
+	}
+	last := -1
+	for i := len(items) - 1; i > start; i-- {
+		if isMessageFrom(items[i], "user") {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return items, 0
+	}
+
+	cut := last
+	for i := start + (last-start+1)/2; i < last; i++ {
+		if isMessageFrom(items[i], "user") {
+			cut = i
+			break
+		}
+	}
+	out := make([]types.ResponsesInputItem, 0, len(items)-(cut-start))
+	out = append(out, items[:start]...)
+	out = append(out, items[cut:]...)
+	return out, cut - start
+}
+
+func isMessageFrom(item types.ResponsesInputItem, roles ...string) bool {
+	if item.Type != "" && item.Type != "message" {
+		return false
+	}
+	for _, role := range roles {
+		if item.Role == role {
+			return true
+		}
+	}
+	return false
+}
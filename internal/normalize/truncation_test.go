@@ -0,0 +1,35 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestTrimHistory(t *testing.T) {
+	msg := func(role, text string) types.ResponsesInputItem {
+		return types.ResponsesInputItem{Type: "message", Role: role, Content: []types.ResponsesContent{{Type: "input_text", Text: text}}}
+	}
+	items := []types.ResponsesInputItem{
+		msg("developer", "rules"),
+		msg("user", "q1"),
+		{Type: "function_call", CallID: "call_1", Name: "lookup"},
+		{Type: "function_call_output", CallID: "call_1", Output: "ok"},
+		msg("assistant", "a1"),
+		msg("user", "q2"),
+		msg("assistant", "a2"),
+		msg("user", "q3"),
+	}
+
+	got, dropped := TrimHistory(items)
+	if dropped != 4 || len(got) != 4 || got[0].Role != "developer" || got[1].Content[0].Text != "q2" {
+		t.Fatalf("first trim: dropped %d, got %+v", dropped, got)
+	}
+	got, dropped = TrimHistory(got)
+	if dropped != 2 || len(got) != 2 || got[1].Content[0].Text != "q3" {
+		t.Fatalf("second trim: dropped %d, got %+v", dropped, got)
+	}
+	if _, dropped = TrimHistory(got); dropped != 0 {
+		t.Errorf("only the latest turn is left, yet %d items were dropped", dropped)
+	}
+}
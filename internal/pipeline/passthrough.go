@@ -1,22 +1,27 @@
 package pipeline
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/n0madic/go-chatmock/internal/auth"
 	"github.com/n0madic/go-chatmock/internal/codec"
 	"github.com/n0madic/go-chatmock/internal/limits"
+	"github.com/n0madic/go-chatmock/internal/metrics"
 	"github.com/n0madic/go-chatmock/internal/models"
 	"github.com/n0madic/go-chatmock/internal/normalize"
 	"github.com/n0madic/go-chatmock/internal/reasoning"
 	"github.com/n0madic/go-chatmock/internal/state"
 	"github.com/n0madic/go-chatmock/internal/stream"
+	"github.com/n0madic/go-chatmock/internal/transform"
 	"github.com/n0madic/go-chatmock/internal/types"
 	"github.com/n0madic/go-chatmock/internal/upstream"
 )
@@ -34,7 +39,7 @@ func BodyHasInputField(body []byte) bool {
 
 // ExecutePassthrough sends a Responses API request upstream with minimal patching.
 // The original request body is preserved — only model, store, instructions,
-// reasoning, and prompt_cache_key fields are patched.
+// reasoning, and (when the client did not set one) prompt_cache_key fields are patched.
 func (p *Pipeline) ExecutePassthrough(
 	ctx *RequestContext,
 	w http.ResponseWriter,
@@ -52,9 +57,12 @@ func (p *Pipeline) ExecutePassthrough(
 	}
 
 	// Extract and normalize model
-	requestedModel := strings.TrimSpace(stream.StringFromAny(raw["model"]))
-	model := models.NormalizeModelName(requestedModel, p.Config.DebugModel)
-	if ok, hint := p.Registry.IsKnownModel(model); !ok && p.Config.DebugModel == "" {
+	requestedModel, deprecation := p.Config.RemapLegacyModel(p.Config.ModelOrDefault(stream.StringFromAny(raw["model"])))
+	codec.SetDeprecationHeader(w, deprecation)
+	model := models.NormalizeModelName(requestedModel, p.Config.DebugModel, p.Registry.Cached())
+	ok, hint := p.Registry.IsKnownModel(model)
+	metrics.SetModels(ctx.Context, requestedModel, model, ok || p.Config.DebugModel != "")
+	if !ok && p.Config.DebugModel == "" {
 		msg := fmt.Sprintf("model %q is not available via this endpoint", model)
 		if hint != "" {
 			msg += "; available models: " + hint
@@ -66,16 +74,16 @@ func (p *Pipeline) ExecutePassthrough(
 	// Patch model for upstream
 	raw["model"] = model
 
-	// Normalize string input to array (upstream requires array format).
-	if s, ok := raw["input"].(string); ok {
-		raw["input"] = []any{
-			map[string]any{
-				"type": "message",
-				"role": "user",
-				"content": []any{
-					map[string]any{"type": "input_text", "text": s},
-				},
-			},
+	// Normalize string input to array (upstream requires array format), and
+	// bare strings mixed into an input array to user messages.
+	switch input := raw["input"].(type) {
+	case string:
+		raw["input"] = []any{userTextInputItem(input)}
+	case []any:
+		for i, item := range input {
+			if s, ok := item.(string); ok {
+				input[i] = userTextInputItem(s)
+			}
 		}
 	}
 
@@ -84,17 +92,77 @@ func (p *Pipeline) ExecutePassthrough(
 	// slice which the []any-based extractor cannot inspect.
 	inputSystemInstructions := extractAndRemoveSystemMessages(raw)
 
+	if p.Config.Verbose {
+		if unknown := normalize.UnknownFields(raw); len(unknown) > 0 {
+			slog.Info("request.unknown_fields", "route", "responses", "fields", unknown, "forwarded", true)
+		}
+	}
+	// The deprecated user field is not accepted upstream; its replacement is.
+	if id := normalize.SafetyIdentifier(raw); id != "" {
+		raw["safety_identifier"] = id
+	}
+
+	// Upstream does not accept max_output_tokens; the server cap is enforced
+	// on the stream instead.
+	outputLimit := p.Config.OutputTokenLimit(model, normalize.RequestedMaxOutputTokens(raw))
+
+	// metadata is kept locally for GET /v1/responses filtering.
+	metadata := normalize.ExtractMetadata(raw)
+	hasStreamOptions := raw["stream_options"] != nil
+
 	// Strip fields unsupported by the upstream ChatGPT Codex backend.
 	for _, key := range []string{"metadata", "stream_options", "user", "prompt_cache_retention", "max_output_tokens"} {
 		delete(raw, key)
 	}
 
+	// Out-of-range sampling params are rejected upstream: answer 400 under
+	// --strict-sampling-params, otherwise clamp them to spec range.
+	if p.Config.StrictSamplingParams {
+		if nerr := normalize.ValidateRawSampling(raw); nerr != nil {
+			writeErr(nerr.StatusCode, nerr.Message)
+			return
+		}
+	} else if adjusted := normalize.ClampRawSampling(raw); len(adjusted) > 0 && p.Config.Verbose {
+		for key, orig := range adjusted {
+			slog.Info("responses.passthrough.clamped", "field", key, "value", orig, "clamped_to", raw[key])
+		}
+	}
+
+	// Per-model temperature (--model-temperature-default/-override), unless
+	// --capabilities-file marks the model as rejecting sampling params.
+	clientTemp, hasClientTemp := raw["temperature"]
+	if !p.Config.Capabilities.For(model).SupportsSamplingParams() {
+		for _, key := range []string{"temperature", "top_p"} {
+			if _, ok := raw[key]; ok && p.Config.Verbose {
+				slog.Info("responses.passthrough.sampling_param_dropped", "model", model, "field", key)
+			}
+			delete(raw, key)
+		}
+	} else if temp, ok := p.Config.ModelTemperature(model, hasClientTemp && clientTemp != nil); ok {
+		if hasClientTemp && p.Config.Verbose {
+			slog.Info("responses.passthrough.temperature_overridden", "model", model, "value", clientTemp, "overridden_to", temp)
+		}
+		raw["temperature"] = temp
+	}
+
+	// truncation is applied locally (see sendTruncated) and never sent upstream.
+	truncation, nerr := normalize.Truncation(raw)
+	if nerr != nil {
+		writeErr(nerr.StatusCode, nerr.Message)
+		return
+	}
+	delete(raw, "truncation")
+
 	// Handle previous_response_id polyfill
 	conversationID := normalize.ExtractConversationID(raw)
 	previousResponseID := strings.TrimSpace(stream.StringFromAny(raw["previous_response_id"]))
 	autoPreviousResponseID := false
 	if previousResponseID == "" && conversationID != "" {
-		if mappedID, ok := p.Store.GetConversationLatest(conversationID); ok {
+		if mappedID, expired := p.Store.ResolveConversation(conversationID, p.Config.MaxConversationAge); expired {
+			if p.Config.Verbose {
+				slog.Warn("conversation.context_expired", "route", "responses", "response_id", mappedID, "fallback", "fresh_context")
+			}
+		} else if mappedID != "" {
 			previousResponseID = mappedID
 			autoPreviousResponseID = true
 		}
@@ -115,35 +183,81 @@ func (p *Pipeline) ExecutePassthrough(
 		}
 	}
 	delete(raw, "previous_response_id")
+	if p.Config.StripEmptyToolResults {
+		normalize.FillRawEmptyToolOutputs(raw)
+	}
 
 	// Instructions composition
 	clientInstructions := strings.TrimSpace(stream.StringFromAny(raw["instructions"]))
-	instructions := normalize.ComposeInstructions(p.Config, p.Store, "responses", model, clientInstructions, inputSystemInstructions, previousResponseID)
+	rawTools, _ := raw["tools"].([]any)
+	if nerr := normalize.ValidateRawToolSchemas(rawTools); nerr != nil {
+		writeErr(nerr.StatusCode, nerr.Message)
+		return
+	}
+	if p.Config.StrictTools {
+		if nerr := normalize.ValidateRawToolNames(rawTools); nerr != nil {
+			writeErr(nerr.StatusCode, nerr.Message)
+			return
+		}
+	}
+	instructions := normalize.ComposeInstructions(p.Config, p.Store, "responses", model, clientInstructions, inputSystemInstructions, previousResponseID, len(rawTools) > 0, ctx.NoDefaultInstructions)
 	if instructions != "" {
 		raw["instructions"] = instructions
 	}
 
-	// Store: always send false upstream
+	// Store: always send false upstream; store:true only keeps the output
+	// locally for GET /v1/responses/{id}.
+	storeOutput, _ := raw["store"].(bool)
 	raw["store"] = false
 
 	// Ensure stream=true
-	streamReq := false
+	streamReq := ctx.AcceptStream
 	if v, ok := raw["stream"].(bool); ok {
 		streamReq = v
 	}
 	raw["stream"] = true
+	if hasStreamOptions && !streamReq && p.Config.Verbose {
+		slog.Warn("request.stream_options_without_stream", "route", "responses", "usage", "always included")
+	}
 
 	// Reasoning: apply model fallback if not provided
 	reasoningOverrides := reasoning.ParseFromRaw(raw)
 	if reasoningOverrides == nil {
-		reasoningOverrides = reasoning.ExtractFromModelName(requestedModel)
+		reasoningOverrides = reasoning.ExtractFromModelName(requestedModel, p.Registry.Cached())
 	}
 	reasoningParam := reasoning.BuildReasoningParam(
 		p.Config.ReasoningEffort,
 		p.Config.ReasoningSummary,
+		p.Config.ReasoningEffortByModel,
+		p.Config.Capabilities,
 		reasoningOverrides,
 		model,
 	)
+	// include: ["usage"] is handled locally and never sent upstream.
+	usageMode := stream.UsageVerbatim
+	if rawInclude, ok := raw["include"].([]any); ok {
+		includes := make([]string, 0, len(rawInclude))
+		for _, inc := range rawInclude {
+			if s, ok := inc.(string); ok {
+				includes = append(includes, s)
+			}
+		}
+		includes, dropped := normalize.FilterIncludes(p.Config, includes)
+		if len(dropped) > 0 && p.Config.Verbose {
+			slog.Warn("request.include_dropped", "route", "responses", "values", dropped)
+		}
+		var filtered []string
+		usageMode, filtered = stream.UsageModeFromInclude(includes)
+		kept := make([]any, 0, len(filtered))
+		for _, inc := range filtered {
+			kept = append(kept, inc)
+		}
+		raw["include"] = kept
+	}
+
+	// Encrypted reasoning is requested on the client's behalf; unless the
+	// client asked for it too, reasoning items are kept out of its response.
+	stripReasoning := false
 	if reasoningParam != nil {
 		raw["reasoning"] = map[string]any{
 			"effort":  reasoningParam.Effort,
@@ -152,21 +266,27 @@ func (p *Pipeline) ExecutePassthrough(
 		includes, _ := raw["include"].([]any)
 		hasReasoningInclude := false
 		for _, inc := range includes {
-			if s, ok := inc.(string); ok && s == "reasoning.encrypted_content" {
+			if s, ok := inc.(string); ok && s == upstream.IncludeReasoningContent {
 				hasReasoningInclude = true
 				break
 			}
 		}
-		if !hasReasoningInclude {
-			includes = append(includes, "reasoning.encrypted_content")
+		if !hasReasoningInclude && p.Config.IncludeAllowed(upstream.IncludeReasoningContent) {
+			includes = append(includes, upstream.IncludeReasoningContent)
 			raw["include"] = includes
+			stripReasoning = true
 		}
+	} else {
+		// Reasoning explicitly disabled: drop the client's sentinel.
+		delete(raw, "reasoning")
 	}
 
 	// Ensure a session ID for upstream prompt caching. The normalized path
 	// (Do) calls EnsureSessionID automatically; for passthrough we must do it
-	// here because DoRaw receives the session ID as an opaque string.
-	sessionID := ctx.SessionID
+	// here because DoRaw receives the session ID as an opaque string. An
+	// explicit X-Session-Id or client prompt_cache_key wins over the derived one.
+	clientSessionID := types.FirstNonEmpty(ctx.SessionID, strings.TrimSpace(stream.StringFromAny(raw["prompt_cache_key"])))
+	sessionID := clientSessionID
 	if sessionID == "" {
 		inputItems := extractInputItemsFromRaw(raw)
 		sessionID = p.Upstream.Sessions.EnsureSessionID(instructions, inputItems, "")
@@ -193,7 +313,7 @@ func (p *Pipeline) ExecutePassthrough(
 			"reasoning_effort", reasoningEffort,
 			"reasoning_summary", reasoningSummary,
 			"session_id", sessionID,
-			"session_override", ctx.SessionID != "",
+			"session_override", clientSessionID != "",
 		)
 	}
 
@@ -207,29 +327,28 @@ func (p *Pipeline) ExecutePassthrough(
 	// Send upstream via DoRaw
 	resp, err := p.Upstream.DoRaw(ctx.Context, patchedBody, sessionID)
 	if err != nil {
-		if errors.Is(err, auth.ErrNoCredentials) {
-			writeErr(http.StatusUnauthorized, err.Error())
-		} else {
-			writeErr(http.StatusBadGateway, err.Error())
-		}
+		writeUpstreamError(w, enc, rawErrorStatus(err), err.Error(), streamReq)
 		return
 	}
 	limits.RecordFromResponse(resp.Headers)
 
 	if resp.StatusCode >= 400 {
-		defer resp.Body.Body.Close()
 		errBody, _ := io.ReadAll(resp.Body.Body)
-		writeErr(resp.StatusCode, codec.FormatUpstreamError(resp.StatusCode, errBody))
-		return
+		resp.Body.Body.Close()
+		status := resp.StatusCode
+		if truncation == "auto" && state.IsContextLengthError(errBody) {
+			resp, status, errBody = p.sendTruncated(ctx.Context, raw, sessionID, status, errBody)
+		}
+		if resp == nil || resp.StatusCode >= 400 {
+			writeUpstreamError(w, enc, status, codec.FormatUpstreamError(status, errBody), streamReq)
+			return
+		}
 	}
 
 	// Extract input items for state storage
 	inputItems := extractInputItemsFromRaw(raw)
 
-	outputModel := requestedModel
-	if outputModel == "" {
-		outputModel = model
-	}
+	outputModel := p.Config.ResponseModel(requestedModel, model)
 
 	if streamReq {
 		flusher, ok := w.(http.Flusher)
@@ -238,41 +357,169 @@ func (p *Pipeline) ExecutePassthrough(
 			resp.Body.Body.Close()
 			return
 		}
+		reader := p.newReader(resp.Body.Body)
+		reader.LimitToolCalls(p.Config.MaxParallelToolCalls)
+		reader.LimitOutputTokens(outputLimit)
+		if msg, ok := failedBeforeOutput(reader); ok {
+			resp.Body.Body.Close()
+			slog.Warn("upstream.failed_before_output", "model", model, "error", msg)
+			writeErr(http.StatusBadGateway, msg)
+			return
+		}
 		enc.WriteStreamHeaders(w, resp.StatusCode)
-		p.streamResponsesPassthrough(w, flusher, resp, inputItems, instructions, conversationID)
+		usage := &stream.UsageShaper{Mode: usageMode}
+		if usageMode == stream.UsageRequired {
+			usage.InputTokens = int64(transform.EstimateResponsesInputTokens(instructions, inputItems, nil))
+		}
+		p.streamResponsesPassthrough(w, flusher, resp, reader, model, raw["tool_choice"], inputItems, instructions, conversationID, metadata, storeOutput, usage, stripReasoning, p.Config.RenumberOutputIndices && previousResponseID != "", p.Config.SystemFingerprint(model))
 		return
 	}
-	p.collectResponsesPassthrough(w, resp, enc, outputModel, inputItems, instructions, conversationID)
+	retry := func() (*codec.CollectedResponse, bool) {
+		return p.retryRawForToolCall(ctx.Context, raw, sessionID, outputLimit)
+	}
+	p.collectResponsesPassthrough(w, resp, enc, model, outputModel, raw["tool_choice"], retry, inputItems, instructions, conversationID, metadata, storeOutput, stripReasoning, outputLimit)
 }
 
-// streamResponsesPassthrough forwards upstream SSE events as-is while capturing state.
+// sendTruncated retries a truncation: "auto" request that upstream rejected
+// for exceeding the context window, dropping the older half of the remaining
+// history (normalize.TrimHistory) on each attempt. raw["input"] is left
+// trimmed so the stored state matches what upstream saw. It returns the first
+// accepted response, or nil with the last error status and body.
+func (p *Pipeline) sendTruncated(ctx context.Context, raw map[string]any, sessionID string, status int, errBody []byte) (*upstream.Response, int, []byte) {
+	for state.IsContextLengthError(errBody) {
+		trimmed, dropped := normalize.TrimHistory(extractInputItemsFromRaw(raw))
+		if dropped == 0 || !upstream.CanRetry(ctx, "truncation") {
+			break
+		}
+		raw["input"] = trimmed
+		if p.Config.Verbose {
+			slog.Info("request.truncated", "route", "responses", "dropped_items", dropped, "kept_items", len(trimmed))
+		}
+		body, err := json.Marshal(raw)
+		if err != nil {
+			break
+		}
+		resp, err := p.Upstream.DoRaw(ctx, body, sessionID)
+		if err != nil {
+			return nil, rawErrorStatus(err), []byte(err.Error())
+		}
+		limits.RecordFromResponse(resp.Headers)
+		if resp.StatusCode < 400 {
+			return resp, resp.StatusCode, nil
+		}
+		status = resp.StatusCode
+		errBody, _ = io.ReadAll(resp.Body.Body)
+		resp.Body.Body.Close()
+	}
+	return nil, status, errBody
+}
+
+// retryRawForToolCall is retryForToolCall for the passthrough: raw is re-sent
+// once with the nudge message appended to its input.
+func (p *Pipeline) retryRawForToolCall(ctx context.Context, raw map[string]any, sessionID string, outputLimit int) (*codec.CollectedResponse, bool) {
+	if !upstream.CanRetry(ctx, "tool_choice") {
+		return nil, false
+	}
+	nudged := maps.Clone(raw)
+	nudged["input"] = nudgedInput(extractInputItemsFromRaw(raw))
+	body, err := json.Marshal(nudged)
+	if err != nil {
+		return nil, false
+	}
+	resp, err := p.Upstream.DoRaw(ctx, body, sessionID)
+	if err != nil {
+		slog.Warn("tool_choice.retry_failed", "status", rawErrorStatus(err), "error", err)
+		return nil, false
+	}
+	defer resp.Body.Body.Close()
+	if resp.StatusCode >= 400 {
+		slog.Warn("tool_choice.retry_failed", "status", resp.StatusCode)
+		return nil, false
+	}
+	collected := p.collectFullResponse(resp.Body.Body, outputLimit)
+	if collected.ErrorMessage != "" || len(collected.ToolCalls) == 0 {
+		return nil, false
+	}
+	return collected, true
+}
+
+// rawErrorStatus maps a DoRaw error to the status reported to the client:
+// 401 without credentials, 429 when every upstream slot is busy, the error's
+// own status for an upstream.UpstreamError, 502 otherwise.
+func rawErrorStatus(err error) int {
+	var upErr *upstream.UpstreamError
+	switch {
+	case errors.Is(err, auth.ErrNoCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, upstream.ErrConcurrencyLimited):
+		return http.StatusTooManyRequests
+	case errors.As(err, &upErr):
+		return upErr.StatusCode
+	}
+	return http.StatusBadGateway
+}
+
+// streamResponsesPassthrough forwards upstream SSE events as-is while capturing
+// state. With stripReasoning, reasoning items are captured but not forwarded;
+// with renumber, output indices are made contiguous (--renumber-output-indices);
+// a non-empty fingerprint is stamped on response objects (--system-fingerprint).
 func (p *Pipeline) streamResponsesPassthrough(
 	w http.ResponseWriter,
 	flusher http.Flusher,
 	resp *upstream.Response,
+	reader *stream.Reader,
+	model string,
+	toolChoice any,
 	inputItems []types.ResponsesInputItem,
 	instructions string,
 	conversationID string,
+	metadata map[string]string,
+	storeOutput bool,
+	usage *stream.UsageShaper,
+	stripReasoning bool,
+	renumber bool,
+	fingerprint string,
 ) {
 	defer resp.Body.Body.Close()
 
-	reader := stream.NewReader(resp.Body.Body)
+	if bw := codec.StartBatchWriter(w, p.Config.SSEFlushInterval); bw != nil {
+		w, flusher = bw, bw
+		reader.OnEvent(bw.Observe)
+		defer bw.Stop()
+	}
+	hb := codec.StartHeartbeat(w, flusher, p.Config.ResponsesHeartbeat)
 	var responseID string
 	var toolCalls []state.FunctionCall
-	var outputItems []types.ResponsesOutputItem
+	var output streamedOutput
 	sentDone := false
+	var readErr error
+	var reasoning stream.ReasoningStripper
+	var indices stream.OutputRenumberer
 
 	for {
 		evt, err := reader.Next()
 		if err != nil {
+			readErr = err
 			break
 		}
 
-		if evt.Type != "" {
-			fmt.Fprintf(w, "event: %s\n", evt.Type)
+		hb.Lock()
+		hb.Observe(evt)
+		if !stripReasoning || reasoning.Keep(evt) {
+			if evt.Type != "" {
+				fmt.Fprintf(w, "event: %s\n", evt.Type)
+			}
+			stream.SetSystemFingerprint(evt, fingerprint)
+			if !p.Config.ForwardObfuscation {
+				stream.StripObfuscation(evt)
+			}
+			if renumber {
+				indices.Apply(evt)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", usage.Apply(evt))
+			flusher.Flush()
 		}
-		fmt.Fprintf(w, "data: %s\n\n", evt.Raw)
-		flusher.Flush()
+		hb.Unlock()
 
 		if id := stream.ResponseIDFromEvent(evt.Data); id != "" {
 			responseID = id
@@ -285,11 +532,12 @@ func (p *Pipeline) streamResponsesPassthrough(
 				if ok {
 					toolCalls = append(toolCalls, fc)
 				}
-				outputItems = append(outputItems, unmarshalOutputItem(item))
 			}
 		}
+		output.observe(evt)
 
-		if evt.Type == "response.completed" || evt.Type == "response.failed" {
+		if evt.Type == "response.completed" || evt.Type == "response.failed" || evt.Type == "response.incomplete" {
+			hb.Stop()
 			fmt.Fprint(w, "data: [DONE]\n\n")
 			flusher.Flush()
 			sentDone = true
@@ -298,48 +546,89 @@ func (p *Pipeline) streamResponsesPassthrough(
 	}
 
 	if !sentDone {
+		hb.Stop()
+		if reason := codec.StreamEndReason(readErr); reason != "" {
+			fmt.Fprintf(w, "event: response.incomplete\ndata: %s\n\n", codec.IncompleteEvent(responseID, reason))
+		}
 		fmt.Fprint(w, "data: [DONE]\n\n")
 		flusher.Flush()
 	}
+	if toolChoiceRequired(toolChoice) && len(toolCalls) == 0 {
+		warnToolChoiceIgnored(model, toolChoice)
+	}
 
-	delta := outputItemsToInputItems(outputItems)
-	combined := appendContextHistory(inputItems, delta)
+	delta := output.inputItems()
+	combined := p.appendContextHistory("", inputItems, delta)
 	p.Store.PutSnapshot(responseID, combined, toolCalls)
+	if storeOutput {
+		p.Store.PutOutput(responseID, p.appendContextHistory("", nil, delta))
+	}
 	p.Store.PutInstructions(responseID, instructions)
 	p.Store.PutConversationLatest(conversationID, responseID)
+	p.Store.PutMetadata(responseID, metadata)
 }
 
-// collectResponsesPassthrough collects a non-streaming responses response with state.
+// collectResponsesPassthrough collects a non-streaming responses response with
+// state, applying --enforce-tool-choice with retry.
 func (p *Pipeline) collectResponsesPassthrough(
 	w http.ResponseWriter,
 	resp *upstream.Response,
 	enc codec.Encoder,
+	model string,
 	outputModel string,
+	toolChoice any,
+	retry func() (*codec.CollectedResponse, bool),
 	inputItems []types.ResponsesInputItem,
 	instructions string,
 	conversationID string,
+	metadata map[string]string,
+	storeOutput bool,
+	stripReasoning bool,
+	outputLimit int,
 ) {
 	defer resp.Body.Body.Close()
 
-	collected := collectFullResponse(resp.Body.Body)
+	collected := p.collectFullResponse(resp.Body.Body, outputLimit)
+	collected, msg := p.enforceToolChoice(model, toolChoice, collected, retry)
+	if msg != "" {
+		enc.WriteError(w, http.StatusBadGateway, msg)
+		return
+	}
+	collected.SystemFingerprint = p.Config.SystemFingerprint(model)
 
 	// Store state
 	delta := outputItemsToInputItems(collected.OutputItems)
 	calls := extractFunctionCalls(delta)
-	combined := appendContextHistory(inputItems, delta)
+	combined := p.appendContextHistory("", inputItems, delta)
 	p.Store.PutSnapshot(collected.ResponseID, combined, calls)
+	if storeOutput {
+		p.Store.PutOutput(collected.ResponseID, p.appendContextHistory("", nil, delta))
+	}
 	p.Store.PutInstructions(collected.ResponseID, instructions)
 	p.Store.PutConversationLatest(conversationID, collected.ResponseID)
+	p.Store.PutMetadata(collected.ResponseID, metadata)
+
+	if stripReasoning {
+		collected.OutputItems = slices.DeleteFunc(collected.OutputItems, func(item types.ResponsesOutputItem) bool {
+			return item.Type == "reasoning"
+		})
+		stream.StripReasoningOutput(collected.RawResponse)
+	}
 
 	if collected.ErrorMessage != "" {
 		enc.WriteError(w, http.StatusBadGateway, collected.ErrorMessage)
 		return
 	}
 
+	p.Config.CostPrices.SetHeader(w, model, collected.Usage)
+	if p.Config.TruncationNotice {
+		codec.SetTruncatedHeader(w, collected.IncompleteReason)
+	}
 	enc.WriteCollected(w, resp.StatusCode, collected, outputModel)
 }
 
-// restorePreviousContext prepends stored context from a previous response.
+// restorePreviousContext prepends stored context from a previous response,
+// resolving any item_reference in input in place.
 func restorePreviousContext(store *state.Store, raw map[string]any, previousResponseID string) (any, error) {
 	ctx, ok := store.GetContext(previousResponseID)
 	if !ok {
@@ -361,12 +650,27 @@ func restorePreviousContext(store *state.Store, raw map[string]any, previousResp
 		}
 	}
 
-	combined := make([]types.ResponsesInputItem, 0, len(ctx)+len(currentItems))
-	combined = append(combined, ctx...)
+	currentItems, rest, err := state.ResolveItemReferences(currentItems, ctx)
+	if err != nil {
+		return nil, err
+	}
+	combined := make([]types.ResponsesInputItem, 0, len(rest)+len(currentItems))
+	combined = append(combined, rest...)
 	combined = append(combined, currentItems...)
 	return combined, nil
 }
 
+// userTextInputItem returns a raw user message input item holding text.
+func userTextInputItem(text string) map[string]any {
+	return map[string]any{
+		"type": "message",
+		"role": "user",
+		"content": []any{
+			map[string]any{"type": "input_text", "text": text},
+		},
+	}
+}
+
 // extractInputItemsFromRaw extracts ResponsesInputItem from the raw map.
 func extractInputItemsFromRaw(raw map[string]any) []types.ResponsesInputItem {
 	inputRaw, ok := raw["input"]
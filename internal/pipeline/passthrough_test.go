@@ -0,0 +1,713 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/auth"
+	"github.com/n0madic/go-chatmock/internal/codec"
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/models"
+	"github.com/n0madic/go-chatmock/internal/normalize"
+	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/types"
+	"github.com/n0madic/go-chatmock/internal/upstream"
+)
+
+// captureTransport records the last upstream request and replies with a
+// minimal completed SSE stream, or with the configured status/content
+// type/body. Queued sse replies are served first, one per request.
+type captureTransport struct {
+	body   map[string]any
+	header http.Header
+	calls  int
+
+	status      int
+	contentType string
+	reply       string
+	sse         []string
+}
+
+func (c *captureTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	data, _ := io.ReadAll(r.Body)
+	c.body = nil
+	json.Unmarshal(data, &c.body) //nolint:errcheck
+	c.header = r.Header.Clone()
+	c.calls++
+	if len(c.sse) > 0 {
+		reply := c.sse[0]
+		c.sse = c.sse[1:]
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader(reply)),
+			Request:    r,
+		}, nil
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+		c.contentType = "text/event-stream"
+		c.reply = "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"output\":[]}}\n\n"
+	}
+	return &http.Response{
+		StatusCode: c.status,
+		Header:     http.Header{"Content-Type": []string{c.contentType}},
+		Body:       io.NopCloser(strings.NewReader(c.reply)),
+		Request:    r,
+	}, nil
+}
+
+func newPassthroughTestPipeline(t *testing.T) (*Pipeline, *captureTransport) {
+	t.Helper()
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	transport := &captureTransport{}
+	uc := upstream.NewClient(auth.NewTokenManager("", ""), false, false)
+	uc.HTTPClient = &http.Client{Transport: transport}
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	return &Pipeline{
+		Config:   &config.ServerConfig{ReasoningEffort: "medium", ReasoningSummary: "auto"},
+		Store:    store,
+		Upstream: uc,
+		Registry: &models.Registry{},
+	}, transport
+}
+
+func TestPassthroughForwardsClientPromptCacheKey(t *testing.T) {
+	p, transport := newPassthroughTestPipeline(t)
+	body := []byte(`{"model":"gpt-5","input":"hi","prompt_cache_key":"client-group-7"}`)
+
+	rec := httptest.NewRecorder()
+	p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	if got := transport.body["prompt_cache_key"]; got != "client-group-7" {
+		t.Errorf("prompt_cache_key: got %v, want client-group-7", got)
+	}
+	if got := transport.header.Get("session_id"); got != "client-group-7" {
+		t.Errorf("session_id header: got %q, want client-group-7", got)
+	}
+}
+
+func TestPassthroughDerivesPromptCacheKeyWhenAbsent(t *testing.T) {
+	p, transport := newPassthroughTestPipeline(t)
+	body := []byte(`{"model":"gpt-5","input":"hi"}`)
+
+	rec := httptest.NewRecorder()
+	p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+	key, _ := transport.body["prompt_cache_key"].(string)
+	if key == "" {
+		t.Fatalf("expected a derived prompt_cache_key, got %v", transport.body["prompt_cache_key"])
+	}
+	if got := transport.header.Get("session_id"); got != key {
+		t.Errorf("session_id header: got %q, want %q", got, key)
+	}
+}
+
+func TestSafetyIdentifierForwardedUpstream(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		body        string
+		passthrough bool
+		want        string
+	}{
+		{name: "chat", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"safety_identifier":"user-hash-1"}`, want: "user-hash-1"},
+		{name: "chat user fallback", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"user":"legacy-user"}`, want: "legacy-user"},
+		{name: "passthrough", body: `{"model":"gpt-5","input":"hi","safety_identifier":"user-hash-2"}`, passthrough: true, want: "user-hash-2"},
+		{name: "passthrough user fallback", body: `{"model":"gpt-5","input":"hi","user":"legacy-user"}`, passthrough: true, want: "legacy-user"},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background()}
+		if tt.passthrough {
+			p.ExecutePassthrough(ctx, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(ctx, rec, []byte(tt.body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+		if got := transport.body["safety_identifier"]; got != tt.want {
+			t.Errorf("%s: safety_identifier got %v, want %q", tt.name, got, tt.want)
+		}
+		if _, ok := transport.body["user"]; ok {
+			t.Errorf("%s: user must not be sent upstream", tt.name)
+		}
+	}
+}
+
+func TestExpiredConversationLinkWarnsAndStartsFresh(t *testing.T) {
+	p, transport := newPassthroughTestPipeline(t)
+	p.Config.Verbose = true
+	p.Store.PutConversationLatest("conv_1", "resp_expired")
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	rec := httptest.NewRecorder()
+	body := []byte(`{"model":"gpt-5","input":"still there?","conversation_id":"conv_1"}`)
+	p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(logs.String(), "conversation.context_expired") || !strings.Contains(logs.String(), "resp_expired") {
+		t.Errorf("expected a context_expired warning naming resp_expired, got %q", logs.String())
+	}
+	if input, _ := transport.body["input"].([]any); len(input) != 1 {
+		t.Errorf("upstream input: got %v, want only the new message", transport.body["input"])
+	}
+}
+
+func TestAllowedIncludesFiltersUpstreamInclude(t *testing.T) {
+	body := []byte(`{"model":"gpt-5","input":"hi","include":["file_search_call.results","message.output_text.logprobs","usage"]}`)
+	for _, passthrough := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.AllowedIncludes = "message.output_text.logprobs"
+		p.Upstream.OmitReasoningInclude = true
+
+		rec := httptest.NewRecorder()
+		if passthrough {
+			p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(&RequestContext{Context: context.Background()}, rec, body, "responses", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("passthrough=%v: status %d, body %s", passthrough, rec.Code, rec.Body.String())
+		}
+		got, _ := transport.body["include"].([]any)
+		if len(got) != 1 || got[0] != "message.output_text.logprobs" {
+			t.Errorf("passthrough=%v: upstream include got %v, want only the allowed value", passthrough, transport.body["include"])
+		}
+	}
+}
+
+func TestStreamingRequestSurfacesUpstreamJSONError(t *testing.T) {
+	const msg = "The requested model is not supported for this account."
+	for _, status := range []int{http.StatusBadRequest, http.StatusOK} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.status = status
+		transport.contentType = "application/json"
+		transport.reply = `{"detail":"` + msg + `"}`
+
+		rec := httptest.NewRecorder()
+		body := []byte(`{"model":"gpt-5","input":"hi","stream":true}`)
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+
+		if rec.Code < 400 {
+			t.Errorf("upstream %d: client status got %d, want an error status", status, rec.Code)
+		}
+		if got := rec.Body.String(); !strings.Contains(got, msg) || strings.Contains(got, "empty response") {
+			t.Errorf("upstream %d: client body should carry the upstream message, got %s", status, got)
+		}
+	}
+}
+
+func TestStreamingFailureBeforeOutputIsPlainError(t *testing.T) {
+	const msg = "Request blocked by content policy."
+	for _, passthrough := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.sse = []string{`data: {"type":"response.failed","response":{"id":"resp_1","error":{"message":"` + msg + `"}}}` + "\n\n"}
+
+		rec := httptest.NewRecorder()
+		if passthrough {
+			body := []byte(`{"model":"gpt-5","input":"hi","stream":true}`)
+			p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+		} else {
+			body := []byte(`{"model":"gpt-5","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+			p.Execute(&RequestContext{Context: context.Background()}, rec, body, "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("passthrough=%v: status got %d, want 502", passthrough, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct == "text/event-stream" {
+			t.Errorf("passthrough=%v: got a stream, want a plain error response", passthrough)
+		}
+		var errResp types.ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil || errResp.Error.Message != msg {
+			t.Errorf("passthrough=%v: body got %s, want an error carrying %q", passthrough, rec.Body.String(), msg)
+		}
+	}
+
+	// A failure after output has started still ends the stream as before.
+	p, transport := newPassthroughTestPipeline(t)
+	transport.sse = []string{"data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\"}}\n\n" +
+		`data: {"type":"response.failed","response":{"id":"resp_1","error":{"message":"` + msg + `"}}}` + "\n\n"}
+	rec := httptest.NewRecorder()
+	p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(`{"model":"gpt-5","input":"hi","stream":true}`), &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "response.failed") {
+		t.Errorf("mid-stream failure: got %d %s, want the failure forwarded in the stream", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStreamingUpstream401CarriesLoginHint(t *testing.T) {
+	for _, passthrough := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.status = http.StatusUnauthorized
+		transport.contentType = "application/json"
+		transport.reply = `{"detail":"Could not validate credentials"}`
+
+		rec := httptest.NewRecorder()
+		if passthrough {
+			body := []byte(`{"model":"gpt-5","input":"hi","stream":true}`)
+			p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+		} else {
+			body := []byte(`{"model":"gpt-5","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+			p.Execute(&RequestContext{Context: context.Background()}, rec, body, "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("passthrough=%v: status got %d, want 401", passthrough, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("passthrough=%v: content-type got %q, want text/event-stream", passthrough, ct)
+		}
+		var errEvent string
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok && strings.Contains(data, "error") {
+				errEvent = data
+			}
+		}
+		if !strings.Contains(errEvent, codec.LoginHint) || !strings.Contains(errEvent, "Could not validate credentials") {
+			t.Errorf("passthrough=%v: error event should carry the upstream message and login hint, got %s", passthrough, rec.Body.String())
+		}
+	}
+}
+
+func TestPassthroughStreamUsageFollowsInclude(t *testing.T) {
+	const (
+		withUsage = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hello there\"}\n\n" +
+			"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_u\",\"usage\":{\"input_tokens\":7,\"output_tokens\":3,\"total_tokens\":10}}}\n\n"
+		withoutUsage = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hello there\"}\n\n" +
+			"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_u\"}}\n\n"
+	)
+	for _, tt := range []struct {
+		name      string
+		include   string
+		sse       string
+		wantUsage bool
+	}{
+		{name: "include usage synthesizes", include: `,"include":["usage"]`, sse: withoutUsage, wantUsage: true},
+		{name: "include usage keeps upstream", include: `,"include":["usage"]`, sse: withUsage, wantUsage: true},
+		{name: "include without usage strips", include: `,"include":["reasoning.encrypted_content"]`, sse: withUsage},
+		{name: "no include is verbatim", sse: withUsage, wantUsage: true},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.sse = []string{tt.sse}
+		body := []byte(`{"model":"gpt-5","stream":true,"input":"hi"` + tt.include + `}`)
+
+		rec := httptest.NewRecorder()
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+
+		for _, inc := range transport.body["include"].([]any) {
+			if inc == "usage" {
+				t.Errorf("%s: include usage must not be sent upstream", tt.name)
+			}
+		}
+		var completed map[string]any
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			if data, ok := strings.CutPrefix(line, "data: "); ok && strings.Contains(data, "response.completed") {
+				json.Unmarshal([]byte(data), &completed) //nolint:errcheck
+			}
+		}
+		resp, _ := completed["response"].(map[string]any)
+		usage, hasUsage := resp["usage"].(map[string]any)
+		if hasUsage != tt.wantUsage {
+			t.Errorf("%s: usage present got %v, want %v (%s)", tt.name, hasUsage, tt.wantUsage, rec.Body.String())
+			continue
+		}
+		if hasUsage && (usage["output_tokens"].(float64) <= 0 || usage["total_tokens"].(float64) <= 0) {
+			t.Errorf("%s: usage should carry token counts, got %v", tt.name, usage)
+		}
+	}
+}
+
+func TestForcedReasoningIncludeStripsReasoningItems(t *testing.T) {
+	const sse = "data: {\"type\":\"response.output_item.added\",\"output_index\":0,\"item\":{\"type\":\"reasoning\",\"id\":\"rs_1\"}}\n\n" +
+		"data: {\"type\":\"response.reasoning_summary_text.delta\",\"item_id\":\"rs_1\",\"delta\":\"thinking\"}\n\n" +
+		"data: {\"type\":\"response.content_part.done\",\"item_id\":\"rs_1\",\"output_index\":0,\"part\":{\"type\":\"summary_text\"}}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"output_index\":0,\"item\":{\"type\":\"reasoning\",\"id\":\"rs_1\",\"encrypted_content\":\"gAAA\"}}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"output_index\":1,\"item\":{\"type\":\"message\",\"id\":\"msg_1\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"Hi.\"}]}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_r\",\"output\":[{\"type\":\"reasoning\",\"id\":\"rs_1\",\"encrypted_content\":\"gAAA\"},{\"type\":\"message\",\"id\":\"msg_1\"}]}}\n\n"
+	for _, tt := range []struct {
+		name      string
+		include   string
+		wantShown bool
+	}{
+		{name: "forced include", include: ""},
+		{name: "client include", include: `,"include":["reasoning.encrypted_content"]`, wantShown: true},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.sse = []string{sse}
+		body := []byte(`{"model":"gpt-5","stream":true,"input":"hi"` + tt.include + `}`)
+
+		rec := httptest.NewRecorder()
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+
+		out := rec.Body.String()
+		if shown := strings.Contains(out, "rs_1"); shown != tt.wantShown {
+			t.Errorf("%s: reasoning in client stream got %v, want %v (%s)", tt.name, shown, tt.wantShown, out)
+		}
+		if !strings.Contains(out, "msg_1") || !strings.Contains(out, "response.completed") {
+			t.Errorf("%s: message and completed events must be forwarded (%s)", tt.name, out)
+		}
+		wantIndex := 0
+		if tt.wantShown {
+			wantIndex = 1
+		}
+		if got := messageOutputIndex(out); got != wantIndex {
+			t.Errorf("%s: message output_index got %d, want %d (%s)", tt.name, got, wantIndex, out)
+		}
+		stored, ok := p.Store.Inspect("resp_r")
+		if !ok || len(stored.Context) != 2 || stored.Context[1].ID != "msg_1" {
+			t.Errorf("%s: stored state got %+v (found %v), want the input and the answer", tt.name, stored.Context, ok)
+		}
+	}
+}
+
+// messageOutputIndex returns the output_index of the message output_item.done
+// event in a Responses SSE body, or -1.
+func messageOutputIndex(sse string) int {
+	for _, line := range strings.Split(sse, "\n") {
+		var evt struct {
+			Type        string `json:"type"`
+			OutputIndex int    `json:"output_index"`
+			Item        struct {
+				Type string `json:"type"`
+			} `json:"item"`
+		}
+		if json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &evt) == nil &&
+			evt.Type == "response.output_item.done" && evt.Item.Type == "message" {
+			return evt.OutputIndex
+		}
+	}
+	return -1
+}
+
+func TestLegacyGenerateSummaryForwardedAsSummary(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		body        string
+		passthrough bool
+	}{
+		{name: "passthrough", body: `{"model":"gpt-5","input":"hi","reasoning":{"effort":"high","generate_summary":"detailed"}}`, passthrough: true},
+		{name: "responses", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"reasoning":{"effort":"high","generate_summary":"detailed"}}`},
+		{name: "chat", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"reasoning":{"generate_summary":"concise"}}`},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background()}
+		route := tt.name
+		if tt.passthrough {
+			p.ExecutePassthrough(ctx, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(ctx, rec, []byte(tt.body), route, &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+		want := "detailed"
+		if route == "chat" {
+			want = "concise"
+		}
+		reasoningParam, _ := transport.body["reasoning"].(map[string]any)
+		if got := reasoningParam["summary"]; got != want {
+			t.Errorf("%s: reasoning.summary got %v, want %q (reasoning %v)", tt.name, got, want, transport.body["reasoning"])
+		}
+		if _, ok := reasoningParam["generate_summary"]; ok {
+			t.Errorf("%s: generate_summary must not be sent upstream", tt.name)
+		}
+	}
+}
+
+func TestStripEmptyToolResultsKeepsCallPairing(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		body        string
+		passthrough bool
+	}{
+		{name: "chat", body: `{"model":"gpt-5","messages":[{"role":"user","content":"run it"},` +
+			`{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"run","arguments":"{}"}}]},` +
+			`{"role":"tool","tool_call_id":"call_1","content":""}]}`},
+		{name: "passthrough", body: `{"model":"gpt-5","input":[{"role":"user","content":"run it"},` +
+			`{"type":"function_call","call_id":"call_1","name":"run","arguments":"{}"},` +
+			`{"type":"function_call_output","call_id":"call_1","output":""}]}`, passthrough: true},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.StripEmptyToolResults = true
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background()}
+		if tt.passthrough {
+			p.ExecutePassthrough(ctx, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(ctx, rec, []byte(tt.body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+
+		input, _ := transport.body["input"].([]any)
+		var call, output map[string]any
+		for _, v := range input {
+			item, _ := v.(map[string]any)
+			switch item["type"] {
+			case "function_call":
+				call = item
+			case "function_call_output":
+				output = item
+			}
+		}
+		if call == nil || output == nil {
+			t.Fatalf("%s: expected the call and its output upstream, got %v", tt.name, input)
+		}
+		if output["output"] != normalize.EmptyToolOutputPlaceholder {
+			t.Errorf("%s: output got %q, want %q", tt.name, output["output"], normalize.EmptyToolOutputPlaceholder)
+		}
+		if call["call_id"] != "call_1" || output["call_id"] != "call_1" {
+			t.Errorf("%s: call_id pairing lost: call %v, output %v", tt.name, call["call_id"], output["call_id"])
+		}
+	}
+}
+
+func TestStreamedStoreKeepsAssistantTextForFollowUp(t *testing.T) {
+	// The message item is never closed: the answer only arrives as deltas,
+	// followed by a tool call.
+	const sse = "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_s\"}}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"Checking \"}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"the weather.\"}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"weather\",\"arguments\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_s\"}}\n\n"
+	for _, passthrough := range []bool{true, false} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.sse = []string{sse, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_t\"}}\n\n"}
+
+		run := func(body string) string {
+			rec := httptest.NewRecorder()
+			ctx := &RequestContext{Context: context.Background()}
+			if passthrough {
+				p.ExecutePassthrough(ctx, rec, []byte(body), &codec.ResponsesEncoder{})
+			} else {
+				p.Execute(ctx, rec, []byte(body), "responses", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+			}
+			return rec.Body.String()
+		}
+
+		if out := run(`{"model":"gpt-5","stream":true,"store":true,"input":"weather?"}`); !strings.Contains(out, "the weather.") {
+			t.Fatalf("passthrough=%v: deltas must reach the client (%s)", passthrough, out)
+		}
+		stored, ok := p.Store.Inspect("resp_s")
+		if !ok || len(stored.Context) != 3 {
+			t.Fatalf("passthrough=%v: stored state got %+v (found %v), want input, answer and call", passthrough, stored.Context, ok)
+		}
+		if msg := stored.Context[1]; msg.Role != "assistant" || len(msg.Content) != 1 || msg.Content[0].Text != "Checking the weather." {
+			t.Errorf("passthrough=%v: stored answer got %+v", passthrough, msg)
+		}
+
+		run(`{"model":"gpt-5","stream":true,"previous_response_id":"resp_s","input":[{"type":"function_call_output","call_id":"call_1","output":"sunny"}]}`)
+		input, _ := json.Marshal(transport.body["input"])
+		if !strings.Contains(string(input), "Checking the weather.") || !strings.Contains(string(input), "call_1") {
+			t.Errorf("passthrough=%v: follow-up input should replay the streamed turn, got %s", passthrough, input)
+		}
+	}
+}
+
+// contextLimitTransport rejects requests whose input has more than limit
+// items the way upstream reports a context window overflow.
+type contextLimitTransport struct {
+	limit  int
+	inputs []int
+}
+
+func (c *contextLimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body struct {
+		Input []any `json:"input"`
+	}
+	data, _ := io.ReadAll(r.Body)
+	json.Unmarshal(data, &body) //nolint:errcheck
+	c.inputs = append(c.inputs, len(body.Input))
+	status, reply := http.StatusOK, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"output\":[]}}\n\n"
+	if len(body.Input) > c.limit {
+		status, reply = http.StatusBadRequest, `{"error":{"code":"context_length_exceeded","message":"Your input exceeds the context window of this model."}}`
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(reply)),
+		Request:    r,
+	}, nil
+}
+
+func TestTruncationAutoTrimsOversizedInput(t *testing.T) {
+	var turns []string
+	for i := range 6 {
+		turns = append(turns,
+			fmt.Sprintf(`{"role":"user","content":"question %d"}`, i),
+			fmt.Sprintf(`{"role":"assistant","content":"answer %d"}`, i))
+	}
+	input := "[" + strings.Join(turns, ",") + `,{"role":"user","content":"latest"}]`
+
+	for _, field := range []string{"input", "messages"} {
+		for _, tt := range []struct {
+			truncation string
+			wantStatus int
+			wantCalls  int
+		}{
+			{truncation: "auto", wantStatus: http.StatusOK, wantCalls: 3},
+			{truncation: "disabled", wantStatus: http.StatusBadRequest, wantCalls: 1},
+			{truncation: "", wantStatus: http.StatusBadRequest, wantCalls: 1},
+			{truncation: "sometimes", wantStatus: http.StatusBadRequest, wantCalls: 0},
+		} {
+			p, _ := newPassthroughTestPipeline(t)
+			transport := &contextLimitTransport{limit: 4}
+			p.Upstream.HTTPClient = &http.Client{Transport: transport}
+			body := `{"model":"gpt-5","stream":false,"` + field + `":` + input
+			if tt.truncation != "" {
+				body += `,"truncation":"` + tt.truncation + `"`
+			}
+			body += "}"
+
+			rec := httptest.NewRecorder()
+			ctx := &RequestContext{Context: context.Background()}
+			if field == "input" {
+				p.ExecutePassthrough(ctx, rec, []byte(body), &codec.ResponsesEncoder{})
+			} else {
+				p.Execute(ctx, rec, []byte(body), "responses", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+			}
+			if rec.Code != tt.wantStatus || len(transport.inputs) != tt.wantCalls {
+				t.Errorf("%s truncation=%q: got status %d after upstream inputs %v, want %d after %d calls (%s)",
+					field, tt.truncation, rec.Code, transport.inputs, tt.wantStatus, tt.wantCalls, rec.Body.String())
+			}
+		}
+	}
+}
+
+// limitedRetryTransport reports a context window overflow, then fails the
+// truncation retry the way a full upstream concurrency limiter does.
+type limitedRetryTransport struct{ calls int }
+
+func (c *limitedRetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.calls++
+	if c.calls > 1 {
+		return nil, upstream.ErrConcurrencyLimited
+	}
+	return &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"error":{"code":"context_length_exceeded","message":"Your input exceeds the context window of this model."}}`)),
+		Request:    r,
+	}, nil
+}
+
+func TestTruncationRetryConcurrencyLimitIs429(t *testing.T) {
+	p, _ := newPassthroughTestPipeline(t)
+	transport := &limitedRetryTransport{}
+	p.Upstream.HTTPClient = &http.Client{Transport: transport}
+	body := `{"model":"gpt-5","stream":false,"truncation":"auto","input":[` +
+		`{"role":"user","content":"first"},{"role":"assistant","content":"answer"},{"role":"user","content":"latest"}]}`
+
+	rec := httptest.NewRecorder()
+	p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+	if transport.calls != 2 || rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d after %d upstream calls, want 429 after the retry (%s)", rec.Code, transport.calls, rec.Body.String())
+	}
+}
+
+func TestPassthroughOutOfRangeSamplingParams(t *testing.T) {
+	const body = `{"model":"gpt-5","stream":false,"input":"hi","temperature":3,"presence_penalty":-5}`
+	for _, strict := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.StrictSamplingParams = strict
+
+		rec := httptest.NewRecorder()
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+		if strict {
+			if rec.Code != http.StatusBadRequest || transport.calls != 0 {
+				t.Errorf("strict: got status %d after %d upstream calls, want 400 before any (%s)", rec.Code, transport.calls, rec.Body.String())
+			}
+			continue
+		}
+		if rec.Code != http.StatusOK || transport.body["temperature"] != float64(2) || transport.body["presence_penalty"] != float64(-2) {
+			t.Errorf("default: got status %d and upstream temperature %v, presence_penalty %v; want clamped to 2 and -2",
+				rec.Code, transport.body["temperature"], transport.body["presence_penalty"])
+		}
+	}
+}
+
+func TestModelTemperatureDefaultOnlyWhenClientOmits(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		body     string
+		override bool
+		want     any
+	}{
+		{name: "omitted", body: `{"model":"gpt-5","input":"hi"}`, want: 0.3},
+		{name: "client set", body: `{"model":"gpt-5","input":"hi","temperature":1.2}`, want: 1.2},
+		{name: "other model", body: `{"model":"gpt-5-codex","input":"hi"}`, want: nil},
+		{name: "override", body: `{"model":"gpt-5","input":"hi","temperature":1.2}`, override: true, want: 0.3},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		rules := []config.TemperatureRule{{Pattern: "gpt-5", Value: 0.3}}
+		if tt.override {
+			p.Config.TemperatureOverrides = rules
+		} else {
+			p.Config.TemperatureDefaults = rules
+		}
+
+		rec := httptest.NewRecorder()
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		if got := transport.body["temperature"]; got != tt.want {
+			t.Errorf("%s: upstream temperature got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPassthroughStripsObfuscationPadding(t *testing.T) {
+	upstreamSSE := "event: response.output_text.delta\n" +
+		`data: {"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"content_index":0,"delta":"Hello","obfuscation":"x9Qz"}` + "\n\n" +
+		"event: response.completed\n" +
+		`data: {"type":"response.completed","response":{"id":"resp_1","output":[]}}` + "\n\n"
+
+	for _, forward := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.ForwardObfuscation = forward
+		transport.sse = []string{upstreamSSE}
+
+		rec := httptest.NewRecorder()
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(`{"model":"gpt-5","input":"hi","stream":true}`), &codec.ResponsesEncoder{})
+		out := rec.Body.String()
+		if got := strings.Contains(out, `"obfuscation"`); got != forward {
+			t.Errorf("forward=%v: obfuscation present %v in %s", forward, got, out)
+		}
+		if !strings.Contains(out, "event: response.output_text.delta\ndata: {") || !strings.Contains(out, `"delta":"Hello"`) {
+			t.Errorf("forward=%v: delta event not framed intact: %s", forward, out)
+		}
+		if !strings.HasSuffix(out, "data: [DONE]\n\n") {
+			t.Errorf("forward=%v: expected [DONE] terminator, got %s", forward, out)
+		}
+	}
+}
+
+func TestPassthroughPromotesBareStringInputItems(t *testing.T) {
+	p, transport := newPassthroughTestPipeline(t)
+	body := []byte(`{"model":"gpt-5","input":["hello",{"role":"user","content":"world"}]}`)
+
+	rec := httptest.NewRecorder()
+	p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, body, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	input, _ := transport.body["input"].([]any)
+	if len(input) != 2 {
+		t.Fatalf("upstream input: got %v, want 2 items", transport.body["input"])
+	}
+	first, _ := input[0].(map[string]any)
+	content, _ := first["content"].([]any)
+	if first["role"] != "user" || len(content) != 1 || content[0].(map[string]any)["text"] != "hello" {
+		t.Errorf("bare string was not promoted to a user message: %v", input[0])
+	}
+}
@@ -7,14 +7,19 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/n0madic/go-chatmock/internal/codec"
 	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/metrics"
 	"github.com/n0madic/go-chatmock/internal/models"
 	"github.com/n0madic/go-chatmock/internal/normalize"
+	"github.com/n0madic/go-chatmock/internal/reasoning"
 	"github.com/n0madic/go-chatmock/internal/state"
 	"github.com/n0madic/go-chatmock/internal/stream"
+	"github.com/n0madic/go-chatmock/internal/transform"
 	"github.com/n0madic/go-chatmock/internal/types"
 	"github.com/n0madic/go-chatmock/internal/upstream"
 )
@@ -51,11 +56,12 @@ func (p *Pipeline) Execute(
 		errEnc.WriteError(w, status, msg)
 	}
 
-	req, nerr := normalize.Enrich(body, route, p.Config, p.Store)
+	req, nerr := normalize.Enrich(body, route, p.Config, p.Store, p.Registry.Cached(), ctx.NoDefaultInstructions)
 	if nerr != nil {
 		writeErr(nerr.StatusCode, nerr.Message)
 		return
 	}
+	codec.SetDeprecationHeader(w, req.DeprecationNotice)
 
 	// Select encoder based on resolved response format (--response-format)
 	enc := chatEnc
@@ -64,7 +70,14 @@ func (p *Pipeline) Execute(
 	}
 	errEnc = enc
 
-	if ok, hint := p.Registry.IsKnownModel(req.Model); !ok && p.Config.DebugModel == "" {
+	// Accept: text/event-stream asks for streaming unless the body decides.
+	if ctx.AcceptStream && !req.StreamSet {
+		req.Stream = true
+	}
+
+	ok, hint := p.Registry.IsKnownModel(req.Model)
+	metrics.SetModels(ctx.Context, req.RequestedModel, req.Model, ok || p.Config.DebugModel != "")
+	if !ok && p.Config.DebugModel == "" {
 		msg := "model " + req.Model + " is not available via this endpoint"
 		if hint != "" {
 			msg += "; available models: " + hint
@@ -73,7 +86,12 @@ func (p *Pipeline) Execute(
 		return
 	}
 
-	p.logNormalizedRequest(route, req, ctx.SessionID)
+	// X-Session-Id takes precedence over a prompt_cache_key from the body.
+	sessionID := types.FirstNonEmpty(ctx.SessionID, req.SessionID)
+	p.logNormalizedRequest(route, req, sessionID)
+
+	// include: ["usage"] is handled locally and never sent upstream.
+	usageMode, include := stream.UsageModeFromInclude(req.Include)
 
 	upReq := &upstream.Request{
 		Model:             req.Model,
@@ -82,28 +100,69 @@ func (p *Pipeline) Execute(
 		Tools:             req.Tools,
 		ToolChoice:        req.ToolChoice,
 		ParallelToolCalls: req.ParallelToolCalls,
-		Include:           req.Include,
+		Include:           include,
 		Store:             req.StoreForUpstream,
 		ReasoningParam:    req.ReasoningParam,
-		SessionID:         ctx.SessionID,
+		SessionID:         sessionID,
+		TextFormat:        req.TextFormat,
+		SafetyIdentifier:  req.SafetyIdentifier,
 	}
 
 	resp, upErr := p.Upstream.DoWithRetry(ctx.Context, upReq, req.HadResponsesTools, req.BaseTools)
+	if upErr != nil && req.Truncation == "auto" {
+		resp, upErr = p.retryTruncated(ctx.Context, upReq, req, upErr)
+	}
 	if upErr != nil {
-		writeErr(upErr.StatusCode, upErr.Error())
+		writeUpstreamError(w, enc, upErr.StatusCode, upErr.Error(), req.Stream)
 		return
 	}
 
-	outputModel := req.RequestedModel
-	if outputModel == "" {
-		outputModel = req.Model
-	}
+	outputModel := p.Config.ResponseModel(req.RequestedModel, req.Model)
 
 	if req.Stream {
-		p.handleStream(w, resp, enc, outputModel, req, ctx)
+		p.handleStream(w, resp, enc, outputModel, req, upReq, ctx, usageMode)
+		return
+	}
+	p.handleCollected(w, resp, enc, outputModel, req, upReq, ctx)
+}
+
+// retryTruncated is sendTruncated for the normalized route: while upstream
+// rejects the request for exceeding the context window, the older half of the
+// remaining history is dropped and the request re-sent. req.InputItems is
+// trimmed too so the stored state matches what upstream saw.
+func (p *Pipeline) retryTruncated(ctx context.Context, upReq *upstream.Request, req *types.CanonicalRequest, upErr *upstream.UpstreamError) (*upstream.Response, *upstream.UpstreamError) {
+	for state.IsContextLengthError(upErr.Body) {
+		trimmed, dropped := normalize.TrimHistory(upReq.InputItems)
+		if dropped == 0 || !upstream.CanRetry(ctx, "truncation") {
+			break
+		}
+		upReq.InputItems, req.InputItems = trimmed, trimmed
+		if p.Config.Verbose {
+			slog.Info("request.truncated", "route", "normalized", "dropped_items", dropped, "kept_items", len(trimmed))
+		}
+		resp, retryErr := p.Upstream.DoWithRetry(ctx, upReq, false, req.BaseTools)
+		if retryErr == nil {
+			return resp, nil
+		}
+		upErr = retryErr
+	}
+	return nil, upErr
+}
+
+// writeUpstreamError reports a failed upstream request. Auth failures carry
+// the login hint and, for streaming requests, are sent as the protocol's
+// stream error event so SSE clients can surface them.
+func writeUpstreamError(w http.ResponseWriter, enc codec.Encoder, status int, msg string, streaming bool) {
+	if status != http.StatusUnauthorized {
+		enc.WriteError(w, status, msg)
 		return
 	}
-	p.handleCollected(w, resp, enc, outputModel, req)
+	msg = codec.WithLoginHint(msg)
+	if streaming {
+		codec.WriteStreamError(w, enc, status, msg)
+		return
+	}
+	enc.WriteError(w, status, msg)
 }
 
 // handleStream processes a streaming response.
@@ -113,25 +172,97 @@ func (p *Pipeline) handleStream(
 	enc codec.Encoder,
 	outputModel string,
 	req *types.CanonicalRequest,
+	upReq *upstream.Request,
 	ctx *RequestContext,
+	usageMode stream.UsageMode,
 ) {
-	enc.WriteStreamHeaders(w, resp.StatusCode)
-
 	// Capture SSE bytes via TeeReader for state extraction after streaming
 	var rawSSE bytes.Buffer
 	teeBody := newTeeReadCloser(resp.Body.Body, &rawSSE)
-	sseReader := stream.NewReader(teeBody)
+	sseReader := p.newReader(teeBody)
+	sseReader.RenameTools(req.ToolNameMap)
+	sseReader.LimitToolCalls(p.Config.MaxParallelToolCalls)
+	sseReader.LimitOutputTokens(p.Config.OutputTokenLimit(req.Model, req.MaxOutputTokens))
 
-	translator := enc.StreamTranslator(w, outputModel, codec.StreamOpts{
-		ReasoningCompat: p.Config.ReasoningCompat,
-		IncludeUsage:    req.IncludeUsage,
-		CreatedAt:       ctx.CreatedAt,
+	// Nothing is on the wire yet, so an empty stream can still be retried or
+	// replaced (see --empty-response-behavior).
+	if sseReader.Empty() {
+		slog.Warn("upstream.empty_response", "model", req.Model, "behavior", p.Config.EmptyResponseBehavior, "stream", true)
+		switch p.Config.EmptyResponseBehavior {
+		case "retry":
+			teeBody.Close()
+			if !upstream.CanRetry(ctx.Context, "empty_response") {
+				enc.WriteError(w, http.StatusBadGateway, emptyResponseMessage)
+				return
+			}
+			retried, upErr := p.Upstream.DoWithRetry(ctx.Context, upReq, req.HadResponsesTools, req.BaseTools)
+			if upErr != nil {
+				writeUpstreamError(w, enc, upErr.StatusCode, upErr.Error(), true)
+				return
+			}
+			resp = retried
+			rawSSE.Reset()
+			teeBody = newTeeReadCloser(resp.Body.Body, &rawSSE)
+			sseReader = p.newReader(teeBody)
+			sseReader.RenameTools(req.ToolNameMap)
+			sseReader.LimitToolCalls(p.Config.MaxParallelToolCalls)
+			sseReader.LimitOutputTokens(p.Config.OutputTokenLimit(req.Model, req.MaxOutputTokens))
+		case "empty":
+			sseReader = stream.NewReader(strings.NewReader(emptyCompletedSSE))
+		}
+	}
+
+	if msg, ok := failedBeforeOutput(sseReader); ok {
+		teeBody.Close()
+		slog.Warn("upstream.failed_before_output", "model", req.Model, "error", msg)
+		enc.WriteError(w, http.StatusBadGateway, msg)
+		return
+	}
+
+	enc.WriteStreamHeaders(w, resp.StatusCode)
+
+	var inputEstimate int64
+	if usageMode == stream.UsageRequired {
+		inputEstimate = int64(transform.EstimateResponsesInputTokens(req.Instructions, req.InputItems, req.Tools))
+	}
+	out, stopBatch := codec.BatchFlushes(w, sseReader, p.Config.SSEFlushInterval)
+	translator := enc.StreamTranslator(out, outputModel, codec.StreamOpts{
+		ReasoningCompat:       p.reasoningCompat(ctx),
+		IncludeUsage:          req.IncludeUsage,
+		CreatedAt:             ctx.CreatedAt,
+		RepairToolArgs:        p.Config.RepairToolArgs,
+		RenumberOutputIndices: p.Config.RenumberOutputIndices && req.PreviousResponseID != "",
+		ResponsesUsage:        usageMode,
+		InputTokensEstimate:   inputEstimate,
+		Heartbeat:             p.Config.ResponsesHeartbeat,
+		SystemFingerprint:     p.Config.SystemFingerprint(req.Model),
 	})
 	translator.Translate(sseReader)
+	stopBatch()
 	teeBody.Close()
 
+	// Output is already on the wire; a streamed mismatch can only be logged.
+	if toolChoiceRequired(req.ToolChoice) && !p.sseHasToolCall(rawSSE.Bytes()) {
+		warnToolChoiceIgnored(req.Model, req.ToolChoice)
+	}
+
 	// Extract state from captured SSE bytes
-	p.storeStateFromSSE(rawSSE.Bytes(), req.InputItems, req.Instructions, req.ConversationID)
+	p.storeStateFromSSE(rawSSE.Bytes(), req.InputItems, req.Instructions, req.ConversationID, req.Metadata, p.reasoningCompat(ctx), storeRequested(req.StoreRequested))
+}
+
+// failedBeforeOutput reports whether the upstream stream opens with
+// response.failed (e.g. an immediate policy rejection behind a 200). Nothing is
+// on the wire yet, so the caller can send a plain error response instead of a
+// stream that fails on its first event.
+func failedBeforeOutput(reader *stream.Reader) (string, bool) {
+	evt, err := reader.Peek()
+	if err != nil || evt.Type != "response.failed" {
+		return "", false
+	}
+	if msg := stream.ResponseErrorMessageFromEvent(evt.Data); msg != "" {
+		return msg, true
+	}
+	return "response.failed", true
 }
 
 // handleCollected processes a non-streaming response.
@@ -141,36 +272,298 @@ func (p *Pipeline) handleCollected(
 	enc codec.Encoder,
 	outputModel string,
 	req *types.CanonicalRequest,
+	upReq *upstream.Request,
+	ctx *RequestContext,
 ) {
 	defer resp.Body.Body.Close()
 
-	collected := collectFullResponse(resp.Body.Body)
+	collected := p.collectFullResponse(resp.Body.Body, p.Config.OutputTokenLimit(req.Model, req.MaxOutputTokens))
+	if collectedIsEmpty(collected) {
+		slog.Warn("upstream.empty_response", "model", req.Model, "behavior", p.Config.EmptyResponseBehavior, "stream", false)
+		switch p.Config.EmptyResponseBehavior {
+		case "retry":
+			if !upstream.CanRetry(ctx.Context, "empty_response") {
+				enc.WriteError(w, http.StatusBadGateway, emptyResponseMessage)
+				return
+			}
+			retried, upErr := p.Upstream.DoWithRetry(ctx.Context, upReq, req.HadResponsesTools, req.BaseTools)
+			if upErr != nil {
+				writeUpstreamError(w, enc, upErr.StatusCode, upErr.Error(), false)
+				return
+			}
+			defer retried.Body.Body.Close()
+			collected = p.collectFullResponse(retried.Body.Body, p.Config.OutputTokenLimit(req.Model, req.MaxOutputTokens))
+			if collectedIsEmpty(collected) {
+				enc.WriteError(w, http.StatusBadGateway, emptyResponseMessage+" after retry")
+				return
+			}
+		case "error":
+			enc.WriteError(w, http.StatusBadGateway, emptyResponseMessage)
+			return
+		}
+	}
+	collected, msg := p.enforceToolChoice(req.Model, req.ToolChoice, collected, func() (*codec.CollectedResponse, bool) {
+		return p.retryForToolCall(ctx, upReq, req)
+	})
+	if msg != "" {
+		enc.WriteError(w, http.StatusBadGateway, msg)
+		return
+	}
 	collected.RawResponse = map[string]any{
-		"_reasoning_compat": p.Config.ReasoningCompat,
+		"_reasoning_compat": p.reasoningCompat(ctx),
 	}
+	collected.SystemFingerprint = p.Config.SystemFingerprint(req.Model)
 
+	// Repair before storing, so a replayed turn carries the same arguments
+	// the client saw.
+	if p.Config.RepairToolArgs {
+		repairToolArgs(collected)
+	}
 	// Store state from collected data
-	p.storeStateFromCollected(collected, req.InputItems, req.Instructions, req.ConversationID)
+	p.storeStateFromCollected(collected, req.InputItems, req.Instructions, req.ConversationID, req.Metadata, p.reasoningCompat(ctx), storeRequested(req.StoreRequested))
+	// Stored state keeps upstream names for replay; the client sees its own.
+	restoreToolNames(collected, req.ToolNameMap)
 
 	if collected.ErrorMessage != "" {
 		enc.WriteError(w, http.StatusBadGateway, collected.ErrorMessage)
 		return
 	}
 
+	p.Config.CostPrices.SetHeader(w, req.Model, collected.Usage)
+	if p.Config.TruncationNotice {
+		codec.SetTruncatedHeader(w, collected.IncompleteReason)
+	}
 	enc.WriteCollected(w, resp.StatusCode, collected, outputModel)
 }
 
+const emptyResponseMessage = "upstream returned empty response"
+
+// emptyCompletedSSE stands in for an empty upstream stream with
+// --empty-response-behavior=empty, so translators emit a valid empty reply.
+const emptyCompletedSSE = "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_empty\",\"status\":\"completed\",\"output\":[]}}\n\n"
+
+// collectedIsEmpty reports whether upstream finished without any output: no
+// text, reasoning, tool calls or output items, and no error.
+func collectedIsEmpty(c *codec.CollectedResponse) bool {
+	return c.ErrorMessage == "" && c.FullText == "" && c.Refusal == "" && c.ReasoningSummary == "" && c.ReasoningFull == "" &&
+		len(c.ToolCalls) == 0 && len(c.OutputItems) == 0
+}
+
+// restoreToolNames maps canonicalized tool call names back to the names the
+// client sent (see --canonical-tool-names).
+func restoreToolNames(collected *codec.CollectedResponse, names map[string]string) {
+	if len(names) == 0 {
+		return
+	}
+	for i := range collected.ToolCalls {
+		if orig, ok := names[collected.ToolCalls[i].Function.Name]; ok {
+			collected.ToolCalls[i].Function.Name = orig
+		}
+	}
+	for i := range collected.OutputItems {
+		if orig, ok := names[collected.OutputItems[i].Name]; ok {
+			collected.OutputItems[i].Name = orig
+		}
+	}
+}
+
+// repairToolArgs rewrites tool call arguments that are not valid JSON with
+// stream.SerializeToolArgs (see --repair-tool-args).
+func repairToolArgs(collected *codec.CollectedResponse) {
+	for i := range collected.ToolCalls {
+		if args := collected.ToolCalls[i].Function.Arguments; !json.Valid([]byte(args)) {
+			collected.ToolCalls[i].Function.Arguments = stream.SerializeToolArgs(args, false, true)
+		}
+	}
+	for i := range collected.OutputItems {
+		item := &collected.OutputItems[i]
+		if item.Type == "function_call" && !json.Valid([]byte(item.Arguments)) {
+			item.Arguments = stream.SerializeToolArgs(item.Arguments, false, true)
+		}
+	}
+}
+
+// toolChoiceNudge is appended to the input when retrying a response that
+// ignored a forced tool_choice.
+const toolChoiceNudge = "You must respond by calling one of the available tools. Do not answer with plain text."
+
+// toolChoiceRequired reports whether tool_choice forces a tool call, either via
+// "required" (also in the {"type":"required"} form the Anthropic and Gemini
+// mappings produce) or by naming a specific function.
+func toolChoiceRequired(toolChoice any) bool {
+	switch tc := toolChoice.(type) {
+	case string:
+		return strings.EqualFold(strings.TrimSpace(tc), "required")
+	case map[string]any:
+		typ, _ := tc["type"].(string)
+		return typ == "function" || typ == "required"
+	}
+	return false
+}
+
+// toolChoiceIgnoredMessage is the 502 message when --enforce-tool-choice
+// rejects an answer without a tool call.
+const toolChoiceIgnoredMessage = "upstream model ignored tool_choice and returned no tool call"
+
+// warnToolChoiceIgnored logs a streamed answer that ignored a forced
+// tool_choice; its output is already on the wire, so nothing is enforced.
+func warnToolChoiceIgnored(model string, toolChoice any) {
+	slog.Warn("tool_choice.ignored", "model", model, "tool_choice", types.SummarizeToolChoice(toolChoice), "stream", true)
+}
+
+// enforceToolChoice applies --enforce-tool-choice to a collected answer. When
+// toolChoice forces a tool call and the answer has none, "error" rejects it
+// and "retry" replaces it with the result of retry, which re-sends the
+// request once with toolChoiceNudge. A non-empty message means the caller
+// must answer 502 with it.
+func (p *Pipeline) enforceToolChoice(model string, toolChoice any, collected *codec.CollectedResponse, retry func() (*codec.CollectedResponse, bool)) (*codec.CollectedResponse, string) {
+	if !toolChoiceRequired(toolChoice) || len(collected.ToolCalls) > 0 || collected.ErrorMessage != "" {
+		return collected, ""
+	}
+	slog.Warn("tool_choice.ignored", "model", model, "tool_choice", types.SummarizeToolChoice(toolChoice), "enforce", p.Config.EnforceToolChoice)
+	switch p.Config.EnforceToolChoice {
+	case "error":
+		return collected, toolChoiceIgnoredMessage
+	case "retry":
+		retried, ok := retry()
+		if !ok {
+			return collected, toolChoiceIgnoredMessage + " after retry"
+		}
+		return retried, ""
+	}
+	return collected, ""
+}
+
+// nudgedInput returns a copy of items with the toolChoiceNudge user message
+// appended.
+func nudgedInput(items []types.ResponsesInputItem) []types.ResponsesInputItem {
+	return append(types.CloneInputItems(items), types.ResponsesInputItem{
+		Type:    "message",
+		Role:    "user",
+		Content: []types.ResponsesContent{{Type: "input_text", Text: toolChoiceNudge}},
+	})
+}
+
+// retryForToolCall re-sends upReq once with a nudge message and returns the
+// collected result if it contains a tool call.
+func (p *Pipeline) retryForToolCall(ctx *RequestContext, upReq *upstream.Request, req *types.CanonicalRequest) (*codec.CollectedResponse, bool) {
+	if !upstream.CanRetry(ctx.Context, "tool_choice") {
+		return nil, false
+	}
+	nudged := *upReq
+	nudged.InputItems = nudgedInput(upReq.InputItems)
+	resp, upErr := p.Upstream.DoWithRetry(ctx.Context, &nudged, req.HadResponsesTools, req.BaseTools)
+	if upErr != nil {
+		slog.Warn("tool_choice.retry_failed", "status", upErr.StatusCode, "error", upErr.Error())
+		return nil, false
+	}
+	defer resp.Body.Body.Close()
+	collected := p.collectFullResponse(resp.Body.Body, p.Config.OutputTokenLimit(req.Model, req.MaxOutputTokens))
+	if collected.ErrorMessage != "" || len(collected.ToolCalls) == 0 {
+		return nil, false
+	}
+	return collected, true
+}
+
+// EnforceToolChoice is enforceToolChoice for handlers that call upstream
+// themselves (Anthropic, Ollama, Gemini) on a non-streaming request. A retry
+// re-sends upReq through DoWithRetry with baseTools and reads the reply with
+// collect, which should capture its state without storing it: the handler
+// stores only the answer it returns, so a rejected answer leaves no trace. A
+// non-empty message means the handler must answer 502 with it.
+func (p *Pipeline) EnforceToolChoice(ctx context.Context, upReq *upstream.Request, baseTools []types.ResponsesTool, collected *codec.CollectedResponse, collect func(io.ReadCloser) *codec.CollectedResponse) (*codec.CollectedResponse, string) {
+	return p.enforceToolChoice(upReq.Model, upReq.ToolChoice, collected, func() (*codec.CollectedResponse, bool) {
+		if !upstream.CanRetry(ctx, "tool_choice") {
+			return nil, false
+		}
+		nudged := *upReq
+		nudged.InputItems = nudgedInput(upReq.InputItems)
+		resp, upErr := p.Upstream.DoWithRetry(ctx, &nudged, false, baseTools)
+		if upErr != nil {
+			slog.Warn("tool_choice.retry_failed", "status", upErr.StatusCode, "error", upErr.Error())
+			return nil, false
+		}
+		defer resp.Body.Body.Close()
+		retried := collect(resp.Body.Body)
+		if retried.ErrorMessage != "" || len(retried.ToolCalls) == 0 {
+			return nil, false
+		}
+		return retried, true
+	})
+}
+
+// WatchToolChoice tees a streamed upstream body when toolChoice forces a tool
+// call, for handlers that call upstream themselves. The returned func, called
+// once the body has been consumed, logs the answer if it had no tool call.
+func (p *Pipeline) WatchToolChoice(body io.ReadCloser, model string, toolChoice any) (io.ReadCloser, func()) {
+	if !toolChoiceRequired(toolChoice) {
+		return body, func() {}
+	}
+	var raw bytes.Buffer
+	return newTeeReadCloser(body, &raw), func() {
+		if !p.sseHasToolCall(raw.Bytes()) {
+			warnToolChoiceIgnored(model, toolChoice)
+		}
+	}
+}
+
+// newReader creates an SSE reader limited to --max-sse-event-size.
+func (p *Pipeline) newReader(r io.Reader) *stream.Reader {
+	return stream.NewReaderSize(r, p.Config.MaxSSEEventSize)
+}
+
+// sseHasToolCall reports whether a captured upstream SSE stream produced a
+// function call output item.
+func (p *Pipeline) sseHasToolCall(raw []byte) bool {
+	reader := p.newReader(bytes.NewReader(raw))
+	for {
+		evt, err := reader.Next()
+		if err != nil {
+			return false
+		}
+		if evt.Type != "response.output_item.done" {
+			continue
+		}
+		item, _ := evt.Data["item"].(map[string]any)
+		if _, ok := stream.FunctionToolCallFromOutputItem(item); ok {
+			return true
+		}
+	}
+}
+
 // collectFullResponse reads an upstream SSE stream and assembles a CollectedResponse
-// with all data needed for both format encoding and state storage.
-func collectFullResponse(body io.Reader) *codec.CollectedResponse {
-	reader := stream.NewReader(io.NopCloser(body))
+// with all data needed for both format encoding and state storage. Tool calls
+// past --max-parallel-tool-calls are held back (see stream.Reader.LimitToolCalls),
+// and output past maxOutputTokens is cut off as a max_output_tokens incomplete
+// response, the way streams are (see stream.Reader.LimitOutputTokens).
+func (p *Pipeline) collectFullResponse(body io.Reader, maxOutputTokens int) *codec.CollectedResponse {
+	reader := p.newReader(body)
+	reader.LimitToolCalls(p.Config.MaxParallelToolCalls)
+	reader.LimitOutputTokens(maxOutputTokens)
 	out := &codec.CollectedResponse{}
+	sawRefusalDelta := false
+	var annotations stream.Annotations
+	var pending []map[string]any // annotation events not yet on a message item
 
 	for {
 		evt, err := reader.Next()
 		if err != nil {
+			if reason := codec.StreamEndReason(err); reason != "" {
+				out.IncompleteReason = reason
+				// The message was cut before its output_item.done.
+				if out.FullText != "" {
+					out.OutputItems = append(out.OutputItems, types.ResponsesOutputItem{
+						Type:    "message",
+						Role:    "assistant",
+						Status:  "incomplete",
+						Content: []types.ResponsesContent{{Type: "output_text", Text: out.FullText, Annotations: pending}},
+					})
+				}
+			}
 			break
 		}
+		added := annotations.Observe(evt)
+		out.Annotations = append(out.Annotations, added...)
 
 		if id := stream.ResponseIDFromEvent(evt.Data); id != "" {
 			out.ResponseID = id
@@ -183,6 +576,12 @@ func collectFullResponse(body io.Reader) *codec.CollectedResponse {
 		case "response.output_text.delta":
 			delta, _ := evt.Data["delta"].(string)
 			out.FullText += delta
+		case "response.output_text.annotation.added":
+			pending = append(pending, added...)
+		case "response.refusal.delta":
+			delta, _ := evt.Data["delta"].(string)
+			out.Refusal += delta
+			sawRefusalDelta = true
 		case "response.reasoning_summary_text.delta":
 			delta, _ := evt.Data["delta"].(string)
 			out.ReasoningSummary += delta
@@ -192,7 +591,15 @@ func collectFullResponse(body io.Reader) *codec.CollectedResponse {
 		case "response.output_item.done":
 			item, _ := evt.Data["item"].(map[string]any)
 			if item != nil {
-				out.OutputItems = append(out.OutputItems, unmarshalOutputItem(item))
+				if !sawRefusalDelta {
+					out.Refusal += stream.RefusalFromOutputItem(item)
+				}
+				outItem := unmarshalOutputItem(item)
+				if outItem.Type == "message" {
+					attachAnnotations(&outItem, pending)
+					pending = nil
+				}
+				out.OutputItems = append(out.OutputItems, outItem)
 				if tc, ok := stream.FunctionToolCallFromOutputItem(item); ok {
 					out.ToolCalls = append(out.ToolCalls, tc)
 				}
@@ -203,10 +610,13 @@ func collectFullResponse(body io.Reader) *codec.CollectedResponse {
 				out.ErrorMessage = "response.failed"
 			}
 			return out
-		case "response.completed":
+		case "response.completed", "response.incomplete":
 			if r, ok := evt.Data["response"].(map[string]any); ok {
 				out.RawResponse = r
 			}
+			if evt.Type == "response.incomplete" {
+				out.IncompleteReason = stream.IncompleteReasonFromEvent(evt.Data)
+			}
 			return out
 		}
 	}
@@ -215,14 +625,18 @@ func collectFullResponse(body io.Reader) *codec.CollectedResponse {
 }
 
 // storeStateFromSSE parses raw SSE bytes and stores conversation state.
-func (p *Pipeline) storeStateFromSSE(raw []byte, requestInput []types.ResponsesInputItem, instructions string, conversationID string) {
+// compat is the reasoning compat mode the client saw the response in. The
+// output served by GET /v1/responses/{id} is kept only with storeOutput, when
+// the client sent store:true.
+func (p *Pipeline) storeStateFromSSE(raw []byte, requestInput []types.ResponsesInputItem, instructions string, conversationID string, metadata map[string]string, compat string, storeOutput bool) {
 	if len(raw) == 0 {
 		return
 	}
 
-	reader := stream.NewReader(io.NopCloser(bytes.NewReader(raw)))
+	reader := p.newReader(bytes.NewReader(raw))
+	reader.LimitToolCalls(p.Config.MaxParallelToolCalls)
 	var responseID string
-	var outputItems []types.ResponsesOutputItem
+	var output streamedOutput
 
 	for {
 		evt, err := reader.Next()
@@ -233,30 +647,88 @@ func (p *Pipeline) storeStateFromSSE(raw []byte, requestInput []types.ResponsesI
 		if id := stream.ResponseIDFromEvent(evt.Data); id != "" {
 			responseID = id
 		}
-		if evt.Type != "response.output_item.done" {
-			continue
-		}
-		item, _ := evt.Data["item"].(map[string]any)
-		if item != nil {
-			outputItems = append(outputItems, unmarshalOutputItem(item))
-		}
+		output.observe(evt)
 	}
 
 	if responseID == "" {
 		return
 	}
 
-	delta := outputItemsToInputItems(outputItems)
+	delta := output.inputItems()
 	calls := extractFunctionCalls(delta)
 
-	combined := appendContextHistory(requestInput, delta)
+	combined := p.appendContextHistory(compat, requestInput, delta)
 	p.Store.PutSnapshot(responseID, combined, calls)
+	if storeOutput {
+		p.Store.PutOutput(responseID, p.appendContextHistory(compat, nil, delta))
+	}
 	p.Store.PutInstructions(responseID, instructions)
 	p.Store.PutConversationLatest(conversationID, responseID)
+	p.Store.PutMetadata(responseID, metadata)
+}
+
+// CaptureState tees an upstream SSE body so handlers that call upstream
+// directly (Anthropic, Ollama) keep the same local state as the OpenAI
+// routes: the returned store func, called once the body has been consumed,
+// records the response snapshot and the conversation's latest response id.
+// compat is the reasoning compat mode the handler rendered the response in.
+// The store func runs once, so a handler may call it early and also defer it.
+func (p *Pipeline) CaptureState(body io.ReadCloser, inputItems []types.ResponsesInputItem, instructions, conversationID, compat string) (io.ReadCloser, func()) {
+	var raw bytes.Buffer
+	return newTeeReadCloser(body, &raw), sync.OnceFunc(func() {
+		p.storeStateFromSSE(raw.Bytes(), inputItems, instructions, conversationID, nil, compat, false)
+	})
+}
+
+// streamedOutput gathers the output of a streamed response for the state
+// snapshot. Items come from response.output_item.done; assistant text that
+// only arrived as output_text deltas (no message item carried it) is kept as
+// a leading assistant message so the stored turn still holds the answer.
+type streamedOutput struct {
+	items   []types.ResponsesOutputItem
+	text    strings.Builder
+	message bool
+}
+
+func (o *streamedOutput) observe(evt *stream.Event) {
+	switch evt.Type {
+	case "response.output_text.delta":
+		if d, ok := evt.Data["delta"].(string); ok {
+			o.text.WriteString(d)
+		}
+	case "response.output_item.done":
+		item, _ := evt.Data["item"].(map[string]any)
+		if item == nil {
+			return
+		}
+		out := unmarshalOutputItem(item)
+		if out.Type == "message" && len(out.Content) > 0 {
+			o.message = true
+		}
+		o.items = append(o.items, out)
+	}
+}
+
+func (o *streamedOutput) inputItems() []types.ResponsesInputItem {
+	delta := outputItemsToInputItems(o.items)
+	if o.message {
+		return delta
+	}
+	txt := strings.TrimSpace(o.text.String())
+	if txt == "" {
+		return delta
+	}
+	msg := types.ResponsesInputItem{
+		Type:    "message",
+		Role:    "assistant",
+		Content: []types.ResponsesContent{{Type: "output_text", Text: txt}},
+	}
+	return append([]types.ResponsesInputItem{msg}, delta...)
 }
 
 // storeStateFromCollected stores conversation state from a collected response.
-func (p *Pipeline) storeStateFromCollected(collected *codec.CollectedResponse, requestInput []types.ResponsesInputItem, instructions string, conversationID string) {
+// storeOutput is as for storeStateFromSSE.
+func (p *Pipeline) storeStateFromCollected(collected *codec.CollectedResponse, requestInput []types.ResponsesInputItem, instructions string, conversationID string, metadata map[string]string, compat string, storeOutput bool) {
 	if collected.ResponseID == "" {
 		return
 	}
@@ -288,10 +760,14 @@ func (p *Pipeline) storeStateFromCollected(collected *codec.CollectedResponse, r
 	}
 
 	calls := extractFunctionCalls(delta)
-	combined := appendContextHistory(requestInput, delta)
+	combined := p.appendContextHistory(compat, requestInput, delta)
 	p.Store.PutSnapshot(collected.ResponseID, combined, calls)
+	if storeOutput {
+		p.Store.PutOutput(collected.ResponseID, p.appendContextHistory(compat, nil, delta))
+	}
 	p.Store.PutInstructions(collected.ResponseID, instructions)
 	p.Store.PutConversationLatest(conversationID, collected.ResponseID)
+	p.Store.PutMetadata(collected.ResponseID, metadata)
 }
 
 // logNormalizedRequest logs the normalized request details.
@@ -310,6 +786,28 @@ func (p *Pipeline) logNormalizedRequest(route string, req *types.CanonicalReques
 	if req.StoreForced {
 		slog.Warn("client requested store=true; forcing store=false for upstream compatibility")
 	}
+	if len(req.UnknownFields) > 0 {
+		slog.Info("request.unknown_fields", "route", route, "fields", req.UnknownFields)
+	}
+	if req.LostContextResponseID != "" {
+		slog.Warn("conversation.context_expired", "route", route, "response_id", req.LostContextResponseID, "fallback", "fresh_context")
+	}
+	// The upstream produces one candidate per request, and several candidates
+	// could each call different tools, so n is always served as n=1.
+	if req.RequestedN > 1 {
+		slog.Warn("request.n_forced_single", "route", route, "n", req.RequestedN, "with_tools", len(req.Tools) > 0)
+	}
+	if len(req.DroppedIncludes) > 0 {
+		slog.Warn("request.include_dropped", "route", route, "values", req.DroppedIncludes)
+	}
+	// Non-streaming responses always carry usage, so stream_options has
+	// nothing to change.
+	if req.HasStreamOptions && !req.Stream {
+		slog.Warn("request.stream_options_without_stream", "route", route, "usage", "always included")
+	}
+	if req.ToolResultAcks > 0 {
+		slog.Info("request.tool_results_acked", "route", route, "count", req.ToolResultAcks)
+	}
 
 	if route == "chat" {
 		slog.Info("openai.chat.request",
@@ -366,9 +864,44 @@ func (p *Pipeline) logNormalizedRequest(route string, req *types.CanonicalReques
 
 // RequestContext carries per-request metadata that isn't part of the canonical request.
 type RequestContext struct {
-	Context   context.Context
-	SessionID string
-	CreatedAt string // RFC3339 timestamp for Ollama
+	Context         context.Context
+	SessionID       string
+	CreatedAt       string // RFC3339 timestamp for Ollama
+	ReasoningCompat string // per-request override of Config.ReasoningCompat
+	AcceptStream    bool   // client sent Accept: text/event-stream
+	// NoDefaultInstructions drops the embedded prompt for this request
+	// (X-Chatmock-No-Default-Instructions).
+	NoDefaultInstructions bool
+}
+
+// reasoningCompat returns the compat mode for this request, preferring the
+// per-request override.
+func (p *Pipeline) reasoningCompat(ctx *RequestContext) string {
+	return types.FirstNonEmpty(ctx.ReasoningCompat, p.Config.ReasoningCompat)
+}
+
+// attachAnnotations puts annotations streamed as
+// response.output_text.annotation.added events on the message's first
+// output_text part, unless the finished item already carries its own.
+func attachAnnotations(item *types.ResponsesOutputItem, anns []map[string]any) {
+	if len(anns) == 0 {
+		return
+	}
+	first := -1
+	for i, c := range item.Content {
+		if c.Type != "output_text" {
+			continue
+		}
+		if len(c.Annotations) > 0 {
+			return
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first >= 0 {
+		item.Content[first].Annotations = anns
+	}
 }
 
 func unmarshalOutputItem(item map[string]any) types.ResponsesOutputItem {
@@ -413,6 +946,7 @@ func inputItemFromOutputItem(item types.ResponsesOutputItem) (types.ResponsesInp
 			Type:    "message",
 			Role:    role,
 			Content: content,
+			ID:      item.ID,
 		}, true
 	case "function_call":
 		callID := item.CallID
@@ -427,6 +961,7 @@ func inputItemFromOutputItem(item types.ResponsesOutputItem) (types.ResponsesInp
 			CallID:    callID,
 			Name:      item.Name,
 			Arguments: item.Arguments,
+			ID:        item.ID,
 		}, true
 	case "custom_tool_call":
 		callID := item.CallID
@@ -440,13 +975,22 @@ func inputItemFromOutputItem(item types.ResponsesOutputItem) (types.ResponsesInp
 			Type:   "custom_tool_call",
 			CallID: callID,
 			Name:   item.Name,
+			ID:     item.ID,
 		}, true
 	default:
 		return types.ResponsesInputItem{}, false
 	}
 }
 
-func appendContextHistory(base []types.ResponsesInputItem, delta []types.ResponsesInputItem) []types.ResponsesInputItem {
+// appendContextHistory builds the context stored for previous_response_id.
+// Reasoning that the compat mode folded into assistant messages is stripped
+// so it is never replayed upstream as if it were part of the answer:
+// <think> blocks when compat is "think-tags" and the "Reasoning:/Answer:"
+// prefix when it is "inline". In any other mode that text is the user's or
+// the model's own and is kept.
+// With --redact-reasoning-in-logs, reasoning items are dropped as well; the
+// messages, tool calls and tool outputs a tool loop needs are kept.
+func (p *Pipeline) appendContextHistory(compat string, base []types.ResponsesInputItem, delta []types.ResponsesInputItem) []types.ResponsesInputItem {
 	if len(base) == 0 && len(delta) == 0 {
 		return nil
 	}
@@ -454,10 +998,34 @@ func appendContextHistory(base []types.ResponsesInputItem, delta []types.Respons
 	if len(delta) > 0 {
 		combined = append(combined, types.CloneInputItems(delta)...)
 	}
+	if p.Config.RedactReasoning {
+		combined = slices.DeleteFunc(combined, func(item types.ResponsesInputItem) bool {
+			return item.Type == "reasoning"
+		})
+	}
+	for i := range combined {
+		if combined[i].Role != "assistant" {
+			continue
+		}
+		for j := range combined[i].Content {
+			switch compat {
+			case "think-tags":
+				combined[i].Content[j].Text = reasoning.StripThinkTags(combined[i].Content[j].Text)
+			case "inline":
+				combined[i].Content[j].Text = reasoning.StripInlineReasoning(combined[i].Content[j].Text)
+			}
+		}
+	}
 	return combined
 }
 
 
+// storeRequested reports whether the client asked for the response to be
+// stored (store:true) so it can be fetched again by id.
+func storeRequested(store *bool) bool {
+	return store != nil && *store
+}
+
 func extractFunctionCalls(items []types.ResponsesInputItem) []state.FunctionCall {
 	if len(items) == 0 {
 		return nil
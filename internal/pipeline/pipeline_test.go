@@ -0,0 +1,1057 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/codec"
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/pricing"
+	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestStoredContextExcludesThinkTags(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	p := &Pipeline{Config: &config.ServerConfig{ReasoningCompat: "think-tags"}, Store: store}
+
+	// The client echoes the previous think-tags answer back as history.
+	requestInput := []types.ResponsesInputItem{
+		{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "2+2?"}}},
+		{Type: "message", Role: "assistant", Content: []types.ResponsesContent{{Type: "output_text", Text: "<think>add them</think>4"}}},
+		{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "and <think> literally?"}}},
+	}
+	sse := "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"<think>hmm</think>Sure.\"}]}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_think\"}}\n\n"
+	p.storeStateFromSSE([]byte(sse), requestInput, "", "", nil, "think-tags", false)
+
+	ctx, ok := store.GetContext("resp_think")
+	if !ok {
+		t.Fatal("expected stored context")
+	}
+	var assistant []string
+	for _, item := range ctx {
+		for _, c := range item.Content {
+			if item.Role == "assistant" {
+				if strings.Contains(c.Text, "<think>") || strings.Contains(c.Text, "</think>") {
+					t.Errorf("stored assistant text still has think markup: %q", c.Text)
+				}
+				assistant = append(assistant, c.Text)
+			}
+		}
+	}
+	if strings.Join(assistant, "|") != "4|Sure." {
+		t.Errorf("assistant texts: got %q, want %q", assistant, []string{"4", "Sure."})
+	}
+	if got := ctx[2].Content[0].Text; got != "and <think> literally?" {
+		t.Errorf("user text must be untouched: got %q", got)
+	}
+}
+
+func TestStoredContextStripsReasoningOnlyInItsCompatMode(t *testing.T) {
+	const inline = "Reasoning: add them\n\nAnswer: 4"
+	const thinkTags = "<think>add them</think>4"
+	sse := "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_inline\"}}\n\n"
+
+	for _, tt := range []struct {
+		compat, answer, want string
+	}{
+		{compat: "inline", answer: inline, want: "4"},
+		{compat: "think-tags", answer: inline, want: inline},
+		{compat: "", answer: inline, want: inline},
+		{compat: "think-tags", answer: thinkTags, want: "4"},
+		{compat: "inline", answer: thinkTags, want: thinkTags},
+		{compat: "", answer: thinkTags, want: thinkTags},
+	} {
+		compat, want := tt.compat, tt.want
+		requestInput := []types.ResponsesInputItem{
+			{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "2+2?"}}},
+			{Type: "message", Role: "assistant", Content: []types.ResponsesContent{{Type: "output_text", Text: tt.answer}}},
+		}
+		store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+		p := &Pipeline{Config: &config.ServerConfig{}, Store: store}
+		p.storeStateFromSSE([]byte(sse), requestInput, "", "", nil, compat, false)
+
+		ctx, ok := store.GetContext("resp_inline")
+		store.Close()
+		if !ok {
+			t.Fatalf("compat %q: expected stored context", compat)
+		}
+		if got := ctx[1].Content[0].Text; got != want {
+			t.Errorf("compat %q: stored assistant text got %q, want %q", compat, got, want)
+		}
+	}
+}
+
+func TestRedactReasoningKeepsToolLoopContext(t *testing.T) {
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	p := &Pipeline{Config: &config.ServerConfig{RedactReasoning: true}, Store: store}
+
+	requestInput := []types.ResponsesInputItem{
+		{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "weather?"}}},
+		{Type: "reasoning", Content: []types.ResponsesContent{{Type: "reasoning_text", Text: "secret plan"}}},
+		{Type: "message", Role: "assistant", Content: []types.ResponsesContent{{Type: "output_text", Text: "<think>secret plan</think>Checking."}}},
+	}
+	sse := "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"reasoning\",\"summary\":[{\"type\":\"summary_text\",\"text\":\"secret plan\"}]}}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"get_weather\",\"arguments\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_redact\"}}\n\n"
+	p.storeStateFromSSE([]byte(sse), requestInput, "", "", nil, "think-tags", false)
+
+	ctx, ok := store.GetContext("resp_redact")
+	if !ok {
+		t.Fatal("expected stored context")
+	}
+	if data, _ := json.Marshal(ctx); strings.Contains(string(data), "secret plan") {
+		t.Errorf("stored context still holds reasoning: %s", data)
+	}
+	var itemTypes []string
+	for _, item := range ctx {
+		itemTypes = append(itemTypes, item.Type)
+	}
+	if strings.Join(itemTypes, ",") != "message,message,function_call" {
+		t.Errorf("stored item types: got %v, want the messages and the tool call", itemTypes)
+	}
+	if calls, _ := store.Get("resp_redact"); len(calls) != 1 || calls[0].CallID != "call_1" {
+		t.Errorf("stored tool calls: got %+v, want call_1", calls)
+	}
+}
+
+const (
+	textOnlySSE = "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"It is sunny.\"}]}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_text\"}}\n\n"
+	toolCallSSE = "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"get_weather\",\"arguments\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_tool\"}}\n\n"
+	requiredToolBody = `{"model":"gpt-5","messages":[{"role":"user","content":"weather?"}],` +
+		`"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}],"tool_choice":"required"}`
+)
+
+func TestEnforceToolChoiceWhenModelAnswersWithText(t *testing.T) {
+	tests := []struct {
+		mode       string
+		sse        []string
+		wantStatus int
+		wantCalls  int
+		wantTool   bool
+	}{
+		{mode: "off", sse: []string{textOnlySSE}, wantStatus: http.StatusOK, wantCalls: 1},
+		{mode: "error", sse: []string{textOnlySSE}, wantStatus: http.StatusBadGateway, wantCalls: 1},
+		{mode: "retry", sse: []string{textOnlySSE, toolCallSSE}, wantStatus: http.StatusOK, wantCalls: 2, wantTool: true},
+		{mode: "retry", sse: []string{textOnlySSE, textOnlySSE}, wantStatus: http.StatusBadGateway, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.EnforceToolChoice = tt.mode
+		transport.sse = tt.sse
+
+		rec := httptest.NewRecorder()
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(requiredToolBody), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status got %d, want %d (body %s)", tt.mode, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+		if transport.calls != tt.wantCalls {
+			t.Errorf("%s: upstream calls got %d, want %d", tt.mode, transport.calls, tt.wantCalls)
+		}
+		if got := strings.Contains(rec.Body.String(), "get_weather"); got != tt.wantTool {
+			t.Errorf("%s: tool call in response got %v, want %v", tt.mode, got, tt.wantTool)
+		}
+		if tt.wantCalls == 2 && !strings.Contains(fmt.Sprint(transport.body["input"]), toolChoiceNudge) {
+			t.Errorf("%s: retry should carry the nudge message", tt.mode)
+		}
+	}
+}
+
+func TestPassthroughEnforceToolChoice(t *testing.T) {
+	const body = `{"model":"gpt-5","stream":false,"input":"weather?",` +
+		`"tools":[{"type":"function","name":"get_weather","parameters":{"type":"object"}}],"tool_choice":"required"}`
+	tests := []struct {
+		mode       string
+		sse        []string
+		wantStatus int
+		wantCalls  int
+	}{
+		{mode: "error", sse: []string{textOnlySSE}, wantStatus: http.StatusBadGateway, wantCalls: 1},
+		{mode: "retry", sse: []string{textOnlySSE, toolCallSSE}, wantStatus: http.StatusOK, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.EnforceToolChoice = tt.mode
+		transport.sse = tt.sse
+
+		rec := httptest.NewRecorder()
+		p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+		if rec.Code != tt.wantStatus || transport.calls != tt.wantCalls {
+			t.Errorf("%s: got status %d after %d upstream calls, want %d after %d (%s)", tt.mode, rec.Code, transport.calls, tt.wantStatus, tt.wantCalls, rec.Body.String())
+		}
+		if tt.mode == "retry" {
+			if !strings.Contains(fmt.Sprint(transport.body["input"]), toolChoiceNudge) {
+				t.Errorf("retry should carry the nudge message, got input %v", transport.body["input"])
+			}
+			if calls, ok := p.Store.Get("resp_tool"); !ok || len(calls) != 1 {
+				t.Errorf("stored state should be the retried answer, got %+v", calls)
+			}
+		}
+	}
+}
+
+func TestRequestReasoningCompatOverridesConfig(t *testing.T) {
+	const reasoningSSE = "data: {\"type\":\"response.reasoning_summary_text.delta\",\"delta\":\"thinking\"}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"Answer\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_r\"}}\n\n"
+	body := []byte(`{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`)
+
+	p, transport := newPassthroughTestPipeline(t)
+	p.Config.ReasoningCompat = "think-tags"
+	transport.sse = []string{reasoningSSE, reasoningSSE}
+
+	overridden := httptest.NewRecorder()
+	p.Execute(&RequestContext{Context: context.Background(), ReasoningCompat: "legacy"}, overridden, body, "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if got := overridden.Body.String(); strings.Contains(got, "<think>") || !strings.Contains(got, `"reasoning_summary":"thinking"`) {
+		t.Errorf("legacy override: got %s", got)
+	}
+
+	defaulted := httptest.NewRecorder()
+	p.Execute(&RequestContext{Context: context.Background()}, defaulted, body, "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if got := defaulted.Body.String(); !strings.Contains(got, `\u003cthink\u003ethinking\u003c/think\u003eAnswer`) {
+		t.Errorf("server default think-tags: got %s", got)
+	}
+}
+
+func TestCanonicalToolNamesRoundTrip(t *testing.T) {
+	const dottedSSE = "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"weather_get\",\"arguments\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_dot\",\"output\":[{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"weather_get\",\"arguments\":\"{}\"}]}}\n\n"
+	for _, streaming := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.CanonicalToolNames = true
+		transport.sse = []string{dottedSSE}
+		body := fmt.Sprintf(`{"model":"gpt-5","stream":%v,"messages":[{"role":"user","content":"weather?"}],`+
+			`"tools":[{"type":"function","function":{"name":"weather.get","parameters":{"type":"object"}}}],`+
+			`"tool_choice":{"type":"function","function":{"name":"weather.get"}}}`, streaming)
+
+		rec := httptest.NewRecorder()
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("stream=%v: status got %d, want 200 (body %s)", streaming, rec.Code, rec.Body.String())
+		}
+		sent := fmt.Sprint(transport.body["tools"], transport.body["tool_choice"])
+		if strings.Contains(sent, "weather.get") || !strings.Contains(sent, "weather_get") {
+			t.Errorf("stream=%v: upstream tools/tool_choice should use weather_get, got %s", streaming, sent)
+		}
+		if got := rec.Body.String(); !strings.Contains(got, "weather.get") || strings.Contains(got, "weather_get") {
+			t.Errorf("stream=%v: client response should name weather.get, got %s", streaming, got)
+		}
+	}
+}
+
+func TestRepairToolArgsBeforeStoringState(t *testing.T) {
+	const brokenSSE = "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"get_weather\",\"arguments\":\"{\\\"city\\\":\\\"Paris\\\",\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_fix\"}}\n\n"
+	p, transport := newPassthroughTestPipeline(t)
+	p.Config.RepairToolArgs = true
+	transport.sse = []string{brokenSSE}
+	body := `{"model":"gpt-5","messages":[{"role":"user","content":"weather?"}],` +
+		`"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`
+
+	rec := httptest.NewRecorder()
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+
+	ctx, ok := p.Store.GetContext("resp_fix")
+	if !ok {
+		t.Fatal("expected stored context")
+	}
+	var stored string
+	for _, item := range ctx {
+		if item.Type == "function_call" {
+			stored = item.Arguments
+		}
+	}
+	if stored != `{"city":"Paris"}` {
+		t.Errorf("stored arguments got %q, want the repaired {\"city\":\"Paris\"}", stored)
+	}
+}
+
+func TestMaxParallelToolCallsForwardsFirstN(t *testing.T) {
+	var sse, output strings.Builder
+	for i := 1; i <= 5; i++ {
+		item := fmt.Sprintf(`{"type":"function_call","id":"fc_%d","call_id":"call_%d","name":"lookup","arguments":"{}"}`, i, i)
+		fmt.Fprintf(&sse, "data: {\"type\":\"response.output_item.added\",\"item\":%s}\n\n", item)
+		fmt.Fprintf(&sse, "data: {\"type\":\"response.function_call_arguments.delta\",\"item_id\":\"fc_%d\",\"delta\":\"{}\"}\n\n", i)
+		fmt.Fprintf(&sse, "data: {\"type\":\"response.output_item.done\",\"item\":%s}\n\n", item)
+		if i > 1 {
+			output.WriteByte(',')
+		}
+		output.WriteString(item)
+	}
+	fmt.Fprintf(&sse, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_tools\",\"output\":[%s]}}\n\n", output.String())
+
+	for _, streaming := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.MaxParallelToolCalls = 2
+		transport.sse = []string{sse.String()}
+		body := fmt.Sprintf(`{"model":"gpt-5","stream":%v,"messages":[{"role":"user","content":"look up five things"}],`+
+			`"tools":[{"type":"function","function":{"name":"lookup","parameters":{"type":"object"}}}]}`, streaming)
+
+		rec := httptest.NewRecorder()
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		got := rec.Body.String()
+		for i := 1; i <= 5; i++ {
+			if want := i <= 2; strings.Contains(got, fmt.Sprintf("call_%d", i)) != want {
+				t.Errorf("stream=%v: call_%d forwarded should be %v (%s)", streaming, i, want, got)
+			}
+		}
+		stored, ok := p.Store.Inspect("resp_tools")
+		if !ok || len(stored.Calls) != 2 {
+			t.Errorf("stream=%v: stored calls got %+v (found %v), want the two forwarded", streaming, stored.Calls, ok)
+		}
+	}
+}
+
+func TestChatAnnotationsFromWebSearchCitations(t *testing.T) {
+	const sse = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Go 1.24 is out.\"}\n\n" +
+		"data: {\"type\":\"response.output_text.annotation.added\",\"annotation\":{\"type\":\"url_citation\",\"url\":\"https://go.dev/doc/go1.24\",\"title\":\"Go 1.24 Release Notes\",\"start_index\":0,\"end_index\":7}}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"Go 1.24 is out.\",\"annotations\":[{\"type\":\"url_citation\",\"url\":\"https://go.dev/doc/go1.24\",\"start_index\":0,\"end_index\":7}]}]}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_ann\"}}\n\n"
+	for _, streaming := range []bool{false, true} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.sse = []string{sse}
+		body := fmt.Sprintf(`{"model":"gpt-5","stream":%v,"messages":[{"role":"user","content":"latest Go?"}]}`, streaming)
+
+		rec := httptest.NewRecorder()
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		got := rec.Body.String()
+		if n := strings.Count(got, `"url_citation":{`); n != 1 {
+			t.Errorf("stream=%v: want one nested url_citation, got %d (%s)", streaming, n, got)
+		}
+		if !strings.Contains(got, `"url":"https://go.dev/doc/go1.24"`) || !strings.Contains(got, `"annotations":[`) {
+			t.Errorf("stream=%v: citation missing from chat output (%s)", streaming, got)
+		}
+	}
+}
+
+func TestResponsesCollectedKeepsAnnotations(t *testing.T) {
+	const ann = `{"type":"url_citation","url":"https://go.dev/doc/go1.24","start_index":0,"end_index":7}`
+	const delta = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Go 1.24 is out.\"}\n\n"
+	for name, sse := range map[string]string{
+		"annotation event": delta + "data: {\"type\":\"response.output_text.annotation.added\",\"annotation\":" + ann + "}\n\n" +
+			"data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"Go 1.24 is out.\"}]}}\n\n" +
+			"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_ann\"}}\n\n",
+		"finished item": delta + "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"Go 1.24 is out.\",\"annotations\":[" + ann + "]}]}}\n\n" +
+			"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_ann\"}}\n\n",
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		transport.sse = []string{sse}
+		body := `{"model":"gpt-5","stream":false,"messages":[{"role":"user","content":"latest Go?"}]}`
+
+		rec := httptest.NewRecorder()
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "responses", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		var resp types.ResponsesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Output) != 1 || len(resp.Output[0].Content) != 1 {
+			t.Fatalf("%s: unexpected response %s (%v)", name, rec.Body.String(), err)
+		}
+		anns := resp.Output[0].Content[0].Annotations
+		if len(anns) != 1 || anns[0]["url"] != "https://go.dev/doc/go1.24" {
+			t.Errorf("%s: output_text annotations got %v, want the citation once", name, anns)
+		}
+	}
+}
+
+// silentTransport streams one text delta and then goes quiet without ever
+// closing the body.
+type silentTransport struct{}
+
+func (silentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_idle\"}}\n\n" + //nolint:errcheck
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"Partial\"}\n\n"))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       pr,
+		Request:    r,
+	}, nil
+}
+
+func TestUpstreamIdleTimeoutEndsStreamAsTruncated(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		run  func(p *Pipeline, rec *httptest.ResponseRecorder)
+		want string
+	}{
+		{
+			name: "chat",
+			run: func(p *Pipeline, rec *httptest.ResponseRecorder) {
+				body := `{"model":"gpt-5","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+				p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+			},
+			want: `"finish_reason":"length"`,
+		},
+		{
+			name: "responses",
+			run: func(p *Pipeline, rec *httptest.ResponseRecorder) {
+				body := `{"model":"gpt-5","stream":true,"input":"hi"}`
+				p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+			},
+			want: `"incomplete_details":{"reason":"upstream_idle_timeout"}`,
+		},
+	} {
+		p, _ := newPassthroughTestPipeline(t)
+		p.Upstream.HTTPClient = &http.Client{Transport: silentTransport{}}
+		p.Upstream.IdleTimeout = 50 * time.Millisecond
+
+		rec := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			tt.run(p, rec)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: stream still open after the idle timeout", tt.name)
+		}
+
+		got := rec.Body.String()
+		if !strings.Contains(got, "Partial") || !strings.Contains(got, tt.want) || !strings.HasSuffix(got, "data: [DONE]\n\n") {
+			t.Errorf("%s: want the partial delta, %s and a final [DONE], got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestServerMaxOutputTokensCutsStream(t *testing.T) {
+	// 60 characters of output against a 5-token (20-character) server cap.
+	var sse strings.Builder
+	for range 6 {
+		sse.WriteString(`data: {"type":"response.output_text.delta","delta":"abcdefghij"}` + "\n\n")
+	}
+	sse.WriteString(`data: {"type":"response.completed","response":{"id":"resp_1"}}` + "\n\n")
+
+	for _, tt := range []struct {
+		name string
+		run  func(p *Pipeline, rec *httptest.ResponseRecorder)
+		want string
+	}{
+		{
+			name: "chat",
+			run: func(p *Pipeline, rec *httptest.ResponseRecorder) {
+				body := `{"model":"gpt-5","stream":true,"max_tokens":1000,"messages":[{"role":"user","content":"hi"}]}`
+				p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+			},
+			want: `"finish_reason":"length"`,
+		},
+		{
+			name: "responses",
+			run: func(p *Pipeline, rec *httptest.ResponseRecorder) {
+				body := `{"model":"gpt-5","stream":true,"max_output_tokens":1000,"input":"hi"}`
+				p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+			},
+			want: `"incomplete_details":{"reason":"max_output_tokens"}`,
+		},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.ServerMaxOutputTokens = 5
+		transport.sse = []string{sse.String()}
+
+		rec := httptest.NewRecorder()
+		tt.run(p, rec)
+
+		var text strings.Builder
+		for _, line := range strings.Split(rec.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			var evt struct {
+				Type    string `json:"type"`
+				Delta   string `json:"delta"`
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			json.Unmarshal([]byte(data), &evt) //nolint:errcheck
+			if evt.Type == "response.output_text.delta" {
+				text.WriteString(evt.Delta)
+			}
+			for _, c := range evt.Choices {
+				text.WriteString(c.Delta.Content)
+			}
+		}
+		if got := text.String(); got != "abcdefghijabcdefghij" {
+			t.Errorf("%s: streamed text %q, want the first 20 characters", tt.name, got)
+		}
+		if got := rec.Body.String(); !strings.Contains(got, tt.want) || !strings.HasSuffix(got, "data: [DONE]\n\n") {
+			t.Errorf("%s: want %s and a final [DONE], got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestEmitCostHeaderFromUsage(t *testing.T) {
+	const usageSSE = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_cost\",\"usage\":{\"input_tokens\":1000,\"output_tokens\":500,\"output_tokens_details\":{\"reasoning_tokens\":200}}}}\n\n"
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"gpt-5":{"input":1.25,"output":10,"reasoning":20}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := pricing.LoadTable(path)
+	if err != nil {
+		t.Fatalf("load price table: %v", err)
+	}
+
+	for _, tt := range []struct {
+		model string
+		want  string
+	}{
+		// 1000*1.25 + 300*10 + 200*20 = 8250 USD per 1M tokens.
+		{model: "gpt-5", want: "0.008250"},
+		{model: "gpt-5-codex", want: ""},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.CostPrices = prices
+		transport.sse = []string{usageSSE}
+
+		rec := httptest.NewRecorder()
+		body := `{"model":"` + tt.model + `","messages":[{"role":"user","content":"hi"}]}`
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status got %d, want 200 (body %s)", tt.model, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get(pricing.HeaderName); got != tt.want {
+			t.Errorf("%s: cost header got %q, want %q", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestChatRefusalSurfacedAsMessageRefusal(t *testing.T) {
+	const refusalSSE = "data: {\"type\":\"response.output_item.added\",\"item\":{\"type\":\"message\",\"id\":\"msg_1\",\"role\":\"assistant\"}}\n\n" +
+		"data: {\"type\":\"response.refusal.delta\",\"item_id\":\"msg_1\",\"delta\":\"I can't help \"}\n\n" +
+		"data: {\"type\":\"response.refusal.delta\",\"item_id\":\"msg_1\",\"delta\":\"with that.\"}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"id\":\"msg_1\",\"role\":\"assistant\",\"content\":[{\"type\":\"refusal\",\"refusal\":\"I can't help with that.\"}]}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_refusal\"}}\n\n"
+
+	p, transport := newPassthroughTestPipeline(t)
+	transport.sse = []string{refusalSSE}
+	rec := httptest.NewRecorder()
+	body := `{"model":"gpt-5","messages":[{"role":"user","content":"do something bad"}]}`
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+	var resp struct {
+		Choices []struct {
+			Message map[string]any `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Choices) != 1 {
+		t.Fatalf("decode response: %v (body %s)", err, rec.Body.String())
+	}
+	msg := resp.Choices[0].Message
+	if msg["refusal"] != "I can't help with that." {
+		t.Errorf("refusal got %v, want the refusal text", msg["refusal"])
+	}
+	if content, ok := msg["content"]; !ok || content != nil {
+		t.Errorf("content got %v (present %v), want null", content, ok)
+	}
+
+	// Streaming carries the refusal in delta.refusal, not delta.content.
+	transport.sse = []string{refusalSSE}
+	rec = httptest.NewRecorder()
+	body = `{"model":"gpt-5","stream":true,"messages":[{"role":"user","content":"do something bad"}]}`
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	out := rec.Body.String()
+	if !strings.Contains(out, `"refusal":"I can't help "`) || strings.Count(out, "with that.") != 1 || strings.Contains(out, `"content":"I can`) {
+		t.Errorf("stream should carry each refusal delta once in delta.refusal, got %s", out)
+	}
+}
+
+func TestTruncationNoticeHeader(t *testing.T) {
+	const truncatedSSE = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Once upon\"}\n\n" +
+		"data: {\"type\":\"response.incomplete\",\"response\":{\"id\":\"resp_trunc\",\"status\":\"incomplete\",\"incomplete_details\":{\"reason\":\"max_output_tokens\"}}}\n\n"
+	for _, tt := range []struct {
+		name   string
+		notice bool
+		sse    string
+		want   string
+	}{
+		{name: "truncated", notice: true, sse: truncatedSSE, want: "max_tokens"},
+		{name: "complete", notice: true, sse: textOnlySSE},
+		{name: "notice off", sse: truncatedSSE},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.TruncationNotice = tt.notice
+		transport.sse = []string{tt.sse}
+
+		rec := httptest.NewRecorder()
+		body := `{"model":"gpt-5","messages":[{"role":"user","content":"tell me a story"}]}`
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		if got := rec.Header().Get(codec.TruncatedHeader); got != tt.want {
+			t.Errorf("%s: truncated header got %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.sse == truncatedSSE && !strings.Contains(rec.Body.String(), `"finish_reason":"length"`) {
+			t.Errorf("%s: expected finish_reason length, got %s", tt.name, rec.Body.String())
+		}
+	}
+}
+
+func TestReportUpstreamModel(t *testing.T) {
+	for _, tt := range []struct {
+		route  string
+		body   string
+		report bool
+		want   string
+	}{
+		{route: "chat", body: `{"model":"gpt-5-high","messages":[{"role":"user","content":"hi"}]}`, want: "gpt-5-high"},
+		{route: "chat", body: `{"model":"gpt-5-high","messages":[{"role":"user","content":"hi"}]}`, report: true, want: "gpt-5"},
+		{route: "chat", body: `{"model":"gpt-5-high","stream":true,"messages":[{"role":"user","content":"hi"}]}`, report: true, want: "gpt-5"},
+		{route: "responses", body: `{"model":"gpt-5-high","input":"hi"}`, want: "gpt-5-high"},
+		{route: "responses", body: `{"model":"gpt-5-high","input":"hi"}`, report: true, want: "gpt-5"},
+		{route: "passthrough", body: `{"model":"gpt-5-high","input":"hi"}`, report: true, want: "gpt-5"},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.ReportUpstreamModel = tt.report
+		transport.sse = []string{textOnlySSE}
+
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background()}
+		if tt.route == "passthrough" {
+			p.ExecutePassthrough(ctx, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(ctx, rec, []byte(tt.body), tt.route, &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+		if want := `"model":"` + tt.want + `"`; !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s report=%v: want %s in %s", tt.route, tt.report, want, rec.Body.String())
+		}
+	}
+}
+
+func TestChatNWithToolsReturnsSingleChoice(t *testing.T) {
+	p, transport := newPassthroughTestPipeline(t)
+	p.Config.Verbose = true
+	transport.sse = []string{toolCallSSE}
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	rec := httptest.NewRecorder()
+	body := `{"model":"gpt-5","n":2,"messages":[{"role":"user","content":"weather?"}],` +
+		`"tools":[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]}`
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	var resp types.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(resp.Choices) != 1 || len(resp.Choices[0].Message.ToolCalls) != 1 {
+		t.Errorf("want one choice carrying the tool call, got %s", rec.Body.String())
+	}
+	if _, ok := transport.body["n"]; ok {
+		t.Errorf("n should not be sent upstream: %v", transport.body)
+	}
+	if !strings.Contains(logs.String(), "request.n_forced_single") || !strings.Contains(logs.String(), "with_tools=true") {
+		t.Errorf("expected an n_forced_single warning, got %q", logs.String())
+	}
+}
+
+func TestEmptyResponseBehavior(t *testing.T) {
+	const answerSSE = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"It is sunny.\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_retry\"}}\n\n"
+	for _, tt := range []struct {
+		behavior  string
+		stream    bool
+		sse       []string
+		wantCalls int
+		wantCode  int
+		want      string
+	}{
+		{behavior: "retry", stream: true, sse: []string{"", answerSSE}, wantCalls: 2, wantCode: http.StatusOK, want: "It is sunny."},
+		{behavior: "retry", sse: []string{"", answerSSE}, wantCalls: 2, wantCode: http.StatusOK, want: "It is sunny."},
+		{behavior: "retry", sse: []string{"", ""}, wantCalls: 2, wantCode: http.StatusBadGateway, want: "empty response after retry"},
+		{behavior: "error", stream: true, sse: []string{""}, wantCalls: 1, wantCode: http.StatusOK, want: "upstream returned empty response"},
+		{behavior: "error", sse: []string{""}, wantCalls: 1, wantCode: http.StatusBadGateway, want: "upstream returned empty response"},
+		{behavior: "empty", stream: true, sse: []string{""}, wantCalls: 1, wantCode: http.StatusOK, want: `"finish_reason":"stop"`},
+		{behavior: "empty", sse: []string{""}, wantCalls: 1, wantCode: http.StatusOK, want: `"finish_reason":"stop"`},
+	} {
+		name := fmt.Sprintf("%s stream=%v", tt.behavior, tt.stream)
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.EmptyResponseBehavior = tt.behavior
+		transport.sse = tt.sse
+
+		rec := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"model":"gpt-5","stream":%v,"messages":[{"role":"user","content":"hi"}]}`, tt.stream)
+		p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+
+		if transport.calls != tt.wantCalls {
+			t.Errorf("%s: upstream calls got %d, want %d", name, transport.calls, tt.wantCalls)
+		}
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status got %d, want %d", name, rec.Code, tt.wantCode)
+		}
+		if got := rec.Body.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("%s: body should contain %q, got %s", name, tt.want, got)
+		}
+		if tt.behavior != "error" && tt.wantCode == http.StatusOK && strings.Contains(rec.Body.String(), "empty response") {
+			t.Errorf("%s: unexpected empty-response error: %s", name, rec.Body.String())
+		}
+	}
+}
+
+func TestExplicitReasoningDisableOmitsReasoningParam(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		body        string
+		passthrough bool
+		disabled    bool
+	}{
+		{name: "chat effort none", body: `{"model":"gpt-5-high","messages":[{"role":"user","content":"hi"}],"reasoning":{"effort":"none"}}`, disabled: true},
+		{name: "chat null", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"reasoning":null}`, disabled: true},
+		{name: "passthrough null", body: `{"model":"gpt-5","input":"hi","reasoning":null}`, passthrough: true, disabled: true},
+		{name: "passthrough effort none", body: `{"model":"gpt-5","input":"hi","reasoning":{"effort":"none"}}`, passthrough: true, disabled: true},
+		{name: "chat absent", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background()}
+		if tt.passthrough {
+			p.ExecutePassthrough(ctx, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(ctx, rec, []byte(tt.body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status got %d, want 200 (body %s)", tt.name, rec.Code, rec.Body.String())
+		}
+
+		_, hasReasoning := transport.body["reasoning"]
+		hasInclude := strings.Contains(fmt.Sprint(transport.body["include"]), "reasoning.encrypted_content")
+		if hasReasoning == tt.disabled || hasInclude == tt.disabled {
+			t.Errorf("%s: reasoning sent=%v include sent=%v, want %v", tt.name, hasReasoning, hasInclude, !tt.disabled)
+		}
+	}
+}
+
+func TestAcceptEventStreamForcesStreamingWhenBodyOmitsStream(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		body        string
+		passthrough bool
+		wantSSE     bool
+	}{
+		{name: "chat omits stream", body: `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`, wantSSE: true},
+		{name: "chat stream false", body: `{"model":"gpt-5","stream":false,"messages":[{"role":"user","content":"hi"}]}`},
+		{name: "passthrough omits stream", body: `{"model":"gpt-5","input":"hi"}`, passthrough: true, wantSSE: true},
+		{name: "passthrough stream false", body: `{"model":"gpt-5","stream":false,"input":"hi"}`, passthrough: true},
+	} {
+		p, _ := newPassthroughTestPipeline(t)
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background(), AcceptStream: true}
+		if tt.passthrough {
+			p.ExecutePassthrough(ctx, rec, []byte(tt.body), &codec.ResponsesEncoder{})
+		} else {
+			p.Execute(ctx, rec, []byte(tt.body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}
+		if got := rec.Header().Get("Content-Type") == "text/event-stream"; got != tt.wantSSE {
+			t.Errorf("%s: streamed got %v, want %v (content-type %q)", tt.name, got, tt.wantSSE, rec.Header().Get("Content-Type"))
+		}
+	}
+
+	// Body wins over Accept: application/json.
+	p, _ := newPassthroughTestPipeline(t)
+	rec := httptest.NewRecorder()
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(`{"model":"gpt-5","stream":true,"messages":[{"role":"user","content":"hi"}]}`), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("stream:true without Accept: content-type got %q, want text/event-stream", ct)
+	}
+}
+
+func TestRenumberOutputIndicesOnRestoredContinuation(t *testing.T) {
+	const shiftedSSE = "data: {\"type\":\"response.output_item.added\",\"output_index\":2,\"item\":{\"type\":\"message\",\"role\":\"assistant\"}}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"output_index\":2,\"delta\":\"Hi\"}\n\n" +
+		"data: {\"type\":\"response.output_item.added\",\"output_index\":3,\"item\":{\"type\":\"function_call\",\"name\":\"f\"}}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"output_index\":3,\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"f\",\"arguments\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_next\",\"output\":[" +
+		"{\"type\":\"message\",\"id\":\"msg_old\"},{\"type\":\"function_call\",\"call_id\":\"call_old\"}," +
+		"{\"type\":\"message\",\"id\":\"msg_new\"},{\"type\":\"function_call\",\"call_id\":\"call_1\"}]}}\n\n"
+
+	routes := []struct {
+		name string
+		run  func(p *Pipeline, rec *httptest.ResponseRecorder)
+	}{
+		{"normalized", func(p *Pipeline, rec *httptest.ResponseRecorder) {
+			body := `{"model":"gpt-5","stream":true,"previous_response_id":"resp_prev","messages":[{"role":"user","content":"again"}]}`
+			p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "responses", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		}},
+		{"passthrough", func(p *Pipeline, rec *httptest.ResponseRecorder) {
+			body := `{"model":"gpt-5","stream":true,"previous_response_id":"resp_prev","input":"again"}`
+			p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+		}},
+	}
+	for _, route := range routes {
+		for _, renumber := range []bool{true, false} {
+			p, transport := newPassthroughTestPipeline(t)
+			p.Config.RenumberOutputIndices = renumber
+			p.Store.PutContext("resp_prev", []types.ResponsesInputItem{
+				{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "hello"}}},
+			})
+			transport.sse = []string{shiftedSSE}
+
+			rec := httptest.NewRecorder()
+			route.run(p, rec)
+			out := rec.Body.String()
+
+			var want []string
+			wantOutput := "msg_old,call_old,msg_new,call_1"
+			if renumber {
+				want = []string{`"output_index":0`, `"output_index":1`}
+				wantOutput = "msg_new,call_1"
+			} else {
+				want = []string{`"output_index":2`, `"output_index":3`}
+			}
+			for _, w := range want {
+				if strings.Count(out, w) != 2 {
+					t.Errorf("%s renumber=%v: expected %s on two events:\n%s", route.name, renumber, w, out)
+				}
+			}
+			if got := completedOutputIDs(t, out); got != wantOutput {
+				t.Errorf("%s renumber=%v: completed output got %s, want %s", route.name, renumber, got, wantOutput)
+			}
+		}
+	}
+}
+
+// completedOutputIDs returns the ids (or call_ids) of the response.completed
+// output items in a client SSE stream, comma-separated.
+func completedOutputIDs(t *testing.T, sse string) string {
+	t.Helper()
+	for _, line := range strings.Split(sse, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || !strings.Contains(data, `"response.completed"`) {
+			continue
+		}
+		var evt struct {
+			Response struct {
+				Output []struct {
+					ID     string `json:"id"`
+					CallID string `json:"call_id"`
+				} `json:"output"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			t.Fatalf("decode completed event: %v", err)
+		}
+		var ids []string
+		for _, item := range evt.Response.Output {
+			ids = append(ids, item.ID+item.CallID)
+		}
+		return strings.Join(ids, ",")
+	}
+	t.Fatalf("no response.completed event in:\n%s", sse)
+	return ""
+}
+
+func TestWarmupSendsOneUpstreamRequest(t *testing.T) {
+	p, transport := newPassthroughTestPipeline(t)
+	transport.sse = []string{textOnlySSE}
+
+	if err := p.Warmup(context.Background()); err != nil {
+		t.Fatalf("Warmup: %v", err)
+	}
+	if transport.calls != 1 {
+		t.Fatalf("upstream calls: got %d, want 1", transport.calls)
+	}
+	if transport.body["stream"] != true {
+		t.Errorf("warm-up must go through the normal upstream payload, got stream=%v", transport.body["stream"])
+	}
+	if want := p.Registry.Cached()[0].Slug; transport.body["model"] != want {
+		t.Errorf("warm-up without --default-model should use the first listed model %q, got %v", want, transport.body["model"])
+	}
+
+	p.Config.DefaultModel = "gpt-5-codex"
+	if err := p.Warmup(context.Background()); err != nil || transport.body["model"] != "gpt-5-codex" {
+		t.Errorf("warm-up should use --default-model, got model %v (err %v)", transport.body["model"], err)
+	}
+
+	transport.status = http.StatusUnauthorized
+	if err := p.Warmup(context.Background()); err == nil {
+		t.Error("expected an error for a failed warm-up")
+	}
+}
+
+func TestSystemFingerprintStableUntilConfigChanges(t *testing.T) {
+	p, _ := newPassthroughTestPipeline(t)
+	p.Config.EmitSystemFingerprint = true
+	body := []byte(`{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`)
+
+	fingerprint := func(stream bool) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		ctx := &RequestContext{Context: context.Background(), AcceptStream: stream}
+		p.Execute(ctx, rec, body, "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+		if stream {
+			line, _, _ := strings.Cut(strings.TrimPrefix(rec.Body.String(), "data: "), "\n")
+			var chunk types.ChatCompletionChunk
+			if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+				t.Fatalf("first chunk %q: %v", line, err)
+			}
+			return chunk.SystemFingerprint
+		}
+		var completion types.ChatCompletionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &completion); err != nil {
+			t.Fatalf("completion %s: %v", rec.Body.String(), err)
+		}
+		return completion.SystemFingerprint
+	}
+
+	first := fingerprint(false)
+	if !strings.HasPrefix(first, "fp_") {
+		t.Fatalf("system_fingerprint: got %q, want an fp_ value", first)
+	}
+	if again := fingerprint(false); again != first {
+		t.Errorf("fingerprint changed between identical requests: %q then %q", first, again)
+	}
+	if streamed := fingerprint(true); streamed != first {
+		t.Errorf("streamed fingerprint %q differs from collected %q", streamed, first)
+	}
+
+	p.Config.ReasoningEffort = "high"
+	if changed := fingerprint(false); changed == first {
+		t.Errorf("fingerprint %q did not change with the reasoning effort", changed)
+	}
+
+	p.Config.EmitSystemFingerprint = false
+	if off := fingerprint(false); off != "" {
+		t.Errorf("fingerprint reported while disabled: %q", off)
+	}
+}
+
+func TestToolSchemaRefsForwardedIntact(t *testing.T) {
+	const params = `{"type":"object","properties":{"root":{"$ref":"#/$defs/node"}},"required":["root"],` +
+		`"$defs":{"node":{"type":"object","properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#/$defs/node"}}}}}}`
+	var want any
+	if err := json.Unmarshal([]byte(params), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	p, transport := newPassthroughTestPipeline(t)
+	body := `{"model":"gpt-5","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"save_tree","parameters":` + params + `}}]}`
+	rec := httptest.NewRecorder()
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", rec.Code, rec.Body.String())
+	}
+	tools, _ := transport.body["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("upstream tools: got %v", transport.body["tools"])
+	}
+	got, _ := tools[0].(map[string]any)
+	if !reflect.DeepEqual(got["parameters"], want) {
+		t.Errorf("parameters changed on the way upstream:\ngot  %v\nwant %v", got["parameters"], want)
+	}
+
+	broken := strings.Replace(body, `"items":{"$ref":"#/$defs/node"}`, `"items":{"$ref":"#/$defs/missing"}`, 1)
+	rec = httptest.NewRecorder()
+	calls := transport.calls
+	p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(broken), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `save_tree`) || !strings.Contains(rec.Body.String(), `does not resolve`) {
+		t.Errorf("unresolvable $ref: got %d %s", rec.Code, rec.Body.String())
+	}
+	if transport.calls != calls {
+		t.Error("an invalid schema should not be sent upstream")
+	}
+}
+
+func TestNonStreamingResponsesIncludeUsageRegardlessOfStreamOptions(t *testing.T) {
+	usageSSE := "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"message\",\"role\":\"assistant\",\"content\":[{\"type\":\"output_text\",\"text\":\"Hi.\"}]}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_usage\",\"usage\":{\"input_tokens\":5,\"output_tokens\":3,\"total_tokens\":8}}}\n\n"
+	for _, route := range []string{"chat", "responses"} {
+		for _, opts := range []string{``, `,"stream_options":{"include_usage":true}`, `,"stream_options":{"include_usage":false}`} {
+			p, transport := newPassthroughTestPipeline(t)
+			transport.sse = []string{usageSSE}
+			body := `{"model":"gpt-5","stream":false,"messages":[{"role":"user","content":"hi"}]` + opts + `}`
+
+			rec := httptest.NewRecorder()
+			p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), route, &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s%s: status %d, body %s", route, opts, rec.Code, rec.Body.String())
+			}
+			var resp struct {
+				Usage map[string]int64 `json:"usage"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s%s: invalid JSON %s", route, opts, rec.Body.String())
+			}
+			if resp.Usage["total_tokens"] != 8 {
+				t.Errorf("%s%s: usage %v, want total_tokens 8 (body %s)", route, opts, resp.Usage, rec.Body.String())
+			}
+		}
+	}
+}
+
+func TestServerMaxOutputTokensCutsCollectedResponses(t *testing.T) {
+	// 60 characters of output against a 5-token (20-character) server cap.
+	var sse strings.Builder
+	for range 6 {
+		sse.WriteString(`data: {"type":"response.output_text.delta","delta":"abcdefghij"}` + "\n\n")
+	}
+	sse.WriteString(`data: {"type":"response.output_item.done","item":{"type":"message","role":"assistant","content":[{"type":"output_text","text":"` + strings.Repeat("abcdefghij", 6) + `"}]}}` + "\n\n")
+	sse.WriteString(`data: {"type":"response.completed","response":{"id":"resp_1"}}` + "\n\n")
+
+	for _, tt := range []struct {
+		name string
+		run  func(p *Pipeline, rec *httptest.ResponseRecorder)
+		want []string
+	}{
+		{
+			name: "chat",
+			run: func(p *Pipeline, rec *httptest.ResponseRecorder) {
+				body := `{"model":"gpt-5","stream":false,"messages":[{"role":"user","content":"hi"}]}`
+				p.Execute(&RequestContext{Context: context.Background()}, rec, []byte(body), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+			},
+			want: []string{`"content":"abcdefghijabcdefghij"`, `"finish_reason":"length"`},
+		},
+		{
+			name: "responses passthrough",
+			run: func(p *Pipeline, rec *httptest.ResponseRecorder) {
+				body := `{"model":"gpt-5","stream":false,"input":"hi"}`
+				p.ExecutePassthrough(&RequestContext{Context: context.Background()}, rec, []byte(body), &codec.ResponsesEncoder{})
+			},
+			want: []string{`"text":"abcdefghijabcdefghij"`, `"incomplete_details":{"reason":"max_output_tokens"}`},
+		},
+	} {
+		p, transport := newPassthroughTestPipeline(t)
+		p.Config.ServerMaxOutputTokens = 5
+		transport.sse = []string{sse.String()}
+
+		rec := httptest.NewRecorder()
+		tt.run(p, rec)
+		for _, want := range tt.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: want %s in %s", tt.name, want, rec.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/codec"
+)
+
+// warmupMaxTokens caps the warm-up reply; only the round trip matters.
+const warmupMaxTokens = 16
+
+// warmupBody is the tiny non-streaming request Warmup sends upstream, for
+// --default-model or else the first model the registry lists, so it works on
+// accounts without access to any particular model.
+func (p *Pipeline) warmupBody() []byte {
+	model := p.Config.DefaultModel
+	if model == "" {
+		if mods := p.Registry.Cached(); len(mods) > 0 {
+			model = mods[0].Slug
+		}
+	}
+	body, _ := json.Marshal(map[string]any{
+		"model":                 model,
+		"stream":                false,
+		"max_completion_tokens": warmupMaxTokens,
+		"messages":              []map[string]string{{"role": "user", "content": "ping"}},
+	})
+	return body
+}
+
+// Warmup sends a minimal request through the full pipeline so the access
+// token, upstream connection pool and instruction caches are primed before
+// the first client request. The response is discarded.
+func (p *Pipeline) Warmup(ctx context.Context) error {
+	w := &discardWriter{header: make(http.Header)}
+	p.Execute(&RequestContext{Context: ctx}, w, p.warmupBody(), "chat", &codec.ChatEncoder{}, &codec.ResponsesEncoder{})
+	if w.status >= http.StatusBadRequest {
+		return fmt.Errorf("warm-up request failed with status %d: %s", w.status, strings.TrimSpace(w.body.String()))
+	}
+	return nil
+}
+
+// discardWriter is a minimal http.ResponseWriter that keeps only the status
+// and body for error reporting.
+type discardWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *discardWriter) Header() http.Header { return w.header }
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status >= http.StatusBadRequest && w.body.Len() < 512 {
+		w.body.Write(b)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,69 @@
+// Package pricing estimates the USD cost of a response from its token usage.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// HeaderName is the response header carrying the cost estimate.
+const HeaderName = "X-Chatmock-Estimated-Cost"
+
+// Price is the USD cost per one million tokens for a model. Reasoning tokens
+// are part of the output tokens and are billed at Output unless Reasoning is set.
+type Price struct {
+	Input     float64  `json:"input"`
+	Output    float64  `json:"output"`
+	Reasoning *float64 `json:"reasoning,omitempty"`
+}
+
+// Table maps normalized model names to prices.
+type Table map[string]Price
+
+// LoadTable reads a price table from a JSON file of the form
+// {"gpt-5": {"input": 1.25, "output": 10}}.
+func LoadTable(path string) (Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parse price table %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Estimate returns the cost of usage for model, or false when the model is not
+// in the table or usage is unknown.
+func (t Table) Estimate(model string, usage *types.Usage) (float64, bool) {
+	price, ok := t[model]
+	if !ok || usage == nil {
+		return 0, false
+	}
+	var reasoning int64
+	if usage.CompletionTokensDetails != nil {
+		reasoning = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	reasoningPrice := price.Output
+	if price.Reasoning != nil {
+		reasoningPrice = *price.Reasoning
+	}
+	cost := float64(usage.PromptTokens)*price.Input +
+		float64(usage.CompletionTokens-reasoning)*price.Output +
+		float64(reasoning)*reasoningPrice
+	return cost / 1e6, true
+}
+
+// SetHeader sets the cost header on w when an estimate is available. It must
+// be called before the response body is written.
+func (t Table) SetHeader(w http.ResponseWriter, model string, usage *types.Usage) {
+	if cost, ok := t.Estimate(model, usage); ok {
+		w.Header().Set(HeaderName, strconv.FormatFloat(cost, 'f', 6, 64))
+	}
+}
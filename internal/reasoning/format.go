@@ -6,6 +6,34 @@ import (
 	"github.com/n0madic/go-chatmock/internal/types"
 )
 
+// validCompatModes lists the accepted reasoning compat modes.
+var validCompatModes = map[string]bool{"think-tags": true, "o3": true, "legacy": true, "current": true, "inline": true}
+
+// Labels the inline compat mode writes around reasoning in message content,
+// for clients that render nothing but content and strip markup.
+const (
+	InlineReasoningLabel = "Reasoning: "
+	InlineAnswerLabel    = "\n\nAnswer: "
+)
+
+// ContentMarkers returns the text that opens and closes reasoning when compat
+// writes it into the message content (think-tags and inline). ok is false for
+// modes that carry reasoning in separate fields.
+func ContentMarkers(compat string) (open, close string, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(compat)) {
+	case "", "think-tags":
+		return "<think>", "</think>", true
+	case "inline":
+		return InlineReasoningLabel, InlineAnswerLabel, true
+	}
+	return "", "", false
+}
+
+// IsValidCompat reports whether mode is a supported reasoning compat mode.
+func IsValidCompat(mode string) bool {
+	return validCompatModes[strings.ToLower(strings.TrimSpace(mode))]
+}
+
 // ApplyReasoningToMessage adds reasoning data to a non-streaming message based on the compat mode.
 func ApplyReasoningToMessage(message *types.ChatResponseMsg, reasoningSummaryText, reasoningFullText, compat string) {
 	compat = strings.ToLower(strings.TrimSpace(compat))
@@ -39,7 +67,8 @@ func ApplyReasoningToMessage(message *types.ChatResponseMsg, reasoningSummaryTex
 			message.Reasoning = reasoningFullText
 		}
 
-	default: // think-tags
+	default: // think-tags, inline
+		open, close, _ := ContentMarkers(compat)
 		var parts []string
 		if reasoningSummaryText != "" {
 			parts = append(parts, reasoningSummaryText)
@@ -49,7 +78,48 @@ func ApplyReasoningToMessage(message *types.ChatResponseMsg, reasoningSummaryTex
 		}
 		rtxt := strings.Join(parts, "\n\n")
 		if rtxt != "" {
-			message.Content = "<think>" + rtxt + "</think>" + message.Content
+			content := open + rtxt + close
+			if message.Content != nil {
+				content += *message.Content
+			}
+			message.Content = &content
 		}
 	}
 }
+
+// StripThinkTags removes <think>...</think> blocks that the think-tags compat
+// mode prepends to assistant content. An unterminated block is dropped to the
+// end of the text.
+func StripThinkTags(text string) string {
+	if !strings.Contains(text, "<think>") {
+		return text
+	}
+	var b strings.Builder
+	rest := text
+	for {
+		start := strings.Index(rest, "<think>")
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:start])
+		end := strings.Index(rest[start:], "</think>")
+		if end < 0 {
+			break
+		}
+		rest = rest[start+end+len("</think>"):]
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// StripInlineReasoning removes the "Reasoning: ...\n\nAnswer: " prefix that
+// the inline compat mode puts before assistant content.
+func StripInlineReasoning(text string) string {
+	if !strings.HasPrefix(text, InlineReasoningLabel) {
+		return text
+	}
+	if _, answer, ok := strings.Cut(text, InlineAnswerLabel); ok {
+		return answer
+	}
+	return text
+}
@@ -3,18 +3,38 @@ package reasoning
 import (
 	"strings"
 
+	"github.com/n0madic/go-chatmock/internal/config"
 	"github.com/n0madic/go-chatmock/internal/models"
 	"github.com/n0madic/go-chatmock/internal/types"
 )
 
+// EffortNone is the override effort that disables reasoning for a request.
+// Clients send it as reasoning.effort "none" or as "reasoning": null.
+const EffortNone = "none"
+
 // BuildReasoningParam constructs the reasoning parameter for the Responses API.
-func BuildReasoningParam(baseEffort, baseSummary string, overrides *types.ReasoningParam, model string) *types.ReasoningParam {
+// It returns nil when overrides explicitly disable reasoning, in which case no
+// reasoning param (and no encrypted reasoning include) is sent upstream.
+//
+// The effort comes from the first of these that the model accepts: the request
+// overrides, the model's effortByModel entry (--reasoning-effort-model),
+// baseEffort (--reasoning-effort), and finally "medium". caps supplies
+// --capabilities-file reasoning levels that replace the built-in sets.
+func BuildReasoningParam(baseEffort, baseSummary string, effortByModel map[string]string, caps config.CapabilityTable, overrides *types.ReasoningParam, model string) *types.ReasoningParam {
+	if overrides != nil && strings.EqualFold(strings.TrimSpace(overrides.Effort), EffortNone) {
+		return nil
+	}
+
 	effort := strings.ToLower(strings.TrimSpace(baseEffort))
 	summary := strings.ToLower(strings.TrimSpace(baseSummary))
 
-	validEfforts := models.AllowedEfforts(model)
+	validEfforts := models.AllowedEfforts(model, caps)
 	validSummaries := map[string]bool{"auto": true, "concise": true, "detailed": true, "none": true}
 
+	if e := effortByModel[strings.ToLower(strings.TrimSpace(model))]; validEfforts[e] {
+		effort = e
+	}
+
 	if overrides != nil {
 		if e := strings.ToLower(strings.TrimSpace(overrides.Effort)); e != "" && validEfforts[e] {
 			effort = e
@@ -43,8 +63,12 @@ func BuildReasoningParam(baseEffort, baseSummary string, overrides *types.Reason
 }
 
 // ParseFromRaw extracts a ReasoningParam from a raw JSON map field.
-// Returns nil if the field is absent or not a map.
+// Returns nil if the field is absent or not a map; an explicit null yields the
+// EffortNone override.
 func ParseFromRaw(raw map[string]any) *types.ReasoningParam {
+	if IsExplicitNull(raw) {
+		return &types.ReasoningParam{Effort: EffortNone}
+	}
 	ro, ok := raw["reasoning"].(map[string]any)
 	if !ok {
 		return nil
@@ -53,14 +77,19 @@ func ParseFromRaw(raw map[string]any) *types.ReasoningParam {
 	if e, ok := ro["effort"].(string); ok {
 		p.Effort = e
 	}
-	if sm, ok := ro["summary"].(string); ok {
+	if sm, ok := ro["summary"].(string); ok && sm != "" {
+		p.Summary = sm
+	} else if sm, ok := ro["generate_summary"].(string); ok {
+		// Older Responses clients send the pre-rename field.
 		p.Summary = sm
 	}
 	return p
 }
 
 // ExtractFromModelName infers reasoning overrides from a model name string.
-func ExtractFromModelName(model string) *types.ReasoningParam {
+// Hyphen and underscore suffixes only count for variants of the available
+// models (see models.SplitEffortVariant).
+func ExtractFromModelName(model string, available []models.RemoteModel) *types.ReasoningParam {
 	if model == "" {
 		return nil
 	}
@@ -84,13 +113,16 @@ func ExtractFromModelName(model string) *types.ReasoningParam {
 	// Hyphen and underscore separators cover the OpenAI-style variant names
 	// that clients may send (e.g. "gpt-5-high", "gpt-5_medium"). Both are
 	// accepted because different integrations use different conventions.
-	for _, sep := range []string{"-", "_"} {
-		for _, e := range efforts {
-			if strings.HasSuffix(s, sep+e) {
-				return &types.ReasoningParam{Effort: e}
-			}
-		}
+	base := strings.TrimSpace(strings.SplitN(model, ":", 2)[0])
+	if _, e := models.SplitEffortVariant(base, available); e != "" {
+		return &types.ReasoningParam{Effort: e}
 	}
 
 	return nil
 }
+
+// IsExplicitNull reports whether the body carries "reasoning": null.
+func IsExplicitNull(raw map[string]any) bool {
+	v, ok := raw["reasoning"]
+	return ok && v == nil
+}
@@ -0,0 +1,34 @@
+package reasoning
+
+import (
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestBuildReasoningParamEffortPrecedence(t *testing.T) {
+	byModel := map[string]string{"gpt-5-codex": "high", "gpt-5.2": "minimal"}
+	for _, tt := range []struct {
+		name      string
+		model     string
+		overrides *types.ReasoningParam
+		want      string
+	}{
+		{name: "model entry beats global default", model: "gpt-5-codex", want: "high"},
+		{name: "request override beats model entry", model: "gpt-5-codex", overrides: &types.ReasoningParam{Effort: "low"}, want: "low"},
+		{name: "unlisted model falls through to global", model: "gpt-5", want: "low"},
+		{name: "effort the model rejects falls through to global", model: "gpt-5.2", want: "low"},
+	} {
+		got := BuildReasoningParam("low", "auto", byModel, nil, tt.overrides, tt.model)
+		if got == nil || got.Effort != tt.want {
+			t.Errorf("%s: got %+v, want effort %q", tt.name, got, tt.want)
+		}
+	}
+
+	if got := BuildReasoningParam("bogus", "auto", nil, nil, nil, "gpt-5"); got.Effort != "medium" {
+		t.Errorf("invalid global effort should fall back to medium, got %q", got.Effort)
+	}
+	if got := BuildReasoningParam("low", "auto", byModel, nil, &types.ReasoningParam{Effort: EffortNone}, "gpt-5-codex"); got != nil {
+		t.Errorf("effort none should disable reasoning, got %+v", got)
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/codec"
+	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+type adminFunctionCall struct {
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type adminStateResponse struct {
+	ResponseID    string                     `json:"response_id"`
+	Context       []types.ResponsesInputItem `json:"context"`
+	FunctionCalls []adminFunctionCall        `json:"function_calls"`
+	Instructions  string                     `json:"instructions"`
+	LastAccess    string                     `json:"last_access"`
+}
+
+type adminRefreshAuthResponse struct {
+	AccountID string `json:"account_id"`
+	Changed   bool   `json:"changed"`
+}
+
+type adminConversationResponse struct {
+	ConversationID   string `json:"conversation_id"`
+	LatestResponseID string `json:"latest_response_id"`
+	LastAccess       string `json:"last_access"`
+}
+
+// conversationExportVersion is the format version of conversation exports.
+const conversationExportVersion = 1
+
+type exportedResponse struct {
+	ResponseID    string                     `json:"response_id"`
+	Context       []types.ResponsesInputItem `json:"context"`
+	FunctionCalls []adminFunctionCall        `json:"function_calls"`
+	Instructions  string                     `json:"instructions,omitempty"`
+}
+
+// conversationExport is the portable document produced by the export route
+// and accepted by the import route. Stored contexts are cumulative, so the
+// latest response carries the whole conversation history.
+type conversationExport struct {
+	Version          int                `json:"version"`
+	ConversationID   string             `json:"conversation_id"`
+	LatestResponseID string             `json:"latest_response_id"`
+	Responses        []exportedResponse `json:"responses"`
+}
+
+// registerAdminRoutes adds the state inspection and conversation export/import
+// endpoints. They are only exposed when a server access token is configured,
+// so the stored conversation context is never reachable on an unauthenticated
+// server.
+func (s *Server) registerAdminRoutes(mux *http.ServeMux) {
+	if s.Config == nil || strings.TrimSpace(s.Config.AccessToken) == "" {
+		return
+	}
+	mux.HandleFunc("GET /admin/state/{responseID}", s.handleAdminState)
+	mux.HandleFunc("GET /admin/state/conversations/{convID}", s.handleAdminConversation)
+	mux.HandleFunc("GET /admin/conversations/{convID}/export", s.handleConversationExport)
+	mux.HandleFunc("POST /admin/conversations/import", s.handleConversationImport)
+	mux.HandleFunc("POST /admin/refresh-auth", s.handleAdminRefreshAuth)
+}
+
+// handleAdminRefreshAuth re-reads the auth file at once instead of waiting
+// for the credential cache to expire. When the account changed, the model
+// list is refetched in the background.
+func (s *Server) handleAdminRefreshAuth(w http.ResponseWriter, r *http.Request) {
+	accountID, changed, err := s.Pipeline.Upstream.TokenManager.Reload()
+	if err != nil {
+		codec.WriteOpenAIError(w, http.StatusServiceUnavailable, "credentials not ready: "+err.Error())
+		return
+	}
+	codec.WriteJSON(w, http.StatusOK, adminRefreshAuthResponse{AccountID: accountID, Changed: changed})
+}
+
+func (s *Server) handleAdminState(w http.ResponseWriter, r *http.Request) {
+	responseID := strings.TrimSpace(r.PathValue("responseID"))
+	snap, ok := s.Store.Inspect(responseID)
+	if !ok {
+		codec.WriteOpenAIError(w, http.StatusNotFound, "unknown or expired response id "+responseID)
+		return
+	}
+
+	calls := make([]adminFunctionCall, 0, len(snap.Calls))
+	for _, c := range snap.Calls {
+		calls = append(calls, adminFunctionCall{CallID: c.CallID, Name: c.Name, Arguments: c.Arguments})
+	}
+	context := snap.Context
+	if context == nil {
+		context = []types.ResponsesInputItem{}
+	}
+	codec.WriteJSON(w, http.StatusOK, adminStateResponse{
+		ResponseID:    responseID,
+		Context:       context,
+		FunctionCalls: calls,
+		Instructions:  snap.Instructions,
+		LastAccess:    snap.LastAccess.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) handleAdminConversation(w http.ResponseWriter, r *http.Request) {
+	convID := strings.TrimSpace(r.PathValue("convID"))
+	responseID, lastAccess, ok := s.Store.InspectConversation(convID)
+	if !ok {
+		codec.WriteOpenAIError(w, http.StatusNotFound, "unknown or expired conversation id "+convID)
+		return
+	}
+	codec.WriteJSON(w, http.StatusOK, adminConversationResponse{
+		ConversationID:   convID,
+		LatestResponseID: responseID,
+		LastAccess:       lastAccess.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) handleConversationExport(w http.ResponseWriter, r *http.Request) {
+	convID := strings.TrimSpace(r.PathValue("convID"))
+	responseID, _, ok := s.Store.InspectConversation(convID)
+	if !ok {
+		codec.WriteOpenAIError(w, http.StatusNotFound, "unknown or expired conversation id "+convID)
+		return
+	}
+	snap, ok := s.Store.Inspect(responseID)
+	if !ok {
+		codec.WriteOpenAIError(w, http.StatusNotFound, "conversation "+convID+" points to expired response id "+responseID)
+		return
+	}
+
+	calls := make([]adminFunctionCall, 0, len(snap.Calls))
+	for _, c := range snap.Calls {
+		calls = append(calls, adminFunctionCall{CallID: c.CallID, Name: c.Name, Arguments: c.Arguments})
+	}
+	context := snap.Context
+	if context == nil {
+		context = []types.ResponsesInputItem{}
+	}
+	codec.WriteJSON(w, http.StatusOK, conversationExport{
+		Version:          conversationExportVersion,
+		ConversationID:   convID,
+		LatestResponseID: responseID,
+		Responses: []exportedResponse{{
+			ResponseID:    responseID,
+			Context:       context,
+			FunctionCalls: calls,
+			Instructions:  snap.Instructions,
+		}},
+	})
+}
+
+func (s *Server) handleConversationImport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		codec.WriteOpenAIError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+	var doc conversationExport
+	if err := json.Unmarshal(body, &doc); err != nil {
+		codec.WriteOpenAIError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	if doc.Version != conversationExportVersion {
+		codec.WriteOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("unsupported export version %d", doc.Version))
+		return
+	}
+	doc.ConversationID = strings.TrimSpace(doc.ConversationID)
+	if doc.ConversationID == "" {
+		codec.WriteOpenAIError(w, http.StatusBadRequest, "conversation_id is required")
+		return
+	}
+	hasLatest := false
+	for _, resp := range doc.Responses {
+		if strings.TrimSpace(resp.ResponseID) == "" {
+			codec.WriteOpenAIError(w, http.StatusBadRequest, "every response needs a response_id")
+			return
+		}
+		hasLatest = hasLatest || resp.ResponseID == doc.LatestResponseID
+	}
+	if !hasLatest {
+		codec.WriteOpenAIError(w, http.StatusBadRequest, "latest_response_id must name one of the exported responses")
+		return
+	}
+
+	for _, resp := range doc.Responses {
+		calls := make([]state.FunctionCall, 0, len(resp.FunctionCalls))
+		for _, c := range resp.FunctionCalls {
+			calls = append(calls, state.FunctionCall{CallID: c.CallID, Name: c.Name, Arguments: c.Arguments})
+		}
+		s.Store.PutSnapshot(resp.ResponseID, resp.Context, calls)
+		s.Store.PutInstructions(resp.ResponseID, resp.Instructions)
+	}
+	s.Store.PutConversationLatest(doc.ConversationID, doc.LatestResponseID)
+
+	codec.WriteJSON(w, http.StatusOK, adminConversationResponse{
+		ConversationID:   doc.ConversationID,
+		LatestResponseID: doc.LatestResponseID,
+		LastAccess:       time.Now().UTC().Format(time.RFC3339),
+	})
+}
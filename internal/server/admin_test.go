@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/normalize"
+	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func newAdminTestHandler(t *testing.T, accessToken string) (http.Handler, *state.Store) {
+	t.Helper()
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	cfg := &config.ServerConfig{AccessToken: accessToken}
+	s := &Server{Config: cfg, Store: store}
+	mux := http.NewServeMux()
+	s.registerAdminRoutes(mux)
+	return authMiddleware(cfg, mux), store
+}
+
+func adminGet(h http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminStateReflectsStoredSnapshot(t *testing.T) {
+	h, store := newAdminTestHandler(t, "secret")
+	store.PutSnapshot("resp_1", []types.ResponsesInputItem{
+		{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "hi"}}},
+		{Type: "function_call", CallID: "call_1", Name: "lookup", Arguments: `{"q":"x"}`},
+	}, []state.FunctionCall{{CallID: "call_1", Name: "lookup", Arguments: `{"q":"x"}`}})
+	store.PutInstructions("resp_1", "be brief")
+	store.PutConversationLatest("conv_1", "resp_1")
+
+	rec := adminGet(h, "/admin/state/resp_1", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	var got adminStateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.ResponseID != "resp_1" || got.Instructions != "be brief" {
+		t.Errorf("unexpected header fields: %+v", got)
+	}
+	if len(got.Context) != 2 || got.Context[1].CallID != "call_1" {
+		t.Errorf("context: got %+v", got.Context)
+	}
+	if len(got.FunctionCalls) != 1 || got.FunctionCalls[0].Name != "lookup" {
+		t.Errorf("function_calls: got %+v", got.FunctionCalls)
+	}
+
+	rec = adminGet(h, "/admin/state/conversations/conv_1", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("conversation status: got %d, want 200", rec.Code)
+	}
+	var conv adminConversationResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &conv); err != nil {
+		t.Fatalf("decode conversation: %v", err)
+	}
+	if conv.LatestResponseID != "resp_1" {
+		t.Errorf("latest_response_id: got %q, want resp_1", conv.LatestResponseID)
+	}
+}
+
+func TestAdminStateUnknownIDsReturn404(t *testing.T) {
+	h, _ := newAdminTestHandler(t, "secret")
+	for _, path := range []string{"/admin/state/missing", "/admin/state/conversations/missing"} {
+		if rec := adminGet(h, path, "secret"); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminStateRequiresToken(t *testing.T) {
+	h, _ := newAdminTestHandler(t, "secret")
+	if rec := adminGet(h, "/admin/state/resp_1", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("missing token: got %d, want 401", rec.Code)
+	}
+
+	h, store := newAdminTestHandler(t, "")
+	store.PutInstructions("resp_1", "x")
+	if rec := adminGet(h, "/admin/state/resp_1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("routes without configured token: got %d, want 404", rec.Code)
+	}
+}
+
+func TestConversationExportImportRoundTrip(t *testing.T) {
+	src, srcStore := newAdminTestHandler(t, "secret")
+	srcStore.PutSnapshot("resp_2", []types.ResponsesInputItem{
+		{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "weather?"}}},
+		{Type: "function_call", CallID: "call_1", Name: "lookup", Arguments: `{"q":"x"}`},
+	}, []state.FunctionCall{{CallID: "call_1", Name: "lookup", Arguments: `{"q":"x"}`}})
+	srcStore.PutInstructions("resp_2", "be brief")
+	srcStore.PutConversationLatest("conv_1", "resp_2")
+
+	rec := adminGet(src, "/admin/conversations/conv_1/export", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status: got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	exported := rec.Body.String()
+
+	dst, dstStore := newAdminTestHandler(t, "secret")
+	req := httptest.NewRequest(http.MethodPost, "/admin/conversations/import", strings.NewReader(exported))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	dst.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import status: got %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+
+	// The next request in the conversation must auto-link to the imported
+	// response and replay its tool call.
+	body := `{"model":"gpt-5","conversation_id":"conv_1","input":[{"type":"function_call_output","call_id":"call_1","output":"sunny"}]}`
+	canon, nerr := normalize.Enrich([]byte(body), "responses", &config.ServerConfig{}, dstStore, nil, false)
+	if nerr != nil {
+		t.Fatalf("enrich after import: %+v", nerr)
+	}
+	if canon.PreviousResponseID != "resp_2" || !canon.AutoPreviousResponseID {
+		t.Errorf("auto-link: got previous_response_id %q (auto %v), want resp_2", canon.PreviousResponseID, canon.AutoPreviousResponseID)
+	}
+	if len(canon.InputItems) != 3 || canon.InputItems[1].CallID != "call_1" {
+		t.Errorf("restored input: got %+v", canon.InputItems)
+	}
+	if got, _ := dstStore.GetInstructions("resp_2"); got != "be brief" {
+		t.Errorf("instructions: got %q, want be brief", got)
+	}
+
+	if rec := adminGet(dst, "/admin/conversations/conv_1/export", "secret"); rec.Body.String() != exported {
+		t.Errorf("re-export differs:\n got %s\nwant %s", rec.Body.String(), exported)
+	}
+}
+
+func TestConversationImportRejectsInvalidDocuments(t *testing.T) {
+	h, _ := newAdminTestHandler(t, "secret")
+	for _, body := range []string{
+		`not json`,
+		`{"version":2,"conversation_id":"c","latest_response_id":"r","responses":[{"response_id":"r"}]}`,
+		`{"version":1,"latest_response_id":"r","responses":[{"response_id":"r"}]}`,
+		`{"version":1,"conversation_id":"c","latest_response_id":"missing","responses":[{"response_id":"r"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/conversations/import", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// embeddingsUnsupported is the 501 message for POST /v1/embeddings when no
+// --embeddings-passthrough-url is configured.
+const embeddingsUnsupported = "Embeddings are not supported: the ChatGPT backend has no embeddings models. Set --embeddings-passthrough-url to forward this endpoint to an embeddings provider."
+
+// embeddingsHTTPClient has no overall timeout so large responses can stream;
+// the client's request context bounds the call.
+var embeddingsHTTPClient = &http.Client{}
+
+// handleEmbeddings handles POST /v1/embeddings. Without
+// --embeddings-passthrough-url it answers 501 in the OpenAI error shape, so
+// clients that probe the endpoint get a clear reason instead of a 404.
+// Otherwise the request body is forwarded to that URL with the client's
+// Authorization header, and the provider's status, content type and body are
+// copied back unchanged.
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimSpace(s.Config.EmbeddingsPassthroughURL)
+	if target == "" {
+		s.chatEnc.WriteError(w, http.StatusNotImplemented, embeddingsUnsupported)
+		return
+	}
+
+	body, ok := readBody(w, r, s.chatEnc)
+	if !ok {
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		s.chatEnc.WriteError(w, http.StatusInternalServerError, "Invalid --embeddings-passthrough-url: "+err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	// The server access token is never sent to the provider, even when the
+	// client puts it in Authorization.
+	if authz := r.Header.Get("Authorization"); authz != "" && !isServerAccessToken(s.Config.AccessToken, authz) {
+		req.Header.Set("Authorization", authz)
+	}
+
+	resp, err := embeddingsHTTPClient.Do(req)
+	if err != nil {
+		s.chatEnc.WriteError(w, http.StatusBadGateway, "Embeddings provider request failed: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		slog.Warn("embeddings.copy_failed", "error", err)
+	}
+}
+
+// isServerAccessToken reports whether an Authorization header carries the
+// configured --access-token.
+func isServerAccessToken(accessToken, authz string) bool {
+	token := strings.TrimSpace(accessToken)
+	if token == "" {
+		return false
+	}
+	value := strings.TrimSpace(authz)
+	if scheme, rest, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		value = strings.TrimSpace(rest)
+	}
+	return value == token
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/codec"
+	"github.com/n0madic/go-chatmock/internal/metrics"
+	"github.com/n0madic/go-chatmock/internal/models"
+	"github.com/n0madic/go-chatmock/internal/normalize"
+	"github.com/n0madic/go-chatmock/internal/reasoning"
+	"github.com/n0madic/go-chatmock/internal/stream"
+	"github.com/n0madic/go-chatmock/internal/transform"
+	"github.com/n0madic/go-chatmock/internal/types"
+	"github.com/n0madic/go-chatmock/internal/upstream"
+)
+
+// handleGeminiGenerateContent handles POST
+// /v1beta/models/{model}:generateContent and :streamGenerateContent. The
+// wildcard holds the whole "{model}:{method}" segment, since ServeMux
+// wildcards cannot share a segment with literal text.
+func (s *Server) handleGeminiGenerateContent(w http.ResponseWriter, r *http.Request) {
+	modelName, method, _ := cutLast(r.PathValue("action"), ":")
+	var streamReq bool
+	switch method {
+	case "generateContent":
+	case "streamGenerateContent":
+		streamReq = true
+	default:
+		s.geminiEnc.WriteError(w, http.StatusNotFound, fmt.Sprintf("method %q is not supported; use generateContent or streamGenerateContent", method))
+		return
+	}
+
+	body, ok := readBody(w, r, s.geminiEnc)
+	if !ok {
+		return
+	}
+	var req types.GeminiGenerateContentRequest
+	if err := decodeJSON(body, &req); err != nil {
+		s.geminiEnc.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+	var payload map[string]any
+	decodeJSON(body, &payload) //nolint:errcheck // already validated above
+
+	modelName, deprecation := s.Config.RemapLegacyModel(s.Config.ModelOrDefault(strings.TrimSpace(modelName)))
+	codec.SetDeprecationHeader(w, deprecation)
+	model := models.NormalizeModelName(modelName, s.Config.DebugModel, s.Registry.Cached())
+	ok, hint := s.Registry.IsKnownModel(model)
+	metrics.SetModels(r.Context(), modelName, model, ok || s.Config.DebugModel != "")
+	if !ok && s.Config.DebugModel == "" {
+		msg := fmt.Sprintf("model %q is not available via this endpoint", model)
+		if hint != "" {
+			msg += "; available models: " + hint
+		}
+		s.geminiEnc.WriteError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	inputItems, err := transform.GeminiMessagesToResponsesInput(req.Contents)
+	if err != nil {
+		s.geminiEnc.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(inputItems) == 0 {
+		s.geminiEnc.WriteError(w, http.StatusBadRequest, "contents must include at least one part")
+		return
+	}
+	if s.Config.StripEmptyToolResults {
+		normalize.FillEmptyToolOutputs(inputItems)
+	}
+
+	if s.Config.StrictTools {
+		if nerr := normalize.ValidateGeminiToolNames(req.Tools); nerr != nil {
+			s.geminiEnc.WriteError(w, nerr.StatusCode, nerr.Message)
+			return
+		}
+	}
+	tools := transform.GeminiToolsToResponses(req.Tools)
+	if nerr := normalize.ValidateToolSchemas(tools); nerr != nil {
+		s.geminiEnc.WriteError(w, nerr.StatusCode, nerr.Message)
+		return
+	}
+
+	instructions := strings.TrimSpace(transform.GeminiSystemText(req.SystemInstruction))
+	if instructions == "" {
+		instructions = s.embeddedInstructions(r, model, len(tools) > 0)
+	}
+
+	textFormat, err := transform.ResponseFormatToTextFormat(transform.GeminiResponseFormat(req.GenerationConfig))
+	if err != nil {
+		s.geminiEnc.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reasoningParam := reasoning.BuildReasoningParam(
+		s.Config.ReasoningEffort,
+		s.Config.ReasoningSummary,
+		s.Config.ReasoningEffortByModel,
+		s.Config.Capabilities,
+		reasoning.ExtractFromModelName(modelName, s.Registry.Cached()),
+		model,
+	)
+	maxOutputTokens := 0
+	includeThoughts := false
+	if gc := req.GenerationConfig; gc != nil {
+		maxOutputTokens = gc.MaxOutputTokens
+		includeThoughts = gc.ThinkingConfig != nil && gc.ThinkingConfig.IncludeThoughts
+	}
+	toolChoice := transform.GeminiToolChoiceToResponses(req.ToolConfig)
+
+	if s.Config.Verbose {
+		reasoningEffort := ""
+		reasoningSummary := ""
+		if reasoningParam != nil {
+			reasoningEffort = reasoningParam.Effort
+			reasoningSummary = reasoningParam.Summary
+		}
+		slog.Info("gemini.generate_content.request",
+			"requested_model", modelName,
+			"upstream_model", model,
+			"stream", streamReq,
+			"contents", len(req.Contents),
+			"input_items", len(inputItems),
+			"tools", len(tools),
+			"tool_choice", types.SummarizeToolChoice(toolChoice),
+			"instructions_chars", len(instructions),
+			"include_thoughts", includeThoughts,
+			"reasoning_effort", reasoningEffort,
+			"reasoning_summary", reasoningSummary,
+			"session_override", strings.TrimSpace(r.Header.Get("X-Session-Id")) != "",
+		)
+	}
+
+	upReq := &upstream.Request{
+		Model:             model,
+		Instructions:      instructions,
+		InputItems:        inputItems,
+		Tools:             tools,
+		ToolChoice:        toolChoice,
+		ParallelToolCalls: true,
+		Store:             types.BoolPtr(false),
+		ReasoningParam:    reasoningParam,
+		SessionID:         r.Header.Get("X-Session-Id"),
+		TextFormat:        textFormat,
+	}
+
+	resp, upErr := s.Pipeline.Upstream.DoWithRetry(r.Context(), upReq, false, tools)
+	if upErr != nil {
+		s.geminiEnc.WriteError(w, upErr.StatusCode, upErr.Error())
+		return
+	}
+
+	outputModel := s.Config.ResponseModel(modelName, model)
+	var storeState func()
+	resp.Body.Body, storeState = s.Pipeline.CaptureState(resp.Body.Body, inputItems, instructions, normalize.ExtractConversationID(payload), "")
+
+	if streamReq {
+		defer storeState()
+		var watchToolChoice func()
+		resp.Body.Body, watchToolChoice = s.Pipeline.WatchToolChoice(resp.Body.Body, model, toolChoice)
+		defer watchToolChoice()
+		s.geminiEnc.WriteStreamHeaders(w, resp.StatusCode)
+		reader := stream.NewReaderSize(resp.Body.Body, s.Config.MaxSSEEventSize)
+		reader.LimitToolCalls(s.Config.MaxParallelToolCalls)
+		reader.LimitOutputTokens(s.Config.OutputTokenLimit(model, maxOutputTokens))
+		out, stopBatch := codec.BatchFlushes(w, reader, s.Config.SSEFlushInterval)
+		translator := s.geminiEnc.StreamTranslator(out, outputModel, codec.StreamOpts{
+			RepairToolArgs:  s.Config.RepairToolArgs,
+			IncludeThoughts: includeThoughts,
+		})
+		translator.Translate(reader)
+		stopBatch()
+		resp.Body.Body.Close()
+		return
+	}
+
+	collect := func(body io.ReadCloser) *codec.CollectedResponse {
+		collected := stream.CollectTextFromSSE(body, stream.CollectOptions{
+			CollectUsage:     true,
+			CollectReasoning: includeThoughts,
+			CollectToolCalls: true,
+			StopOnFailed:     true,
+			MaxToolCalls:     s.Config.MaxParallelToolCalls,
+			MaxOutputTokens:  s.Config.OutputTokenLimit(model, maxOutputTokens),
+			MaxEventSize:     s.Config.MaxSSEEventSize,
+		})
+		return &codec.CollectedResponse{
+			ResponseID:       collected.ResponseID,
+			FullText:         collected.FullText,
+			ReasoningSummary: collected.ReasoningSummary,
+			ReasoningFull:    collected.ReasoningFull,
+			ToolCalls:        collected.ToolCalls,
+			Usage:            collected.Usage,
+			ErrorMessage:     collected.ErrorMessage,
+			IncompleteReason: collected.IncompleteReason,
+		}
+	}
+	collected := collect(resp.Body.Body)
+	collected, msg := s.Pipeline.EnforceToolChoice(r.Context(), upReq, tools, collected, func(body io.ReadCloser) *codec.CollectedResponse {
+		body, storeState = s.Pipeline.CaptureState(body, inputItems, instructions, normalize.ExtractConversationID(payload), "")
+		return collect(body)
+	})
+	if msg != "" {
+		s.geminiEnc.WriteError(w, http.StatusBadGateway, msg)
+		return
+	}
+	storeState()
+	s.Config.CostPrices.SetHeader(w, model, collected.Usage)
+	if s.Config.TruncationNotice {
+		codec.SetTruncatedHeader(w, collected.IncompleteReason)
+	}
+	s.geminiEnc.WriteCollected(w, resp.StatusCode, collected, outputModel)
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
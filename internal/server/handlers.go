@@ -13,7 +13,9 @@ import (
 	"github.com/n0madic/go-chatmock/internal/auth"
 	"github.com/n0madic/go-chatmock/internal/codec"
 	"github.com/n0madic/go-chatmock/internal/limits"
+	"github.com/n0madic/go-chatmock/internal/metrics"
 	"github.com/n0madic/go-chatmock/internal/models"
+	"github.com/n0madic/go-chatmock/internal/normalize"
 	"github.com/n0madic/go-chatmock/internal/reasoning"
 	"github.com/n0madic/go-chatmock/internal/stream"
 	"github.com/n0madic/go-chatmock/internal/transform"
@@ -34,9 +36,13 @@ func (s *Server) handleTextCompletions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	requestedModel, _ := payload["model"].(string)
-	model := models.NormalizeModelName(requestedModel, s.Config.DebugModel)
+	requestedModel, deprecation := s.Config.RemapLegacyModel(s.Config.ModelOrDefault(requestedModel))
+	codec.SetDeprecationHeader(w, deprecation)
+	model := models.NormalizeModelName(requestedModel, s.Config.DebugModel, s.Registry.Cached())
 
-	if ok, hint := s.Registry.IsKnownModel(model); !ok && s.Config.DebugModel == "" {
+	ok, hint := s.Registry.IsKnownModel(model)
+	metrics.SetModels(r.Context(), requestedModel, model, ok || s.Config.DebugModel != "")
+	if !ok && s.Config.DebugModel == "" {
 		msg := fmt.Sprintf("model %q is not available via this endpoint", model)
 		if hint != "" {
 			msg += "; available models: " + hint
@@ -70,11 +76,13 @@ func (s *Server) handleTextCompletions(w http.ResponseWriter, r *http.Request) {
 
 	reasoningOverrides := reasoning.ParseFromRaw(payload)
 	if reasoningOverrides == nil {
-		reasoningOverrides = reasoning.ExtractFromModelName(requestedModel)
+		reasoningOverrides = reasoning.ExtractFromModelName(requestedModel, s.Registry.Cached())
 	}
 	reasoningParam := reasoning.BuildReasoningParam(
 		s.Config.ReasoningEffort,
 		s.Config.ReasoningSummary,
+		s.Config.ReasoningEffortByModel,
+		s.Config.Capabilities,
 		reasoningOverrides,
 		model,
 	)
@@ -96,21 +104,41 @@ func (s *Server) handleTextCompletions(w http.ResponseWriter, r *http.Request) {
 			"reasoning_effort", reasoningEffort,
 			"reasoning_summary", reasoningSummary,
 		)
+		if streamOpts != nil && !isStream {
+			slog.Warn("request.stream_options_without_stream", "route", "completions", "usage", "always included")
+		}
 	}
 
 	upReq := &upstream.Request{
 		Model:          model,
-		Instructions:   s.Config.InstructionsForModel(model),
+		Instructions:   s.embeddedInstructions(r, model, false),
 		InputItems:     inputItems,
 		Store:          types.BoolPtr(false),
 		ReasoningParam: reasoningParam,
 	}
+	// Logprobs are only mapped onto non-streaming responses, so only those
+	// ask upstream for them.
+	topLogprobs, wantLogprobs := requestedLogprobs(payload)
+	if wantLogprobs && !isStream {
+		if !s.Config.IncludeAllowed(upstream.IncludeOutputTextLogprobs) {
+			s.textEnc.WriteError(w, http.StatusBadRequest, "logprobs requires "+upstream.IncludeOutputTextLogprobs+" in --allowed-includes")
+			return
+		}
+		upReq.Include = []string{upstream.IncludeOutputTextLogprobs}
+		upReq.TopLogprobs = min(topLogprobs, upstream.MaxTopLogprobs)
+	}
 
 	resp, err := s.Pipeline.Upstream.Do(r.Context(), upReq)
 	if err != nil {
 		status := http.StatusBadGateway
-		if errors.Is(err, auth.ErrNoCredentials) {
+		var upErr *upstream.UpstreamError
+		switch {
+		case errors.Is(err, auth.ErrNoCredentials):
 			status = http.StatusUnauthorized
+		case errors.Is(err, upstream.ErrConcurrencyLimited):
+			status = http.StatusTooManyRequests
+		case errors.As(err, &upErr):
+			status = upErr.StatusCode
 		}
 		s.textEnc.WriteError(w, status, err.Error())
 		return
@@ -124,18 +152,19 @@ func (s *Server) handleTextCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	outputModel := requestedModel
-	if outputModel == "" {
-		outputModel = model
-	}
+	outputModel := s.Config.ResponseModel(requestedModel, model)
+	outputLimit := s.Config.OutputTokenLimit(model, normalize.RequestedMaxOutputTokens(payload))
 
 	if isStream {
 		s.textEnc.WriteStreamHeaders(w, resp.StatusCode)
-		translator := s.textEnc.StreamTranslator(w, outputModel, codec.StreamOpts{
+		reader := stream.NewReaderSize(resp.Body.Body, s.Config.MaxSSEEventSize)
+		reader.LimitOutputTokens(outputLimit)
+		out, stopBatch := codec.BatchFlushes(w, reader, s.Config.SSEFlushInterval)
+		translator := s.textEnc.StreamTranslator(out, outputModel, codec.StreamOpts{
 			IncludeUsage: includeUsage,
 		})
-		reader := stream.NewReader(resp.Body.Body)
 		translator.Translate(reader)
+		stopBatch()
 		resp.Body.Body.Close()
 		return
 	}
@@ -144,14 +173,38 @@ func (s *Server) handleTextCompletions(w http.ResponseWriter, r *http.Request) {
 	collected := stream.CollectTextFromSSE(resp.Body.Body, stream.CollectOptions{
 		InitialResponseID: "cmpl",
 		CollectUsage:      true,
+		CollectLogprobs:   wantLogprobs,
+		MaxOutputTokens:   outputLimit,
+		MaxEventSize:      s.Config.MaxSSEEventSize,
 	})
+	var textLogprobs *types.TextLogprobs
+	if wantLogprobs {
+		textLogprobs = codec.BuildTextLogprobs(collected.Logprobs, topLogprobs)
+	}
+	s.Config.CostPrices.SetHeader(w, model, collected.Usage)
+	if s.Config.TruncationNotice {
+		codec.SetTruncatedHeader(w, collected.IncompleteReason)
+	}
 	s.textEnc.WriteCollected(w, resp.StatusCode, &codec.CollectedResponse{
-		ResponseID: collected.ResponseID,
-		FullText:   collected.FullText,
-		Usage:      collected.Usage,
+		ResponseID:       collected.ResponseID,
+		FullText:         collected.FullText,
+		Usage:            collected.Usage,
+		IncompleteReason: collected.IncompleteReason,
+		TextLogprobs:     textLogprobs,
 	}, outputModel)
 }
 
+// requestedLogprobs reads the legacy completions "logprobs" field: a number of
+// alternatives per token (0 means only the sampled token). Null or absent means
+// logprobs were not requested.
+func requestedLogprobs(payload map[string]any) (int, bool) {
+	n, ok := payload["logprobs"].(float64)
+	if !ok || n < 0 {
+		return 0, false
+	}
+	return int(n), true
+}
+
 // handleAnthropicMessages handles POST /v1/messages.
 func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request) {
 	if !validateAnthropicHeaders(w, r) {
@@ -167,18 +220,24 @@ func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request)
 		codec.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body")
 		return
 	}
+	var rawReq map[string]any
+	decodeJSON(body, &rawReq) //nolint:errcheck // already validated above
+	conversationID := normalize.ExtractConversationID(rawReq)
 
 	resolvedModel, matchedModel := models.ResolveAnthropicModel(req.Model, models.DefaultAnthropicFallbackModel)
-	model := models.NormalizeModelName(resolvedModel, s.Config.DebugModel)
-	if s.Config.DebugModel == "" {
-		if ok, hint := s.Registry.IsKnownModel(model); !ok {
-			msg := fmt.Sprintf("model %q is not available via this endpoint", model)
-			if hint != "" {
-				msg += "; available models: " + hint
-			}
-			codec.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", msg)
-			return
+	if strings.TrimSpace(req.Model) == "" && s.Config.DefaultModel != "" {
+		resolvedModel = s.Config.DefaultModel
+	}
+	model := models.NormalizeModelName(resolvedModel, s.Config.DebugModel, s.Registry.Cached())
+	ok, hint := s.Registry.IsKnownModel(model)
+	metrics.SetModels(r.Context(), req.Model, model, ok || s.Config.DebugModel != "")
+	if !ok && s.Config.DebugModel == "" {
+		msg := fmt.Sprintf("model %q is not available via this endpoint", model)
+		if hint != "" {
+			msg += "; available models: " + hint
 		}
+		codec.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", msg)
+		return
 	}
 
 	systemText, err := types.ParseSystemText(req.System)
@@ -192,19 +251,42 @@ func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request)
 		codec.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
 		return
 	}
+	if s.Config.StripEmptyToolResults {
+		normalize.FillEmptyToolOutputs(inputItems)
+	}
 
 	instructions := strings.TrimSpace(systemText)
 	if instructions == "" {
-		instructions = strings.TrimSpace(s.Config.InstructionsForModel(model))
+		instructions = strings.TrimSpace(s.embeddedInstructions(r, model, len(req.Tools) > 0))
 	}
 
+	if s.Config.StrictTools {
+		if nerr := normalize.ValidateAnthropicToolNames(req.Tools); nerr != nil {
+			codec.WriteAnthropicError(w, nerr.StatusCode, "invalid_request_error", nerr.Message)
+			return
+		}
+	}
 	tools := transform.AnthropicToolsToResponses(req.Tools)
+	if nerr := normalize.ValidateToolSchemas(tools); nerr != nil {
+		codec.WriteAnthropicError(w, nerr.StatusCode, "invalid_request_error", nerr.Message)
+		return
+	}
 	defaultWebSearchApplied := false
-	if len(tools) == 0 && s.Config.DefaultWebSearch {
+	if len(tools) == 0 && s.Config.DefaultWebSearch && s.Config.Capabilities.For(model).SupportsWebSearch() {
 		tools = []types.ResponsesTool{{Type: "web_search"}}
 		defaultWebSearchApplied = true
 	}
 
+	formatHint := req.OutputFormat
+	if formatHint == nil {
+		formatHint = req.ResponseFormat
+	}
+	textFormat, err := transform.ResponseFormatToTextFormat(formatHint)
+	if err != nil {
+		codec.WriteAnthropicError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
 	var reasoningOverrides *types.ReasoningParam
 	if effort, ok := models.ResolveAnthropicReasoningEffort(req.Model); ok {
 		reasoningOverrides = &types.ReasoningParam{Effort: effort}
@@ -212,6 +294,8 @@ func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request)
 	reasoningParam := reasoning.BuildReasoningParam(
 		s.Config.ReasoningEffort,
 		s.Config.ReasoningSummary,
+		s.Config.ReasoningEffortByModel,
+		s.Config.Capabilities,
 		reasoningOverrides,
 		model,
 	)
@@ -240,6 +324,7 @@ func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request)
 			"reasoning_effort", reasoningEffort,
 			"reasoning_summary", reasoningSummary,
 			"session_override", strings.TrimSpace(r.Header.Get("X-Session-Id")) != "",
+			"user_id", req.MetadataUserID(),
 		)
 	}
 
@@ -253,12 +338,16 @@ func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request)
 		Store:             types.BoolPtr(false),
 		ReasoningParam:    reasoningParam,
 		SessionID:         r.Header.Get("X-Session-Id"),
+		SessionSalt:       req.MetadataUserID(),
+		TextFormat:        textFormat,
 	}
 
 	resp, err := s.Pipeline.Upstream.Do(r.Context(), upReq)
 	if err != nil {
 		if errors.Is(err, auth.ErrNoCredentials) {
-			codec.WriteAnthropicError(w, http.StatusUnauthorized, "authentication_error", err.Error())
+			s.writeAnthropicUpstreamError(w, http.StatusUnauthorized, err.Error(), req.Stream)
+		} else if errors.Is(err, upstream.ErrConcurrencyLimited) {
+			codec.WriteAnthropicError(w, http.StatusTooManyRequests, "rate_limit_error", err.Error())
 		} else {
 			codec.WriteAnthropicError(w, http.StatusBadGateway, "api_error", err.Error())
 		}
@@ -289,36 +378,79 @@ func (s *Server) handleAnthropicMessages(w http.ResponseWriter, r *http.Request)
 			if msg == "" {
 				msg = codec.FormatUpstreamErrorWithHeaders(resp.StatusCode, errBody, resp.Headers)
 			}
-			codec.WriteAnthropicError(w, resp.StatusCode, "api_error", msg)
+			s.writeAnthropicUpstreamError(w, resp.StatusCode, msg, req.Stream)
 			return
 		}
 	}
 
-	outputModel := strings.TrimSpace(req.Model)
-	if outputModel == "" {
-		outputModel = model
-	}
+	outputModel := s.Config.ResponseModel(strings.TrimSpace(req.Model), model)
+	var storeState func()
+	resp.Body.Body, storeState = s.Pipeline.CaptureState(resp.Body.Body, inputItems, instructions, conversationID, "")
 
 	if req.Stream {
+		defer storeState()
+		var watchToolChoice func()
+		resp.Body.Body, watchToolChoice = s.Pipeline.WatchToolChoice(resp.Body.Body, model, upReq.ToolChoice)
+		defer watchToolChoice()
 		s.anthropicEnc.WriteStreamHeaders(w, resp.StatusCode)
-		translator := s.anthropicEnc.StreamTranslator(w, outputModel, codec.StreamOpts{})
-		reader := stream.NewReader(resp.Body.Body)
+		reader := stream.NewReaderSize(resp.Body.Body, s.Config.MaxSSEEventSize)
+		reader.LimitToolCalls(s.Config.MaxParallelToolCalls)
+		reader.LimitOutputTokens(s.Config.OutputTokenLimit(model, req.MaxTokens))
+		out, stopBatch := codec.BatchFlushes(w, reader, s.Config.SSEFlushInterval)
+		translator := s.anthropicEnc.StreamTranslator(out, outputModel, codec.StreamOpts{
+			InputTokensEstimate: int64(transform.EstimateResponsesInputTokens(instructions, inputItems, tools)),
+		})
 		translator.Translate(reader)
+		stopBatch()
 		resp.Body.Body.Close()
 		return
 	}
 
 	// Non-streaming anthropic - collect through SSE
-	collected := collectAnthropicResponse(resp.Body.Body)
+	collected := s.collectAnthropicResponse(resp.Body.Body, s.Config.OutputTokenLimit(model, req.MaxTokens))
+	collected, msg := s.Pipeline.EnforceToolChoice(r.Context(), upReq, tools, collected, func(body io.ReadCloser) *codec.CollectedResponse {
+		body, storeState = s.Pipeline.CaptureState(body, inputItems, instructions, conversationID, "")
+		return s.collectAnthropicResponse(body, s.Config.OutputTokenLimit(model, req.MaxTokens))
+	})
+	if msg != "" {
+		codec.WriteAnthropicError(w, http.StatusBadGateway, "api_error", msg)
+		return
+	}
+	storeState()
+	s.Config.CostPrices.SetHeader(w, model, collected.Usage)
+	if s.Config.TruncationNotice {
+		codec.SetTruncatedHeader(w, collected.IncompleteReason)
+	}
 	s.anthropicEnc.WriteCollected(w, resp.StatusCode, collected, outputModel)
 }
 
+// writeAnthropicUpstreamError reports a failed upstream request in Anthropic
+// format. Auth failures carry the login hint and, for streaming requests, are
+// sent as a stream error event.
+func (s *Server) writeAnthropicUpstreamError(w http.ResponseWriter, status int, msg string, streaming bool) {
+	if status != http.StatusUnauthorized {
+		codec.WriteAnthropicError(w, status, "api_error", msg)
+		return
+	}
+	msg = codec.WithLoginHint(msg)
+	if streaming {
+		codec.WriteStreamError(w, s.anthropicEnc, status, msg)
+		return
+	}
+	codec.WriteAnthropicError(w, status, "authentication_error", msg)
+}
+
 // handleOllamaChat handles POST /api/chat.
 func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 	body, ok := readBody(w, r, s.ollamaEnc)
 	if !ok {
 		return
 	}
+	compat, ok := reasoningCompatOverride(w, r, s.ollamaEnc)
+	if !ok {
+		return
+	}
+	compat = types.FirstNonEmpty(compat, s.Config.ReasoningCompat)
 	var payload map[string]any
 	if err := decodeJSON(body, &payload); err != nil {
 		s.ollamaEnc.WriteError(w, http.StatusBadRequest, "Invalid JSON body")
@@ -326,6 +458,8 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	modelName, _ := payload["model"].(string)
+	modelName, deprecation := s.Config.RemapLegacyModel(s.Config.ModelOrDefault(modelName))
+	codec.SetDeprecationHeader(w, deprecation)
 	rawMsgs, _ := payload["messages"].([]any)
 	var topImages []string
 	if imgs, ok := payload["images"].([]any); ok {
@@ -336,7 +470,7 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	messages := transform.ConvertOllamaMessages(rawMsgs, topImages)
-	convertSystemToUser(messages)
+	messages = normalize.ConvertSystemToUser(messages)
 
 	streamReq := true
 	if v, ok := payload["stream"].(bool); ok {
@@ -344,8 +478,18 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	toolsRaw, _ := payload["tools"].([]any)
+	if s.Config.StrictTools {
+		if nerr := normalize.ValidateRawToolNames(toolsRaw); nerr != nil {
+			s.ollamaEnc.WriteError(w, nerr.StatusCode, nerr.Message)
+			return
+		}
+	}
 	normalizedTools := transform.NormalizeOllamaTools(toolsRaw)
 	toolsResponses := transform.ToolsChatToResponses(normalizedTools)
+	if nerr := normalize.ValidateToolSchemas(toolsResponses); nerr != nil {
+		s.ollamaEnc.WriteError(w, nerr.StatusCode, nerr.Message)
+		return
+	}
 	toolChoice := "auto"
 	if tc, ok := payload["tool_choice"].(string); ok {
 		toolChoice = tc
@@ -358,9 +502,14 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	inputItems := transform.ChatMessagesToResponsesInput(messages)
-	normalizedModel := models.NormalizeModelName(modelName, s.Config.DebugModel)
+	if s.Config.StripEmptyToolResults {
+		normalize.FillEmptyToolOutputs(inputItems)
+	}
+	normalizedModel := models.NormalizeModelName(modelName, s.Config.DebugModel, s.Registry.Cached())
 
-	if ok, hint := s.Registry.IsKnownModel(normalizedModel); !ok && s.Config.DebugModel == "" {
+	ok, hint := s.Registry.IsKnownModel(normalizedModel)
+	metrics.SetModels(r.Context(), modelName, normalizedModel, ok || s.Config.DebugModel != "")
+	if !ok && s.Config.DebugModel == "" {
 		msg := fmt.Sprintf("model %q is not available via this endpoint", normalizedModel)
 		if hint != "" {
 			msg += "; available models: " + hint
@@ -372,7 +521,9 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 	reasoningParam := reasoning.BuildReasoningParam(
 		s.Config.ReasoningEffort,
 		s.Config.ReasoningSummary,
-		reasoning.ExtractFromModelName(modelName),
+		s.Config.ReasoningEffortByModel,
+		s.Config.Capabilities,
+		reasoning.ExtractFromModelName(modelName, s.Registry.Cached()),
 		normalizedModel,
 	)
 
@@ -401,11 +552,12 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 
 	upReq := &upstream.Request{
 		Model:             normalizedModel,
-		Instructions:      s.Config.InstructionsForModel(normalizedModel),
+		Instructions:      s.embeddedInstructions(r, normalizedModel, len(toolsResponses) > 0),
 		InputItems:        inputItems,
 		Tools:             toolsResponses,
 		ToolChoice:        toolChoice,
 		ParallelToolCalls: parallelToolCalls,
+		Store:             types.BoolPtr(false),
 		ReasoningParam:    reasoningParam,
 		SessionID:         r.Header.Get("X-Session-Id"),
 	}
@@ -418,35 +570,67 @@ func (s *Server) handleOllamaChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	createdAt := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	outputModel := s.Config.ResponseModel(modelName, normalizedModel)
+	var storeState func()
+	resp.Body.Body, storeState = s.Pipeline.CaptureState(resp.Body.Body, inputItems, upReq.Instructions, normalize.ExtractConversationID(payload), compat)
+
+	outputLimit := s.Config.OutputTokenLimit(normalizedModel, ollamaNumPredict(payload))
 
 	if streamReq {
+		defer storeState()
+		var watchToolChoice func()
+		resp.Body.Body, watchToolChoice = s.Pipeline.WatchToolChoice(resp.Body.Body, normalizedModel, toolChoice)
+		defer watchToolChoice()
 		s.ollamaEnc.WriteStreamHeaders(w, resp.StatusCode)
-		translator := s.ollamaEnc.StreamTranslator(w, modelName, codec.StreamOpts{
-			ReasoningCompat: s.Config.ReasoningCompat,
+		reader := stream.NewReaderSize(resp.Body.Body, s.Config.MaxSSEEventSize)
+		reader.LimitToolCalls(s.Config.MaxParallelToolCalls)
+		reader.LimitOutputTokens(outputLimit)
+		out, stopBatch := codec.BatchFlushes(w, reader, s.Config.SSEFlushInterval)
+		translator := s.ollamaEnc.StreamTranslator(out, outputModel, codec.StreamOpts{
+			ReasoningCompat: compat,
 			CreatedAt:       createdAt,
 		})
-		reader := stream.NewReader(resp.Body.Body)
 		translator.Translate(reader)
+		stopBatch()
 		resp.Body.Body.Close()
 		return
 	}
 
 	// Non-streaming ollama
-	collected := stream.CollectTextFromSSE(resp.Body.Body, stream.CollectOptions{
+	collected := s.collectOllamaResponse(resp.Body.Body, outputLimit)
+	collected, msg := s.Pipeline.EnforceToolChoice(r.Context(), upReq, baseTools, collected, func(body io.ReadCloser) *codec.CollectedResponse {
+		body, storeState = s.Pipeline.CaptureState(body, inputItems, upReq.Instructions, normalize.ExtractConversationID(payload), compat)
+		return s.collectOllamaResponse(body, outputLimit)
+	})
+	if msg != "" {
+		s.ollamaEnc.WriteError(w, http.StatusBadGateway, msg)
+		return
+	}
+	storeState()
+	collected.RawResponse = map[string]any{
+		"_reasoning_compat": compat,
+		"_created_at":       createdAt,
+	}
+	s.ollamaEnc.WriteCollected(w, http.StatusOK, collected, outputModel)
+}
+
+// collectOllamaResponse collects a non-streaming Ollama chat response from SSE.
+func (s *Server) collectOllamaResponse(body io.ReadCloser, maxOutputTokens int) *codec.CollectedResponse {
+	collected := stream.CollectTextFromSSE(body, stream.CollectOptions{
 		CollectReasoning: true,
 		CollectToolCalls: true,
+		MaxToolCalls:     s.Config.MaxParallelToolCalls,
+		MaxOutputTokens:  maxOutputTokens,
+		MaxEventSize:     s.Config.MaxSSEEventSize,
 	})
-	s.ollamaEnc.WriteCollected(w, http.StatusOK, &codec.CollectedResponse{
+	return &codec.CollectedResponse{
 		ResponseID:       collected.ResponseID,
 		FullText:         collected.FullText,
 		ReasoningSummary: collected.ReasoningSummary,
 		ReasoningFull:    collected.ReasoningFull,
 		ToolCalls:        collected.ToolCalls,
-		RawResponse: map[string]any{
-			"_reasoning_compat": s.Config.ReasoningCompat,
-			"_created_at":       createdAt,
-		},
-	}, modelName)
+		IncompleteReason: collected.IncompleteReason,
+	}
 }
 
 // --- helpers ---
@@ -455,40 +639,41 @@ func decodeJSON(body []byte, dst any) error {
 	return json.Unmarshal(body, dst)
 }
 
+// ollamaNumPredict returns options.num_predict from an Ollama request, or 0
+// when it is unset or not a positive count (-1 and -2 mean unlimited).
+func ollamaNumPredict(payload map[string]any) int {
+	options, _ := payload["options"].(map[string]any)
+	if n := stream.Int64FromAny(options["num_predict"]); n > 0 {
+		return int(n)
+	}
+	return 0
+}
+
 func boolVal(m map[string]any, key string) bool {
 	v, _ := m[key].(bool)
 	return v
 }
 
 
-func convertSystemToUser(messages []types.ChatMessage) {
-	for i, m := range messages {
-		if m.Role == "system" {
-			messages[i] = types.ChatMessage{Role: "user", Content: m.Content}
-			if i > 0 {
-				msg := messages[i]
-				copy(messages[1:i+1], messages[:i])
-				messages[0] = msg
-			}
-			return
-		}
-	}
-}
-
 // collectAnthropicResponse collects a non-streaming anthropic response from SSE.
-func collectAnthropicResponse(body io.ReadCloser) *codec.CollectedResponse {
+func (s *Server) collectAnthropicResponse(body io.ReadCloser, maxOutputTokens int) *codec.CollectedResponse {
 	collected := stream.CollectTextFromSSE(body, stream.CollectOptions{
 		InitialResponseID: "msg_chatmock",
 		CollectUsage:      true,
 		CollectToolCalls:  true,
 		StopOnFailed:      true,
+		MaxToolCalls:      s.Config.MaxParallelToolCalls,
+		MaxOutputTokens:   maxOutputTokens,
+		MaxEventSize:      s.Config.MaxSSEEventSize,
 	})
 	return &codec.CollectedResponse{
-		ResponseID:   collected.ResponseID,
-		FullText:     collected.FullText,
-		ToolCalls:    collected.ToolCalls,
-		Usage:        collected.Usage,
-		ErrorMessage: collected.ErrorMessage,
+		ResponseID:       collected.ResponseID,
+		FullText:         collected.FullText,
+		ToolCalls:        collected.ToolCalls,
+		Annotations:      collected.Annotations,
+		Usage:            collected.Usage,
+		ErrorMessage:     collected.ErrorMessage,
+		IncompleteReason: collected.IncompleteReason,
 	}
 }
 
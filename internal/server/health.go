@@ -1,11 +1,44 @@
 package server
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/n0madic/go-chatmock/internal/auth"
 	"github.com/n0madic/go-chatmock/internal/codec"
 )
 
+// handleHealth serves /, /health and the /healthz liveness probe: it
+// succeeds whenever the server is serving.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	codec.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
+
+// handleReadyz is the readiness probe: it succeeds only when usable
+// credentials are loaded. It never calls upstream or fetches models.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if err := s.credentialsReady(); err != nil {
+		codec.WriteJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": "unavailable",
+			"error":  err.Error(),
+		})
+		return
+	}
+	codec.WriteJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Server) credentialsReady() error {
+	if _, err := auth.ReadAuthFile(); err != nil {
+		return err
+	}
+	accessToken, accountID, err := s.Pipeline.Upstream.TokenManager.PeekEffectiveAuth()
+	switch {
+	case err != nil:
+		return err
+	case accessToken == "":
+		return errors.New("credentials have no access token")
+	case accountID == "":
+		return errors.New("credentials have no ChatGPT account id")
+	}
+	return nil
+}
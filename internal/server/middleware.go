@@ -1,16 +1,26 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
 	"crypto/subtle"
+	"encoding/hex"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/http/httputil"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/n0madic/go-chatmock/internal/codec"
 	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/metrics"
+	"github.com/n0madic/go-chatmock/internal/upstream"
 )
 
 var debugDumpMu sync.Mutex
@@ -36,6 +46,62 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+type requestIDKey struct{}
+
+// requestIDMiddleware reads the correlation ID from the configured header
+// (generating one when absent), echoes it on the response and stores the
+// loggable form on the request context.
+func requestIDMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
+	name := config.DefaultRequestIDHeader
+	if cfg != nil && strings.TrimSpace(cfg.RequestIDHeader) != "" {
+		name = strings.TrimSpace(cfg.RequestIDHeader)
+	}
+	traceparent := strings.EqualFold(name, "traceparent")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := strings.TrimSpace(r.Header.Get(name))
+		logID := value
+		if traceparent {
+			if traceID, ok := parseTraceparent(value); ok {
+				logID = traceID
+			} else {
+				logID = randomHex(16)
+				value = "00-" + logID + "-" + randomHex(8) + "-01"
+			}
+		} else if value == "" {
+			value = randomHex(16)
+			logID = value
+		}
+		w.Header().Set(name, value)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, logID)))
+	})
+}
+
+// requestIDFromContext returns the correlation ID set by requestIDMiddleware.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// parseTraceparent extracts the trace-id from a W3C traceparent value
+// ("version-traceid-parentid-flags").
+func parseTraceparent(value string) (string, bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", false
+	}
+	traceID := strings.ToLower(parts[1])
+	if _, err := hex.DecodeString(traceID); err != nil || traceID == strings.Repeat("0", 32) {
+		return "", false
+	}
+	return traceID, true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func authMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		expectedToken := ""
@@ -48,7 +114,7 @@ func authMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
 		}
 
 		switch r.URL.Path {
-		case "/", "/health":
+		case "/", "/health", "/healthz", "/readyz":
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -57,8 +123,7 @@ func authMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
 			return
 		}
 
-		header := strings.TrimSpace(r.Header.Get("Authorization"))
-		token, ok := parseBearerAuthToken(header)
+		token, ok := requestAccessToken(r)
 		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(expectedToken)) != 1 {
 			writeAccessTokenAuthError(w, r)
 			return
@@ -68,6 +133,39 @@ func authMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
 	})
 }
 
+// jsonContentTypeMiddleware rejects POST bodies that are not declared as JSON
+// (--require-json-content-type). Ollama routes are exempt: its API documents
+// plain `curl -d` requests without a JSON content type.
+func jsonContentTypeMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
+	if cfg == nil || !cfg.RequireJSONContentType {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || strings.HasPrefix(r.URL.Path, "/api/") || isJSONContentType(r.Header.Get("Content-Type")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		msg := "Content-Type must be application/json"
+		if isAnthropicRequest(r) {
+			codec.WriteAnthropicError(w, http.StatusUnsupportedMediaType, "invalid_request_error", msg)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/v1beta/") {
+			codec.WriteGeminiError(w, http.StatusUnsupportedMediaType, msg)
+			return
+		}
+		codec.WriteOpenAIError(w, http.StatusUnsupportedMediaType, msg)
+	})
+}
+
+func isJSONContentType(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
 func writeAccessTokenAuthError(w http.ResponseWriter, r *http.Request) {
 	if isAnthropicRequest(r) {
 		codec.WriteAnthropicError(w, http.StatusUnauthorized, "authentication_error", serverAccessTokenError)
@@ -77,6 +175,10 @@ func writeAccessTokenAuthError(w http.ResponseWriter, r *http.Request) {
 		codec.WriteOllamaError(w, http.StatusUnauthorized, serverAccessTokenError)
 		return
 	}
+	if strings.HasPrefix(r.URL.Path, "/v1beta/") {
+		codec.WriteGeminiError(w, http.StatusUnauthorized, serverAccessTokenError)
+		return
+	}
 	codec.WriteOpenAIError(w, http.StatusUnauthorized, serverAccessTokenError)
 }
 
@@ -85,6 +187,28 @@ func isAnthropicRequest(r *http.Request) bool {
 		strings.TrimSpace(r.Header.Get("anthropic-beta")) != ""
 }
 
+// accessTokenHeaders lists the headers that may carry the server access token,
+// in precedence order. Only the first one present is checked, so a request is
+// judged the same way whichever combination of headers a client or proxy sets.
+var accessTokenHeaders = []string{"Authorization", "x-api-key", "x-goog-api-key", "Proxy-Authorization"}
+
+// requestAccessToken returns the token from the highest-precedence auth header
+// present. x-api-key and x-goog-api-key (Gemini clients) carry the bare
+// token; the others use the Bearer scheme.
+func requestAccessToken(r *http.Request) (string, bool) {
+	for _, name := range accessTokenHeaders {
+		value := strings.TrimSpace(r.Header.Get(name))
+		if value == "" {
+			continue
+		}
+		if name == "x-api-key" || name == "x-goog-api-key" {
+			return value, true
+		}
+		return parseBearerAuthToken(value)
+	}
+	return "", false
+}
+
 func parseBearerAuthToken(header string) (string, bool) {
 	parts := strings.Fields(header)
 	if len(parts) != 2 || parts[0] != "Bearer" || strings.TrimSpace(parts[1]) == "" {
@@ -94,7 +218,133 @@ func parseBearerAuthToken(header string) (string, bool) {
 }
 
 func requiresAccessToken(path string) bool {
-	return strings.HasPrefix(path, "/v1/") || strings.HasPrefix(path, "/api/")
+	return strings.HasPrefix(path, "/v1/") || strings.HasPrefix(path, "/v1beta/") || strings.HasPrefix(path, "/api/") ||
+		strings.HasPrefix(path, "/admin/") || path == "/metrics"
+}
+
+// attemptBudgetMiddleware caps the upstream calls each request may make
+// (--max-upstream-attempts); see upstream.WithAttemptBudget.
+func attemptBudgetMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
+	if cfg == nil || cfg.MaxUpstreamAttempts <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(upstream.WithAttemptBudget(r.Context(), cfg.MaxUpstreamAttempts)))
+	})
+}
+
+// concurrencyRetryAfter is the Retry-After value, in seconds, sent when the
+// upstream concurrency backlog is full.
+const concurrencyRetryAfter = "1"
+
+// concurrencyMiddleware gates upstream calls through one shared limiter
+// (--max-concurrent-requests); see upstream.WithConcurrencyLimiter. Up to
+// --max-concurrent-backlog calls wait for a slot, by default as many as the
+// limit. Requests the limiter turns away get a Retry-After header on their 429.
+func concurrencyMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
+	if cfg == nil || cfg.MaxConcurrentRequests <= 0 {
+		return next
+	}
+	backlog := cfg.MaxConcurrentBacklog
+	if backlog < 0 {
+		backlog = cfg.MaxConcurrentRequests
+	}
+	limiter := upstream.NewConcurrencyLimiter(cfg.MaxConcurrentRequests, backlog)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := upstream.WithConcurrencyLimiter(r.Context(), limiter)
+		next.ServeHTTP(&retryAfterWriter{ResponseWriter: w, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// retryAfterWriter adds Retry-After to a 429 caused by the concurrency
+// limiter.
+type retryAfterWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	wroteHeader bool
+}
+
+func (w *retryAfterWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusTooManyRequests && upstream.ConcurrencyLimited(w.ctx) {
+			w.Header().Set("Retry-After", concurrencyRetryAfter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *retryAfterWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *retryAfterWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *retryAfterWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// metricsMiddleware counts every request in the request_total metric under
+// the route pattern it matches on mux, and gives handlers a context for the
+// model labels (metrics.SetModels).
+func metricsMiddleware(cfg *config.ServerConfig, mux *http.ServeMux, next http.Handler) http.Handler {
+	if cfg == nil || !cfg.EnableMetrics {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			_, endpoint, _ = strings.Cut(pattern, " ")
+		}
+		r = r.WithContext(metrics.WithRequest(r.Context()))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		metrics.ObserveRequest(r.Context(), endpoint, rec.Status())
+	})
+}
+
+// statusRecorder remembers the response status for metricsMiddleware while
+// keeping the writer flushable for streamed responses.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Status is the written status, 200 when the handler wrote nothing.
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
 }
 
 func verboseMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
@@ -102,17 +352,118 @@ func verboseMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler
 		return next
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("request", "method", r.Method, "path", r.URL.Path)
+		slog.Info("request", "method", r.Method, "path", r.URL.Path, "request_id", requestIDFromContext(r.Context()))
 		next.ServeHTTP(w, r)
 	})
 }
 
+// gzipSSEMiddleware compresses text/event-stream responses for clients that
+// accept gzip (--gzip-sse). Each Flush flushes the compressor first, so every
+// event still reaches the client as soon as the handler flushes it.
+func gzipSSEMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
+	if cfg == nil || !cfg.GzipSSE {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r.Header.Values("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipSSEWriter{ResponseWriter: w}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether Accept-Encoding names gzip with a non-zero
+// quality. A bare "*" is not taken as consent.
+func acceptsGzip(values []string) bool {
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+				continue
+			}
+			q, ok := strings.CutPrefix(strings.ReplaceAll(strings.TrimSpace(params), " ", ""), "q=")
+			if !ok {
+				return true
+			}
+			v, err := strconv.ParseFloat(q, 64)
+			return err == nil && v > 0
+		}
+	}
+	return false
+}
+
+// gzipSSEWriter switches to gzip once the handler commits an event-stream
+// response; other responses are written through unchanged.
+type gzipSSEWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipSSEWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if strings.HasPrefix(h.Get("Content-Type"), "text/event-stream") && h.Get("Content-Encoding") == "" {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipSSEWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *gzipSSEWriter) Flush() {
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipSSEWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close writes the gzip trailer once the handler has returned.
+func (w *gzipSSEWriter) close() {
+	if w.gz != nil {
+		if err := w.gz.Close(); err != nil {
+			slog.Debug("gzip.close.failed", "error", err)
+		}
+	}
+}
+
 func debugMiddleware(cfg *config.ServerConfig, next http.Handler) http.Handler {
 	if cfg == nil || !cfg.Debug {
 		return next
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		dump, err := httputil.DumpRequest(r, true)
+		dump, err := httputil.DumpRequest(r, false)
+		if err == nil && r.Body != nil {
+			var body []byte
+			body, err = io.ReadAll(r.Body)
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			dump = append(dump, redactLogBody(body, cfg.LogRedact, cfg.RedactReasoning)...)
+		}
 		if err != nil {
 			slog.Error("request.dump.failed", "method", r.Method, "path", r.URL.Path, "error", err)
 		} else {
@@ -141,14 +492,10 @@ func writeDebugDumpBlock(title string, data []byte) {
 }
 
 func hasAnthropicAuthHeader(r *http.Request) bool {
-	if strings.TrimSpace(r.Header.Get("x-api-key")) != "" {
-		return true
-	}
-	if strings.TrimSpace(r.Header.Get("Authorization")) != "" {
-		return true
-	}
-	if strings.TrimSpace(r.Header.Get("Proxy-Authorization")) != "" {
-		return true
+	for _, name := range accessTokenHeaders {
+		if strings.TrimSpace(r.Header.Get(name)) != "" {
+			return true
+		}
 	}
 	return false
 }
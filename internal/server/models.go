@@ -2,7 +2,9 @@ package server
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/n0madic/go-chatmock/internal/codec"
 	"github.com/n0madic/go-chatmock/internal/config"
@@ -81,43 +83,83 @@ func (s *Server) handleListModelsAnthropic(w http.ResponseWriter, r *http.Reques
 // Ollama model endpoints
 
 func (s *Server) handleOllamaVersion(w http.ResponseWriter, r *http.Request) {
-	codec.WriteJSON(w, http.StatusOK, types.OllamaVersionResponse{Version: config.OllamaVersionString})
+	version := s.Config.OllamaVersion
+	if version == "" {
+		version = config.OllamaVersionString
+	}
+	codec.WriteJSON(w, http.StatusOK, types.OllamaVersionResponse{Version: version})
 }
 
-func (s *Server) handleOllamaTags(w http.ResponseWriter, r *http.Request) {
-	mods := s.Registry.GetModels()
-	var modelList []types.OllamaModelEntry
-	for _, m := range mods {
+// Synthetic model metadata reported by the Ollama listing endpoints. The
+// context sizes give way to a --capabilities-file context_window.
+const (
+	ollamaModelSize     = 815319791
+	ollamaModelDigest   = "8648f39daa8fbf5b18c7b4e6a8fb4990c692751d49917417b8842ca5758e7ffc"
+	ollamaNumCtx        = 100000
+	ollamaContextLength = 2000000
+)
+
+var ollamaModelDetails = types.OllamaModelDetails{
+	ParentModel:       "",
+	Format:            "gguf",
+	Family:            "llama",
+	Families:          []string{"llama"},
+	ParameterSize:     "8.0B",
+	QuantizationLevel: "Q4_0",
+}
+
+// ollamaModelIDs lists the visible model slugs, plus effort variants with
+// --expose-reasoning-models.
+func (s *Server) ollamaModelIDs() []string {
+	var ids []string
+	for _, m := range s.Registry.GetModels() {
 		if m.Visibility == "hidden" {
 			continue
 		}
-		ids := []string{m.Slug}
+		ids = append(ids, m.Slug)
 		if s.Config.ExposeReasoningModels {
 			for _, lvl := range m.SupportedReasoningLevels {
 				ids = append(ids, m.Slug+"-"+lvl.Effort)
 			}
 		}
-		for _, id := range ids {
-			modelList = append(modelList, types.OllamaModelEntry{
-				Name:       id,
-				Model:      id,
-				ModifiedAt: "2023-10-01T00:00:00Z",
-				Size:       815319791,
-				Digest:     "8648f39daa8fbf5b18c7b4e6a8fb4990c692751d49917417b8842ca5758e7ffc",
-				Details: types.OllamaModelDetails{
-					ParentModel:       "",
-					Format:            "gguf",
-					Family:            "llama",
-					Families:          []string{"llama"},
-					ParameterSize:     "8.0B",
-					QuantizationLevel: "Q4_0",
-				},
-			})
-		}
+	}
+	return ids
+}
+
+func (s *Server) handleOllamaTags(w http.ResponseWriter, r *http.Request) {
+	var modelList []types.OllamaModelEntry
+	for _, id := range s.ollamaModelIDs() {
+		modelList = append(modelList, types.OllamaModelEntry{
+			Name:       id,
+			Model:      id,
+			ModifiedAt: "2023-10-01T00:00:00Z",
+			Size:       ollamaModelSize,
+			Digest:     ollamaModelDigest,
+			Details:    ollamaModelDetails,
+		})
 	}
 	codec.WriteJSON(w, http.StatusOK, types.OllamaModelList{Models: modelList})
 }
 
+// handleOllamaPs reports every model as loaded; nothing is ever unloaded, so
+// expires_at is always a day ahead.
+func (s *Server) handleOllamaPs(w http.ResponseWriter, r *http.Request) {
+	expiresAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	modelList := []types.OllamaProcessEntry{}
+	for _, id := range s.ollamaModelIDs() {
+		modelList = append(modelList, types.OllamaProcessEntry{
+			Name:      id,
+			Model:     id,
+			Size:      ollamaModelSize,
+			Digest:    ollamaModelDigest,
+			Details:   ollamaModelDetails,
+			ExpiresAt: expiresAt,
+			SizeVRAM:  ollamaModelSize,
+		})
+	}
+	codec.WriteJSON(w, http.StatusOK, types.OllamaProcessList{Models: modelList})
+}
+
 func (s *Server) handleOllamaShow(w http.ResponseWriter, r *http.Request) {
 	var payload map[string]any
 	body, ok := readBody(w, r, s.ollamaEnc)
@@ -133,9 +175,13 @@ func (s *Server) handleOllamaShow(w http.ResponseWriter, r *http.Request) {
 		s.ollamaEnc.WriteError(w, http.StatusBadRequest, "Model not found")
 		return
 	}
+	numCtx, contextLength := ollamaNumCtx, ollamaContextLength
+	if window := s.Config.Capabilities.For(model).ContextWindow; window > 0 {
+		numCtx, contextLength = window, window
+	}
 
 	codec.WriteJSON(w, http.StatusOK, types.OllamaShowResponse{
-		Modelfile:  "# Modelfile generated by \"ollama show\"\nFROM /models/blobs/sha256:placeholder\nTEMPLATE \"\"\"{{ .System }}\\nUSER: {{ .Prompt }}\\nASSISTANT: \"\"\"\nPARAMETER num_ctx 100000\nPARAMETER stop \"</s>\"\nPARAMETER stop \"USER:\"\nPARAMETER stop \"ASSISTANT:\"",
+		Modelfile:  "# Modelfile generated by \"ollama show\"\nFROM /models/blobs/sha256:placeholder\nTEMPLATE \"\"\"{{ .System }}\\nUSER: {{ .Prompt }}\\nASSISTANT: \"\"\"\nPARAMETER num_ctx " + strconv.Itoa(numCtx) + "\nPARAMETER stop \"</s>\"\nPARAMETER stop \"USER:\"\nPARAMETER stop \"ASSISTANT:\"",
 		Parameters: "num_keep 24\nstop \"<|start_header_id|>\"\nstop \"<|end_header_id|>\"\nstop \"<|eot_id|>\"",
 		Template:   "{{ if .System }}<|start_header_id|>system<|end_header_id|>\n\n{{ .System }}<|eot_id|>{{ end }}{{ if .Prompt }}<|start_header_id|>user<|end_header_id|>\n\n{{ .Prompt }}<|eot_id|>{{ end }}<|start_header_id|>assistant<|end_header_id|>\n\n{{ .Response }}<|eot_id|>",
 		Details: types.OllamaModelDetails{
@@ -149,7 +195,7 @@ func (s *Server) handleOllamaShow(w http.ResponseWriter, r *http.Request) {
 		ModelInfo: map[string]any{
 			"general.architecture": "llama",
 			"general.file_type":    2,
-			"llama.context_length": 2000000,
+			"llama.context_length": contextLength,
 		},
 		Capabilities: []string{"completion", "vision", "tools", "thinking"},
 	})
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/n0madic/go-chatmock/internal/reasoning"
+)
+
+// redactTruncateChars is how much of each text field --log-redact=truncate
+// keeps.
+const redactTruncateChars = 32
+
+// contentKeys are the fields holding message text across the OpenAI,
+// Anthropic and Ollama request shapes. Other string fields (role, type, model,
+// ids, names) are structural and always logged as-is.
+var contentKeys = map[string]bool{
+	"content":      true,
+	"text":         true,
+	"input":        true,
+	"instructions": true,
+	"prompt":       true,
+	"system":       true,
+	"arguments":    true,
+	"output":       true,
+	"thinking":     true,
+}
+
+// redactedReasoning replaces reasoning text under --redact-reasoning-in-logs.
+const redactedReasoning = "[reasoning redacted]"
+
+// reasoningKeys are the fields holding reasoning text that clients echo back:
+// chat reasoning compat fields, Anthropic thinking blocks and Ollama thinking.
+var reasoningKeys = map[string]bool{
+	"reasoning":         true,
+	"reasoning_content": true,
+	"reasoning_summary": true,
+	"thinking":          true,
+}
+
+// reasoningItemKeys are the text-bearing fields of Responses reasoning items
+// and Anthropic thinking blocks.
+var reasoningItemKeys = []string{"summary", "content", "text", "thinking", "encrypted_content", "data", "signature"}
+
+// redactLogBody returns a copy of a JSON request body suitable for logging.
+// Base64 data (data URIs, file_data, Anthropic base64 sources and Ollama
+// images) is replaced with "[<N> bytes]", and message text is truncated or
+// hashed according to mode. With dropReasoning, reasoning echoed back by the
+// client is replaced as well. Bodies that are not JSON are returned unchanged.
+func redactLogBody(body []byte, mode string, dropReasoning bool) []byte {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	if dropReasoning {
+		v = redactReasoning(v, "")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redactValue(v, "", false, mode)); err != nil {
+		return body
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func redactValue(v any, key string, base64Source bool, mode string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		isBase64 := t["type"] == "base64"
+		for k, child := range t {
+			t[k] = redactValue(child, k, isBase64, mode)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			if key == "images" {
+				if s, ok := child.(string); ok {
+					t[i] = redactedBytes(s)
+					continue
+				}
+			}
+			t[i] = redactValue(child, key, false, mode)
+		}
+		return t
+	case string:
+		switch {
+		case isDataURI(t), key == "file_data", key == "data" && base64Source:
+			return redactedBytes(t)
+		case contentKeys[key]:
+			return redactText(t, mode)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// redactReasoning replaces reasoning text in a decoded request body: reasoning
+// and thinking items, reasoning fields on messages, and think-tags or inline
+// reasoning prefixed to assistant content.
+func redactReasoning(v any, key string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		switch t["type"] {
+		case "reasoning", "thinking", "redacted_thinking":
+			for _, k := range reasoningItemKeys {
+				if _, ok := t[k]; ok {
+					t[k] = redactedReasoning
+				}
+			}
+			return t
+		}
+		for k, child := range t {
+			if reasoningKeys[k] {
+				switch c := child.(type) {
+				case string:
+					t[k] = redactedReasoning
+					continue
+				case map[string]any:
+					// o3 compat: {"content": [{"type": "text", "text": ...}]}.
+					if _, ok := c["content"]; ok {
+						c["content"] = redactedReasoning
+						continue
+					}
+				}
+			}
+			t[k] = redactReasoning(child, k)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			t[i] = redactReasoning(child, key)
+		}
+		return t
+	case string:
+		if key == "content" || key == "text" {
+			return reasoning.StripInlineReasoning(reasoning.StripThinkTags(t))
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func isDataURI(s string) bool {
+	return strings.HasPrefix(s, "data:") && strings.Contains(s[:min(len(s), 128)], ";base64,")
+}
+
+func redactedBytes(s string) string {
+	return fmt.Sprintf("[%d bytes]", len(s))
+}
+
+func redactText(s, mode string) string {
+	switch mode {
+	case "truncate":
+		if utf8.RuneCountInString(s) <= redactTruncateChars {
+			return s
+		}
+		return fmt.Sprintf("%s…[%d chars]", string([]rune(s)[:redactTruncateChars]), utf8.RuneCountInString(s))
+	case "hash":
+		sum := sha256.Sum256([]byte(s))
+		return fmt.Sprintf("[sha256:%s %d chars]", hex.EncodeToString(sum[:6]), utf8.RuneCountInString(s))
+	default:
+		return s
+	}
+}
@@ -5,16 +5,21 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/n0madic/go-chatmock/internal/auth"
 	"github.com/n0madic/go-chatmock/internal/codec"
 	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/metrics"
 	"github.com/n0madic/go-chatmock/internal/models"
 	"github.com/n0madic/go-chatmock/internal/pipeline"
+	"github.com/n0madic/go-chatmock/internal/reasoning"
 	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/types"
 	"github.com/n0madic/go-chatmock/internal/upstream"
 )
 
@@ -28,6 +33,7 @@ type Server struct {
 	Pipeline   *pipeline.Pipeline
 	Registry   *models.Registry
 	Store      *state.Store
+	bgCtx      context.Context
 	cancelBg   context.CancelFunc
 
 	chatEnc      codec.Encoder
@@ -35,14 +41,25 @@ type Server struct {
 	textEnc      codec.Encoder
 	anthropicEnc codec.Encoder
 	ollamaEnc    codec.Encoder
+	geminiEnc    codec.Encoder
 }
 
 // New creates a new server with all routes registered.
 func New(cfg *config.ServerConfig) *Server {
 	tm := auth.NewTokenManager(config.ClientID(), config.TokenURL())
 	uc := upstream.NewClient(tm, cfg.Verbose, cfg.Debug)
+	uc.OmitReasoningInclude = !cfg.IncludeAllowed(upstream.IncludeReasoningContent)
+	uc.IdleTimeout = cfg.UpstreamIdleTimeout
+	uc.RedactReasoning = cfg.RedactReasoning
 	reg := models.NewRegistry(tm)
-	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity)
+	reg.StartupTimeout = cfg.StartupTimeout
+	reg.Capabilities = cfg.Capabilities
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, cfg.StateConversationCapacity, cfg.StateSweepInterval, cfg.StateConversationTTL)
+	if cfg.StateSpillDir != "" {
+		if err := store.SetSpillDir(cfg.StateSpillDir); err != nil {
+			slog.Warn("state.spill.disabled", "dir", cfg.StateSpillDir, "error", err)
+		}
+	}
 
 	s := &Server{
 		Config:   cfg,
@@ -59,11 +76,12 @@ func New(cfg *config.ServerConfig) *Server {
 		textEnc:      &codec.TextEncoder{},
 		anthropicEnc: &codec.AnthropicEncoder{},
 		ollamaEnc:    &codec.OllamaEncoder{},
+		geminiEnc:    &codec.GeminiEncoder{},
 	}
 
 	// Pre-fetch available models in background
 	bgCtx, cancel := context.WithCancel(context.Background())
-	s.cancelBg = cancel
+	s.bgCtx, s.cancelBg = bgCtx, cancel
 	go func() {
 		done := make(chan struct{})
 		go func() {
@@ -82,12 +100,18 @@ func New(cfg *config.ServerConfig) *Server {
 	// Health
 	mux.HandleFunc("GET /", s.handleHealth)
 	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
 
 	// OpenAI-compatible routes
 	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
 	mux.HandleFunc("POST /v1/completions", s.handleCompletions)
 	mux.HandleFunc("GET /v1/models", s.handleListModels)
 	mux.HandleFunc("POST /v1/responses", s.handleResponses)
+	mux.HandleFunc("GET /v1/responses", s.handleListResponses)
+	mux.HandleFunc("GET /v1/responses/{id}", s.handleGetResponse)
+	mux.HandleFunc("POST /v1/embeddings", s.handleEmbeddings)
 
 	// Anthropic-compatible routes
 	mux.HandleFunc("POST /v1/messages", s.handleAnthropicMessages)
@@ -98,11 +122,24 @@ func New(cfg *config.ServerConfig) *Server {
 	mux.HandleFunc("GET /api/tags", s.handleOllamaTags)
 	mux.HandleFunc("POST /api/show", s.handleOllamaShow)
 	mux.HandleFunc("GET /api/version", s.handleOllamaVersion)
+	mux.HandleFunc("GET /api/ps", s.handleOllamaPs)
+
+	// Gemini-compatible routes ({model}:generateContent, {model}:streamGenerateContent)
+	mux.HandleFunc("POST /v1beta/models/{action}", s.handleGeminiGenerateContent)
+
+	// Admin inspection routes (only with --access-token)
+	s.registerAdminRoutes(mux)
+
+	// Prometheus metrics (only with --enable-metrics)
+	if cfg.EnableMetrics {
+		metrics.Enable()
+		mux.Handle("GET /metrics", metrics.Handler())
+	}
 
 	// OPTIONS for CORS preflight
 	mux.HandleFunc("OPTIONS /", s.handleOptions)
 
-	handler := corsMiddleware(authMiddleware(cfg, verboseMiddleware(cfg, debugMiddleware(cfg, mux))))
+	handler := corsMiddleware(requestIDMiddleware(cfg, metricsMiddleware(cfg, mux, authMiddleware(cfg, jsonContentTypeMiddleware(cfg, attemptBudgetMiddleware(cfg, concurrencyMiddleware(cfg, verboseMiddleware(cfg, debugMiddleware(cfg, gzipSSEMiddleware(cfg, mux))))))))))
 
 	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 	s.httpServer = &http.Server{
@@ -116,9 +153,42 @@ func New(cfg *config.ServerConfig) *Server {
 	return s
 }
 
-// ListenAndServe starts the server.
+// ListenAndServe starts the server, over TLS when --tls-cert and --tls-key
+// are set. With --warmup, a warm-up request is sent once the listener is open.
 func (s *Server) ListenAndServe() error {
-	return s.httpServer.ListenAndServe()
+	useTLS := s.Config.TLSCertFile != ""
+	if useTLS {
+		tlsCfg, err := TLSConfig(s.Config.TLSMinVersion, s.Config.TLSCipherSuites)
+		if err != nil {
+			return err
+		}
+		s.httpServer.TLSConfig = tlsCfg
+	}
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
+	}
+	if s.Config.Warmup {
+		go s.warmup()
+	}
+	if useTLS {
+		return s.httpServer.ServeTLS(ln, s.Config.TLSCertFile, s.Config.TLSKeyFile)
+	}
+	return s.httpServer.Serve(ln)
+}
+
+// warmup primes the models registry and sends a tiny request through the
+// pipeline. Failures are logged and otherwise ignored.
+func (s *Server) warmup() {
+	start := time.Now()
+	s.Registry.GetModels()
+	ctx, cancel := context.WithTimeout(s.bgCtx, 60*time.Second)
+	defer cancel()
+	if err := s.Pipeline.Warmup(ctx); err != nil {
+		slog.Warn("warmup.failed", "error", err, "elapsed", time.Since(start))
+		return
+	}
+	slog.Info("warmup.done", "elapsed", time.Since(start))
 }
 
 // Shutdown gracefully stops the server.
@@ -139,10 +209,17 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	compat, ok := reasoningCompatOverride(w, r, s.chatEnc)
+	if !ok {
+		return
+	}
 
 	ctx := &pipeline.RequestContext{
-		Context:   r.Context(),
-		SessionID: strings.TrimSpace(r.Header.Get("X-Session-Id")),
+		Context:               r.Context(),
+		SessionID:             strings.TrimSpace(r.Header.Get("X-Session-Id")),
+		ReasoningCompat:       compat,
+		AcceptStream:          acceptsEventStream(r),
+		NoDefaultInstructions: noDefaultInstructions(r),
 	}
 
 	// Passthrough: when the body has a top-level `input` field (Responses API
@@ -162,10 +239,17 @@ func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	compat, ok := reasoningCompatOverride(w, r, s.responsesEnc)
+	if !ok {
+		return
+	}
 
 	ctx := &pipeline.RequestContext{
-		Context:   r.Context(),
-		SessionID: strings.TrimSpace(r.Header.Get("X-Session-Id")),
+		Context:               r.Context(),
+		SessionID:             strings.TrimSpace(r.Header.Get("X-Session-Id")),
+		ReasoningCompat:       compat,
+		AcceptStream:          acceptsEventStream(r),
+		NoDefaultInstructions: noDefaultInstructions(r),
 	}
 
 	// Passthrough: when the body has a top-level `input` field
@@ -177,6 +261,106 @@ func (s *Server) handleResponses(w http.ResponseWriter, r *http.Request) {
 	s.Pipeline.Execute(ctx, w, body, "responses", s.chatEnc, s.responsesEnc)
 }
 
+// Page size bounds for GET /v1/responses.
+const (
+	defaultResponsesListLimit = 20
+	maxResponsesListLimit     = 100
+)
+
+type storedResponseSummary struct {
+	ID        string            `json:"id"`
+	Object    string            `json:"object"`
+	CreatedAt int64             `json:"created_at"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+type storedResponseList struct {
+	Object  string                  `json:"object"`
+	Data    []storedResponseSummary `json:"data"`
+	FirstID string                  `json:"first_id,omitempty"`
+	LastID  string                  `json:"last_id,omitempty"`
+	HasMore bool                    `json:"has_more"`
+}
+
+// handleListResponses handles GET /v1/responses: the store:true responses
+// held in the local state store, newest first, filtered by metadata[key]=value
+// query parameters against the metadata each request sent. Only ids, store
+// times and metadata are reported; GET /v1/responses/{id} returns the output.
+func (s *Server) handleListResponses(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := map[string]string{}
+	for key, values := range query {
+		if name, ok := strings.CutPrefix(key, "metadata["); ok && strings.HasSuffix(name, "]") && len(values) > 0 {
+			filter[strings.TrimSuffix(name, "]")] = values[0]
+		}
+	}
+	limit := defaultResponsesListLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxResponsesListLimit {
+			codec.WriteOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("limit must be an integer between 1 and %d", maxResponsesListLimit))
+			return
+		}
+		limit = n
+	}
+
+	listings := s.Store.ListByMetadata(filter)
+	list := storedResponseList{Object: "list", Data: []storedResponseSummary{}, HasMore: len(listings) > limit}
+	for _, l := range listings[:min(limit, len(listings))] {
+		md := l.Metadata
+		if md == nil {
+			md = map[string]string{}
+		}
+		list.Data = append(list.Data, storedResponseSummary{ID: l.ResponseID, Object: "response", CreatedAt: l.StoredAt.Unix(), Metadata: md})
+	}
+	if n := len(list.Data); n > 0 {
+		list.FirstID, list.LastID = list.Data[0].ID, list.Data[n-1].ID
+	}
+	codec.WriteJSON(w, http.StatusOK, list)
+}
+
+// storedResponse is a response rebuilt from the state store for
+// GET /v1/responses/{id}.
+type storedResponse struct {
+	ID           string                     `json:"id"`
+	Object       string                     `json:"object"`
+	CreatedAt    int64                      `json:"created_at"`
+	Status       string                     `json:"status"`
+	Instructions string                     `json:"instructions,omitempty"`
+	Output       []types.ResponsesInputItem `json:"output"`
+	Metadata     map[string]string          `json:"metadata"`
+}
+
+// handleGetResponse handles GET /v1/responses/{id}: a response created with
+// store:true and held in the local state store, with the output items it
+// produced, streamed or not. Responses created without store:true are kept
+// only for previous_response_id and answer 404 here, as with OpenAI. Like the
+// list it does not refresh the entry's TTL.
+func (s *Server) handleGetResponse(w http.ResponseWriter, r *http.Request) {
+	responseID := strings.TrimSpace(r.PathValue("id"))
+	snap, ok := s.Store.Inspect(responseID)
+	if !ok || !snap.Stored {
+		codec.WriteOpenAIError(w, http.StatusNotFound, "unknown or expired response id "+responseID)
+		return
+	}
+	resp := storedResponse{
+		ID:           responseID,
+		Object:       "response",
+		CreatedAt:    snap.StoredAt.Unix(),
+		Status:       "completed",
+		Instructions: snap.Instructions,
+		Output:       snap.Output,
+		Metadata:     snap.Metadata,
+	}
+	if resp.Output == nil {
+		resp.Output = []types.ResponsesInputItem{}
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	codec.WriteJSON(w, http.StatusOK, resp)
+}
+
 func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
 	// Text completions uses its own handler path (not unified pipeline)
 	// as it has simpler normalization.
@@ -197,3 +381,44 @@ func readBody(w http.ResponseWriter, r *http.Request, enc codec.Encoder) ([]byte
 	}
 	return body, true
 }
+
+// acceptsEventStream reports whether the Accept header asks for SSE.
+func acceptsEventStream(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// noDefaultInstructions reports whether the request opted out of the embedded
+// prompt with a true X-Chatmock-No-Default-Instructions header.
+func noDefaultInstructions(r *http.Request) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(r.Header.Get("X-Chatmock-No-Default-Instructions")))
+	return err == nil && v
+}
+
+// embeddedInstructions returns the embedded prompt for a request without
+// client instructions, or "" when the request opted out of it.
+func (s *Server) embeddedInstructions(r *http.Request, model string, hasTools bool) string {
+	if noDefaultInstructions(r) {
+		return ""
+	}
+	return s.Config.InstructionsForRequest(model, hasTools)
+}
+
+// reasoningCompatOverride reads the per-request X-Chatmock-Reasoning-Compat
+// header. An empty result means the server default applies.
+func reasoningCompatOverride(w http.ResponseWriter, r *http.Request, enc codec.Encoder) (string, bool) {
+	compat := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Chatmock-Reasoning-Compat")))
+	if compat == "" {
+		return "", true
+	}
+	if !reasoning.IsValidCompat(compat) {
+		enc.WriteError(w, http.StatusBadRequest, fmt.Sprintf("invalid X-Chatmock-Reasoning-Compat %q; expected think-tags, inline, o3, legacy, or current", compat))
+		return "", false
+	}
+	return compat, true
+}
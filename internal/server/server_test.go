@@ -0,0 +1,1117 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/auth"
+	"github.com/n0madic/go-chatmock/internal/codec"
+	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/metrics"
+	"github.com/n0madic/go-chatmock/internal/models"
+	"github.com/n0madic/go-chatmock/internal/pipeline"
+	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/types"
+	"github.com/n0madic/go-chatmock/internal/upstream"
+)
+
+func TestReasoningCompatOverrideHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"", "", true},
+		{"legacy", "legacy", true},
+		{" O3 ", "o3", true},
+		{"deepseek", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Chatmock-Reasoning-Compat", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		got, ok := reasoningCompatOverride(rec, req, &codec.ChatEncoder{})
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("header %q: got (%q, %v), want (%q, %v)", tt.header, got, ok, tt.want, tt.ok)
+		}
+		if !tt.ok && rec.Code != http.StatusBadRequest {
+			t.Errorf("header %q: status got %d, want 400", tt.header, rec.Code)
+		}
+	}
+}
+
+func TestAcceptsEventStream(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"":                  false,
+		"application/json":  false,
+		"text/event-stream": true,
+		"application/json, Text/Event-Stream; q=0.9": true,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		r.Header.Set("Accept", accept)
+		if got := acceptsEventStream(r); got != want {
+			t.Errorf("Accept %q: got %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestRequestIDHeaderConfigurable(t *testing.T) {
+	var logged string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logged = requestIDFromContext(r.Context())
+	})
+
+	h := requestIDMiddleware(&config.ServerConfig{RequestIDHeader: "X-Correlation-Id"}, next)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	req.Header.Set("X-Correlation-Id", "corr-42")
+	req.Header.Set("X-Request-Id", "ignored")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Correlation-Id"); got != "corr-42" {
+		t.Errorf("echoed header: got %q, want corr-42", got)
+	}
+	if rec.Header().Get("X-Request-Id") != "" {
+		t.Error("default header must not be echoed when a custom one is configured")
+	}
+	if logged != "corr-42" {
+		t.Errorf("context id: got %q, want corr-42", logged)
+	}
+
+	// Missing inbound value is generated and echoed.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := rec.Header().Get("X-Correlation-Id"); got == "" || got != logged {
+		t.Errorf("generated id: header %q, context %q", got, logged)
+	}
+
+	// Traceparent is echoed verbatim and logged by its trace-id.
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	h = requestIDMiddleware(&config.ServerConfig{RequestIDHeader: "Traceparent"}, next)
+	req = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	req.Header.Set("traceparent", tp)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Traceparent"); got != tp {
+		t.Errorf("traceparent echo: got %q", got)
+	}
+	if logged != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("traceparent trace-id: got %q", logged)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// newAnthropicTestServer returns a server whose upstream records each request
+// body into upstreamBody and replies with a completed response carrying
+// output (a JSON array of output items; empty means none).
+func newAnthropicTestServer(t *testing.T, upstreamBody *map[string]any, output string) *Server {
+	t.Helper()
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	if output == "" {
+		output = "[]"
+	}
+	calls := 0
+	uc := upstream.NewClient(auth.NewTokenManager("", ""), false, false)
+	uc.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(r.Body)
+		*upstreamBody = nil
+		json.Unmarshal(data, upstreamBody) //nolint:errcheck
+		calls++
+		completed := fmt.Sprintf(`{"type":"response.completed","response":{"id":"resp_%d","output":%s}}`, calls, output)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader("data: " + completed + "\n\n")),
+			Request:    r,
+		}, nil
+	})}
+	cfg := &config.ServerConfig{DebugModel: "gpt-5"}
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	return &Server{
+		Config:       cfg,
+		Store:        store,
+		Registry:     &models.Registry{},
+		Pipeline:     &pipeline.Pipeline{Config: cfg, Store: store, Upstream: uc},
+		anthropicEnc: &codec.AnthropicEncoder{},
+		ollamaEnc:    &codec.OllamaEncoder{},
+		geminiEnc:    &codec.GeminiEncoder{},
+	}
+}
+
+func TestTextCompletionLogprobsRequestedUpstream(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	s.textEnc = &codec.TextEncoder{}
+
+	body := `{"model":"gpt-5","prompt":"hi","logprobs":3}`
+	rec := httptest.NewRecorder()
+	s.handleTextCompletions(rec, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+	include, _ := upstreamBody["include"].([]any)
+	if !slices.Contains(include, any("message.output_text.logprobs")) || upstreamBody["top_logprobs"] != float64(3) {
+		t.Errorf("upstream include %v, top_logprobs %v; want message.output_text.logprobs and 3", include, upstreamBody["top_logprobs"])
+	}
+	if !strings.Contains(rec.Body.String(), `"token_logprobs":[]`) {
+		t.Errorf("response should carry the logprobs structure: %s", rec.Body.String())
+	}
+
+	upstreamBody = nil
+	rec = httptest.NewRecorder()
+	s.handleTextCompletions(rec, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"gpt-5","prompt":"hi"}`)))
+	if _, ok := upstreamBody["top_logprobs"]; ok {
+		t.Errorf("top_logprobs sent without logprobs: %v", upstreamBody)
+	}
+
+	s.Config.AllowedIncludes = "reasoning.encrypted_content"
+	rec = httptest.NewRecorder()
+	s.handleTextCompletions(rec, httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "--allowed-includes") {
+		t.Errorf("logprobs with the include disallowed: status %d, body %s; want 400", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAnthropicResponseFormatBecomesTextFormat(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+
+	body := `{"model":"claude-sonnet-4","max_tokens":64,"messages":[{"role":"user","content":"city?"}],` +
+		`"output_format":{"type":"json_schema","schema":{"type":"object","properties":{"city":{"type":"string"}}}}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("x-api-key", "any")
+	rec := httptest.NewRecorder()
+	s.handleAnthropicMessages(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	text, _ := upstreamBody["text"].(map[string]any)
+	format, _ := text["format"].(map[string]any)
+	if format["type"] != "json_schema" || format["name"] != "response" {
+		t.Fatalf("upstream text.format: got %v", upstreamBody["text"])
+	}
+	if _, ok := format["schema"].(map[string]any); !ok {
+		t.Errorf("upstream text.format missing schema: %v", format)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(
+		`{"model":"claude-sonnet-4","max_tokens":64,"messages":[{"role":"user","content":"x"}],"response_format":{"type":"yaml"}}`))
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("x-api-key", "any")
+	rec = httptest.NewRecorder()
+	s.handleAnthropicMessages(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unsupported format: status got %d, want 400", rec.Code)
+	}
+}
+
+func TestAnthropicEnforceToolChoiceRetries(t *testing.T) {
+	const (
+		textSSE = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"It is sunny.\"}\n\n" +
+			"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_text\"}}\n\n"
+		toolSSE = "data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"get_weather\",\"arguments\":\"{}\"}}\n\n" +
+			"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_tool\"}}\n\n"
+	)
+	for _, tt := range []struct {
+		mode       string
+		wantStatus int
+		wantCalls  int
+		wantStored string // the only response id kept in the state store
+	}{
+		{mode: "off", wantStatus: http.StatusOK, wantCalls: 1, wantStored: "resp_text"},
+		{mode: "error", wantStatus: http.StatusBadGateway, wantCalls: 1},
+		{mode: "retry", wantStatus: http.StatusOK, wantCalls: 2, wantStored: "resp_tool"},
+	} {
+		var upstreamBody map[string]any
+		s := newAnthropicTestServer(t, &upstreamBody, "")
+		s.Config.EnforceToolChoice = tt.mode
+		replies := []string{textSSE, toolSSE}
+		calls := 0
+		s.Pipeline.Upstream.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+				Body:       io.NopCloser(strings.NewReader(replies[min(calls, len(replies))-1])),
+				Request:    r,
+			}, nil
+		})}
+
+		body := `{"model":"claude-sonnet-4","max_tokens":64,"messages":[{"role":"user","content":"weather?"}],` +
+			`"tools":[{"name":"get_weather","input_schema":{"type":"object"}}],"tool_choice":{"type":"any"}}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("x-api-key", "any")
+		rec := httptest.NewRecorder()
+		s.handleAnthropicMessages(rec, req)
+
+		if rec.Code != tt.wantStatus || calls != tt.wantCalls {
+			t.Errorf("%s: got status %d after %d upstream calls, want %d after %d (%s)", tt.mode, rec.Code, calls, tt.wantStatus, tt.wantCalls, rec.Body.String())
+		}
+		if tt.mode == "retry" && !strings.Contains(rec.Body.String(), `"tool_use"`) {
+			t.Errorf("retry: response should carry the tool call, got %s", rec.Body.String())
+		}
+		for _, id := range []string{"resp_text", "resp_tool"} {
+			if got := s.Pipeline.Store.Exists(id); got != (id == tt.wantStored) {
+				t.Errorf("%s: stored %s = %v, want %v", tt.mode, id, got, id == tt.wantStored)
+			}
+		}
+	}
+}
+
+func TestStrictToolsRejectsNamelessToolsOnEveryRoute(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", s.handleAnthropicMessages)
+	mux.HandleFunc("POST /api/chat", s.handleOllamaChat)
+	mux.HandleFunc("POST /v1beta/models/{action}", s.handleGeminiGenerateContent)
+
+	for _, tt := range []struct {
+		route, path, body, wantIndex string
+	}{
+		{"anthropic", "/v1/messages",
+			`{"model":"claude-sonnet-4","max_tokens":64,"messages":[{"role":"user","content":"hi"}],"tools":[{"name":"ok"},{"input_schema":{"type":"object"}}]}`,
+			"tools[1]"},
+		{"ollama", "/api/chat",
+			`{"model":"gpt-5","stream":false,"messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"parameters":{"type":"object"}}}]}`,
+			"tools[0]"},
+		{"gemini", "/v1beta/models/gemini-2.5-pro:generateContent",
+			`{"contents":[{"role":"user","parts":[{"text":"hi"}]}],"tools":[{"functionDeclarations":[{"name":"ok"},{"description":"nameless"}]}]}`,
+			"tools[0].functionDeclarations[1]"},
+	} {
+		for _, strict := range []bool{true, false} {
+			s.Config.StrictTools = strict
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("anthropic-version", "2023-06-01")
+			req.Header.Set("x-api-key", "any")
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if !strict {
+				if rec.Code != http.StatusOK {
+					t.Errorf("%s lenient: status got %d, want 200 (%s)", tt.route, rec.Code, rec.Body.String())
+				}
+				continue
+			}
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.wantIndex) {
+				t.Errorf("%s strict: got %d %s, want 400 naming %s", tt.route, rec.Code, rec.Body.String(), tt.wantIndex)
+			}
+		}
+	}
+}
+
+func TestAnthropicMetadataUserIDSaltsSession(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+
+	send := func(metadata string) string {
+		t.Helper()
+		body := `{"model":"claude-sonnet-4","max_tokens":64,"messages":[{"role":"user","content":"hello"}]` + metadata + `}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("x-api-key", "any")
+		rec := httptest.NewRecorder()
+		s.handleAnthropicMessages(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: got %d, body %s", rec.Code, rec.Body.String())
+		}
+		if _, ok := upstreamBody["metadata"]; ok {
+			t.Errorf("metadata forwarded upstream: %v", upstreamBody["metadata"])
+		}
+		key, _ := upstreamBody["prompt_cache_key"].(string)
+		if key == "" {
+			t.Fatalf("expected a derived prompt_cache_key, got %v", upstreamBody["prompt_cache_key"])
+		}
+		return key
+	}
+
+	alice := send(`,"metadata":{"user_id":"alice"}`)
+	bob := send(`,"metadata":{"user_id":"bob"}`)
+	anonymous := send("")
+	if alice == bob || alice == anonymous || bob == anonymous {
+		t.Errorf("expected distinct sessions per user_id: alice=%s bob=%s anonymous=%s", alice, bob, anonymous)
+	}
+	if again := send(`,"metadata":{"user_id":"alice"}`); again != alice {
+		t.Errorf("same user_id: got session %s, want %s", again, alice)
+	}
+}
+
+func TestAnthropicAndOllamaTrackConversationLatest(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, `[{"type":"message","role":"assistant","content":[{"type":"output_text","text":"hi there"}]}]`)
+
+	for _, stream := range []bool{false, true} {
+		body := fmt.Sprintf(`{"model":"claude-sonnet-4","max_tokens":64,"stream":%v,"metadata":{"conversation_id":"conv-anthropic"},"messages":[{"role":"user","content":"hello"}]}`, stream)
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("x-api-key", "any")
+		rec := httptest.NewRecorder()
+		s.handleAnthropicMessages(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("stream=%v: status %d, body %s", stream, rec.Code, rec.Body.String())
+		}
+		if upstreamBody["store"] != false {
+			t.Errorf("stream=%v: upstream store got %v, want false", stream, upstreamBody["store"])
+		}
+		latest, ok := s.Store.GetConversationLatest("conv-anthropic")
+		if !ok {
+			t.Fatalf("stream=%v: conversation was not tracked", stream)
+		}
+		context, _ := s.Store.GetContext(latest)
+		if len(context) == 0 || context[0].Role != "user" || context[0].Content[0].Text != "hello" {
+			t.Errorf("stream=%v: stored context for %s: %+v", stream, latest, context)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(
+		`{"model":"gpt-5","stream":false,"conversation_id":"conv-ollama","messages":[{"role":"user","content":"hello"}]}`))
+	rec := httptest.NewRecorder()
+	s.handleOllamaChat(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ollama: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if upstreamBody["store"] != false {
+		t.Errorf("ollama: upstream store got %v, want false", upstreamBody["store"])
+	}
+	if _, ok := s.Store.GetConversationLatest("conv-ollama"); !ok {
+		t.Error("ollama: conversation was not tracked")
+	}
+}
+
+func TestRequireJSONContentType(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	for _, tt := range []struct {
+		name        string
+		strict      bool
+		path        string
+		contentType string
+		want        int
+	}{
+		{"lenient text/plain", false, "/v1/chat/completions", "text/plain", http.StatusOK},
+		{"strict text/plain", true, "/v1/chat/completions", "text/plain", http.StatusUnsupportedMediaType},
+		{"strict missing", true, "/v1/messages", "", http.StatusUnsupportedMediaType},
+		{"strict json with charset", true, "/v1/chat/completions", "application/json; charset=utf-8", http.StatusOK},
+		{"strict ollama exempt", true, "/api/chat", "application/x-www-form-urlencoded", http.StatusOK},
+	} {
+		h := jsonContentTypeMiddleware(&config.ServerConfig{RequireJSONContentType: tt.strict}, next)
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{}`))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status got %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusUnsupportedMediaType && !strings.Contains(rec.Body.String(), "application/json") {
+			t.Errorf("%s: expected a JSON error body, got %s", tt.name, rec.Body.String())
+		}
+	}
+}
+
+func TestTLSConfigAppliesMinVersion(t *testing.T) {
+	for version, want := range map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		cfg, err := TLSConfig(version, "")
+		if err != nil {
+			t.Fatalf("TLSConfig(%q): %v", version, err)
+		}
+		if cfg.MinVersion != want {
+			t.Errorf("TLSConfig(%q): MinVersion got %#x, want %#x", version, cfg.MinVersion, want)
+		}
+		if len(cfg.CipherSuites) == 0 {
+			t.Errorf("TLSConfig(%q): expected the default cipher suites", version)
+		}
+	}
+
+	cfg, err := TLSConfig("1.2", "tls_ecdhe_rsa_with_aes_256_gcm_sha384")
+	if err != nil || len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("cipher suite list: got %v, %v", cfg, err)
+	}
+
+	for _, tt := range [][2]string{{"1.1", ""}, {"tls1.3", ""}, {"1.2", "TLS_RSA_WITH_RC4_128_SHA"}} {
+		if _, err := TLSConfig(tt[0], tt[1]); err == nil {
+			t.Errorf("TLSConfig(%q, %q): expected an error", tt[0], tt[1])
+		}
+	}
+}
+
+func TestOllamaVersionAndPs(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	s := &Server{
+		Config:   &config.ServerConfig{OllamaVersion: "0.13.0"},
+		Registry: models.NewRegistry(auth.NewTokenManager("", "")),
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleOllamaVersion(rec, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+	var version types.OllamaVersionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &version); err != nil || version.Version != "0.13.0" {
+		t.Errorf("/api/version: got %s (%v), want version 0.13.0", rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleOllamaPs(rec, httptest.NewRequest(http.MethodGet, "/api/ps", nil))
+	var ps types.OllamaProcessList
+	if err := json.Unmarshal(rec.Body.Bytes(), &ps); err != nil {
+		t.Fatalf("/api/ps: invalid JSON %s: %v", rec.Body.String(), err)
+	}
+	if len(ps.Models) == 0 {
+		t.Fatalf("/api/ps: expected the registry models, got %s", rec.Body.String())
+	}
+	for _, m := range ps.Models {
+		if m.Name == "" || m.Model != m.Name || m.Size <= 0 || m.SizeVRAM <= 0 || m.Details.Format == "" {
+			t.Errorf("/api/ps: malformed entry %+v", m)
+		}
+		if _, err := time.Parse(time.RFC3339, m.ExpiresAt); err != nil {
+			t.Errorf("/api/ps: expires_at %q is not RFC 3339", m.ExpiresAt)
+		}
+	}
+}
+
+func TestAccessTokenHeaderPrecedence(t *testing.T) {
+	h := authMiddleware(&config.ServerConfig{AccessToken: "secret"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"none", nil, http.StatusUnauthorized},
+		{"authorization", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"x-api-key", map[string]string{"x-api-key": "secret"}, http.StatusOK},
+		{"proxy-authorization", map[string]string{"Proxy-Authorization": "Bearer secret"}, http.StatusOK},
+		{"wrong authorization", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		{"wrong x-api-key", map[string]string{"x-api-key": "nope"}, http.StatusUnauthorized},
+		{"authorization wins over x-api-key", map[string]string{"Authorization": "Bearer secret", "x-api-key": "nope"}, http.StatusOK},
+		{"wrong authorization is not rescued", map[string]string{"Authorization": "Bearer nope", "x-api-key": "secret"}, http.StatusUnauthorized},
+		{"x-api-key wins over proxy", map[string]string{"x-api-key": "secret", "Proxy-Authorization": "Bearer nope"}, http.StatusOK},
+		{"wrong x-api-key is not rescued", map[string]string{"x-api-key": "nope", "Proxy-Authorization": "Bearer secret"}, http.StatusUnauthorized},
+	}
+	for _, path := range []string{"/v1/chat/completions", "/v1/messages", "/api/chat", "/admin/state/resp_1"} {
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodPost, path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s: got %d, want %d", path, tt.name, rec.Code, tt.want)
+			}
+		}
+	}
+}
+
+func TestHealthzAndReadyz(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	t.Setenv("CODEX_HOME", "")
+	uc := upstream.NewClient(auth.NewTokenManager("", ""), false, false)
+	uc.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("probe called upstream: %s", r.URL)
+		return nil, io.EOF
+	})}
+	s := &Server{Config: &config.ServerConfig{}, Pipeline: &pipeline.Pipeline{Upstream: uc}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	h := authMiddleware(&config.ServerConfig{AccessToken: "secret"}, mux)
+
+	probe := func(path string) (int, map[string]string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &body) //nolint:errcheck
+		return rec.Code, body
+	}
+
+	if code, body := probe("/healthz"); code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("/healthz: got %d %v", code, body)
+	}
+	if code, body := probe("/readyz"); code != http.StatusServiceUnavailable || body["error"] == "" {
+		t.Errorf("/readyz without credentials: got %d %v, want 503 with an error", code, body)
+	}
+
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	if code, body := probe("/readyz"); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("/readyz with credentials: got %d %v", code, body)
+	}
+}
+
+func TestNoDefaultInstructionsHeader(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	var upstreamBody map[string]any
+	uc := upstream.NewClient(auth.NewTokenManager("", ""), false, false)
+	uc.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(r.Body)
+		upstreamBody = nil
+		json.Unmarshal(data, &upstreamBody) //nolint:errcheck
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader("data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"output\":[]}}\n\n")),
+			Request:    r,
+		}, nil
+	})}
+	store := state.NewStore(state.DefaultTTL, state.DefaultCapacity, state.DefaultConversationCapacity, state.DefaultSweepInterval, 0)
+	t.Cleanup(store.Close)
+	cfg := &config.ServerConfig{DebugModel: "gpt-5", BaseInstructions: "embedded prompt"}
+	s := &Server{
+		Config:       cfg,
+		Pipeline:     &pipeline.Pipeline{Config: cfg, Store: store, Upstream: uc, Registry: &models.Registry{}},
+		chatEnc:      &codec.ChatEncoder{},
+		responsesEnc: &codec.ResponsesEncoder{},
+	}
+
+	for _, tt := range []struct {
+		header string
+		want   any
+	}{
+		{header: "true", want: nil},
+		{header: "", want: "embedded prompt"},
+		{header: "no", want: "embedded prompt"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(
+			`{"model":"gpt-5","messages":[{"role":"user","content":"hi"}]}`))
+		if tt.header != "" {
+			req.Header.Set("X-Chatmock-No-Default-Instructions", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		s.handleChatCompletions(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("header %q: status %d, body %s", tt.header, rec.Code, rec.Body.String())
+		}
+		if got := upstreamBody["instructions"]; got != tt.want {
+			t.Errorf("header %q: instructions got %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestGetResponseReturnsStreamedOutput(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	s.chatEnc, s.responsesEnc = &codec.ChatEncoder{}, &codec.ResponsesEncoder{}
+	s.Pipeline.Registry = s.Registry
+	const sse = "data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_s\"}}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"Checking \"}\n\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"the weather.\"}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\"item\":{\"type\":\"function_call\",\"call_id\":\"call_1\",\"name\":\"weather\",\"arguments\":\"{}\"}}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_s\"}}\n\n"
+	s.Pipeline.Upstream.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader(sse)),
+			Request:    r,
+		}, nil
+	})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/responses", s.handleResponses)
+	mux.HandleFunc("GET /v1/responses/{id}", s.handleGetResponse)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(
+		`{"model":"gpt-5","stream":true,"store":true,"input":"weather?","metadata":{"team":"a"}}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/responses/resp_s", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		ID       string                     `json:"id"`
+		Object   string                     `json:"object"`
+		Output   []types.ResponsesInputItem `json:"output"`
+		Metadata map[string]string          `json:"metadata"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rec.Body.String())
+	}
+	if got.ID != "resp_s" || got.Object != "response" || got.Metadata["team"] != "a" {
+		t.Errorf("response header fields: %+v", got)
+	}
+	if len(got.Output) != 2 || got.Output[0].Role != "assistant" || len(got.Output[0].Content) != 1 ||
+		got.Output[0].Content[0].Text != "Checking the weather." || got.Output[1].CallID != "call_1" {
+		t.Errorf("output should hold the streamed answer and the call, got %+v", got.Output)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/responses/resp_missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id: status %d, want 404", rec.Code)
+	}
+}
+
+func TestGetResponseRequiresStoreTrue(t *testing.T) {
+	const sse = "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi.\"}\n\n" +
+		"data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_ns\"}}\n\n"
+	for _, store := range []string{``, `,"store":false`} {
+		var upstreamBody map[string]any
+		s := newAnthropicTestServer(t, &upstreamBody, "")
+		s.chatEnc, s.responsesEnc = &codec.ChatEncoder{}, &codec.ResponsesEncoder{}
+		s.Pipeline.Registry = s.Registry
+		s.Pipeline.Upstream.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+				Body:       io.NopCloser(strings.NewReader(sse)),
+				Request:    r,
+			}, nil
+		})}
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /v1/responses", s.handleResponses)
+		mux.HandleFunc("GET /v1/responses/{id}", s.handleGetResponse)
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(
+			`{"model":"gpt-5","stream":true,"input":"hi"`+store+`}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("store %q: POST status %d, body %s", store, rec.Code, rec.Body.String())
+		}
+		if !s.Store.Exists("resp_ns") {
+			t.Errorf("store %q: state should still be kept for previous_response_id", store)
+		}
+
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/responses/resp_ns", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("store %q: GET status %d, want 404 (%s)", store, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestOpenAPISpecListsRoutes(t *testing.T) {
+	s := &Server{Config: &config.ServerConfig{}}
+	rec := httptest.NewRecorder()
+	s.handleOpenAPI(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", spec.OpenAPI)
+	}
+	for _, path := range []string{
+		"/health",
+		"/healthz",
+		"/readyz",
+		"/v1/chat/completions",
+		"/v1/completions",
+		"/v1/responses",
+		"/v1/responses/{id}",
+		"/v1/embeddings",
+		"/v1/models",
+		"/v1/messages",
+		"/v1/messages/count_tokens",
+		"/api/chat",
+		"/api/tags",
+		"/api/show",
+		"/api/version",
+		"/api/ps",
+	} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("spec is missing path %s", path)
+		}
+	}
+}
+
+func TestRedactLogBody(t *testing.T) {
+	image := "data:image/png;base64," + strings.Repeat("QUJD", 1000)
+	body := `{"model":"gpt-5","messages":[{"role":"user","content":[` +
+		`{"type":"text","text":"describe this picture in great detail please"},` +
+		`{"type":"image_url","image_url":{"url":"` + image + `"}}]}]}`
+
+	got := string(redactLogBody([]byte(body), "none", false))
+	if strings.Contains(got, "QUJD") {
+		t.Fatalf("image data was logged: %s", got)
+	}
+	if want := fmt.Sprintf(`"url":"[%d bytes]"`, len(image)); !strings.Contains(got, want) {
+		t.Errorf("redacted body %s does not contain %s", got, want)
+	}
+	for _, want := range []string{`"model":"gpt-5"`, `"role":"user"`, `"type":"image_url"`, "describe this picture in great detail please"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("redacted body %s lost %s", got, want)
+		}
+	}
+
+	got = string(redactLogBody([]byte(body), "truncate", false))
+	if strings.Contains(got, "detail please") || !strings.Contains(got, "[44 chars]") {
+		t.Errorf("truncate mode: %s", got)
+	}
+	got = string(redactLogBody([]byte(body), "hash", false))
+	if strings.Contains(got, "describe") || !strings.Contains(got, "[sha256:") || !strings.Contains(got, `"role":"user"`) {
+		t.Errorf("hash mode: %s", got)
+	}
+}
+
+func TestRedactLogBodyDropsReasoning(t *testing.T) {
+	bodies := []string{
+		`{"model":"gpt-5","reasoning":{"effort":"high"},"messages":[{"role":"assistant","content":"<think>secret plan</think>Answer","reasoning_content":"secret plan"},{"role":"assistant","content":"Reasoning: secret plan\n\nAnswer: 4"}]}`,
+		`{"model":"gpt-5","input":[{"type":"reasoning","summary":[{"type":"summary_text","text":"secret plan"}],"encrypted_content":"abc"},{"role":"user","content":"next"}]}`,
+		`{"model":"claude","messages":[{"role":"assistant","content":[{"type":"thinking","thinking":"secret plan","signature":"sig"},{"type":"text","text":"Answer"}]}]}`,
+		`{"model":"gpt-5","messages":[{"role":"assistant","content":"Answer","thinking":"secret plan"}]}`,
+	}
+	for _, body := range bodies {
+		got := string(redactLogBody([]byte(body), "none", true))
+		if strings.Contains(got, "secret plan") {
+			t.Errorf("reasoning left in %s", got)
+		}
+		if !strings.Contains(got, `"model"`) {
+			t.Errorf("structure lost: %s", got)
+		}
+		if unredacted := string(redactLogBody([]byte(body), "none", false)); !strings.Contains(unredacted, "secret plan") {
+			t.Errorf("reasoning must be kept without the flag: %s", unredacted)
+		}
+	}
+	if got := string(redactLogBody([]byte(bodies[0]), "none", true)); !strings.Contains(got, `"effort":"high"`) || !strings.Contains(got, `"content":"Answer"`) {
+		t.Errorf("answers and reasoning params must survive: %s", got)
+	}
+}
+
+func TestMetricsLabelRequestsWithModels(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	s.Config.EnableMetrics = true
+	metrics.Enable()
+	s.Pipeline.Upstream.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		completed := `{"type":"response.completed","response":{"id":"resp_1","output":[],"usage":{"input_tokens":11,"output_tokens":7}}}`
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader("data: " + completed + "\n\n")),
+			Request:    r,
+		}, nil
+	})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", s.handleAnthropicMessages)
+	mux.Handle("GET /metrics", metrics.Handler())
+	h := metricsMiddleware(s.Config, mux, mux)
+	if !requiresAccessToken("/metrics") {
+		t.Error("/metrics should require the access token")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(
+		`{"model":"claude-metrics-test","max_tokens":64,"messages":[{"role":"user","content":"hello"}]}`))
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("x-api-key", "any")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+	labels := `requested_model="other",upstream_model="gpt-5"`
+	for _, want := range []string{
+		`chatmock_request_total{endpoint="/v1/messages",status="200",` + labels + `}`,
+		`chatmock_upstream_responses_total{status="200",` + labels + `}`,
+		`chatmock_upstream_latency_seconds_count{` + labels + `}`,
+		`chatmock_tokens_prompt_total{` + labels + `} 11`,
+		`chatmock_tokens_completion_total{` + labels + `} 7`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("/metrics missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGeminiGenerateContent(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	s.Pipeline.Upstream.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &upstreamBody) //nolint:errcheck
+		events := []string{
+			`{"type":"response.output_text.delta","delta":"Sunny."}`,
+			`{"type":"response.output_item.done","item":{"type":"function_call","call_id":"call_9","name":"forecast","arguments":"{\"days\":2}"}}`,
+			`{"type":"response.completed","response":{"id":"resp_1"}}`,
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+			Body:       io.NopCloser(strings.NewReader("data: " + strings.Join(events, "\n\ndata: ") + "\n\n")),
+			Request:    r,
+		}, nil
+	})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1beta/models/{action}", s.handleGeminiGenerateContent)
+
+	body := `{"systemInstruction":{"parts":[{"text":"Be brief."}]},` +
+		`"contents":[{"role":"user","parts":[{"text":"Weather?"}]}],` +
+		`"tools":[{"functionDeclarations":[{"name":"forecast","parameters":{"type":"OBJECT","properties":{"days":{"type":"INTEGER"}}}}]}],` +
+		`"toolConfig":{"functionCallingConfig":{"mode":"ANY"}}}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.5-pro:generateContent", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	if upstreamBody["instructions"] != "Be brief." || upstreamBody["tool_choice"] != "required" {
+		t.Errorf("upstream instructions/tool_choice: %v / %v", upstreamBody["instructions"], upstreamBody["tool_choice"])
+	}
+	tools, _ := upstreamBody["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["parameters"].(map[string]any)["type"] != "object" {
+		t.Errorf("upstream tools: %v", upstreamBody["tools"])
+	}
+
+	var resp types.GeminiGenerateContentResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	parts := resp.Candidates[0].Content.Parts
+	if resp.Candidates[0].Content.Role != "model" || resp.Candidates[0].FinishReason != "STOP" || len(parts) != 2 {
+		t.Fatalf("unexpected candidate: %s", rec.Body.String())
+	}
+	if parts[0].Text != "Sunny." || parts[1].FunctionCall == nil || parts[1].FunctionCall.Name != "forecast" || parts[1].FunctionCall.Args["days"] != float64(2) {
+		t.Errorf("unexpected parts: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-2.5-pro:embedContent", strings.NewReader(body)))
+	var errResp types.GeminiErrorResponse
+	json.Unmarshal(rec.Body.Bytes(), &errResp) //nolint:errcheck
+	if rec.Code != http.StatusNotFound || errResp.Error.Status != "NOT_FOUND" {
+		t.Errorf("unsupported method: got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListResponsesFiltersByMetadata(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	s.responsesEnc = &codec.ResponsesEncoder{}
+	s.Pipeline.Registry = s.Registry
+
+	for _, team := range []string{"red", "blue"} {
+		body := `{"model":"gpt-5","stream":false,"store":true,"input":"hi","metadata":{"team":"` + team + `","env":"test"}}`
+		rec := httptest.NewRecorder()
+		s.handleResponses(rec, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: status %d, body %s", team, rec.Code, rec.Body.String())
+		}
+	}
+	if _, ok := upstreamBody["metadata"]; ok {
+		t.Errorf("metadata must not be forwarded upstream: %v", upstreamBody["metadata"])
+	}
+
+	list := func(query string) storedResponseList {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleListResponses(rec, httptest.NewRequest(http.MethodGet, "/v1/responses?"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET ?%s: status %d, body %s", query, rec.Code, rec.Body.String())
+		}
+		var out storedResponseList
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode list: %v", err)
+		}
+		return out
+	}
+
+	got := list("metadata[team]=blue")
+	if len(got.Data) != 1 || got.Data[0].ID != "resp_2" || got.Data[0].Metadata["team"] != "blue" {
+		t.Fatalf("metadata[team]=blue: got %+v", got)
+	}
+	if got := list("metadata[env]=test"); len(got.Data) != 2 {
+		t.Errorf("metadata[env]=test should match both responses, got %+v", got)
+	}
+	if got := list("metadata[team]=green"); len(got.Data) != 0 || got.HasMore {
+		t.Errorf("metadata[team]=green should match nothing, got %+v", got)
+	}
+
+	body := `{"model":"gpt-5","stream":false,"input":"hi","metadata":{"team":"green","env":"test"}}`
+	rec := httptest.NewRecorder()
+	s.handleResponses(rec, httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST green: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := list("metadata[team]=green"); len(got.Data) != 0 {
+		t.Errorf("a response sent without store:true must not be listed, got %+v", got)
+	}
+}
+
+func TestLegacyModelRemappedWithDeprecationHeader(t *testing.T) {
+	var upstreamBody map[string]any
+	s := newAnthropicTestServer(t, &upstreamBody, "")
+	s.Config.DebugModel = ""
+	s.Config.LegacyModelTarget = "gpt-5"
+	s.chatEnc = &codec.ChatEncoder{}
+	s.responsesEnc = &codec.ResponsesEncoder{}
+	s.Pipeline.Registry = s.Registry
+
+	body := `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`
+	rec := httptest.NewRecorder()
+	s.handleChatCompletions(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d, body %s", rec.Code, rec.Body.String())
+	}
+	if upstreamBody["model"] != "gpt-5" {
+		t.Errorf("upstream model: got %v, want gpt-5", upstreamBody["model"])
+	}
+	notice := rec.Header().Get(codec.DeprecationHeader)
+	if !strings.Contains(notice, `"gpt-3.5-turbo"`) || !strings.Contains(notice, `"gpt-5"`) {
+		t.Errorf("%s: got %q", codec.DeprecationHeader, notice)
+	}
+}
+
+func TestGzipSSEMiddlewareFlushesEachEvent(t *testing.T) {
+	release := make(chan struct{})
+	h := gzipSSEMiddleware(&config.ServerConfig{GzipSSE: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data: one\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: two\n\n")
+		w.(http.Flusher).Flush()
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding: got %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	lines := bufio.NewReader(zr)
+	// The first event must decode while the handler is still blocked.
+	if line, err := lines.ReadString('\n'); err != nil || line != "data: one\n" {
+		t.Fatalf("first event before release: got %q, %v", line, err)
+	}
+	close(release)
+	rest, err := io.ReadAll(lines)
+	if err != nil {
+		t.Fatalf("read rest: %v", err)
+	}
+	if string(rest) != "\ndata: two\n\n" {
+		t.Errorf("rest of stream: got %q", rest)
+	}
+
+	// Clients that do not accept gzip (or refuse it with q=0) get plain text.
+	for _, accept := range []string{"", "identity", "gzip;q=0", "*"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
+		}
+		release = make(chan struct{})
+		close(release)
+		h.ServeHTTP(rec, req)
+		if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "data: one\n\ndata: two\n\n" {
+			t.Errorf("Accept-Encoding %q: got encoding %q, body %q", accept, rec.Header().Get("Content-Encoding"), rec.Body.String())
+		}
+	}
+}
+
+func TestEmbeddingsUnsupportedAndPassthrough(t *testing.T) {
+	s := &Server{Config: &config.ServerConfig{AccessToken: "local-secret"}, chatEnc: &codec.ChatEncoder{}}
+	body := `{"model":"text-embedding-3-small","input":"hi"}`
+
+	rec := httptest.NewRecorder()
+	s.handleEmbeddings(rec, httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body)))
+	var errResp types.ErrorResponse
+	if rec.Code != http.StatusNotImplemented || json.Unmarshal(rec.Body.Bytes(), &errResp) != nil || !strings.Contains(errResp.Error.Message, "not supported") {
+		t.Fatalf("without passthrough: status %d, body %s; want 501 OpenAI error", rec.Code, rec.Body.String())
+	}
+
+	var gotAuth, gotBody string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, `{"object":"list","data":[]}`)
+	}))
+	t.Cleanup(provider.Close)
+	s.Config.EmbeddingsPassthroughURL = provider.URL
+
+	for _, tt := range []struct{ authz, want string }{
+		{"Bearer sk-provider", "Bearer sk-provider"},
+		{"Bearer local-secret", ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body))
+		req.Header.Set("Authorization", tt.authz)
+		rec = httptest.NewRecorder()
+		s.handleEmbeddings(rec, req)
+		if rec.Code != http.StatusTeapot || rec.Header().Get("Content-Type") != "application/json; charset=utf-8" || rec.Body.String() != `{"object":"list","data":[]}` {
+			t.Errorf("passthrough: status %d, content type %q, body %s; want the provider response", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+		if gotAuth != tt.want || gotBody != body {
+			t.Errorf("provider got Authorization %q body %s; want %q and the client body", gotAuth, gotBody, tt.want)
+		}
+	}
+}
+
+func TestOllamaNumPredict(t *testing.T) {
+	for _, tt := range []struct {
+		body string
+		want int
+	}{
+		{`{"options":{"num_predict":64}}`, 64},
+		{`{"options":{"num_predict":-1}}`, 0},
+		{`{"options":{}}`, 0},
+		{`{}`, 0},
+	} {
+		var payload map[string]any
+		json.Unmarshal([]byte(tt.body), &payload) //nolint:errcheck
+		if got := ollamaNumPredict(payload); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.body, got, tt.want)
+		}
+	}
+	s := &Server{Config: &config.ServerConfig{ServerMaxOutputTokens: 100}}
+	if got := s.Config.OutputTokenLimit("gpt-5", ollamaNumPredict(map[string]any{"options": map[string]any{"num_predict": float64(10)}})); got != 10 {
+		t.Errorf("num_predict under the server cap: limit %d, want 10", got)
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// defaultCipherSuites limits TLS 1.2 to forward-secret AEAD suites. TLS 1.3
+// suites are fixed by crypto/tls and always secure.
+var defaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// TLSConfig builds the listener TLS config from --tls-min-version and
+// --tls-cipher-suites (comma-separated Go suite names; empty selects the
+// secure defaults). Suites crypto/tls considers insecure are rejected.
+func TLSConfig(minVersion, cipherSuites string) (*tls.Config, error) {
+	version, ok := tlsVersions[strings.TrimSpace(minVersion)]
+	if !ok {
+		return nil, fmt.Errorf("invalid TLS minimum version %q; expected 1.2 or 1.3", minVersion)
+	}
+	suites := defaultCipherSuites
+	if strings.TrimSpace(cipherSuites) != "" {
+		byName := make(map[string]uint16)
+		for _, s := range tls.CipherSuites() {
+			byName[s.Name] = s.ID
+		}
+		suites = nil
+		for _, name := range strings.Split(cipherSuites, ",") {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			id, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure TLS cipher suite %q", name)
+			}
+			suites = append(suites, id)
+		}
+	}
+	return &tls.Config{
+		MinVersion:   version,
+		CipherSuites: suites,
+	}, nil
+}
@@ -45,11 +45,19 @@ func (ss *SessionStore) Len() int {
 // so the ChatGPT backend can reuse cached computation across turns even
 // though we never send the previous_response_id in the upstream request.
 func (ss *SessionStore) EnsureSessionID(instructions string, inputItems []types.ResponsesInputItem, clientSupplied string) string {
+	return ss.EnsureUserSessionID("", instructions, inputItems, clientSupplied)
+}
+
+// EnsureUserSessionID is EnsureSessionID with an end-user identifier mixed
+// into the fingerprint, so identical prompts from different end users map to
+// distinct sessions (and upstream prompt caches). An empty user behaves
+// exactly like EnsureSessionID.
+func (ss *SessionStore) EnsureUserSessionID(user, instructions string, inputItems []types.ResponsesInputItem, clientSupplied string) string {
 	if clientSupplied != "" {
 		return clientSupplied
 	}
 
-	canon := canonicalizePrefix(instructions, inputItems)
+	canon := canonicalizePrefix(user, instructions, inputItems)
 	fp := fingerprint(canon)
 
 	ss.mu.Lock()
@@ -87,8 +95,12 @@ func EnsureSessionID(instructions string, inputItems []types.ResponsesInputItem,
 // the request: instructions and the first user message. Subsequent turns in the
 // conversation must map to the same session ID so upstream prompt caching is effective.
 // Including later messages would produce a new session ID every turn, defeating caching.
-func canonicalizePrefix(instructions string, inputItems []types.ResponsesInputItem) string {
+// A non-empty user salts the prefix so end users never share a session.
+func canonicalizePrefix(user, instructions string, inputItems []types.ResponsesInputItem) string {
 	prefix := make(map[string]any)
+	if user != "" {
+		prefix["user"] = user
+	}
 	if instructions != "" {
 		prefix["instructions"] = instructions
 	}
@@ -16,8 +16,13 @@ func (s *Store) RestoreFunctionCallContext(inputItems []types.ResponsesInputItem
 	if previousResponseID != "" && prependPreviousContext {
 		previousContext, hasContext := s.GetContext(previousResponseID)
 		if hasContext && len(previousContext) > 0 {
-			if !hasResponsesInputPrefix(effectiveInput, previousContext) {
-				effectiveInput = append(types.CloneInputItems(previousContext), effectiveInput...)
+			resolved, rest, err := ResolveItemReferences(effectiveInput, previousContext)
+			if err != nil {
+				return nil, err
+			}
+			effectiveInput = resolved
+			if !hasResponsesInputPrefix(effectiveInput, rest) {
+				effectiveInput = append(types.CloneInputItems(rest), effectiveInput...)
 			}
 		} else {
 			if !s.Exists(previousResponseID) {
@@ -25,6 +30,9 @@ func (s *Store) RestoreFunctionCallContext(inputItems []types.ResponsesInputItem
 			}
 		}
 	}
+	if id, ok := firstItemReference(effectiveInput); ok {
+		return nil, fmt.Errorf("item_reference %q cannot be resolved; send previous_response_id from the response that contains it", id)
+	}
 
 	missingCallIDs := missingFunctionCallOutputIDs(effectiveInput)
 	if len(missingCallIDs) == 0 {
@@ -120,12 +128,62 @@ func (s *Store) RestorePreviousContext(raw map[string]any, previousResponseID st
 		}
 	}
 
-	combined := make([]types.ResponsesInputItem, 0, len(ctx)+len(currentItems))
-	combined = append(combined, ctx...)
+	currentItems, rest, err := ResolveItemReferences(currentItems, ctx)
+	if err != nil {
+		return nil, err
+	}
+	combined := make([]types.ResponsesInputItem, 0, len(rest)+len(currentItems))
+	combined = append(combined, rest...)
 	combined = append(combined, currentItems...)
 	return combined, nil
 }
 
+// ResolveItemReferences replaces each item_reference in input, in place, with
+// the item of the same id from ctx, so references keep their position among
+// literal items. It also returns the ctx items that were not referenced, which
+// callers prepend as the restored context. An unknown id is an error.
+func ResolveItemReferences(input, ctx []types.ResponsesInputItem) (resolved, rest []types.ResponsesInputItem, err error) {
+	if _, ok := firstItemReference(input); !ok {
+		return input, ctx, nil
+	}
+	byID := make(map[string]int, len(ctx))
+	for i, item := range ctx {
+		if item.ID != "" {
+			byID[item.ID] = i
+		}
+	}
+	referenced := make(map[int]bool)
+	resolved = make([]types.ResponsesInputItem, 0, len(input))
+	for _, item := range input {
+		if item.Type != "item_reference" {
+			resolved = append(resolved, item)
+			continue
+		}
+		i, ok := byID[item.ID]
+		if !ok {
+			return nil, nil, fmt.Errorf("item_reference %q not found in the previous response context", item.ID)
+		}
+		resolved = append(resolved, types.CloneInputItems(ctx[i:i+1])...)
+		referenced[i] = true
+	}
+	rest = make([]types.ResponsesInputItem, 0, len(ctx)-len(referenced))
+	for i, item := range ctx {
+		if !referenced[i] {
+			rest = append(rest, item)
+		}
+	}
+	return resolved, rest, nil
+}
+
+func firstItemReference(items []types.ResponsesInputItem) (string, bool) {
+	for _, item := range items {
+		if item.Type == "item_reference" {
+			return item.ID, true
+		}
+	}
+	return "", false
+}
+
 // IsUnsupportedParameterError checks if an error body indicates unsupported parameter.
 func IsUnsupportedParameterError(rawBody []byte, param string) bool {
 	msg := strings.ToLower(extractUpstreamErrorMessage(rawBody))
@@ -135,6 +193,16 @@ func IsUnsupportedParameterError(rawBody []byte, param string) bool {
 	return strings.Contains(msg, "unsupported parameter") && strings.Contains(msg, strings.ToLower(strings.TrimSpace(param)))
 }
 
+// IsContextLengthError reports whether an upstream error body rejects the
+// request for exceeding the model's context window.
+func IsContextLengthError(rawBody []byte) bool {
+	if strings.Contains(string(rawBody), "context_length_exceeded") {
+		return true
+	}
+	msg := strings.ToLower(extractUpstreamErrorMessage(rawBody))
+	return strings.Contains(msg, "context window") || strings.Contains(msg, "context length")
+}
+
 // NormalizeStoreForUpstream keeps store handling compatible with upstream.
 func NormalizeStoreForUpstream(requested *bool) (*bool, bool) {
 	if requested != nil && *requested {
@@ -179,7 +247,8 @@ func responsesContentSliceEqual(a, b []types.ResponsesContent) bool {
 		return false
 	}
 	for i := range a {
-		if a[i] != b[i] {
+		// Annotations are ignored: clients rarely echo citations back.
+		if a[i].Type != b[i].Type || a[i].Text != b[i].Text || a[i].ImageURL != b[i].ImageURL || a[i].Refusal != b[i].Refusal {
 			return false
 		}
 	}
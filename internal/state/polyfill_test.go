@@ -0,0 +1,44 @@
+package state
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestRestoreResolvesItemReferenceInPlace(t *testing.T) {
+	s := NewStore(DefaultTTL, DefaultCapacity, DefaultConversationCapacity, DefaultSweepInterval, 0)
+	t.Cleanup(s.Close)
+	s.PutContext("resp_1", []types.ResponsesInputItem{
+		{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "first question"}}},
+		{Type: "message", Role: "assistant", ID: "msg_1", Content: []types.ResponsesContent{{Type: "output_text", Text: "first answer"}}},
+	})
+
+	var input []types.ResponsesInputItem
+	if err := json.Unmarshal([]byte(`[
+		{"role":"user","content":"before"},
+		{"type":"item_reference","id":"msg_1"},
+		{"role":"user","content":"after"}
+	]`), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.RestoreFunctionCallContext(input, "resp_1", true)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	var texts []string
+	for _, item := range got {
+		texts = append(texts, item.Content[0].Text)
+	}
+	if want := "first question|before|first answer|after"; strings.Join(texts, "|") != want {
+		t.Errorf("resolved order got %q, want %q", strings.Join(texts, "|"), want)
+	}
+
+	input[1].ID = "msg_missing"
+	if _, err := s.RestoreFunctionCallContext(input, "resp_1", true); err == nil || !strings.Contains(err.Error(), "msg_missing") {
+		t.Errorf("unknown reference: got %v, want an error naming msg_missing", err)
+	}
+}
@@ -0,0 +1,281 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// Subdirectories of the spill directory.
+const (
+	spillResponsesDir     = "responses"
+	spillConversationsDir = "conversations"
+)
+
+// spilledEntry is the on-disk form of a response entry evicted by capacity.
+type spilledEntry struct {
+	Calls        []FunctionCall             `json:"calls,omitempty"`
+	Context      []types.ResponsesInputItem `json:"context,omitempty"`
+	Instructions string                     `json:"instructions,omitempty"`
+	Metadata     map[string]string          `json:"metadata,omitempty"`
+	Output       []types.ResponsesInputItem `json:"output,omitempty"`
+	Stored       bool                       `json:"stored,omitempty"`
+	StoredAt     time.Time                  `json:"stored_at"`
+	LastAccess   time.Time                  `json:"last_access"`
+}
+
+// spilledLink is the on-disk form of a conversation link evicted by capacity.
+type spilledLink struct {
+	ResponseID string    `json:"response_id"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// pendingSpill holds capacity victims between eviction, which runs under
+// s.mu, and flushSpill, which writes them to disk after s.mu is released.
+// Lookups check it first so a victim stays reachable until its file exists.
+type pendingSpill struct {
+	entries map[string]*entry
+	links   map[string]*conversationLink
+}
+
+// SetSpillDir enables the disk tier (--state-spill-dir): entries and
+// conversation links evicted for capacity are written under dir instead of
+// being dropped, and a lookup that misses memory loads them back, so
+// previous_response_id and conversation ids keep resolving past the memory
+// limits. Spilled data keeps the in-memory TTLs; expired files are removed by
+// the cleanup sweep. Files are plaintext JSON holding conversation context
+// (mode 0600 in a 0700 directory), so dir should be private to this process.
+// It must be called before the store is shared: lookups read the directory
+// without locking, so it cannot change afterwards.
+func (s *Store) SetSpillDir(dir string) error {
+	for _, sub := range []string{spillResponsesDir, spillConversationsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.spillDir = dir
+	s.mu.Unlock()
+	return nil
+}
+
+func spillPath(dir, sub, id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(dir, sub, hex.EncodeToString(sum[:16])+".json")
+}
+
+// loadSpilled promotes a spilled response entry back into memory when it is
+// not held there. File I/O runs under spillMu only, never under s.mu.
+func (s *Store) loadSpilled(responseID string) {
+	dir := s.spillDir
+	if dir == "" || responseID == "" {
+		return
+	}
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	s.mu.Lock()
+	_, inMemory := s.entries[responseID]
+	if inMemory {
+		s.mu.Unlock()
+		return
+	}
+	if e, ok := s.pending.entries[responseID]; ok {
+		delete(s.pending.entries, responseID)
+		if s.now().Sub(e.lastAccess) <= s.ttl {
+			s.restoreEntryLocked(responseID, e)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	path := spillPath(dir, spillResponsesDir, responseID)
+	var se spilledEntry
+	if !readSpill(path, &se) {
+		return
+	}
+	s.mu.Lock()
+	_, inMemory = s.entries[responseID]
+	restored := !inMemory && s.now().Sub(se.LastAccess) <= s.ttl
+	if restored {
+		s.restoreEntryLocked(responseID, &entry{
+			calls:        buildCallMap(se.Calls),
+			context:      se.Context,
+			instructions: se.Instructions,
+			metadata:     se.Metadata,
+			output:       se.Output,
+			stored:       se.Stored,
+			storedAt:     se.StoredAt,
+			lastAccess:   se.LastAccess,
+		})
+	}
+	s.mu.Unlock()
+	if restored {
+		removeSpill(path)
+	}
+}
+
+// loadSpilledLink is loadSpilled for conversation links.
+func (s *Store) loadSpilledLink(conversationID string) {
+	dir := s.spillDir
+	if dir == "" || conversationID == "" {
+		return
+	}
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	s.mu.Lock()
+	_, inMemory := s.conv[conversationID]
+	if inMemory {
+		s.mu.Unlock()
+		return
+	}
+	if link, ok := s.pending.links[conversationID]; ok {
+		delete(s.pending.links, conversationID)
+		if s.now().Sub(link.lastAccess) <= s.convTTL {
+			s.restoreLinkLocked(conversationID, link)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	path := spillPath(dir, spillConversationsDir, conversationID)
+	var sl spilledLink
+	if !readSpill(path, &sl) {
+		return
+	}
+	s.mu.Lock()
+	_, inMemory = s.conv[conversationID]
+	restored := !inMemory && s.now().Sub(sl.LastAccess) <= s.convTTL
+	if restored {
+		s.restoreLinkLocked(conversationID, &conversationLink{responseID: sl.ResponseID, lastAccess: sl.LastAccess})
+	}
+	s.mu.Unlock()
+	if restored {
+		removeSpill(path)
+	}
+}
+
+func (s *Store) restoreEntryLocked(responseID string, e *entry) {
+	s.entries[responseID] = e
+	s.touchLRU(responseID, false, e)
+	s.evictIfNeededLocked()
+}
+
+func (s *Store) restoreLinkLocked(conversationID string, link *conversationLink) {
+	s.conv[conversationID] = link
+	s.touchConvLRU(conversationID, link)
+	s.evictIfNeededLocked()
+}
+
+// queueSpillLocked records capacity victims for flushSpill.
+func (s *Store) queueSpillLocked(id string, e *entry, link *conversationLink) {
+	if e != nil {
+		if s.pending.entries == nil {
+			s.pending.entries = make(map[string]*entry)
+		}
+		s.pending.entries[id] = e
+	}
+	if link != nil {
+		if s.pending.links == nil {
+			s.pending.links = make(map[string]*conversationLink)
+		}
+		s.pending.links[id] = link
+	}
+}
+
+// flushSpill writes queued capacity victims to the spill directory. Callers
+// must not hold s.mu. Victims are no longer reachable from the store's maps,
+// so they are read here without s.mu.
+func (s *Store) flushSpill() {
+	dir := s.spillDir
+	if dir == "" {
+		return
+	}
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = pendingSpill{}
+	s.mu.Unlock()
+	for id, e := range pending.entries {
+		calls := make([]FunctionCall, 0, len(e.calls))
+		for _, c := range e.calls {
+			calls = append(calls, c)
+		}
+		writeSpill(spillPath(dir, spillResponsesDir, id), spilledEntry{
+			Calls:        calls,
+			Context:      e.context,
+			Instructions: e.instructions,
+			Metadata:     e.metadata,
+			Output:       e.output,
+			Stored:       e.stored,
+			StoredAt:     e.storedAt,
+			LastAccess:   e.lastAccess,
+		}, e.lastAccess)
+	}
+	for id, link := range pending.links {
+		writeSpill(spillPath(dir, spillConversationsDir, id), spilledLink{
+			ResponseID: link.responseID,
+			LastAccess: link.lastAccess,
+		}, link.lastAccess)
+	}
+}
+
+// writeSpill stores v at path with lastAccess as its modification time, which
+// the cleanup sweep compares against the TTL.
+func writeSpill(path string, v any, lastAccess time.Time) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = os.WriteFile(path, data, 0o600)
+	}
+	if err == nil {
+		err = os.Chtimes(path, lastAccess, lastAccess)
+	}
+	if err != nil {
+		slog.Warn("state.spill.write_failed", "path", path, "error", err)
+	}
+}
+
+// readSpill loads the spill file at path. The file is kept until the caller
+// has restored its contents (removeSpill), so a failed restore loses nothing.
+func readSpill(path string, v any) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		slog.Warn("state.spill.read_failed", "path", path, "error", err)
+		return false
+	}
+	return true
+}
+
+// removeSpill deletes a spill file whose contents were promoted back into
+// memory, which then holds the only copy.
+func removeSpill(path string) {
+	os.Remove(path) //nolint:errcheck // a leftover file expires with the TTL
+}
+
+// sweepSpill removes spill files whose last access is older than their TTL.
+func sweepSpill(dir string, now time.Time, ttl, convTTL time.Duration) {
+	for sub, maxAge := range map[string]time.Duration{spillResponsesDir: ttl, spillConversationsDir: convTTL} {
+		files, err := os.ReadDir(filepath.Join(dir, sub))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil || now.Sub(info.ModTime()) <= maxAge {
+				continue
+			}
+			os.Remove(filepath.Join(dir, sub, f.Name())) //nolint:errcheck
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"maps"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,7 +14,12 @@ import (
 const (
 	DefaultTTL      = 60 * time.Minute
 	DefaultCapacity = 10000
-	cleanupTick     = 30 * time.Second
+	// DefaultConversationCapacity bounds conversation links separately from
+	// response entries so throwaway conversation ids cannot evict tool-loop state.
+	DefaultConversationCapacity = 10000
+	DefaultSweepInterval        = 30 * time.Second
+	// MinSweepInterval bounds how often the cleanup loop may wake up.
+	MinSweepInterval = 100 * time.Millisecond
 )
 
 // FunctionCall stores a function_call item so it can be replayed in a future request.
@@ -32,6 +38,10 @@ type entry struct {
 	calls        map[string]FunctionCall
 	context      []types.ResponsesInputItem
 	instructions string
+	metadata     map[string]string
+	output       []types.ResponsesInputItem // the response's own items, for GET /v1/responses/{id}
+	stored       bool                       // PutOutput ran: the client sent store:true
+	storedAt     time.Time                  // last write, unlike lastAccess which reads also bump
 	lastAccess   time.Time
 	listElem     *list.Element
 }
@@ -47,27 +57,57 @@ type Store struct {
 	mu       sync.Mutex
 	entries  map[string]*entry
 	conv     map[string]*conversationLink
-	lru      *list.List
+	lru      *list.List // response entries, most recently used first
+	convLRU  *list.List // conversation links, most recently used first
 	ttl      time.Duration
+	convTTL  time.Duration
 	capacity int
+	convCap  int
+	sweep    time.Duration
+	now      func() time.Time
+	spillDir string     // disk tier for capacity evictions; see SetSpillDir
+	spillMu  sync.Mutex // serializes spill file I/O; taken before mu, never under it
+	pending  pendingSpill
 	stopCh   chan struct{}
 	done     chan struct{}
 }
 
 // NewStore creates an in-memory state store with TTL and capacity limits.
-func NewStore(ttl time.Duration, capacity int) *Store {
+// Response entries and conversation links are bounded by separate capacities.
+// Expired entries are swept every sweepInterval (DefaultSweepInterval when
+// zero, never more often than MinSweepInterval). Conversation links expire
+// after convTTL, which defaults to ttl when zero; a longer value keeps the
+// link around so a resumed conversation can report that its context expired.
+func NewStore(ttl time.Duration, capacity, convCapacity int, sweepInterval, convTTL time.Duration) *Store {
 	if ttl <= 0 {
 		ttl = DefaultTTL
 	}
+	if convTTL <= 0 {
+		convTTL = ttl
+	}
 	if capacity <= 0 {
 		capacity = DefaultCapacity
 	}
+	if convCapacity <= 0 {
+		convCapacity = DefaultConversationCapacity
+	}
+	if sweepInterval <= 0 {
+		sweepInterval = DefaultSweepInterval
+	}
+	if sweepInterval < MinSweepInterval {
+		sweepInterval = MinSweepInterval
+	}
 	s := &Store{
 		entries:  make(map[string]*entry),
 		conv:     make(map[string]*conversationLink),
 		lru:      list.New(),
+		convLRU:  list.New(),
 		ttl:      ttl,
+		convTTL:  convTTL,
 		capacity: capacity,
+		convCap:  convCapacity,
+		sweep:    sweepInterval,
+		now:      time.Now,
 		stopCh:   make(chan struct{}),
 		done:     make(chan struct{}),
 	}
@@ -83,15 +123,18 @@ func (s *Store) Close() {
 
 func (s *Store) cleanupLoop() {
 	defer close(s.done)
-	ticker := time.NewTicker(cleanupTick)
+	ticker := time.NewTicker(s.sweep)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			now := time.Now()
 			s.mu.Lock()
+			now, spillDir := s.now(), s.spillDir
 			s.cleanupExpiredLocked(now)
 			s.mu.Unlock()
+			if spillDir != "" {
+				sweepSpill(spillDir, now, s.ttl, s.convTTL)
+			}
 		case <-s.stopCh:
 			return
 		}
@@ -107,8 +150,10 @@ func (s *Store) Put(responseID string, calls []FunctionCall) {
 	if len(callMap) == 0 {
 		return
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	s.putCallsLocked(responseID, callMap, now)
 	s.evictIfNeededLocked()
@@ -120,8 +165,10 @@ func (s *Store) PutContext(responseID string, context []types.ResponsesInputItem
 		return
 	}
 	ctxCopy := types.CloneInputItems(context)
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	s.putContextLocked(responseID, ctxCopy, now)
 	s.evictIfNeededLocked()
@@ -137,8 +184,10 @@ func (s *Store) PutSnapshot(responseID string, context []types.ResponsesInputIte
 	if len(ctxCopy) == 0 && len(callMap) == 0 {
 		return
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	if len(ctxCopy) > 0 {
 		s.putContextLocked(responseID, ctxCopy, now)
@@ -154,8 +203,10 @@ func (s *Store) PutInstructions(responseID string, instructions string) {
 	if responseID == "" {
 		return
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	e, ok := s.entries[responseID]
 	if !ok {
@@ -163,18 +214,113 @@ func (s *Store) PutInstructions(responseID string, instructions string) {
 		s.entries[responseID] = e
 	}
 	e.instructions = instructions
+	e.storedAt = now
+	e.lastAccess = now
+	s.touchLRU(responseID, false, e)
+	s.evictIfNeededLocked()
+}
+
+// PutMetadata saves the client's request metadata for a response id so
+// ListByMetadata can find it. Empty metadata is not stored.
+func (s *Store) PutMetadata(responseID string, metadata map[string]string) {
+	if responseID == "" || len(metadata) == 0 {
+		return
+	}
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
+	s.mu.Lock()
+	now := s.now()
+	defer s.mu.Unlock()
+	e, ok := s.entries[responseID]
+	if !ok {
+		e = &entry{}
+		s.entries[responseID] = e
+	}
+	e.metadata = maps.Clone(metadata)
+	e.storedAt = now
+	e.lastAccess = now
+	s.touchLRU(responseID, false, e)
+	s.evictIfNeededLocked()
+}
+
+// PutOutput saves the output items of a response id and marks it stored, so
+// the response can be returned again without its input context. Callers use
+// it only for responses the client asked to store (store:true).
+func (s *Store) PutOutput(responseID string, output []types.ResponsesInputItem) {
+	if responseID == "" {
+		return
+	}
+	outCopy := types.CloneInputItems(output)
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
+	s.mu.Lock()
+	now := s.now()
+	defer s.mu.Unlock()
+	e, ok := s.entries[responseID]
+	if !ok {
+		e = &entry{}
+		s.entries[responseID] = e
+	}
+	e.output = outCopy
+	e.stored = true
+	e.storedAt = now
 	e.lastAccess = now
 	s.touchLRU(responseID, false, e)
 	s.evictIfNeededLocked()
 }
 
+// Listing is a stored response as reported by ListByMetadata.
+type Listing struct {
+	ResponseID string
+	StoredAt   time.Time
+	Metadata   map[string]string
+}
+
+// ListByMetadata returns the stored responses whose metadata contains every
+// key/value pair of filter, newest first. Only responses the client asked to
+// store (PutOutput) are listed; an empty filter matches every one of them.
+// Like Inspect it does not refresh TTL or LRU position. Entries past their
+// TTL that the sweep has not removed yet are skipped, and so are entries
+// spilled to disk (--state-spill-dir): listing does not scan the spill
+// directory.
+func (s *Store) ListByMetadata(filter map[string]string) []Listing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var out []Listing
+	for id, e := range s.entries {
+		if !e.stored || now.Sub(e.lastAccess) > s.ttl || !metadataMatches(e.metadata, filter) {
+			continue
+		}
+		out = append(out, Listing{ResponseID: id, StoredAt: e.storedAt, Metadata: maps.Clone(e.metadata)})
+	}
+	slices.SortFunc(out, func(a, b Listing) int {
+		if c := b.StoredAt.Compare(a.StoredAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ResponseID, b.ResponseID)
+	})
+	return out
+}
+
+func metadataMatches(metadata, filter map[string]string) bool {
+	for k, v := range filter {
+		if got, ok := metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
 // Get returns stored function calls for a response id.
 func (s *Store) Get(responseID string) ([]FunctionCall, bool) {
 	if responseID == "" {
 		return nil, false
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	e, ok := s.entries[responseID]
 	if !ok {
@@ -196,8 +342,10 @@ func (s *Store) GetContext(responseID string) ([]types.ResponsesInputItem, bool)
 	if responseID == "" {
 		return nil, false
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	e, ok := s.entries[responseID]
 	if !ok {
@@ -213,8 +361,10 @@ func (s *Store) GetInstructions(responseID string) (string, bool) {
 	if responseID == "" {
 		return "", false
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	e, ok := s.entries[responseID]
 	if !ok {
@@ -230,8 +380,10 @@ func (s *Store) Exists(responseID string) bool {
 	if responseID == "" {
 		return false
 	}
-	now := time.Now()
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	if e, ok := s.entries[responseID]; ok {
 		e.lastAccess = now
@@ -246,8 +398,10 @@ func (s *Store) PutConversationLatest(conversationID, responseID string) {
 	if conversationID == "" || responseID == "" {
 		return
 	}
-	now := time.Now()
+	s.loadSpilledLink(conversationID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	link, ok := s.conv[conversationID]
 	if !ok {
@@ -265,8 +419,10 @@ func (s *Store) GetConversationLatest(conversationID string) (string, bool) {
 	if conversationID == "" {
 		return "", false
 	}
-	now := time.Now()
+	s.loadSpilledLink(conversationID)
+	defer s.flushSpill()
 	s.mu.Lock()
+	now := s.now()
 	defer s.mu.Unlock()
 	link, ok := s.conv[conversationID]
 	if !ok || link.responseID == "" {
@@ -277,6 +433,103 @@ func (s *Store) GetConversationLatest(conversationID string) (string, bool) {
 	return link.responseID, true
 }
 
+// ResolveConversation returns the latest response id linked to a conversation
+// id. expired reports that the link outlived its response entry, or that the
+// entry was stored more than maxAge ago (when maxAge is positive), so the
+// conversation can only continue with a fresh context.
+func (s *Store) ResolveConversation(conversationID string, maxAge time.Duration) (responseID string, expired bool) {
+	if conversationID == "" {
+		return "", false
+	}
+	s.loadSpilledLink(conversationID)
+	s.mu.Lock()
+	var linked string
+	if link, ok := s.conv[conversationID]; ok {
+		linked = link.responseID
+	}
+	s.mu.Unlock()
+	s.loadSpilled(linked)
+	defer s.flushSpill()
+	s.mu.Lock()
+	now := s.now()
+	defer s.mu.Unlock()
+	link, ok := s.conv[conversationID]
+	if !ok || link.responseID == "" {
+		return "", false
+	}
+	link.lastAccess = now
+	s.touchConvLRU(conversationID, link)
+	e, ok := s.entries[link.responseID]
+	if !ok || now.Sub(e.lastAccess) > s.ttl {
+		return link.responseID, true
+	}
+	if maxAge > 0 && now.Sub(e.storedAt) > maxAge {
+		return link.responseID, true
+	}
+	return link.responseID, false
+}
+
+// Inspection is a read-only deep copy of a stored response entry.
+type Inspection struct {
+	Context      []types.ResponsesInputItem
+	Output       []types.ResponsesInputItem
+	Stored       bool // the client sent store:true; see PutOutput
+	Calls        []FunctionCall
+	Instructions string
+	Metadata     map[string]string
+	StoredAt     time.Time
+	LastAccess   time.Time
+}
+
+// Inspect returns a deep copy of the entry stored for a response id.
+// Unlike Get/GetContext it does not refresh the entry's TTL or LRU position;
+// a spilled entry is loaded back into memory like any other lookup.
+func (s *Store) Inspect(responseID string) (Inspection, bool) {
+	if responseID == "" {
+		return Inspection{}, false
+	}
+	s.loadSpilled(responseID)
+	defer s.flushSpill()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[responseID]
+	if !ok {
+		return Inspection{}, false
+	}
+	keys := slices.Sorted(maps.Keys(e.calls))
+	calls := make([]FunctionCall, 0, len(keys))
+	for _, id := range keys {
+		calls = append(calls, e.calls[id])
+	}
+	return Inspection{
+		Context:      types.CloneInputItems(e.context),
+		Output:       types.CloneInputItems(e.output),
+		Stored:       e.stored,
+		Calls:        calls,
+		Instructions: e.instructions,
+		Metadata:     maps.Clone(e.metadata),
+		StoredAt:     e.storedAt,
+		LastAccess:   e.lastAccess,
+	}, true
+}
+
+// InspectConversation returns the latest response id mapped to a conversation id
+// without refreshing the link's TTL or LRU position.
+func (s *Store) InspectConversation(conversationID string) (string, time.Time, bool) {
+	if conversationID == "" {
+		return "", time.Time{}, false
+	}
+	s.loadSpilledLink(conversationID)
+	defer s.flushSpill()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.conv[conversationID]
+	if !ok || link.responseID == "" {
+		return "", time.Time{}, false
+	}
+	return link.responseID, link.lastAccess, true
+}
+
 // Len returns current entry count (for tests).
 func (s *Store) Len() int {
 	s.mu.Lock()
@@ -302,6 +555,7 @@ func (s *Store) putCallsLocked(responseID string, callMap map[string]FunctionCal
 		s.entries[responseID] = e
 	}
 	e.calls = callMap
+	e.storedAt = now
 	e.lastAccess = now
 	s.touchLRU(responseID, false, e)
 }
@@ -313,6 +567,7 @@ func (s *Store) putContextLocked(responseID string, ctxCopy []types.ResponsesInp
 		s.entries[responseID] = e
 	}
 	e.context = ctxCopy
+	e.storedAt = now
 	e.lastAccess = now
 	s.touchLRU(responseID, false, e)
 }
@@ -327,9 +582,9 @@ func (s *Store) touchLRU(id string, isConv bool, e *entry) {
 
 func (s *Store) touchConvLRU(id string, link *conversationLink) {
 	if link.listElem != nil {
-		s.lru.MoveToFront(link.listElem)
+		s.convLRU.MoveToFront(link.listElem)
 	} else {
-		link.listElem = s.lru.PushFront(lruKey{id: id, isConv: true})
+		link.listElem = s.convLRU.PushFront(lruKey{id: id, isConv: true})
 	}
 }
 
@@ -343,9 +598,9 @@ func (s *Store) cleanupExpiredLocked(now time.Time) {
 		}
 	}
 	for conversationID, c := range s.conv {
-		if now.Sub(c.lastAccess) > s.ttl {
+		if now.Sub(c.lastAccess) > s.convTTL {
 			if c.listElem != nil {
-				s.lru.Remove(c.listElem)
+				s.convLRU.Remove(c.listElem)
 			}
 			delete(s.conv, conversationID)
 		}
@@ -353,24 +608,34 @@ func (s *Store) cleanupExpiredLocked(now time.Time) {
 }
 
 func (s *Store) evictIfNeededLocked() {
-	for len(s.entries)+len(s.conv) > s.capacity {
+	for len(s.entries) > s.capacity {
 		back := s.lru.Back()
 		if back == nil {
-			return
+			break
 		}
 		key := back.Value.(lruKey)
 		s.lru.Remove(back)
-		if key.isConv {
-			if link, ok := s.conv[key.id]; ok {
-				link.listElem = nil
-				delete(s.conv, key.id)
+		if e, ok := s.entries[key.id]; ok {
+			if s.spillDir != "" {
+				s.queueSpillLocked(key.id, e, nil)
 			}
-		} else {
-			if e, ok := s.entries[key.id]; ok {
-				e.listElem = nil
-				delete(s.entries, key.id)
+			e.listElem = nil
+			delete(s.entries, key.id)
+		}
+	}
+	for len(s.conv) > s.convCap {
+		back := s.convLRU.Back()
+		if back == nil {
+			return
+		}
+		key := back.Value.(lruKey)
+		s.convLRU.Remove(back)
+		if link, ok := s.conv[key.id]; ok {
+			if s.spillDir != "" {
+				s.queueSpillLocked(key.id, nil, link)
 			}
+			link.listElem = nil
+			delete(s.conv, key.id)
 		}
 	}
 }
-
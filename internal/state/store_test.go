@@ -0,0 +1,313 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// fakeClock is a manually advanced time source for the store.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestStore(t *testing.T, ttl, sweep time.Duration) (*Store, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewStore(ttl, 0, 0, sweep, 0)
+	s.mu.Lock()
+	s.now = clock.Now
+	s.mu.Unlock()
+	t.Cleanup(s.Close)
+	return s, clock
+}
+
+func TestNewStoreClampsSweepInterval(t *testing.T) {
+	for _, tc := range []struct {
+		in, want time.Duration
+	}{
+		{0, DefaultSweepInterval},
+		{-time.Second, DefaultSweepInterval},
+		{time.Millisecond, MinSweepInterval},
+		{5 * time.Second, 5 * time.Second},
+	} {
+		s := NewStore(0, 0, 0, tc.in, 0)
+		if s.sweep != tc.want {
+			t.Errorf("NewStore(sweep=%v): got %v, want %v", tc.in, s.sweep, tc.want)
+		}
+		s.Close()
+	}
+}
+
+func TestCleanupLoopSweepsOnConfiguredInterval(t *testing.T) {
+	s, clock := newTestStore(t, time.Minute, MinSweepInterval)
+	s.PutInstructions("resp_old", "x")
+	s.PutConversationLatest("conv_old", "resp_old")
+
+	// Nothing has expired yet, so a few sweeps must leave the entries alone.
+	time.Sleep(3 * MinSweepInterval)
+	if got := s.Len(); got != 1 {
+		t.Fatalf("before expiry: got %d entries, want 1", got)
+	}
+
+	clock.Advance(2 * time.Minute)
+	s.PutInstructions("resp_new", "y")
+
+	deadline := time.Now().Add(20 * MinSweepInterval)
+	for s.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(MinSweepInterval / 4)
+	}
+	if got := s.Len(); got != 1 {
+		t.Fatalf("after expiry: got %d entries, want 1", got)
+	}
+	if _, _, ok := s.InspectConversation("conv_old"); ok {
+		t.Error("expired conversation link should be swept")
+	}
+	if _, ok := s.Inspect("resp_new"); !ok {
+		t.Error("fresh entry should survive the sweep")
+	}
+}
+
+func TestConversationLinksDoNotEvictResponseEntries(t *testing.T) {
+	s := NewStore(time.Hour, 4, 2, 0, 0)
+	t.Cleanup(s.Close)
+	for _, id := range []string{"resp_a", "resp_b"} {
+		s.PutSnapshot(id, nil, []FunctionCall{{CallID: "call_" + id, Name: "lookup"}})
+	}
+
+	for i := range 100 {
+		s.PutConversationLatest(fmt.Sprintf("conv_%d", i), "resp_a")
+	}
+
+	for _, id := range []string{"resp_a", "resp_b"} {
+		if _, ok := s.Get(id); !ok {
+			t.Errorf("%s was evicted by throwaway conversation links", id)
+		}
+	}
+	s.mu.Lock()
+	convLen := len(s.conv)
+	s.mu.Unlock()
+	if got := convLen; got != 2 {
+		t.Errorf("conversation links: got %d, want capacity 2", got)
+	}
+	if _, ok := s.GetConversationLatest("conv_99"); !ok {
+		t.Error("most recent conversation link should be kept")
+	}
+	if _, ok := s.GetConversationLatest("conv_0"); ok {
+		t.Error("oldest conversation link should be evicted")
+	}
+}
+
+func TestConversationLinkOutlivesExpiredEntry(t *testing.T) {
+	s, clock := newTestStore(t, time.Minute, 0)
+	s.mu.Lock()
+	s.convTTL = time.Hour
+	s.mu.Unlock()
+	s.PutContext("resp_1", nil)
+	s.PutConversationLatest("conv_1", "resp_1")
+
+	if id, expired := s.ResolveConversation("conv_1", 0); id != "resp_1" || expired {
+		t.Fatalf("fresh link: got (%q, %v), want (resp_1, false)", id, expired)
+	}
+
+	clock.Advance(10 * time.Minute)
+	if id, expired := s.ResolveConversation("conv_1", 0); id != "resp_1" || !expired {
+		t.Errorf("entry past TTL: got (%q, %v), want (resp_1, true)", id, expired)
+	}
+
+	s.mu.Lock()
+	s.cleanupExpiredLocked(s.now())
+	s.mu.Unlock()
+	if _, ok := s.Inspect("resp_1"); ok {
+		t.Error("response entry should be swept after its TTL")
+	}
+	if id, expired := s.ResolveConversation("conv_1", 0); id != "resp_1" || !expired {
+		t.Errorf("after sweep: got (%q, %v), want the link to survive as expired", id, expired)
+	}
+
+	clock.Advance(2 * time.Hour)
+	s.mu.Lock()
+	s.cleanupExpiredLocked(s.now())
+	s.mu.Unlock()
+	if id, expired := s.ResolveConversation("conv_1", 0); id != "" || expired {
+		t.Errorf("past conversation TTL: got (%q, %v), want the link gone", id, expired)
+	}
+}
+
+func TestResolveConversationDeclinesAgedEntry(t *testing.T) {
+	s, clock := newTestStore(t, time.Hour, 0)
+	s.PutContext("resp_1", nil)
+	s.PutConversationLatest("conv_1", "resp_1")
+
+	clock.Advance(10 * time.Minute)
+	if id, expired := s.ResolveConversation("conv_1", 15*time.Minute); id != "resp_1" || expired {
+		t.Fatalf("young entry: got (%q, %v), want (resp_1, false)", id, expired)
+	}
+
+	// Reads keep the entry alive but do not make it younger.
+	clock.Advance(10 * time.Minute)
+	if _, ok := s.GetContext("resp_1"); !ok {
+		t.Fatal("entry should still be stored before its TTL")
+	}
+	if id, expired := s.ResolveConversation("conv_1", 15*time.Minute); id != "resp_1" || !expired {
+		t.Errorf("aged but unexpired entry: got (%q, %v), want (resp_1, true)", id, expired)
+	}
+	if _, expired := s.ResolveConversation("conv_1", 0); expired {
+		t.Error("without a max age the unexpired entry should still link")
+	}
+
+	s.PutContext("resp_2", nil)
+	s.PutConversationLatest("conv_1", "resp_2")
+	if id, expired := s.ResolveConversation("conv_1", 15*time.Minute); id != "resp_2" || expired {
+		t.Errorf("new turn: got (%q, %v), want (resp_2, false)", id, expired)
+	}
+}
+
+func TestListByMetadataSkipsExpiredEntries(t *testing.T) {
+	s, clock := newTestStore(t, time.Minute, time.Hour)
+	s.PutMetadata("resp_old", map[string]string{"team": "a"})
+	s.PutOutput("resp_old", nil)
+	clock.Advance(30 * time.Second)
+	s.PutMetadata("resp_new", map[string]string{"team": "a"})
+	s.PutOutput("resp_new", nil)
+	s.PutMetadata("resp_other", map[string]string{"team": "b"})
+	s.PutOutput("resp_other", nil)
+	s.PutMetadata("resp_unstored", map[string]string{"team": "a"})
+
+	got := s.ListByMetadata(map[string]string{"team": "a"})
+	if len(got) != 2 || got[0].ResponseID != "resp_new" || got[1].ResponseID != "resp_old" {
+		t.Fatalf("ListByMetadata(team=a) = %+v; want resp_new then resp_old", got)
+	}
+
+	// resp_old is past its TTL, but the hourly sweep has not removed it.
+	clock.Advance(45 * time.Second)
+	got = s.ListByMetadata(map[string]string{"team": "a"})
+	if len(got) != 1 || got[0].ResponseID != "resp_new" {
+		t.Errorf("ListByMetadata(team=a) after resp_old expired = %+v; want only resp_new", got)
+	}
+	if n := s.Len(); n != 4 {
+		t.Errorf("the expired entry should still await the sweep, Len() = %d", n)
+	}
+}
+
+func TestSpillDirRestoresEvictedEntries(t *testing.T) {
+	s := NewStore(time.Hour, 1, 1, 0, 0)
+	t.Cleanup(s.Close)
+	if err := s.SetSpillDir(t.TempDir()); err != nil {
+		t.Fatalf("SetSpillDir: %v", err)
+	}
+	first := []types.ResponsesInputItem{{Type: "message", Role: "user", Content: []types.ResponsesContent{{Type: "input_text", Text: "first"}}}}
+	s.PutSnapshot("resp_a", first, []FunctionCall{{CallID: "call_a", Name: "lookup"}})
+	s.PutConversationLatest("conv_a", "resp_a")
+	s.PutSnapshot("resp_b", nil, []FunctionCall{{CallID: "call_b", Name: "lookup"}})
+	s.PutConversationLatest("conv_b", "resp_b")
+
+	s.mu.Lock()
+	_, inMemory := s.entries["resp_a"]
+	s.mu.Unlock()
+	if inMemory {
+		t.Fatal("resp_a should have been evicted from memory")
+	}
+
+	ctx, ok := s.GetContext("resp_a")
+	if !ok || len(ctx) != 1 || ctx[0].Content[0].Text != "first" {
+		t.Fatalf("GetContext(resp_a) = %v, %v; want the spilled context", ctx, ok)
+	}
+	if calls, ok := s.Get("resp_a"); !ok || len(calls) != 1 || calls[0].CallID != "call_a" {
+		t.Errorf("Get(resp_a) = %v, %v; want the spilled call", calls, ok)
+	}
+	if _, ok := s.Get("resp_b"); !ok {
+		t.Error("resp_b should load back after being spilled by the promotion of resp_a")
+	}
+	if id, ok := s.GetConversationLatest("conv_a"); !ok || id != "resp_a" {
+		t.Errorf("GetConversationLatest(conv_a) = %q, %v; want resp_a", id, ok)
+	}
+}
+
+func TestSpillDirInspectLoadsSpilledEntry(t *testing.T) {
+	s := NewStore(time.Hour, 1, 1, 0, 0)
+	t.Cleanup(s.Close)
+	dir := t.TempDir()
+	if err := s.SetSpillDir(dir); err != nil {
+		t.Fatalf("SetSpillDir: %v", err)
+	}
+	s.PutSnapshot("resp_a", nil, []FunctionCall{{CallID: "call_a", Name: "lookup"}})
+	s.PutConversationLatest("conv_a", "resp_a")
+	s.PutSnapshot("resp_b", nil, []FunctionCall{{CallID: "call_b", Name: "lookup"}})
+	s.PutConversationLatest("conv_b", "resp_b")
+	path := spillPath(dir, spillResponsesDir, "resp_a")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("resp_a should have been spilled: %v", err)
+	}
+
+	if got, ok := s.Inspect("resp_a"); !ok || len(got.Calls) != 1 || got.Calls[0].CallID != "call_a" {
+		t.Errorf("Inspect(resp_a) = %+v, %v; want the spilled entry", got, ok)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("the spill file should be removed once restored, stat err = %v", err)
+	}
+	if id, _, ok := s.InspectConversation("conv_a"); !ok || id != "resp_a" {
+		t.Errorf("InspectConversation(conv_a) = %q, %v; want resp_a", id, ok)
+	}
+}
+
+func TestSpillDirQueuedVictimStaysReachable(t *testing.T) {
+	s := NewStore(time.Hour, 1, 1, 0, 0)
+	t.Cleanup(s.Close)
+	dir := t.TempDir()
+	if err := s.SetSpillDir(dir); err != nil {
+		t.Fatalf("SetSpillDir: %v", err)
+	}
+	s.PutSnapshot("resp_a", nil, []FunctionCall{{CallID: "call_a", Name: "lookup"}})
+
+	// Evict under the lock as a Put does, but before flushSpill runs.
+	s.mu.Lock()
+	s.entries["resp_b"] = &entry{lastAccess: s.now()}
+	s.touchLRU("resp_b", false, s.entries["resp_b"])
+	s.evictIfNeededLocked()
+	s.mu.Unlock()
+	if _, err := os.Stat(spillPath(dir, spillResponsesDir, "resp_a")); !os.IsNotExist(err) {
+		t.Fatalf("eviction should only queue the write, stat err = %v", err)
+	}
+
+	if calls, ok := s.Get("resp_a"); !ok || len(calls) != 1 || calls[0].CallID != "call_a" {
+		t.Errorf("Get(resp_a) = %v, %v; want the queued victim", calls, ok)
+	}
+	if _, err := os.Stat(spillPath(dir, spillResponsesDir, "resp_b")); err != nil {
+		t.Errorf("promoting resp_a should flush the evicted resp_b to disk: %v", err)
+	}
+}
+
+func TestSpillDirHonoursTTL(t *testing.T) {
+	s, clock := newTestStore(t, time.Minute, time.Hour)
+	s.mu.Lock()
+	s.capacity = 1
+	s.mu.Unlock()
+	if err := s.SetSpillDir(t.TempDir()); err != nil {
+		t.Fatalf("SetSpillDir: %v", err)
+	}
+	s.PutSnapshot("resp_a", nil, []FunctionCall{{CallID: "call_a", Name: "lookup"}})
+	s.PutSnapshot("resp_b", nil, []FunctionCall{{CallID: "call_b", Name: "lookup"}})
+
+	clock.Advance(2 * time.Minute)
+	if _, ok := s.Get("resp_a"); ok {
+		t.Error("a spilled entry past its TTL should not load back")
+	}
+}
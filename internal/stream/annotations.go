@@ -0,0 +1,57 @@
+package stream
+
+// Annotations gathers output_text annotations (web search citations) from a
+// stream. response.output_text.annotation.added events are taken as they
+// arrive; the annotations on a finished message item are only used when the
+// stream sent no such events, so each citation is reported once.
+type Annotations struct {
+	List      []map[string]any
+	sawEvents bool
+}
+
+// Observe records the annotations carried by evt and returns the ones it
+// added, in order.
+func (a *Annotations) Observe(evt *Event) []map[string]any {
+	switch evt.Type {
+	case "response.output_text.annotation.added":
+		ann, ok := evt.Data["annotation"].(map[string]any)
+		if !ok {
+			return nil
+		}
+		a.sawEvents = true
+		a.List = append(a.List, ann)
+		return []map[string]any{ann}
+	case "response.output_item.done":
+		if a.sawEvents {
+			return nil
+		}
+		item, _ := evt.Data["item"].(map[string]any)
+		added := AnnotationsFromOutputItem(item)
+		a.List = append(a.List, added...)
+		return added
+	}
+	return nil
+}
+
+// AnnotationsFromOutputItem returns the annotations on the output_text parts
+// of a message output item.
+func AnnotationsFromOutputItem(item map[string]any) []map[string]any {
+	if itemType, _ := item["type"].(string); itemType != "message" {
+		return nil
+	}
+	content, _ := item["content"].([]any)
+	var out []map[string]any
+	for _, part := range content {
+		p, _ := part.(map[string]any)
+		if partType, _ := p["type"].(string); partType != "output_text" {
+			continue
+		}
+		anns, _ := p["annotations"].([]any)
+		for _, v := range anns {
+			if ann, ok := v.(map[string]any); ok {
+				out = append(out, ann)
+			}
+		}
+	}
+	return out
+}
@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"errors"
 	"io"
 	"strings"
 
@@ -14,6 +15,10 @@ type CollectOptions struct {
 	CollectReasoning  bool
 	CollectToolCalls  bool
 	StopOnFailed      bool
+	CollectLogprobs   bool
+	MaxToolCalls      int // see Reader.LimitToolCalls
+	MaxOutputTokens   int // see Reader.LimitOutputTokens
+	MaxEventSize      int // see NewReaderSize
 }
 
 // CollectedText holds the result of collecting a text response from SSE.
@@ -23,8 +28,11 @@ type CollectedText struct {
 	ReasoningSummary string
 	ReasoningFull    string
 	ToolCalls        []types.ToolCall
+	Annotations      []map[string]any
 	Usage            *types.Usage
+	Logprobs         []types.TokenLogprob
 	ErrorMessage     string
+	IncompleteReason string
 }
 
 // CollectTextFromSSE reads an upstream SSE stream and assembles text, tool calls,
@@ -35,13 +43,23 @@ func CollectTextFromSSE(body io.ReadCloser, opts CollectOptions) CollectedText {
 	out := CollectedText{
 		ResponseID: opts.InitialResponseID,
 	}
-	reader := NewReader(body)
+	reader := NewReaderSize(body, opts.MaxEventSize)
+	reader.LimitToolCalls(opts.MaxToolCalls)
+	reader.LimitOutputTokens(opts.MaxOutputTokens)
+	var annotations Annotations
 
 	for {
 		evt, err := reader.Next()
 		if err != nil {
+			switch {
+			case errors.Is(err, ErrOutputTokenLimit):
+				out.IncompleteReason = IncompleteMaxOutputTokens
+			case errors.Is(err, ErrIdleTimeout):
+				out.IncompleteReason = IncompleteIdleTimeout
+			}
 			break
 		}
+		out.Annotations = append(out.Annotations, annotations.Observe(evt)...)
 
 		if id := ResponseIDFromEvent(evt.Data); id != "" {
 			out.ResponseID = id
@@ -56,6 +74,9 @@ func CollectTextFromSSE(body io.ReadCloser, opts CollectOptions) CollectedText {
 		case "response.output_text.delta":
 			delta, _ := evt.Data["delta"].(string)
 			out.FullText += delta
+			if opts.CollectLogprobs {
+				out.Logprobs = append(out.Logprobs, TokenLogprobsFromEvent(evt.Data)...)
+			}
 		case "response.reasoning_summary_text.delta":
 			if opts.CollectReasoning {
 				delta, _ := evt.Data["delta"].(string)
@@ -81,6 +102,9 @@ func CollectTextFromSSE(body io.ReadCloser, opts CollectOptions) CollectedText {
 			if opts.StopOnFailed {
 				return out
 			}
+		case "response.incomplete":
+			out.IncompleteReason = IncompleteReasonFromEvent(evt.Data)
+			return out
 		case "response.completed":
 			return out
 		}
@@ -89,6 +113,38 @@ func CollectTextFromSSE(body io.ReadCloser, opts CollectOptions) CollectedText {
 	return out
 }
 
+// TokenLogprobsFromEvent parses the logprobs array of an output_text delta.
+func TokenLogprobsFromEvent(data map[string]any) []types.TokenLogprob {
+	raw, _ := data["logprobs"].([]any)
+	var out []types.TokenLogprob
+	for _, v := range raw {
+		if lp, ok := tokenLogprobFromAny(v); ok {
+			out = append(out, lp)
+		}
+	}
+	return out
+}
+
+func tokenLogprobFromAny(v any) (types.TokenLogprob, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return types.TokenLogprob{}, false
+	}
+	token, ok := m["token"].(string)
+	if !ok {
+		return types.TokenLogprob{}, false
+	}
+	lp := types.TokenLogprob{Token: token}
+	lp.Logprob, _ = m["logprob"].(float64)
+	top, _ := m["top_logprobs"].([]any)
+	for _, t := range top {
+		if alt, ok := tokenLogprobFromAny(t); ok {
+			lp.TopLogprobs = append(lp.TopLogprobs, alt)
+		}
+	}
+	return lp, true
+}
+
 // FunctionToolCallFromOutputItem extracts a ToolCall from a function_call output item.
 func FunctionToolCallFromOutputItem(item map[string]any) (types.ToolCall, bool) {
 	if item == nil {
@@ -115,6 +171,24 @@ func FunctionToolCallFromOutputItem(item map[string]any) (types.ToolCall, bool)
 	}, true
 }
 
+// RefusalFromOutputItem returns the text of the refusal content parts of a
+// message output item, or "" when the model did not refuse.
+func RefusalFromOutputItem(item map[string]any) string {
+	if itemType, _ := item["type"].(string); itemType != "message" {
+		return ""
+	}
+	content, _ := item["content"].([]any)
+	var refusal string
+	for _, part := range content {
+		p, _ := part.(map[string]any)
+		if partType, _ := p["type"].(string); partType == "refusal" {
+			text, _ := p["refusal"].(string)
+			refusal += text
+		}
+	}
+	return refusal
+}
+
 // ResponseIDFromEvent extracts the response ID from an SSE event data map.
 func ResponseIDFromEvent(data map[string]any) string {
 	resp, _ := data["response"].(map[string]any)
@@ -124,6 +198,19 @@ func ResponseIDFromEvent(data map[string]any) string {
 	return StringFromAny(resp["id"])
 }
 
+// IncompleteContentFilter is the upstream incomplete reason for a generation
+// halted by content moderation.
+const IncompleteContentFilter = "content_filter"
+
+// IncompleteReasonFromEvent extracts response.incomplete_details.reason from a
+// response.incomplete event.
+func IncompleteReasonFromEvent(data map[string]any) string {
+	resp, _ := data["response"].(map[string]any)
+	details, _ := resp["incomplete_details"].(map[string]any)
+	reason, _ := details["reason"].(string)
+	return strings.TrimSpace(reason)
+}
+
 // ResponseErrorMessageFromEvent extracts the error message from a response.failed event.
 func ResponseErrorMessageFromEvent(data map[string]any) string {
 	resp, _ := data["response"].(map[string]any)
@@ -0,0 +1,20 @@
+package stream
+
+import "encoding/json"
+
+// SetSystemFingerprint stamps system_fingerprint on the response object carried
+// by response.* lifecycle events (created, in_progress, completed, ...) and
+// re-encodes evt.Raw. An empty fingerprint leaves the event untouched.
+func SetSystemFingerprint(evt *Event, fingerprint string) {
+	if fingerprint == "" || evt == nil || evt.Data == nil {
+		return
+	}
+	resp, _ := evt.Data["response"].(map[string]any)
+	if resp == nil {
+		return
+	}
+	resp["system_fingerprint"] = fingerprint
+	if data, err := json.Marshal(evt.Data); err == nil {
+		evt.Raw = data
+	}
+}
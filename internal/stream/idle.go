@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is returned by reads from a body wrapped with
+// NewIdleTimeoutBody once upstream has been silent for longer than the
+// timeout (--upstream-idle-timeout).
+var ErrIdleTimeout = errors.New("upstream stream idle timeout")
+
+// IncompleteIdleTimeout is the incomplete reason reported when a stream is
+// cut short by ErrIdleTimeout.
+const IncompleteIdleTimeout = "upstream_idle_timeout"
+
+type idleTimeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+// NewIdleTimeoutBody closes body when no bytes arrive for timeout; the
+// pending and later reads then fail with ErrIdleTimeout. A timeout <= 0
+// returns body unchanged.
+func NewIdleTimeoutBody(body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	b := &idleTimeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		b.fired.Store(true)
+		slog.Warn("upstream.idle_timeout", "timeout", timeout)
+		body.Close()
+	})
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.fired.Load() {
+		return n, ErrIdleTimeout
+	}
+	if n > 0 {
+		b.timer.Reset(b.timeout)
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
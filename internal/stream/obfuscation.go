@@ -0,0 +1,19 @@
+package stream
+
+import "encoding/json"
+
+// StripObfuscation removes the random "obfuscation" padding upstream attaches
+// to streamed delta events (Responses stream_options.include_obfuscation) and
+// re-encodes evt.Raw. Events without padding are left untouched.
+func StripObfuscation(evt *Event) {
+	if evt == nil || evt.Data == nil {
+		return
+	}
+	if _, ok := evt.Data["obfuscation"]; !ok {
+		return
+	}
+	delete(evt.Data, "obfuscation")
+	if data, err := json.Marshal(evt.Data); err == nil {
+		evt.Raw = data
+	}
+}
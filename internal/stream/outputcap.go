@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"unicode/utf8"
+)
+
+// ErrOutputTokenLimit is returned by Next once a reader limited with
+// LimitOutputTokens has passed on its full output budget.
+var ErrOutputTokenLimit = errors.New("server output token limit reached")
+
+// IncompleteMaxOutputTokens is the upstream incomplete reason for a response
+// cut short by its output token limit; it maps to finish_reason "length".
+const IncompleteMaxOutputTokens = "max_output_tokens"
+
+// outputDeltaEvents are the delta events whose text counts as output and is
+// trimmed at the limit.
+var outputDeltaEvents = map[string]bool{
+	"response.output_text.delta":            true,
+	"response.refusal.delta":                true,
+	"response.reasoning_text.delta":         true,
+	"response.reasoning_summary_text.delta": true,
+}
+
+// charsPerToken matches the estimate used for local token counts.
+const charsPerToken = 4
+
+// LimitOutputTokens makes Next end the stream with ErrOutputTokenLimit once
+// the text of output and reasoning deltas reaches about n tokens
+// (--server-max-output-tokens). The delta that crosses the limit is trimmed to
+// fit, so clients receive exactly the budget. Function call arguments count
+// toward the budget but are never cut, since partial JSON is useless to a
+// client: a call that started is passed on whole, and once the budget is spent
+// the stream ends before the next call begins. n <= 0 leaves the stream
+// unlimited.
+func (r *Reader) LimitOutputTokens(n int) {
+	r.outputBudget = n * charsPerToken
+}
+
+// capOutput applies the LimitOutputTokens budget to an event returned by Next.
+func (r *Reader) capOutput(evt *Event) (*Event, error) {
+	switch {
+	case evt.Type == "response.function_call_arguments.delta":
+		delta, _ := evt.Data["delta"].(string)
+		r.outputChars += utf8.RuneCountInString(delta)
+		return evt, nil
+	case evt.Type == "response.output_item.added" && r.outputChars >= r.outputBudget:
+		if item, _ := evt.Data["item"].(map[string]any); item["type"] == "function_call" {
+			r.outputCapped = true
+			slog.Info("stream.output_token_limit", "max_output_tokens", r.outputBudget/charsPerToken)
+			return nil, ErrOutputTokenLimit
+		}
+		return evt, nil
+	case !outputDeltaEvents[evt.Type]:
+		return evt, nil
+	}
+	delta, _ := evt.Data["delta"].(string)
+	n := utf8.RuneCountInString(delta)
+	left := r.outputBudget - r.outputChars
+	if n <= left {
+		r.outputChars += n
+		return evt, nil
+	}
+	r.outputCapped = true
+	slog.Info("stream.output_token_limit", "max_output_tokens", r.outputBudget/charsPerToken)
+	if left <= 0 {
+		return nil, ErrOutputTokenLimit
+	}
+	evt.Data["delta"] = string([]rune(delta)[:left])
+	if b, err := json.Marshal(evt.Data); err == nil {
+		evt.Raw = b
+	}
+	r.outputChars += left
+	return evt, nil
+}
@@ -3,52 +3,232 @@ package stream
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"strings"
 )
 
+const (
+	// DefaultMaxEventSize bounds a single SSE line; it leaves ample room for
+	// large tool-argument events while stopping a runaway upstream line.
+	DefaultMaxEventSize = 16 << 20
+	// MinMaxEventSize is the smallest accepted --max-sse-event-size.
+	MinMaxEventSize = 64 << 10
+
+	initialBufferSize = 256 << 10
+)
+
+// ErrEventTooLarge is returned by Next when an SSE line exceeds the limit.
+var ErrEventTooLarge = errors.New("upstream SSE event exceeds the maximum event size")
+
 // Reader reads SSE events from an io.Reader.
 type Reader struct {
-	scanner *bufio.Scanner
+	scanner   *bufio.Scanner
+	maxSize   int
+	toolNames map[string]string
+	onEvent   func(*Event)
+
+	maxToolCalls  int
+	keptToolCalls int
+	toolCallKept  map[string]bool
+
+	outputBudget int // runes; see LimitOutputTokens
+	outputChars  int
+	outputCapped bool
+
+	peeked    bool
+	peekEvent *Event
+	peekErr   error
 }
 
-// NewReader creates a new SSE reader.
+// NewReader creates a new SSE reader limited to DefaultMaxEventSize.
 func NewReader(r io.Reader) *Reader {
+	return NewReaderSize(r, DefaultMaxEventSize)
+}
+
+// NewReaderSize creates a new SSE reader whose lines may not exceed maxSize
+// bytes (--max-sse-event-size); zero or less means DefaultMaxEventSize.
+func NewReaderSize(r io.Reader, maxSize int) *Reader {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxEventSize
+	}
 	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 0, 256*1024), 1024*1024)
-	return &Reader{scanner: scanner}
+	scanner.Buffer(make([]byte, 0, min(initialBufferSize, maxSize)), maxSize)
+	return &Reader{scanner: scanner, maxSize: maxSize}
+}
+
+// RenameTools makes Next rewrite function and custom tool call names in output
+// items, mapping upstream names back to the names the client sent.
+func (r *Reader) RenameTools(names map[string]string) {
+	r.toolNames = names
+}
+
+// OnEvent registers fn to be called with each event as Next returns it.
+func (r *Reader) OnEvent(fn func(*Event)) {
+	r.onEvent = fn
+}
+
+// Peek returns the next event without consuming it; the following call to
+// Next returns the same event.
+func (r *Reader) Peek() (*Event, error) {
+	if !r.peeked {
+		r.peekEvent, r.peekErr = r.next()
+		r.peeked = true
+	}
+	return r.peekEvent, r.peekErr
+}
+
+// Empty reports whether the stream ends before its first event. The event
+// read to decide is returned by the following call to Next.
+func (r *Reader) Empty() bool {
+	_, err := r.Peek()
+	return errors.Is(err, io.EOF)
 }
 
 // Next returns the next SSE event. Returns nil, io.EOF when done.
 func (r *Reader) Next() (*Event, error) {
+	if r.outputCapped {
+		return nil, ErrOutputTokenLimit
+	}
+	var evt *Event
+	var err error
+	if r.peeked {
+		r.peeked = false
+		evt, err = r.peekEvent, r.peekErr
+	} else {
+		evt, err = r.next()
+	}
+	if evt != nil && r.outputBudget > 0 {
+		evt, err = r.capOutput(evt)
+	}
+	if evt != nil && r.onEvent != nil {
+		r.onEvent(evt)
+	}
+	return evt, err
+}
+
+// next assembles the next event from its data lines. bufio.Scanner buffers
+// partial lines across reads, and an event is only dispatched once the blank
+// line ending it (or the end of the stream) has been seen, so events split
+// across arbitrary read boundaries parse the same as a single read. Multiple
+// data lines are joined with "\n" as the SSE spec requires.
+func (r *Reader) next() (*Event, error) {
+	var data strings.Builder
+	pending := false
 	for r.scanner.Scan() {
 		line := r.scanner.Text()
 		if line == "" {
+			if !pending {
+				continue
+			}
+			evt, err := r.dispatch(data.String())
+			data.Reset()
+			pending = false
+			if evt != nil || err != nil {
+				return evt, err
+			}
 			continue
 		}
-		if !strings.HasPrefix(line, "data: ") {
-			continue
-		}
-		data := strings.TrimSpace(line[6:])
-		if data == "" {
+		value, ok := strings.CutPrefix(line, "data:")
+		if !ok {
 			continue
 		}
-		if data == "[DONE]" {
-			return nil, io.EOF
+		if pending {
+			data.WriteByte('\n')
 		}
-		var parsed map[string]any
-		if err := json.Unmarshal([]byte(data), &parsed); err != nil {
-			continue
+		data.WriteString(strings.TrimPrefix(value, " "))
+		pending = true
+		if data.Len() > r.maxSize {
+			return nil, r.tooLarge()
 		}
-		eventType, _ := parsed["type"].(string)
-		return &Event{
-			Type: eventType,
-			Raw:  json.RawMessage(data),
-			Data: parsed,
-		}, nil
 	}
 	if err := r.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, r.tooLarge()
+		}
 		return nil, err
 	}
+	// Upstream may close the stream without the final blank line.
+	if pending {
+		if evt, err := r.dispatch(data.String()); evt != nil || err != nil {
+			return evt, err
+		}
+	}
 	return nil, io.EOF
 }
+
+// dispatch parses one assembled event payload. It returns nil, nil when the
+// payload is empty, not JSON or a held-back tool call and should be skipped.
+func (r *Reader) dispatch(data string) (*Event, error) {
+	data = strings.TrimSpace(data)
+	if data == "" {
+		return nil, nil
+	}
+	if data == "[DONE]" {
+		return nil, io.EOF
+	}
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(data), &parsed); err != nil {
+		return nil, nil
+	}
+	changed := len(r.toolNames) > 0 && renameToolCalls(parsed, r.toolNames)
+	if r.maxToolCalls > 0 {
+		if r.holdToolCall(parsed) {
+			return nil, nil
+		}
+		if limitResponseToolCalls(parsed, r.maxToolCalls) {
+			changed = true
+		}
+	}
+	if changed {
+		if b, err := json.Marshal(parsed); err == nil {
+			data = string(b)
+		}
+	}
+	eventType, _ := parsed["type"].(string)
+	return &Event{
+		Type: eventType,
+		Raw:  json.RawMessage(data),
+		Data: parsed,
+	}, nil
+}
+
+func (r *Reader) tooLarge() error {
+	slog.Warn("sse.event_too_large", "max_bytes", r.maxSize)
+	return fmt.Errorf("%w (%d bytes)", ErrEventTooLarge, r.maxSize)
+}
+
+// renameToolCalls rewrites tool call names in the event's item and in the
+// output of a response object. It reports whether anything changed.
+func renameToolCalls(data map[string]any, names map[string]string) bool {
+	changed := renameToolCallItem(data["item"], names)
+	if resp, ok := data["response"].(map[string]any); ok {
+		if output, ok := resp["output"].([]any); ok {
+			for _, item := range output {
+				if renameToolCallItem(item, names) {
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+func renameToolCallItem(v any, names map[string]string) bool {
+	item, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+	if typ, _ := item["type"].(string); typ != "function_call" && typ != "custom_tool_call" {
+		return false
+	}
+	name, _ := item["name"].(string)
+	orig, ok := names[name]
+	if !ok {
+		return false
+	}
+	item["name"] = orig
+	return true
+}
@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReaderRejectsOversizedEvent(t *testing.T) {
+	big := strings.Repeat("x", 128<<10)
+	body := `data: {"type":"response.output_text.delta","delta":"` + big + `"}` + "\n\n"
+
+	r := NewReaderSize(strings.NewReader(body), MinMaxEventSize)
+	if _, err := r.Next(); !errors.Is(err, ErrEventTooLarge) {
+		t.Fatalf("expected ErrEventTooLarge, got %v", err)
+	}
+}
+
+func TestReaderAcceptsLargeToolArgumentsEvent(t *testing.T) {
+	args := strings.Repeat("a", 70<<10)
+	body := `data: {"type":"response.function_call_arguments.delta","delta":"` + args + `"}` + "\n\n"
+
+	r := NewReader(strings.NewReader(body))
+	ev, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if ev.Type != "response.function_call_arguments.delta" {
+		t.Fatalf("unexpected event type %q", ev.Type)
+	}
+	if got, _ := ev.Data["delta"].(string); len(got) != len(args) {
+		t.Fatalf("delta length = %d, want %d", len(got), len(args))
+	}
+}
+
+func TestReaderEmptyKeepsPeekedEvent(t *testing.T) {
+	if r := NewReader(strings.NewReader(": keep-alive\n\ndata: [DONE]\n\n")); !r.Empty() {
+		t.Error("stream without events should be empty")
+	}
+
+	r := NewReader(strings.NewReader("data: {\"type\":\"response.created\"}\n\n"))
+	if r.Empty() {
+		t.Fatal("stream with an event should not be empty")
+	}
+	evt, err := r.Next()
+	if err != nil || evt.Type != "response.created" {
+		t.Fatalf("Next after Empty: got %v, %v; want the peeked response.created", evt, err)
+	}
+}
+
+// chunkReader returns at most a few bytes per Read, cycling through sizes.
+type chunkReader struct {
+	data  []byte
+	sizes []int
+	n     int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.data) == 0 {
+		return 0, io.EOF
+	}
+	size := min(c.sizes[c.n%len(c.sizes)], len(p), len(c.data))
+	c.n++
+	copy(p, c.data[:size])
+	c.data = c.data[size:]
+	return size, nil
+}
+
+func readAllEvents(t *testing.T, r io.Reader) []*Event {
+	t.Helper()
+	reader := NewReader(r)
+	var events []*Event
+	for {
+		evt, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		events = append(events, evt)
+	}
+}
+
+func TestReaderReassemblesEventsSplitAcrossReads(t *testing.T) {
+	body := "event: response.created\r\n" +
+		"data: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\"}}\r\n\r\n" +
+		": keep-alive\n\n" +
+		"event: response.output_text.delta\n" +
+		"data: {\"type\":\"response.output_text.delta\",\"delta\":\"" + strings.Repeat("héllo ", 200) + "\"}\n\n" +
+		"data: {\"type\":\"response.output_item.done\",\n" +
+		"data: \"item\":{\"type\":\"message\"}}\n\n" +
+		"data:{\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\"}}\n\n" +
+		"data: [DONE]\n\n"
+
+	want := readAllEvents(t, strings.NewReader(body))
+	if len(want) != 4 {
+		t.Fatalf("single read: got %d events, want 4", len(want))
+	}
+	if want[2].Type != "response.output_item.done" || want[3].Type != "response.completed" {
+		t.Fatalf("single read: unexpected events %s, %s", want[2].Type, want[3].Type)
+	}
+	for _, sizes := range [][]int{{1}, {2}, {3}, {1, 3, 2}} {
+		got := readAllEvents(t, &chunkReader{data: []byte(body), sizes: sizes})
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("chunk sizes %v: events differ from a single-read parse", sizes)
+		}
+	}
+}
+
+func TestCollectTextFromSSEIdleTimeoutIncomplete(t *testing.T) {
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("data: {\"type\":\"response.output_text.delta\",\"delta\":\"Partial\"}\n\n")) //nolint:errcheck
+	out := CollectTextFromSSE(NewIdleTimeoutBody(pr, 50*time.Millisecond), CollectOptions{})
+	if out.FullText != "Partial" || out.IncompleteReason != IncompleteIdleTimeout {
+		t.Errorf("got text %q reason %q, want the partial text and %q", out.FullText, out.IncompleteReason, IncompleteIdleTimeout)
+	}
+}
+
+func TestLimitOutputTokensKeepsFunctionArgumentsWhole(t *testing.T) {
+	const sse = `data: {"type":"response.reasoning_summary_text.delta","delta":"plan"}` + "\n\n" +
+		`data: {"type":"response.output_item.added","item":{"type":"function_call","call_id":"call_1"}}` + "\n\n" +
+		`data: {"type":"response.function_call_arguments.delta","delta":"{\"city\":\"Paris\"}"}` + "\n\n" +
+		`data: {"type":"response.output_item.added","item":{"type":"function_call","call_id":"call_2"}}` + "\n\n" +
+		`data: {"type":"response.function_call_arguments.delta","delta":"{}"}` + "\n\n"
+	r := NewReader(strings.NewReader(sse))
+	r.LimitOutputTokens(2)
+
+	var seen []string
+	var args string
+	for {
+		evt, err := r.Next()
+		if err != nil {
+			if !errors.Is(err, ErrOutputTokenLimit) {
+				t.Fatalf("Next: %v, want ErrOutputTokenLimit", err)
+			}
+			break
+		}
+		seen = append(seen, evt.Type)
+		if delta, _ := evt.Data["delta"].(string); evt.Type == "response.function_call_arguments.delta" {
+			args += delta
+		}
+	}
+	if len(seen) != 3 || args != `{"city":"Paris"}` {
+		t.Errorf("got events %v with arguments %q; want the reasoning delta and the first call whole, then the limit", seen, args)
+	}
+}
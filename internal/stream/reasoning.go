@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ReasoningStripper removes reasoning output items from a Responses event
+// stream. Every event of a reasoning item (its output_item, summary, text and
+// part events) is dropped, the output_index of later items is shifted down to
+// close the gap, and terminal events no longer list reasoning items in
+// response.output. The zero value is ready to use.
+type ReasoningStripper struct {
+	items   map[string]bool
+	indices []int
+}
+
+// Keep reports whether evt should be forwarded. Forwarded events are
+// rewritten in place (updating evt.Raw) when their output_index or output
+// array changes.
+func (s *ReasoningStripper) Keep(evt *Event) bool {
+	if evt == nil || evt.Data == nil {
+		return true
+	}
+	if strings.HasPrefix(evt.Type, "response.reasoning") {
+		return false
+	}
+	if id, _ := evt.Data["item_id"].(string); id != "" && s.items[id] {
+		return false
+	}
+	changed := false
+	switch evt.Type {
+	case "response.output_item.added", "response.output_item.done":
+		item, _ := evt.Data["item"].(map[string]any)
+		if item["type"] == "reasoning" {
+			s.strip(item, evt.Data["output_index"])
+			return false
+		}
+	case "response.completed", "response.incomplete", "response.failed":
+		resp, _ := evt.Data["response"].(map[string]any)
+		changed = StripReasoningOutput(resp)
+	}
+	if idx, ok := evt.Data["output_index"].(float64); ok {
+		if shift := s.shift(int(idx)); shift > 0 {
+			evt.Data["output_index"] = int(idx) - shift
+			changed = true
+		}
+	}
+	if changed {
+		if data, err := json.Marshal(evt.Data); err == nil {
+			evt.Raw = data
+		}
+	}
+	return true
+}
+
+// strip records a reasoning item so its remaining events are dropped and
+// later output indices shift past it.
+func (s *ReasoningStripper) strip(item map[string]any, outputIndex any) {
+	if id, _ := item["id"].(string); id != "" {
+		if s.items == nil {
+			s.items = make(map[string]bool)
+		}
+		s.items[id] = true
+	}
+	idx, ok := outputIndex.(float64)
+	if !ok {
+		return
+	}
+	for _, seen := range s.indices {
+		if seen == int(idx) {
+			return
+		}
+	}
+	s.indices = append(s.indices, int(idx))
+}
+
+// shift returns how many stripped items precede output index idx.
+func (s *ReasoningStripper) shift(idx int) int {
+	n := 0
+	for _, seen := range s.indices {
+		if seen < idx {
+			n++
+		}
+	}
+	return n
+}
+
+// StripReasoningOutput drops reasoning items from a Responses response
+// object's output array and reports whether anything was removed.
+func StripReasoningOutput(resp map[string]any) bool {
+	output, _ := resp["output"].([]any)
+	kept := make([]any, 0, len(output))
+	for _, item := range output {
+		if m, ok := item.(map[string]any); ok && m["type"] == "reasoning" {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(kept) == len(output) {
+		return false
+	}
+	resp["output"] = kept
+	return true
+}
@@ -0,0 +1,75 @@
+package stream
+
+import "encoding/json"
+
+// OutputRenumberer rewrites output_index values so items reach the client as
+// 0, 1, 2, ... in order of first appearance, and narrows the response.output
+// array of terminal events to the same items in the same order, so it lines
+// up with the renumbered indices (--renumber-output-indices). The zero value
+// is ready to use.
+type OutputRenumberer struct {
+	indices map[int]int
+	order   []int // upstream output_index by client-facing index
+}
+
+// Apply renumbers evt in place, updating evt.Raw when anything changes.
+func (r *OutputRenumberer) Apply(evt *Event) {
+	if evt == nil || evt.Data == nil {
+		return
+	}
+	changed := false
+	if v, ok := evt.Data["output_index"].(float64); ok {
+		upstream := int(v)
+		idx, seen := r.indices[upstream]
+		if !seen {
+			if r.indices == nil {
+				r.indices = make(map[int]int)
+			}
+			idx = len(r.order)
+			r.indices[upstream] = idx
+			r.order = append(r.order, upstream)
+		}
+		if idx != upstream {
+			evt.Data["output_index"] = idx
+			changed = true
+		}
+	}
+	switch evt.Type {
+	case "response.completed", "response.incomplete", "response.failed":
+		resp, _ := evt.Data["response"].(map[string]any)
+		if r.renumberOutput(resp) {
+			changed = true
+		}
+	}
+	if changed {
+		if data, err := json.Marshal(evt.Data); err == nil {
+			evt.Raw = data
+		}
+	}
+}
+
+// renumberOutput reorders resp's output array to the streamed items in
+// client-facing order. An array that does not cover every streamed index is
+// left alone.
+func (r *OutputRenumberer) renumberOutput(resp map[string]any) bool {
+	output, ok := resp["output"].([]any)
+	if !ok || len(r.order) == 0 {
+		return false
+	}
+	kept := make([]any, 0, len(r.order))
+	identity := len(r.order) == len(output)
+	for i, upstream := range r.order {
+		if upstream < 0 || upstream >= len(output) {
+			return false
+		}
+		if upstream != i {
+			identity = false
+		}
+		kept = append(kept, output[upstream])
+	}
+	if identity {
+		return false
+	}
+	resp["output"] = kept
+	return true
+}
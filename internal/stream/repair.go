@@ -0,0 +1,88 @@
+package stream
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// RepairJSON attempts a lightweight repair of truncated or slightly malformed
+// JSON object/array text, as produced when a generation is cut short: it
+// closes an unterminated string, drops trailing commas, fills a dangling
+// value with null and balances braces/brackets. It reports false when the
+// input is not object/array-shaped or is still invalid after repair.
+func RepairJSON(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || (raw[0] != '{' && raw[0] != '[') {
+		return "", false
+	}
+
+	var b strings.Builder
+	var stack []byte
+	inString, escaped := false, false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if inString {
+			b.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+			trimTrailingComma(&b)
+		}
+		b.WriteByte(c)
+	}
+
+	if inString {
+		if escaped {
+			// Drop the dangling backslash so the closing quote is not escaped.
+			s := b.String()
+			b.Reset()
+			b.WriteString(s[:len(s)-1])
+		}
+		b.WriteByte('"')
+	}
+	trimTrailingComma(&b)
+	if s := strings.TrimRight(b.String(), " \t\r\n"); strings.HasSuffix(s, ":") {
+		b.Reset()
+		b.WriteString(s)
+		b.WriteString("null")
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		b.WriteByte(stack[i])
+	}
+
+	out := b.String()
+	if !json.Valid([]byte(out)) {
+		return "", false
+	}
+	return out, true
+}
+
+// trimTrailingComma removes a trailing comma (and any whitespace after it)
+// from the text written so far.
+func trimTrailingComma(b *strings.Builder) {
+	s := strings.TrimRight(b.String(), " \t\r\n")
+	if !strings.HasSuffix(s, ",") {
+		return
+	}
+	b.Reset()
+	b.WriteString(s[:len(s)-1])
+}
@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`{"city":"Paris","days":3,}`, `{"city":"Paris","days":3}`},
+		{`{"city":"Paris","tags":["a","b",`, `{"city":"Paris","tags":["a","b"]}`},
+		{`{"query":"weather in Par`, `{"query":"weather in Par"}`},
+		{`{"a":{"b":1},"c":`, `{"a":{"b":1},"c":null}`},
+		{`{"path":"C:\\dir\`, `{"path":"C:\\dir"}`},
+		{`{"note":"braces } and ] in text", `, `{"note":"braces } and ] in text"}`},
+	}
+	for _, tt := range tests {
+		got, ok := RepairJSON(tt.in)
+		if !ok || got != tt.want {
+			t.Errorf("RepairJSON(%q): got %q, %v; want %q", tt.in, got, ok, tt.want)
+			continue
+		}
+		if !json.Valid([]byte(got)) {
+			t.Errorf("RepairJSON(%q): result %q is not valid JSON", tt.in, got)
+		}
+	}
+
+	for _, in := range []string{`weather in Paris`, `{"a":1]`, `{"a" 1}`} {
+		if got, ok := RepairJSON(in); ok {
+			t.Errorf("RepairJSON(%q): got %q, want failure", in, got)
+		}
+	}
+}
+
+func TestSerializeToolArgsRepair(t *testing.T) {
+	if got := SerializeToolArgs(`{"city":"Paris",`, false, true); got != `{"city":"Paris"}` {
+		t.Errorf("repair on: got %q", got)
+	}
+	if got := SerializeToolArgs(`{"city":: }`, false, true); got != "{}" {
+		t.Errorf("unrepairable: got %q, want {}", got)
+	}
+	if got := SerializeToolArgs(`{"city":"Paris",`, false, false); got != `{"city":"Paris",` {
+		t.Errorf("repair off must forward as-is: got %q", got)
+	}
+	if got := SerializeToolArgs(`latest news`, true, true); got != `{"query":"latest news"}` {
+		t.Errorf("query fallback: got %q", got)
+	}
+}
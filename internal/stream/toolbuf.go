@@ -178,7 +178,9 @@ func IsEmptyToolArgs(args any) bool {
 }
 
 // SerializeToolArgs converts args to a JSON string for chat completion chunks.
-func SerializeToolArgs(args any, queryFallback bool) string {
+// With repair set, malformed JSON is passed through RepairJSON and replaced by
+// "{}" when it cannot be salvaged (unless queryFallback applies).
+func SerializeToolArgs(args any, queryFallback, repair bool) string {
 	switch a := args.(type) {
 	case map[string]any:
 		b, _ := json.Marshal(a)
@@ -196,6 +198,14 @@ func SerializeToolArgs(args any, queryFallback bool) string {
 			b, _ := json.Marshal(parsed)
 			return string(b)
 		}
+		if repair {
+			if repaired, ok := RepairJSON(raw); ok {
+				return repaired
+			}
+			if !queryFallback {
+				return "{}"
+			}
+		}
 		if queryFallback {
 			b, _ := json.Marshal(map[string]any{"query": raw})
 			return string(b)
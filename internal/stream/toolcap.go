@@ -0,0 +1,84 @@
+package stream
+
+// LimitToolCalls makes Next hold back function and custom tool calls after
+// the first n of a response (--max-parallel-tool-calls): events for later
+// calls are skipped and those calls are dropped from the output of response
+// objects, so every consumer sees the same first n calls in arrival order.
+// n <= 0 forwards all calls.
+func (r *Reader) LimitToolCalls(n int) {
+	r.maxToolCalls = n
+	r.toolCallKept = map[string]bool{}
+}
+
+// holdToolCall reports whether an event belongs to a held-back tool call.
+func (r *Reader) holdToolCall(data map[string]any) bool {
+	if item, ok := data["item"].(map[string]any); ok && isClientToolCall(item) {
+		return !r.keepToolCall(toolCallKey(item))
+	}
+	if id, _ := data["item_id"].(string); id != "" {
+		if kept, seen := r.toolCallKept[id]; seen {
+			return !kept
+		}
+	}
+	return false
+}
+
+// keepToolCall decides once per call whether it is within the limit.
+func (r *Reader) keepToolCall(key string) bool {
+	if kept, seen := r.toolCallKept[key]; seen {
+		return kept
+	}
+	kept := r.keptToolCalls < r.maxToolCalls
+	if kept {
+		r.keptToolCalls++
+	}
+	if key != "" {
+		r.toolCallKept[key] = kept
+	}
+	return kept
+}
+
+// limitResponseToolCalls drops client tool calls after the first n from the
+// output of the event's response object. It reports whether anything changed.
+func limitResponseToolCalls(data map[string]any, n int) bool {
+	resp, ok := data["response"].(map[string]any)
+	if !ok {
+		return false
+	}
+	output, ok := resp["output"].([]any)
+	if !ok {
+		return false
+	}
+	kept := make([]any, 0, len(output))
+	calls := 0
+	for _, v := range output {
+		if item, ok := v.(map[string]any); ok && isClientToolCall(item) {
+			if calls++; calls > n {
+				continue
+			}
+		}
+		kept = append(kept, v)
+	}
+	if len(kept) == len(output) {
+		return false
+	}
+	resp["output"] = kept
+	return true
+}
+
+// isClientToolCall reports whether an output item is a call the client
+// executes, as opposed to a hosted tool such as web search.
+func isClientToolCall(item map[string]any) bool {
+	typ, _ := item["type"].(string)
+	return typ == "function_call" || typ == "custom_tool_call"
+}
+
+// toolCallKey identifies a call across its events: argument deltas refer to
+// the item id, which older payloads may omit in favor of call_id.
+func toolCallKey(item map[string]any) string {
+	if id, _ := item["id"].(string); id != "" {
+		return id
+	}
+	id, _ := item["call_id"].(string)
+	return id
+}
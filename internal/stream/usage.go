@@ -54,6 +54,12 @@ func ExtractUsageFromEvent(data map[string]any) *types.Usage {
 			RejectedPredictionTokens: Int64FromAny(ctd["rejected_prediction_tokens"]),
 		}
 	}
+	// The Responses API reports reasoning under output_tokens_details.
+	if otd, ok := usage["output_tokens_details"].(map[string]any); ok && u.CompletionTokensDetails == nil {
+		if rt := Int64FromAny(otd["reasoning_tokens"]); rt > 0 {
+			u.CompletionTokensDetails = &types.CompletionTokensDetails{ReasoningTokens: rt}
+		}
+	}
 	if ptd, ok := usage["prompt_tokens_details"].(map[string]any); ok && len(ptd) > 0 {
 		u.PromptTokensDetails = &types.PromptTokensDetails{
 			AudioTokens:  Int64FromAny(ptd["audio_tokens"]),
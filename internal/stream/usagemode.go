@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// IncludeUsage is the client include value that asks for a guaranteed usage
+// block in the streamed response.completed. It is never sent upstream.
+const IncludeUsage = "usage"
+
+// UsageMode controls the usage block of a streamed Responses response.completed.
+type UsageMode int
+
+const (
+	// UsageVerbatim forwards whatever upstream sends (client sent no include).
+	UsageVerbatim UsageMode = iota
+	// UsageRequired guarantees a usage block, estimating one when missing.
+	UsageRequired
+	// UsageStripped removes the usage block (include sent without "usage").
+	UsageStripped
+)
+
+// UsageModeFromInclude derives the usage mode from a client include list and
+// returns the list with "usage" removed. A nil include means the client did
+// not send one and leaves usage untouched.
+func UsageModeFromInclude(include []string) (UsageMode, []string) {
+	if include == nil {
+		return UsageVerbatim, nil
+	}
+	mode := UsageStripped
+	filtered := make([]string, 0, len(include))
+	for _, inc := range include {
+		if inc == IncludeUsage {
+			mode = UsageRequired
+			continue
+		}
+		filtered = append(filtered, inc)
+	}
+	return mode, filtered
+}
+
+// UsageShaper applies a UsageMode to a Responses event stream. It counts
+// streamed output so a missing usage block can be estimated.
+type UsageShaper struct {
+	Mode        UsageMode
+	InputTokens int64 // local prompt estimate used when synthesizing
+	outputChars int
+}
+
+// Apply returns the event data to forward to the client, updating evt.Raw
+// when the event was rewritten.
+func (s *UsageShaper) Apply(evt *Event) json.RawMessage {
+	if s == nil || s.Mode == UsageVerbatim || evt.Data == nil {
+		return evt.Raw
+	}
+	switch evt.Type {
+	case "response.output_text.delta", "response.function_call_arguments.delta",
+		"response.reasoning_summary_text.delta", "response.reasoning_text.delta":
+		delta, _ := evt.Data["delta"].(string)
+		s.outputChars += utf8.RuneCountInString(delta)
+		return evt.Raw
+	case "response.completed":
+	default:
+		return evt.Raw
+	}
+
+	resp, _ := evt.Data["response"].(map[string]any)
+	if resp == nil {
+		return evt.Raw
+	}
+	_, hasUsage := resp["usage"]
+	switch {
+	case s.Mode == UsageStripped && hasUsage:
+		delete(resp, "usage")
+	case s.Mode == UsageRequired && !hasUsage:
+		output := int64((s.outputChars + 3) / 4)
+		resp["usage"] = map[string]any{
+			"input_tokens":  s.InputTokens,
+			"output_tokens": output,
+			"total_tokens":  s.InputTokens + output,
+		}
+	default:
+		return evt.Raw
+	}
+	data, err := json.Marshal(evt.Data)
+	if err != nil {
+		return evt.Raw
+	}
+	evt.Raw = data
+	return data
+}
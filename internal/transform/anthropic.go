@@ -83,10 +83,14 @@ func AnthropicMessagesToResponsesInput(messages []types.AnthropicMessage) ([]typ
 				if callID == "" {
 					callID = strings.TrimSpace(block.ID)
 				}
+				output := types.ParseToolResultText(block.Content)
+				if block.IsError {
+					output = markToolError(output)
+				}
 				out = append(out, types.ResponsesInputItem{
 					Type:   "function_call_output",
 					CallID: callID,
-					Output: types.ParseToolResultText(block.Content),
+					Output: output,
 				})
 
 			default:
@@ -107,6 +111,18 @@ func AnthropicMessagesToResponsesInput(messages []types.AnthropicMessage) ([]typ
 	return out, nil
 }
 
+// toolErrorPrefix marks the output of a tool_result flagged is_error.
+// function_call_output has no error field, so the text is the only place the
+// model can learn that the call failed.
+const toolErrorPrefix = "Error: the tool call failed."
+
+func markToolError(output string) string {
+	if strings.TrimSpace(output) == "" {
+		return toolErrorPrefix
+	}
+	return toolErrorPrefix + "\n" + output
+}
+
 // AnthropicToolsToResponses converts Anthropic Messages tools to Responses tools.
 func AnthropicToolsToResponses(tools []types.AnthropicTool) []types.ResponsesTool {
 	if len(tools) == 0 {
@@ -153,3 +153,37 @@ func TestEstimateResponsesInputTokensDeterministic(t *testing.T) {
 		t.Fatalf("expected deterministic estimate, got %d and %d", got1, got2)
 	}
 }
+
+func TestAnthropicToolResultIsErrorSurvives(t *testing.T) {
+	messages := []types.AnthropicMessage{
+		{
+			Role:    "assistant",
+			Content: json.RawMessage(`[{"type":"tool_use","id":"toolu_1","name":"read_file","input":{"path":"missing.md"}}]`),
+		},
+		{
+			Role: "user",
+			Content: json.RawMessage(`[
+				{"type":"tool_result","tool_use_id":"toolu_1","is_error":true,"content":"ENOENT: no such file"},
+				{"type":"tool_result","tool_use_id":"toolu_2","is_error":true},
+				{"type":"tool_result","tool_use_id":"toolu_3","content":"ok"}
+			]`),
+		},
+	}
+
+	got, err := AnthropicMessagesToResponsesInput(messages)
+	if err != nil {
+		t.Fatalf("AnthropicMessagesToResponsesInput returned error: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 input items, got %d", len(got))
+	}
+	if want := "Error: the tool call failed.\nENOENT: no such file"; got[1].Output != want {
+		t.Errorf("is_error output: got %q, want %q", got[1].Output, want)
+	}
+	if want := "Error: the tool call failed."; got[2].Output != want {
+		t.Errorf("empty is_error output: got %q, want %q", got[2].Output, want)
+	}
+	if got[3].Output != "ok" {
+		t.Errorf("successful output should be unchanged, got %q", got[3].Output)
+	}
+}
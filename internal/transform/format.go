@@ -0,0 +1,52 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResponseFormatToTextFormat converts a structured-output hint into the
+// Responses API text.format object. It accepts the OpenAI chat shape
+// ({"type":"json_schema","json_schema":{"name":...,"schema":...}}), the flat
+// Responses/Anthropic shape ({"type":"json_schema","schema":...}) and
+// {"type":"json_object"}. A nil result means plain text (no directive).
+func ResponseFormatToTextFormat(rf any) (map[string]any, error) {
+	if rf == nil {
+		return nil, nil
+	}
+	m, ok := rf.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("response_format must be an object")
+	}
+	formatType, _ := m["type"].(string)
+	switch strings.TrimSpace(formatType) {
+	case "", "text":
+		return nil, nil
+	case "json_object":
+		return map[string]any{"type": "json_object"}, nil
+	case "json_schema":
+	default:
+		return nil, fmt.Errorf("unsupported response_format type %q", formatType)
+	}
+
+	spec := m
+	if nested, ok := m["json_schema"].(map[string]any); ok {
+		spec = nested
+	}
+	schema, ok := spec["schema"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("response_format json_schema requires a schema object")
+	}
+	name, _ := spec["name"].(string)
+	if strings.TrimSpace(name) == "" {
+		name = "response"
+	}
+	out := map[string]any{"type": "json_schema", "name": name, "schema": schema}
+	if strict, ok := spec["strict"].(bool); ok {
+		out["strict"] = strict
+	}
+	if desc, ok := spec["description"].(string); ok && desc != "" {
+		out["description"] = desc
+	}
+	return out, nil
+}
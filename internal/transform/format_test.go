@@ -0,0 +1,39 @@
+package transform
+
+import "testing"
+
+func TestResponseFormatToTextFormat(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+	tests := []struct {
+		name     string
+		in       any
+		wantType any
+		wantName any
+		wantErr  bool
+	}{
+		{name: "absent", in: nil},
+		{name: "text", in: map[string]any{"type": "text"}},
+		{name: "json_object", in: map[string]any{"type": "json_object"}, wantType: "json_object"},
+		{name: "chat json_schema", in: map[string]any{"type": "json_schema", "json_schema": map[string]any{"name": "city", "schema": schema, "strict": true}}, wantType: "json_schema", wantName: "city"},
+		{name: "flat json_schema", in: map[string]any{"type": "json_schema", "schema": schema}, wantType: "json_schema", wantName: "response"},
+		{name: "missing schema", in: map[string]any{"type": "json_schema"}, wantErr: true},
+		{name: "unknown type", in: map[string]any{"type": "yaml"}, wantErr: true},
+		{name: "not an object", in: "json", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ResponseFormatToTextFormat(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantType == nil {
+			if got != nil {
+				t.Errorf("%s: expected no directive, got %v", tt.name, got)
+			}
+			continue
+		}
+		if got["type"] != tt.wantType || (tt.wantName != nil && got["name"] != tt.wantName) {
+			t.Errorf("%s: got %v", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// GeminiMessagesToResponsesInput converts Gemini contents into Responses API
+// input items. Text and inlineData images become message content,
+// functionCall parts become function_call items and functionResponse parts
+// become function_call_output items. Gemini calls often carry no id, so
+// missing ids are generated and a response is matched to the oldest pending
+// call with the same name. Thought parts echoed back are dropped.
+func GeminiMessagesToResponsesInput(contents []types.GeminiContent) ([]types.ResponsesInputItem, error) {
+	var out []types.ResponsesInputItem
+	var pending []pendingOllamaCall
+	nextCallID := 1
+
+	for _, content := range contents {
+		role := "user"
+		if strings.EqualFold(strings.TrimSpace(content.Role), "model") {
+			role = "assistant"
+		}
+
+		var parts []types.ResponsesContent
+		flushParts := func() {
+			if len(parts) == 0 {
+				return
+			}
+			out = append(out, types.ResponsesInputItem{Type: "message", Role: role, Content: parts})
+			parts = nil
+		}
+
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				continue
+
+			case part.FunctionCall != nil:
+				flushParts()
+				callID := strings.TrimSpace(part.FunctionCall.ID)
+				if callID == "" {
+					callID = fmt.Sprintf("call_%d", nextCallID)
+					nextCallID++
+				}
+				pending = append(pending, pendingOllamaCall{id: callID, name: part.FunctionCall.Name})
+				args := "{}"
+				if part.FunctionCall.Args != nil {
+					if b, err := json.Marshal(part.FunctionCall.Args); err == nil {
+						args = string(b)
+					}
+				}
+				out = append(out, types.ResponsesInputItem{
+					Type:      "function_call",
+					Name:      part.FunctionCall.Name,
+					Arguments: args,
+					CallID:    callID,
+				})
+
+			case part.FunctionResponse != nil:
+				flushParts()
+				callID := strings.TrimSpace(part.FunctionResponse.ID)
+				if callID == "" {
+					callID, pending = takePendingOllamaCall(pending, part.FunctionResponse.Name)
+				} else {
+					pending = dropPendingOllamaCall(pending, callID)
+				}
+				out = append(out, types.ResponsesInputItem{
+					Type:   "function_call_output",
+					CallID: callID,
+					Output: geminiFunctionOutput(part.FunctionResponse.Response),
+				})
+
+			case part.InlineData != nil:
+				mime := strings.ToLower(strings.TrimSpace(part.InlineData.MimeType))
+				if !strings.HasPrefix(mime, "image/") {
+					return nil, fmt.Errorf("unsupported inlineData mimeType %q: only images are supported", part.InlineData.MimeType)
+				}
+				parts = append(parts, types.ResponsesContent{
+					Type:     "input_image",
+					ImageURL: "data:" + mime + ";base64," + part.InlineData.Data,
+				})
+
+			case part.Text != "":
+				kind := "input_text"
+				if role == "assistant" {
+					kind = "output_text"
+				}
+				parts = append(parts, types.ResponsesContent{Type: kind, Text: part.Text})
+			}
+		}
+		flushParts()
+	}
+	return out, nil
+}
+
+// geminiFunctionOutput renders a functionResponse.response as tool output
+// text: strings as-is, anything else as JSON.
+func geminiFunctionOutput(response any) string {
+	if s, ok := response.(string); ok {
+		return s
+	}
+	if response == nil {
+		return ""
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// GeminiSystemText joins the text parts of a systemInstruction.
+func GeminiSystemText(system *types.GeminiContent) string {
+	if system == nil {
+		return ""
+	}
+	var texts []string
+	for _, part := range system.Parts {
+		if strings.TrimSpace(part.Text) != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// GeminiToolsToResponses converts Gemini function declarations to Responses
+// tools. parametersJsonSchema is forwarded as-is; the OpenAPI-style
+// parameters schema is converted to JSON Schema.
+func GeminiToolsToResponses(tools []types.GeminiTool) []types.ResponsesTool {
+	var out []types.ResponsesTool
+	for _, tool := range tools {
+		for _, fn := range tool.FunctionDeclarations {
+			if strings.TrimSpace(fn.Name) == "" {
+				continue
+			}
+			params := fn.ParametersJSONSchema
+			if params == nil && fn.Parameters != nil {
+				params = GeminiSchemaToJSONSchema(fn.Parameters)
+			}
+			if params == nil {
+				params = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			out = append(out, types.ResponsesTool{
+				Type:        "function",
+				Name:        fn.Name,
+				Description: fn.Description,
+				Strict:      types.BoolPtr(false),
+				Parameters:  params,
+			})
+		}
+	}
+	return out
+}
+
+// GeminiSchemaToJSONSchema converts Gemini's OpenAPI schema subset to JSON
+// Schema: type names are lower-cased ("OBJECT" → "object"), nullable becomes
+// a "null" type alternative and the Gemini-only propertyOrdering is dropped.
+func GeminiSchemaToJSONSchema(schema any) any {
+	switch s := schema.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(s))
+		for k, v := range s {
+			switch k {
+			case "type":
+				if t, ok := v.(string); ok {
+					out[k] = strings.ToLower(t)
+					continue
+				}
+				out[k] = v
+			case "nullable", "propertyOrdering":
+			default:
+				out[k] = GeminiSchemaToJSONSchema(v)
+			}
+		}
+		if nullable, _ := s["nullable"].(bool); nullable {
+			if t, ok := out["type"].(string); ok {
+				out["type"] = []any{t, "null"}
+			}
+		}
+		return out
+	case []any:
+		out := make([]any, len(s))
+		for i, v := range s {
+			out[i] = GeminiSchemaToJSONSchema(v)
+		}
+		return out
+	default:
+		return schema
+	}
+}
+
+// GeminiToolChoiceToResponses maps functionCallingConfig to a Responses
+// tool_choice the way AnthropicToolChoiceToResponses does: NONE → "none", ANY
+// → required (or the single allowed function), anything else → "auto".
+func GeminiToolChoiceToResponses(cfg *types.GeminiToolConfig) any {
+	if cfg == nil || cfg.FunctionCallingConfig == nil {
+		return "auto"
+	}
+	fc := cfg.FunctionCallingConfig
+	switch strings.ToUpper(strings.TrimSpace(fc.Mode)) {
+	case "NONE":
+		return "none"
+	case "ANY":
+		if len(fc.AllowedFunctionNames) == 1 {
+			return map[string]any{"type": "function", "name": fc.AllowedFunctionNames[0]}
+		}
+		return map[string]any{"type": "required"}
+	default:
+		return "auto"
+	}
+}
+
+// GeminiResponseFormat returns the structured-output hint for a
+// generationConfig, in the shape ResponseFormatToTextFormat accepts: a JSON
+// schema when responseSchema is set with a JSON mime type, json_object for a
+// bare JSON mime type, and nil otherwise.
+func GeminiResponseFormat(cfg *types.GeminiGenerationConfig) any {
+	if cfg == nil || !strings.EqualFold(strings.TrimSpace(cfg.ResponseMimeType), "application/json") {
+		return nil
+	}
+	if cfg.ResponseSchema != nil {
+		return map[string]any{"type": "json_schema", "schema": GeminiSchemaToJSONSchema(cfg.ResponseSchema)}
+	}
+	return map[string]any{"type": "json_object"}
+}
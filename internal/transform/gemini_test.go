@@ -0,0 +1,76 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+func TestGeminiMessagesToResponsesInput(t *testing.T) {
+	var contents []types.GeminiContent
+	err := json.Unmarshal([]byte(`[
+		{"role":"user","parts":[{"text":"What is in this image?"},{"inlineData":{"mimeType":"image/png","data":"iVBORw0KGgo"}}]},
+		{"role":"model","parts":[{"text":"thinking","thought":true},{"text":"Let me look it up."},{"functionCall":{"name":"lookup","args":{"q":"cat"}}}]},
+		{"role":"user","parts":[{"functionResponse":{"name":"lookup","response":{"result":"a cat"}}}]}
+	]`), &contents)
+	if err != nil {
+		t.Fatalf("unmarshal contents: %v", err)
+	}
+
+	got, err := GeminiMessagesToResponsesInput(contents)
+	if err != nil {
+		t.Fatalf("GeminiMessagesToResponsesInput returned error: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 input items, got %d: %+v", len(got), got)
+	}
+	wantUser := []types.ResponsesContent{
+		{Type: "input_text", Text: "What is in this image?"},
+		{Type: "input_image", ImageURL: "data:image/png;base64,iVBORw0KGgo"},
+	}
+	if got[0].Role != "user" || !reflect.DeepEqual(got[0].Content, wantUser) {
+		t.Errorf("unexpected user item: %+v", got[0])
+	}
+	if got[1].Role != "assistant" || len(got[1].Content) != 1 || !reflect.DeepEqual(got[1].Content[0], types.ResponsesContent{Type: "output_text", Text: "Let me look it up."}) {
+		t.Errorf("thought part should be dropped from the model turn: %+v", got[1])
+	}
+	if got[2].Type != "function_call" || got[2].Name != "lookup" || got[2].Arguments != `{"q":"cat"}` || got[2].CallID == "" {
+		t.Errorf("unexpected function_call item: %+v", got[2])
+	}
+	if got[3].Type != "function_call_output" || got[3].CallID != got[2].CallID || got[3].Output != `{"result":"a cat"}` {
+		t.Errorf("functionResponse should answer the pending call %q: %+v", got[2].CallID, got[3])
+	}
+
+	_, err = GeminiMessagesToResponsesInput([]types.GeminiContent{{Role: "user", Parts: []types.GeminiPart{{InlineData: &types.GeminiBlob{MimeType: "audio/wav", Data: "AAAA"}}}}})
+	if err == nil {
+		t.Error("non-image inlineData should be rejected")
+	}
+}
+
+func TestGeminiSchemaToJSONSchema(t *testing.T) {
+	var schema any
+	json.Unmarshal([]byte(`{
+		"type":"OBJECT",
+		"propertyOrdering":["city","days"],
+		"properties":{
+			"city":{"type":"STRING","nullable":true},
+			"days":{"type":"ARRAY","items":{"type":"INTEGER"}}
+		},
+		"required":["city"]
+	}`), &schema) //nolint:errcheck
+	var want any
+	json.Unmarshal([]byte(`{
+		"type":"object",
+		"properties":{
+			"city":{"type":["string","null"]},
+			"days":{"type":"array","items":{"type":"integer"}}
+		},
+		"required":["city"]
+	}`), &want) //nolint:errcheck
+
+	if got := GeminiSchemaToJSONSchema(schema); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -35,6 +35,21 @@ func ChatMessagesToResponsesInput(messages []types.ChatMessage) []types.Response
 			continue
 		}
 
+		// An assistant turn may carry text alongside tool_calls; the text was
+		// produced before the calls, so it is replayed first.
+		contentItems := extractContentItems(message.Content, role)
+		if len(contentItems) > 0 {
+			roleOut := "user"
+			if role == "assistant" {
+				roleOut = "assistant"
+			}
+			inputItems = append(inputItems, types.ResponsesInputItem{
+				Type:    "message",
+				Role:    roleOut,
+				Content: contentItems,
+			})
+		}
+
 		if role == "assistant" {
 			for _, tc := range message.ToolCalls {
 				tcType := tc.Type
@@ -54,21 +69,6 @@ func ChatMessagesToResponsesInput(messages []types.ChatMessage) []types.Response
 				}
 			}
 		}
-
-		contentItems := extractContentItems(message.Content, role)
-		if len(contentItems) == 0 {
-			continue
-		}
-
-		roleOut := "user"
-		if role == "assistant" {
-			roleOut = "assistant"
-		}
-		inputItems = append(inputItems, types.ResponsesInputItem{
-			Type:    "message",
-			Role:    roleOut,
-			Content: contentItems,
-		})
 	}
 
 	return inputItems
@@ -80,6 +80,26 @@ func TestChatMessagesToResponsesInput(t *testing.T) {
 				return items[0].Type == "function_call" && items[0].Name == "get_weather"
 			},
 		},
+		{
+			name: "assistant with text and tool_calls",
+			messages: []types.ChatMessage{
+				{
+					Role:    "assistant",
+					Content: "Checking both cities.",
+					ToolCalls: []types.ToolCall{
+						{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"NYC"}`}},
+						{ID: "call_2", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"SF"}`}},
+					},
+				},
+			},
+			wantLen: 3,
+			check: func(items []types.ResponsesInputItem) bool {
+				return items[0].Type == "message" && items[0].Role == "assistant" &&
+					items[0].Content[0].Text == "Checking both cities." &&
+					items[1].Type == "function_call" && items[1].CallID == "call_1" &&
+					items[2].Type == "function_call" && items[2].CallID == "call_2"
+			},
+		},
 		{
 			name: "multimodal content",
 			messages: []types.ChatMessage{
@@ -33,7 +33,7 @@ func ToDataURL(imageStr string) string {
 // Input stays []any because Ollama messages have a custom format requiring dynamic parsing.
 func ConvertOllamaMessages(messages []any, topImages []string) []types.ChatMessage {
 	var out []types.ChatMessage
-	var pendingCallIDs []string
+	var pending []pendingOllamaCall
 	callCounter := 0
 
 	for _, m := range messages {
@@ -43,7 +43,7 @@ func ConvertOllamaMessages(messages []any, topImages []string) []types.ChatMessa
 		}
 		role, _ := msg["role"].(string)
 		if role == "" {
-			role = "user"
+			role = inferOllamaRole(msg)
 		}
 		nm := types.ChatMessage{Role: role}
 
@@ -65,6 +65,12 @@ func ConvertOllamaMessages(messages []any, topImages []string) []types.ChatMessa
 			}
 		case string:
 			parts = append(parts, map[string]any{"type": "text", "text": c})
+		case map[string]any:
+			// Structured tool results arrive as JSON objects.
+			if role == "tool" {
+				b, _ := json.Marshal(c)
+				parts = append(parts, map[string]any{"type": "text", "text": string(b)})
+			}
 		}
 
 		// Handle images
@@ -107,7 +113,7 @@ func ConvertOllamaMessages(messages []any, topImages []string) []types.ChatMessa
 						callCounter++
 						callID = fmt.Sprintf("ollama_call_%d", callCounter)
 					}
-					pendingCallIDs = append(pendingCallIDs, callID)
+					pending = append(pending, pendingOllamaCall{id: callID, name: name})
 
 					args := "{}"
 					if a, ok := fn["arguments"].(string); ok {
@@ -135,9 +141,11 @@ func ConvertOllamaMessages(messages []any, topImages []string) []types.ChatMessa
 			if tci == "" {
 				tci, _ = msg["id"].(string)
 			}
-			if tci == "" && len(pendingCallIDs) > 0 {
-				tci = pendingCallIDs[0]
-				pendingCallIDs = pendingCallIDs[1:]
+			if tci == "" {
+				toolName, _ := msg["tool_name"].(string)
+				tci, pending = takePendingOllamaCall(pending, toolName)
+			} else {
+				pending = dropPendingOllamaCall(pending, tci)
 			}
 			if tci != "" {
 				nm.ToolCallID = tci
@@ -182,6 +190,56 @@ func ConvertOllamaMessages(messages []any, topImages []string) []types.ChatMessa
 	return out
 }
 
+// pendingOllamaCall is an assistant tool call still awaiting its result.
+type pendingOllamaCall struct {
+	id   string
+	name string
+}
+
+// inferOllamaRole picks a role for messages that omit it: tool results carry
+// tool_call_id/tool_name, assistant turns carry tool_calls.
+func inferOllamaRole(msg map[string]any) string {
+	if _, ok := msg["tool_call_id"].(string); ok {
+		return "tool"
+	}
+	if _, ok := msg["tool_name"].(string); ok {
+		return "tool"
+	}
+	if _, ok := msg["tool_calls"].([]any); ok {
+		return "assistant"
+	}
+	return "user"
+}
+
+// takePendingOllamaCall returns the ID of the oldest pending call matching
+// toolName (or the oldest call at all when no name is given or none match).
+func takePendingOllamaCall(pending []pendingOllamaCall, toolName string) (string, []pendingOllamaCall) {
+	if len(pending) == 0 {
+		return "", pending
+	}
+	idx := 0
+	if toolName != "" {
+		for i, p := range pending {
+			if p.name == toolName {
+				idx = i
+				break
+			}
+		}
+	}
+	id := pending[idx].id
+	return id, append(pending[:idx:idx], pending[idx+1:]...)
+}
+
+// dropPendingOllamaCall removes an explicitly answered call from pending.
+func dropPendingOllamaCall(pending []pendingOllamaCall, id string) []pendingOllamaCall {
+	for i, p := range pending {
+		if p.id == id {
+			return append(pending[:i:i], pending[i+1:]...)
+		}
+	}
+	return pending
+}
+
 // NormalizeOllamaTools converts Ollama-format tools to OpenAI function tool format.
 // Input stays []any because Ollama tools have varying schemas.
 func NormalizeOllamaTools(tools []any) []types.ChatTool {
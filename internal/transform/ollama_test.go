@@ -0,0 +1,43 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConvertOllamaToolResultMessages(t *testing.T) {
+	var messages []any
+	if err := json.Unmarshal([]byte(`[
+		{"role":"user","content":"weather and time in Paris?"},
+		{"role":"assistant","tool_calls":[
+			{"function":{"name":"get_weather","arguments":{"city":"Paris"}}},
+			{"function":{"name":"get_time","arguments":{"tz":"Europe/Paris"}}}
+		]},
+		{"role":"tool","tool_name":"get_time","content":"12:00"},
+		{"tool_name":"get_weather","content":{"temp":21}}
+	]`), &messages); err != nil {
+		t.Fatal(err)
+	}
+
+	items := ChatMessagesToResponsesInput(ConvertOllamaMessages(messages, nil))
+
+	calls := map[string]string{}
+	outputs := map[string]string{}
+	for _, it := range items {
+		switch it.Type {
+		case "function_call":
+			calls[it.Name] = it.CallID
+		case "function_call_output":
+			outputs[it.CallID] = it.Output
+		}
+	}
+	if len(calls) != 2 || len(outputs) != 2 {
+		t.Fatalf("expected 2 calls and 2 outputs, got %+v", items)
+	}
+	if got := outputs[calls["get_time"]]; got != "12:00" {
+		t.Errorf("get_time output: got %q", got)
+	}
+	if got := outputs[calls["get_weather"]]; got != `{"temp":21}` {
+		t.Errorf("get_weather output: got %q", got)
+	}
+}
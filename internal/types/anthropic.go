@@ -16,6 +16,26 @@ type AnthropicMessagesRequest struct {
 	Stream        bool               `json:"stream,omitempty"`
 	MaxTokens     int                `json:"max_tokens,omitempty"`
 	StopSequences []string           `json:"stop_sequences,omitempty"`
+	// ResponseFormat/OutputFormat are structured-output hints mapped to the
+	// upstream text.format directive.
+	ResponseFormat any `json:"response_format,omitempty"`
+	OutputFormat   any `json:"output_format,omitempty"`
+	// Metadata.UserID salts the derived prompt-cache session; it is never
+	// forwarded upstream.
+	Metadata *AnthropicMetadata `json:"metadata,omitempty"`
+}
+
+// AnthropicMetadata is the request metadata object of the Messages API.
+type AnthropicMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// MetadataUserID returns the trimmed metadata.user_id, or "" when absent.
+func (r *AnthropicMessagesRequest) MetadataUserID() string {
+	if r.Metadata == nil {
+		return ""
+	}
+	return strings.TrimSpace(r.Metadata.UserID)
 }
 
 // AnthropicCountTokensRequest is the incoming body for POST /v1/messages/count_tokens.
@@ -70,11 +90,12 @@ type AnthropicMessageResponse struct {
 
 // AnthropicContentOut represents response content blocks.
 type AnthropicContentOut struct {
-	Type  string `json:"type"`
-	Text  string `json:"text,omitempty"`
-	ID    string `json:"id,omitempty"`
-	Name  string `json:"name,omitempty"`
-	Input any    `json:"input,omitempty"`
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Input     any    `json:"input,omitempty"`
+	Citations []any  `json:"citations,omitempty"`
 }
 
 // AnthropicUsage holds Messages API usage.
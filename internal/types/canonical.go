@@ -8,13 +8,19 @@ type CanonicalRequest struct {
 	ResponseFormat string // "chat", "responses", "text", "anthropic", "ollama"
 
 	// Model fields
-	RequestedModel string // original model string from the client
-	Model          string // normalized model for upstream
+	RequestedModel    string // original model string from the client (after --legacy-model-target)
+	Model             string // normalized model for upstream
+	DeprecationNotice string // --legacy-model-target remap notice for the X-Chatmock-Deprecation header
 
 	// Streaming
 	Stream       bool
+	StreamSet    bool // body carried an explicit "stream" boolean
 	IncludeUsage bool
 
+	// MaxOutputTokens is the client's max_output_tokens, max_completion_tokens
+	// or max_tokens (0 when unset); see ServerConfig.OutputTokenLimit.
+	MaxOutputTokens int
+
 	// Input
 	InputItems    []ResponsesInputItem
 	Instructions  string
@@ -27,12 +33,16 @@ type CanonicalRequest struct {
 	HadResponsesTools bool
 	ToolChoice        any
 	ParallelToolCalls bool
+	ToolNameMap       map[string]string // upstream tool name → client name (--canonical-tool-names)
 
 	// Responses API fields
 	PreviousResponseID     string
 	ConversationID         string
+	Metadata               map[string]string // request metadata, kept for GET /v1/responses filtering
 	AutoPreviousResponseID bool
 	Include                []string
+	TextFormat             map[string]any // text.format from response_format
+	Truncation             string         // "auto" trims history on a context-length error; never sent upstream
 
 	// Reasoning
 	ReasoningParam  *ReasoningParam
@@ -46,8 +56,17 @@ type CanonicalRequest struct {
 	// Session
 	SessionID string
 
+	// SafetyIdentifier is forwarded upstream as safety_identifier.
+	SafetyIdentifier string
+
 	// Diagnostics
 	UsedPromptFallback      bool
 	UsedInputFallback       bool
 	DefaultWebSearchApplied bool
+	UnknownFields           []string // top-level request fields the proxy does not recognize
+	LostContextResponseID   string   // conversation link outlived this response entry
+	DroppedIncludes         []string // include values removed by --allowed-includes
+	RequestedN              int      // chat n; a single choice is always returned
+	HasStreamOptions        bool     // body carried stream_options, which only streams use
+	ToolResultAcks          int      // assistant acknowledgements added by --ack-tool-results
 }
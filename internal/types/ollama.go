@@ -62,6 +62,22 @@ type OllamaModelList struct {
 	Models []OllamaModelEntry `json:"models"`
 }
 
+// OllamaProcessEntry represents a loaded model in the Ollama ps list.
+type OllamaProcessEntry struct {
+	Name      string             `json:"name"`
+	Model     string             `json:"model"`
+	Size      int64              `json:"size"`
+	Digest    string             `json:"digest"`
+	Details   OllamaModelDetails `json:"details"`
+	ExpiresAt string             `json:"expires_at"`
+	SizeVRAM  int64              `json:"size_vram"`
+}
+
+// OllamaProcessList is the response for GET /api/ps.
+type OllamaProcessList struct {
+	Models []OllamaProcessEntry `json:"models"`
+}
+
 // OllamaShowResponse is the response for POST /api/show.
 type OllamaShowResponse struct {
 	Modelfile    string             `json:"modelfile"`
@@ -1,5 +1,7 @@
 package types
 
+import "encoding/json"
+
 // --- Request types ---
 
 // ChatCompletionRequest represents an OpenAI chat completion request.
@@ -15,6 +17,8 @@ type ChatCompletionRequest struct {
 	ResponsesTools      []any           `json:"responses_tools,omitempty"`
 	ResponsesToolChoice string          `json:"responses_tool_choice,omitempty"`
 	Prompt              string          `json:"prompt,omitempty"`
+	ResponseFormat      any             `json:"response_format,omitempty"`
+	N                   int             `json:"n,omitempty"`
 }
 
 // ChatMessage represents an OpenAI chat message.
@@ -76,6 +80,25 @@ type ReasoningParam struct {
 	Summary string `json:"summary,omitempty"`
 }
 
+// UnmarshalJSON accepts the legacy generate_summary field as an alias for
+// summary; summary wins when both are present.
+func (p *ReasoningParam) UnmarshalJSON(data []byte) error {
+	var alias struct {
+		Effort          string `json:"effort"`
+		Summary         string `json:"summary"`
+		GenerateSummary string `json:"generate_summary"`
+	}
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	p.Effort = alias.Effort
+	p.Summary = alias.Summary
+	if p.Summary == "" {
+		p.Summary = alias.GenerateSummary
+	}
+	return nil
+}
+
 // --- Response types ---
 
 // ChatCompletionResponse represents a non-streaming chat completion response.
@@ -101,7 +124,7 @@ type ChatChoice struct {
 // ChatResponseMsg is the message in a non-streaming response choice.
 type ChatResponseMsg struct {
 	Role             string     `json:"role"`
-	Content          string     `json:"content"`
+	Content          *string    `json:"content"` // null when the model refused
 	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 	Reasoning        any        `json:"reasoning,omitempty"`
 	ReasoningSummary string     `json:"reasoning_summary,omitempty"`
@@ -137,6 +160,7 @@ type ChatDelta struct {
 	Reasoning        any        `json:"reasoning,omitempty"`
 	ReasoningSummary string     `json:"reasoning_summary,omitempty"`
 	Refusal          string     `json:"refusal,omitempty"`
+	Annotations      []any      `json:"annotations,omitempty"`
 }
 
 // ReasoningContent represents o3 compat mode reasoning content.
@@ -168,6 +192,21 @@ type TextChoice struct {
 	Logprobs     any     `json:"logprobs"`
 }
 
+// TokenLogprob is one output token's log probability as reported upstream.
+type TokenLogprob struct {
+	Token       string         `json:"token"`
+	Logprob     float64        `json:"logprob"`
+	TopLogprobs []TokenLogprob `json:"top_logprobs,omitempty"`
+}
+
+// TextLogprobs is the legacy completions choices[].logprobs object.
+type TextLogprobs struct {
+	Tokens        []string             `json:"tokens"`
+	TokenLogprobs []float64            `json:"token_logprobs"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs"`
+	TextOffset    []int                `json:"text_offset"`
+}
+
 // TextCompletionChunk represents a streaming text completion chunk.
 type TextCompletionChunk struct {
 	ID      string            `json:"id"`
@@ -39,14 +39,21 @@ func (req *ResponsesRequest) ParseInput() ([]ResponsesInputItem, error) {
 
 // ResponsesResponse is the non-streaming response for POST /v1/responses.
 type ResponsesResponse struct {
-	ID        string                `json:"id"`
-	Object    string                `json:"object"`
-	CreatedAt int64                 `json:"created_at"`
-	Model     string                `json:"model"`
-	Output    []ResponsesOutputItem `json:"output"`
-	Status    string                `json:"status"`
-	Usage     *ResponsesUsage       `json:"usage,omitempty"`
-	Error     *ErrorDetail          `json:"error,omitempty"`
+	ID                string                `json:"id"`
+	Object            string                `json:"object"`
+	CreatedAt         int64                 `json:"created_at"`
+	Model             string                `json:"model"`
+	Output            []ResponsesOutputItem `json:"output"`
+	Status            string                `json:"status"`
+	IncompleteDetails *IncompleteDetails    `json:"incomplete_details,omitempty"`
+	Usage             *ResponsesUsage       `json:"usage,omitempty"`
+	Error             *ErrorDetail          `json:"error,omitempty"`
+	SystemFingerprint string                `json:"system_fingerprint,omitempty"`
+}
+
+// IncompleteDetails explains why a response has status "incomplete".
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
 }
 
 // ResponsesOutputItem represents a single output item in the Responses API response.
@@ -92,6 +99,9 @@ type ResponsesInputItem struct {
 	Input     string             `json:"input,omitempty"`
 	CallID    string             `json:"call_id,omitempty"`
 	Output    string             `json:"-"`
+	// ID is the item id: the target of an item_reference, or the upstream id
+	// of a stored output item. It is never sent upstream.
+	ID string `json:"-"`
 }
 
 // MarshalJSON implements custom JSON marshaling for ResponsesInputItem.
@@ -133,12 +143,20 @@ type Alias struct {
 	Input     string          `json:"input,omitempty"`
 	CallID    string          `json:"call_id,omitempty"`
 	Output    json.RawMessage `json:"output,omitempty"`
+	ID        string          `json:"id,omitempty"`
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for ResponsesInputItem.
 // It handles `content` as either a plain string or an array of ResponsesContent,
 // and defaults `type` to "message" when `role` is present but `type` is absent.
+// A bare string item, as loosely-typed clients mix into input arrays, becomes
+// a user message.
 func (item *ResponsesInputItem) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*item = ResponsesInputItem{Type: "message", Role: "user", Content: []ResponsesContent{{Type: "input_text", Text: text}}}
+		return nil
+	}
 	var alias Alias
 	if err := json.Unmarshal(data, &alias); err != nil {
 		return err
@@ -150,6 +168,7 @@ func (item *ResponsesInputItem) UnmarshalJSON(data []byte) error {
 	item.Input = alias.Input
 	item.CallID = alias.CallID
 	item.Output = parseResponsesOutput(alias.Output)
+	item.ID = alias.ID
 
 	if alias.Content != nil {
 		var s string
@@ -208,9 +227,11 @@ func parseResponsesOutput(raw json.RawMessage) string {
 
 // ResponsesContent represents a content item in a Responses API input message.
 type ResponsesContent struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	ImageURL string `json:"image_url,omitempty"`
+	Type        string           `json:"type"`
+	Text        string           `json:"text,omitempty"`
+	ImageURL    string           `json:"image_url,omitempty"`
+	Refusal     string           `json:"refusal,omitempty"`
+	Annotations []map[string]any `json:"annotations,omitempty"` // output_text citations
 }
 
 // ResponsesTool represents a tool in the Responses API format.
@@ -119,6 +119,28 @@ func TestParseInputAssistantStringContent(t *testing.T) {
 	}
 }
 
+func TestParseInputMixedBareStrings(t *testing.T) {
+	req := &ResponsesRequest{
+		Input: json.RawMessage(`["hello", {"role":"user","content":"world"}]`),
+	}
+	items, err := req.ParseInput()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(items))
+	}
+	for i, want := range []string{"hello", "world"} {
+		item := items[i]
+		if item.Type != "message" || item.Role != "user" || len(item.Content) != 1 {
+			t.Fatalf("item %d: expected a user message, got %+v", i, item)
+		}
+		if c := item.Content[0]; c.Type != "input_text" || c.Text != want {
+			t.Errorf("item %d: expected input_text %q, got %+v", i, want, c)
+		}
+	}
+}
+
 func TestParseInputInvalid(t *testing.T) {
 	req := &ResponsesRequest{
 		Input: json.RawMessage(`123`), // not string or array
@@ -0,0 +1,54 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/n0madic/go-chatmock/internal/metrics"
+)
+
+// ErrAttemptBudgetExhausted is returned by Do and DoRaw once the request
+// context has used every upstream call allowed by WithAttemptBudget.
+var ErrAttemptBudgetExhausted = errors.New("upstream attempt budget exhausted")
+
+type attemptBudgetKey struct{}
+
+// WithAttemptBudget returns a context that allows at most max physical
+// upstream calls across Do, DoRaw and every retry built on them
+// (--max-upstream-attempts). max <= 0 leaves ctx unlimited; an existing budget
+// is kept so nested callers cannot widen it.
+func WithAttemptBudget(ctx context.Context, max int) context.Context {
+	if max <= 0 || ctx.Value(attemptBudgetKey{}) != nil {
+		return ctx
+	}
+	left := &atomic.Int64{}
+	left.Store(int64(max))
+	return context.WithValue(ctx, attemptBudgetKey{}, left)
+}
+
+// AttemptsLeft reports whether ctx still allows another upstream call.
+func AttemptsLeft(ctx context.Context) bool {
+	left, ok := ctx.Value(attemptBudgetKey{}).(*atomic.Int64)
+	return !ok || left.Load() > 0
+}
+
+// spendAttempt reserves one upstream call, reporting false when the budget is
+// already used up.
+func spendAttempt(ctx context.Context) bool {
+	left, ok := ctx.Value(attemptBudgetKey{}).(*atomic.Int64)
+	return !ok || left.Add(-1) >= 0
+}
+
+// CanRetry reports whether ctx allows another upstream call for the named
+// retry strategy, logging when the budget cuts the retry short. Allowed
+// retries are counted in the upstream_retries_total metric.
+func CanRetry(ctx context.Context, strategy string) bool {
+	if AttemptsLeft(ctx) {
+		metrics.ObserveRetry(ctx, strategy)
+		return true
+	}
+	slog.Warn("upstream.attempt_budget_exhausted", "skipped_retry", strategy)
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -16,7 +17,9 @@ import (
 
 	"github.com/n0madic/go-chatmock/internal/auth"
 	"github.com/n0madic/go-chatmock/internal/config"
+	"github.com/n0madic/go-chatmock/internal/metrics"
 	"github.com/n0madic/go-chatmock/internal/session"
+	"github.com/n0madic/go-chatmock/internal/stream"
 	"github.com/n0madic/go-chatmock/internal/types"
 )
 
@@ -38,7 +41,11 @@ type Request struct {
 	Include           []string
 	Store             *bool
 	ReasoningParam    *types.ReasoningParam
-	SessionID         string // Client-supplied session ID override
+	SessionID         string         // Client-supplied session ID override
+	TextFormat        map[string]any // Responses text.format (structured outputs)
+	SafetyIdentifier  string         // End-user identifier for upstream abuse detection
+	SessionSalt       string         // End-user identifier mixed into the derived session; never sent upstream
+	TopLogprobs       int            // Alternatives per token alongside message.output_text.logprobs; zero omits it
 }
 
 // Response wraps the upstream HTTP response.
@@ -55,7 +62,17 @@ type Client struct {
 	HTTPClient   *http.Client
 	Verbose      bool
 	Debug        bool
-	dumpMu       sync.Mutex
+	// OmitReasoningInclude stops reasoning.encrypted_content being added to
+	// reasoning requests (it is not in --allowed-includes).
+	OmitReasoningInclude bool
+	// IdleTimeout fails a response body read with stream.ErrIdleTimeout after
+	// this much upstream silence; zero disables it (--upstream-idle-timeout).
+	IdleTimeout time.Duration
+	// RedactReasoning drops reasoning items from --debug response dumps
+	// (--redact-reasoning-in-logs).
+	RedactReasoning bool
+
+	dumpMu sync.Mutex
 }
 
 // NewClient creates a new upstream client.
@@ -76,7 +93,7 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 		return nil, auth.ErrNoCredentials
 	}
 
-	sessionID := c.Sessions.EnsureSessionID(req.Instructions, req.InputItems, req.SessionID)
+	sessionID := c.Sessions.EnsureUserSessionID(req.SessionSalt, req.Instructions, req.InputItems, req.SessionID)
 
 	// Normalize tool_choice for upstream
 	toolChoice := req.ToolChoice
@@ -92,7 +109,7 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 	}
 
 	// Build SDK payload
-	includes := mergeIncludes(req.Include, req.ReasoningParam != nil)
+	includes := mergeIncludes(req.Include, req.ReasoningParam != nil && !c.OmitReasoningInclude)
 
 	payload := responses.ResponseNewParams{
 		Model:             req.Model,
@@ -112,8 +129,14 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 	if req.ReasoningParam != nil {
 		payload.Reasoning = reasoningToSDK(req.ReasoningParam)
 	}
+	if req.SafetyIdentifier != "" {
+		payload.SafetyIdentifier = openai.String(req.SafetyIdentifier)
+	}
+	if req.TopLogprobs > 0 {
+		payload.TopLogprobs = openai.Int(int64(req.TopLogprobs))
+	}
 
-	body, err := marshalWithStream(&payload)
+	body, err := marshalWithStream(&payload, req.TextFormat)
 	if err != nil {
 		return nil, err
 	}
@@ -165,6 +188,14 @@ func (c *Client) DoRaw(ctx context.Context, body []byte, sessionID string) (*Res
 
 // sendPayload is the shared HTTP send logic for both Do and DoRaw.
 func (c *Client) sendPayload(ctx context.Context, body []byte, sessionID, accessToken, accountID string) (*Response, error) {
+	if !spendAttempt(ctx) {
+		return nil, ErrAttemptBudgetExhausted
+	}
+	release, err := acquireSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", config.ResponsesURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
@@ -180,11 +211,21 @@ func (c *Client) sendPayload(ctx context.Context, body []byte, sessionID, access
 	// caching; the payload field may be required by older API versions.
 	httpReq.Header.Set("session_id", sessionID)
 
+	start := time.Now()
 	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
+		metrics.ObserveUpstream(ctx, 0, time.Since(start))
 		return nil, fmt.Errorf("upstream ChatGPT request failed: %w", err)
 	}
+	metrics.ObserveUpstream(ctx, resp.StatusCode, time.Since(start))
 	c.dumpUpstreamResponse(resp)
+	if err := jsonErrorBody(resp); err != nil {
+		return nil, err
+	}
+	resp.Body = stream.NewIdleTimeoutBody(resp.Body, c.IdleTimeout)
+	if metrics.Enabled() && resp.StatusCode < 400 {
+		resp.Body = &usageMetricsBody{src: resp.Body, ctx: ctx}
+	}
 	if c.Verbose {
 		requestID := upstreamRequestID(resp.Header)
 		attrs := []any{"status", resp.StatusCode}
@@ -201,11 +242,30 @@ func (c *Client) sendPayload(ctx context.Context, body []byte, sessionID, access
 	}, nil
 }
 
-// marshalWithStream marshals an SDK payload with stream=true injected.
+// jsonErrorBody returns a 502 UpstreamError carrying the body when the
+// upstream answers a successful status with JSON instead of an SSE stream,
+// which it only does to report an error. Handlers report it like any other
+// upstream error; without this, stream translators see zero SSE events and
+// report an empty response.
+func jsonErrorBody(resp *http.Response) *UpstreamError {
+	if resp.StatusCode >= 400 || !strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "application/json") {
+		return nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return &UpstreamError{StatusCode: http.StatusBadGateway, Body: body, Headers: resp.Header}
+}
+
+// marshalWithStream marshals an SDK payload with stream=true injected, plus
+// the text.format directive when set.
 // The SDK ResponseNewParams does not have a stream field, so we use
 // SetExtraFields to add it before marshaling.
-func marshalWithStream(payload *responses.ResponseNewParams) ([]byte, error) {
-	payload.SetExtraFields(map[string]any{"stream": true})
+func marshalWithStream(payload *responses.ResponseNewParams, textFormat map[string]any) ([]byte, error) {
+	extra := map[string]any{"stream": true}
+	if textFormat != nil {
+		extra["text"] = map[string]any{"format": textFormat}
+	}
+	payload.SetExtraFields(extra)
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
@@ -228,6 +288,16 @@ func upstreamRequestID(headers http.Header) string {
 	)
 }
 
+// IncludeReasoningContent is the include value added to reasoning requests.
+const IncludeReasoningContent = "reasoning.encrypted_content"
+
+// IncludeOutputTextLogprobs asks upstream for token logprobs on output_text
+// deltas.
+const IncludeOutputTextLogprobs = "message.output_text.logprobs"
+
+// MaxTopLogprobs is the most alternatives per token upstream returns.
+const MaxTopLogprobs = 20
+
 // mergeIncludes combines client-requested includes with the reasoning content
 // include that is required for the summary stream events to arrive. The
 // reasoning include is only added when a reasoning parameter is active to avoid
@@ -253,7 +323,7 @@ func mergeIncludes(clientInclude []string, includeReasoning bool) []string {
 		add(v)
 	}
 	if includeReasoning {
-		add("reasoning.encrypted_content")
+		add(IncludeReasoningContent)
 	}
 
 	return merged
@@ -1,6 +1,7 @@
 package upstream
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
 	"os"
@@ -206,3 +207,15 @@ func TestDumpUpstreamResponseSSEWithoutContentTypeStillFilters(t *testing.T) {
 		t.Fatalf("did not expect event prelude lines in body dump, got %q", dumpStr)
 	}
 }
+
+func TestDropReasoningOutputFromDump(t *testing.T) {
+	payload := []byte(`{"type":"response.completed","response":{"id":"resp_1","output":[{"type":"reasoning","summary":[{"type":"summary_text","text":"secret plan"}]},{"type":"message","content":[{"type":"output_text","text":"Answer"}]}]}}`)
+	var obj map[string]any
+	if err := json.Unmarshal(payload, &obj); err != nil {
+		t.Fatal(err)
+	}
+	got := string(dropReasoningOutput(obj, payload))
+	if strings.Contains(got, "secret plan") || !strings.Contains(got, "Answer") {
+		t.Errorf("dump payload: %s", got)
+	}
+}
@@ -0,0 +1,93 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrConcurrencyLimited is returned by Do and DoRaw when every upstream slot
+// is taken and the wait backlog is full (--max-concurrent-requests).
+var ErrConcurrencyLimited = errors.New("too many concurrent upstream requests; retry later")
+
+// ConcurrencyLimiter bounds how many upstream calls run at once. Callers
+// beyond the limit wait in a backlog of fixed size; once that is full they
+// are rejected with ErrConcurrencyLimited instead of queueing.
+type ConcurrencyLimiter struct {
+	slots   chan struct{}
+	waiting atomic.Int64
+	backlog int64
+}
+
+// NewConcurrencyLimiter returns a limiter allowing limit concurrent upstream
+// calls with up to backlog callers waiting for a slot. limit <= 0 returns
+// nil, which never limits.
+func NewConcurrencyLimiter(limit, backlog int) *ConcurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &ConcurrencyLimiter{slots: make(chan struct{}, limit), backlog: int64(max(backlog, 0))}
+}
+
+// acquire takes a slot, waiting in the backlog when none is free. The
+// returned func releases the slot.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context) (func(), error) {
+	release := func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if l.waiting.Add(1) > l.backlog {
+		l.waiting.Add(-1)
+		return nil, ErrConcurrencyLimited
+	}
+	defer l.waiting.Add(-1)
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// concurrencyGate is the per-request context value: the shared limiter plus
+// whether it turned this request away.
+type concurrencyGate struct {
+	limiter  *ConcurrencyLimiter
+	rejected atomic.Bool
+}
+
+type concurrencyGateKey struct{}
+
+// WithConcurrencyLimiter returns a context whose upstream calls take a slot
+// from l for as long as it takes the upstream to answer with headers. The
+// streamed body is read outside the slot, so long generations do not hold it.
+// A nil l leaves ctx unlimited.
+func WithConcurrencyLimiter(ctx context.Context, l *ConcurrencyLimiter) context.Context {
+	if l == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, concurrencyGateKey{}, &concurrencyGate{limiter: l})
+}
+
+// ConcurrencyLimited reports whether an upstream call made with ctx was
+// rejected with ErrConcurrencyLimited.
+func ConcurrencyLimited(ctx context.Context) bool {
+	gate, ok := ctx.Value(concurrencyGateKey{}).(*concurrencyGate)
+	return ok && gate.rejected.Load()
+}
+
+// acquireSlot takes an upstream slot for ctx, returning a no-op release when
+// ctx carries no limiter.
+func acquireSlot(ctx context.Context) (func(), error) {
+	gate, ok := ctx.Value(concurrencyGateKey{}).(*concurrencyGate)
+	if !ok {
+		return func() {}, nil
+	}
+	release, err := gate.limiter.acquire(ctx)
+	if errors.Is(err, ErrConcurrencyLimited) {
+		gate.rejected.Store(true)
+	}
+	return release, err
+}
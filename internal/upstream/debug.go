@@ -206,6 +206,9 @@ func (d *debugDumpReadCloser) handleSSEFrame(frame []byte) {
 		if typ != "response.completed" && typ != "response.failed" {
 			continue
 		}
+		if d.client != nil && d.client.RedactReasoning {
+			payload = dropReasoningOutput(obj, payload)
+		}
 		d.hasData = true
 		d.lastByte = '\n'
 		if d.client != nil {
@@ -216,6 +219,28 @@ func (d *debugDumpReadCloser) handleSSEFrame(frame []byte) {
 	}
 }
 
+// dropReasoningOutput removes reasoning items from the output of a terminal
+// response event, returning payload unchanged when it has none.
+func dropReasoningOutput(obj map[string]any, payload []byte) []byte {
+	resp, _ := obj["response"].(map[string]any)
+	output, _ := resp["output"].([]any)
+	kept := make([]any, 0, len(output))
+	for _, item := range output {
+		if m, ok := item.(map[string]any); ok && m["type"] == "reasoning" {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	if len(kept) == len(output) {
+		return payload
+	}
+	resp["output"] = kept
+	if b, err := json.Marshal(obj); err == nil {
+		return b
+	}
+	return payload
+}
+
 func (d *debugDumpReadCloser) writeRawChunk(chunk []byte) {
 	if d == nil || len(chunk) == 0 {
 		return
@@ -2,6 +2,7 @@ package upstream
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
@@ -26,6 +27,7 @@ func (e *UpstreamError) Error() string {
 // DoWithRetry sends a request and retries on failure:
 // 1. If hadResponsesTools is true and upstream rejects, retries with baseTools.
 // 2. If store is set and upstream rejects it as unsupported, retries without store.
+// Retries stop early once the context's attempt budget is spent (WithAttemptBudget).
 // Returns the successful response, or an UpstreamError with the final error details.
 func (c *Client) DoWithRetry(
 	ctx context.Context,
@@ -35,7 +37,18 @@ func (c *Client) DoWithRetry(
 ) (*Response, *UpstreamError) {
 	resp, err := c.Do(ctx, req)
 	if err != nil {
-		return nil, &UpstreamError{StatusCode: http.StatusUnauthorized, Body: []byte(err.Error())}
+		var upErr *UpstreamError
+		if errors.As(err, &upErr) {
+			return nil, upErr
+		}
+		status := http.StatusUnauthorized
+		switch {
+		case errors.Is(err, ErrAttemptBudgetExhausted):
+			status = http.StatusBadGateway
+		case errors.Is(err, ErrConcurrencyLimited):
+			status = http.StatusTooManyRequests
+		}
+		return nil, &UpstreamError{StatusCode: status, Body: []byte(err.Error())}
 	}
 	limits.RecordFromResponse(resp.Headers)
 
@@ -63,7 +76,7 @@ func (c *Client) retryOnFailure(
 	latestHeaders := resp.Headers
 
 	// Strategy 1: retry without responses_tools
-	if hadResponsesTools {
+	if hadResponsesTools && CanRetry(ctx, "responses_tools") {
 		req.Tools = baseTools
 		resp2, err2 := c.Do(ctx, req)
 		if err2 != nil {
@@ -83,7 +96,7 @@ func (c *Client) retryOnFailure(
 	}
 
 	// Strategy 2: retry without store
-	if req.Store != nil && state.IsUnsupportedParameterError(errBody, "store") {
+	if req.Store != nil && state.IsUnsupportedParameterError(errBody, "store") && CanRetry(ctx, "store") {
 		if c.Verbose {
 			slog.Warn("upstream rejected store parameter; retrying without store")
 		}
@@ -124,7 +137,7 @@ func (c *Client) RetryIfStoreUnsupported(
 	errBody, _ = io.ReadAll(resp.Body.Body)
 	resp.Body.Body.Close()
 
-	if req.Store == nil || !state.IsUnsupportedParameterError(errBody, "store") {
+	if req.Store == nil || !state.IsUnsupportedParameterError(errBody, "store") || !CanRetry(ctx, "store") {
 		return nil, errBody, false, nil
 	}
 
@@ -0,0 +1,181 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/n0madic/go-chatmock/internal/auth"
+	"github.com/n0madic/go-chatmock/internal/types"
+)
+
+// scriptedTransport replies with the queued status/body pairs in order and
+// succeeds once they run out.
+type scriptedTransport struct {
+	replies []string
+	calls   int
+}
+
+func (s *scriptedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	s.calls++
+	status, body := http.StatusOK, "data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",\"output\":[]}}\n\n"
+	if len(s.replies) > 0 {
+		status, body = http.StatusBadRequest, s.replies[0]
+		s.replies = s.replies[1:]
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func TestDoWithRetryHonorsAttemptBudget(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	const (
+		toolsErr = `{"error":{"message":"Tool 'web_search' is not available."}}`
+		storeErr = `{"error":{"message":"Unsupported parameter: store"}}`
+	)
+
+	for _, tt := range []struct {
+		budget    int
+		wantCalls int
+		wantErr   string // substring of the returned error; "" means success
+	}{
+		{budget: 0, wantCalls: 3},
+		{budget: 3, wantCalls: 3},
+		{budget: 2, wantCalls: 2, wantErr: "Unsupported parameter: store"},
+		{budget: 1, wantCalls: 1, wantErr: "is not available"},
+	} {
+		transport := &scriptedTransport{replies: []string{toolsErr, storeErr}}
+		c := NewClient(auth.NewTokenManager("", ""), false, false)
+		c.HTTPClient = &http.Client{Transport: transport}
+		ctx := WithAttemptBudget(context.Background(), tt.budget)
+		req := &Request{
+			Model: "gpt-5",
+			Tools: []types.ResponsesTool{{Type: "web_search"}},
+			Store: types.BoolPtr(false),
+		}
+
+		resp, upErr := c.DoWithRetry(ctx, req, true, nil)
+		if transport.calls != tt.wantCalls {
+			t.Errorf("budget %d: got %d upstream calls, want %d", tt.budget, transport.calls, tt.wantCalls)
+		}
+		switch {
+		case tt.wantErr == "" && upErr != nil:
+			t.Errorf("budget %d: unexpected error %v", tt.budget, upErr)
+		case tt.wantErr != "" && (upErr == nil || upErr.StatusCode != http.StatusBadRequest || !strings.Contains(upErr.Error(), tt.wantErr)):
+			t.Errorf("budget %d: got error %v, want the last upstream 400 containing %q", tt.budget, upErr, tt.wantErr)
+		}
+		if resp != nil {
+			resp.Body.Body.Close()
+		}
+
+		// A later retry on the same request (e.g. an empty-response retry)
+		// draws from the same budget.
+		if tt.budget > 0 {
+			_, upErr = c.DoWithRetry(ctx, req, false, nil)
+			if upErr == nil || transport.calls != tt.wantCalls {
+				t.Errorf("budget %d: follow-up call went upstream (calls %d, err %v)", tt.budget, transport.calls, upErr)
+			}
+		}
+	}
+}
+
+// gatedTransport blocks each call until release is closed, after signalling
+// entered.
+type gatedTransport struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (g *gatedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	g.entered <- struct{}{}
+	<-g.release
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader("data: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\"}}\n\n")),
+		Request:    r,
+	}, nil
+}
+
+func TestDoWithRetryConcurrencyLimit(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	transport := &gatedTransport{entered: make(chan struct{}, 4), release: make(chan struct{})}
+	c := NewClient(auth.NewTokenManager("", ""), false, false)
+	c.HTTPClient = &http.Client{Transport: transport}
+	limiter := NewConcurrencyLimiter(1, 0)
+
+	first := make(chan *Response, 1)
+	go func() {
+		resp, _ := c.DoWithRetry(WithConcurrencyLimiter(context.Background(), limiter), &Request{Model: "gpt-5"}, false, nil)
+		first <- resp
+	}()
+	<-transport.entered
+
+	// The only slot is taken and the backlog is empty: rejected with 429.
+	ctx := WithConcurrencyLimiter(context.Background(), limiter)
+	if _, upErr := c.DoWithRetry(ctx, &Request{Model: "gpt-5"}, false, nil); upErr == nil || upErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while the slot is held, got %v", upErr)
+	}
+	if !ConcurrencyLimited(ctx) {
+		t.Error("rejected context should report ConcurrencyLimited")
+	}
+
+	// Once headers arrive the slot is free, even though the body is unread.
+	close(transport.release)
+	resp := <-first
+	if resp == nil {
+		t.Fatal("first call should succeed")
+	}
+	defer resp.Body.Body.Close()
+	ctx = WithConcurrencyLimiter(context.Background(), limiter)
+	resp2, upErr := c.DoWithRetry(ctx, &Request{Model: "gpt-5"}, false, nil)
+	if upErr != nil {
+		t.Fatalf("slot should be released while the first body streams: %v", upErr)
+	}
+	resp2.Body.Body.Close()
+	if ConcurrencyLimited(ctx) {
+		t.Error("admitted context should not report ConcurrencyLimited")
+	}
+}
+
+func TestDoWithRetryReportsJSONBodyWithSuccessStatus(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_HOME", t.TempDir())
+	if err := auth.WriteAuthFile(&auth.AuthFile{Tokens: auth.TokenData{AccessToken: "tok", AccountID: "acct"}}); err != nil {
+		t.Fatalf("write auth file: %v", err)
+	}
+	const msg = "The requested model is not supported for this account."
+	c := NewClient(auth.NewTokenManager("", ""), false, false)
+	c.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"detail":"` + msg + `"}`)),
+			Request:    r,
+		}, nil
+	})}
+
+	resp, upErr := c.DoWithRetry(context.Background(), &Request{Model: "gpt-5"}, false, nil)
+	if resp != nil {
+		resp.Body.Body.Close()
+		t.Fatal("expected an error, got a response")
+	}
+	if upErr == nil || upErr.StatusCode != http.StatusBadGateway || !strings.Contains(upErr.Error(), msg) {
+		t.Errorf("got error %v, want a 502 carrying %q", upErr, msg)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/n0madic/go-chatmock/internal/metrics"
+)
+
+// usageMetricsBody passes an upstream SSE body through unchanged while
+// watching for the terminal event's usage, which it adds to the token metrics
+// once. Every route reads the body through it, so usage is counted the same
+// way for streamed and collected responses.
+type usageMetricsBody struct {
+	src      io.ReadCloser
+	ctx      context.Context
+	line     []byte
+	recorded bool
+}
+
+func (b *usageMetricsBody) Read(p []byte) (int, error) {
+	n, err := b.src.Read(p)
+	if n > 0 && !b.recorded {
+		b.scan(p[:n])
+	}
+	return n, err
+}
+
+func (b *usageMetricsBody) Close() error {
+	return b.src.Close()
+}
+
+func (b *usageMetricsBody) scan(chunk []byte) {
+	for len(chunk) > 0 && !b.recorded {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			b.line = append(b.line, chunk...)
+			return
+		}
+		b.line = append(b.line, chunk[:i]...)
+		chunk = chunk[i+1:]
+		b.observeLine(b.line)
+		b.line = b.line[:0]
+	}
+}
+
+func (b *usageMetricsBody) observeLine(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return
+	}
+	var evt struct {
+		Type     string `json:"type"`
+		Response struct {
+			Usage *struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		} `json:"response"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(data), &evt) != nil || evt.Response.Usage == nil {
+		return
+	}
+	switch evt.Type {
+	case "response.completed", "response.incomplete", "response.failed":
+		metrics.ObserveTokens(b.ctx, evt.Response.Usage.InputTokens, evt.Response.Usage.OutputTokens)
+		b.recorded = true
+		b.line = nil
+	}
+}
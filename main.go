@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	_ "embed"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -23,7 +25,10 @@ import (
 	"github.com/n0madic/go-chatmock/internal/limits"
 	"github.com/n0madic/go-chatmock/internal/models"
 	"github.com/n0madic/go-chatmock/internal/oauth"
+	"github.com/n0madic/go-chatmock/internal/pricing"
 	"github.com/n0madic/go-chatmock/internal/server"
+	"github.com/n0madic/go-chatmock/internal/state"
+	"github.com/n0madic/go-chatmock/internal/stream"
 )
 
 //go:embed prompts/prompt.md
@@ -35,7 +40,7 @@ var promptGPT5CodexMD string
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Fprintln(os.Stderr, "Usage: go-chatmock <command> [flags]")
-		fmt.Fprintln(os.Stderr, "Commands: login, serve, info")
+		fmt.Fprintln(os.Stderr, "Commands: login, serve, info, doctor")
 		os.Exit(1)
 	}
 
@@ -46,9 +51,11 @@ func main() {
 		os.Exit(cmdServe())
 	case "info":
 		os.Exit(cmdInfo())
+	case "doctor":
+		os.Exit(cmdDoctor())
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
-		fmt.Fprintln(os.Stderr, "Commands: login, serve, info")
+		fmt.Fprintln(os.Stderr, "Commands: login, serve, info, doctor")
 		os.Exit(1)
 	}
 }
@@ -143,25 +150,31 @@ func stdinPasteWorker(srv *oauth.Server) {
 }
 
 func cmdServe() int {
-	fs := flag.NewFlagSet("serve", flag.ExitOnError)
-	cfg := config.DefaultFromEnv()
-
-	fs.StringVar(&cfg.Host, "host", cfg.Host, "Bind host")
-	fs.IntVar(&cfg.Port, "port", cfg.Port, "Listen port")
-	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "Enable verbose logging")
-	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable full inbound request and upstream response dumps (headers/body)")
-	fs.StringVar(&cfg.AccessToken, "access-token", cfg.AccessToken, "Require inbound Authorization bearer token for API routes")
-	fs.StringVar(&cfg.ReasoningEffort, "reasoning-effort", cfg.ReasoningEffort, "Reasoning effort level (minimal|low|medium|high|xhigh)")
-	fs.StringVar(&cfg.ReasoningSummary, "reasoning-summary", cfg.ReasoningSummary, "Reasoning summary (auto|concise|detailed|none)")
-	fs.StringVar(&cfg.ReasoningCompat, "reasoning-compat", cfg.ReasoningCompat, "Reasoning compat mode (think-tags|o3|legacy|current)")
-	fs.StringVar(&cfg.DebugModel, "debug-model", cfg.DebugModel, "Force model name override")
-	fs.BoolVar(&cfg.ExposeReasoningModels, "expose-reasoning-models", cfg.ExposeReasoningModels, "Expose effort variants as separate models")
-	fs.BoolVar(&cfg.DefaultWebSearch, "enable-web-search", cfg.DefaultWebSearch, "Enable default web_search tool")
-	fs.StringVar(&cfg.ResponseFormat, "response-format", cfg.ResponseFormat, "Response format mode: 'route' (endpoint determines format) or 'input' (request body shape determines format)")
-	fs.Parse(os.Args[2:])
+	return runServe(os.Args[2:], os.Stderr)
+}
 
-	cfg.BaseInstructions = promptMD
-	cfg.CodexInstructions = promptGPT5CodexMD
+// runServe parses and validates the serve flags, then starts the server. With
+// --check-config it reports the validation result to out and exits instead.
+func runServe(args []string, out io.Writer) int {
+	cfg, checkOnly, err := parseServeConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if checkOnly {
+		if err != nil {
+			fmt.Fprintln(out, "configuration invalid:")
+			for _, line := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintf(out, "  - %s\n", line)
+			}
+			return 1
+		}
+		fmt.Fprintln(out, "configuration OK")
+		return 0
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		return 1
+	}
 
 	srv := server.New(cfg)
 
@@ -175,7 +188,7 @@ func cmdServe() int {
 		srv.Shutdown(ctx)
 	}()
 
-	slog.Info("ChatMock starting", "host", cfg.Host, "port", cfg.Port)
+	slog.Info("ChatMock starting", "host", cfg.Host, "port", cfg.Port, "tls", cfg.TLSCertFile != "")
 	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("server error", "error", err)
 		return 1
@@ -183,6 +196,209 @@ func cmdServe() int {
 	return 0
 }
 
+// parseServeConfig builds the serve configuration from the environment and
+// args and validates it without binding a port. All validation problems are
+// joined into the returned error. checkOnly reports whether --check-config was
+// given.
+func parseServeConfig(args []string) (cfg *config.ServerConfig, checkOnly bool, err error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg, envNumErr := config.LoadFromEnv()
+	var envEffortErr error
+	cfg.ReasoningEffortByModel, envEffortErr = config.EnvReasoningEffortByModel()
+
+	fs.BoolVar(&checkOnly, "check-config", false, "Validate flags, environment and referenced files, then exit without starting the server")
+	fs.StringVar(&cfg.Host, "host", cfg.Host, "Bind host")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "Listen port")
+	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "Enable verbose logging")
+	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "Enable full inbound request and upstream response dumps (headers/body)")
+	fs.BoolVar(&cfg.RedactReasoning, "redact-reasoning-in-logs", cfg.RedactReasoning, "Keep reasoning text out of --debug dumps and of the stored conversation context (answers and tool calls are kept)")
+	fs.BoolVar(&cfg.EnableMetrics, "enable-metrics", cfg.EnableMetrics, "Serve Prometheus metrics at GET /metrics")
+	fs.BoolVar(&cfg.GzipSSE, "gzip-sse", cfg.GzipSSE, "Gzip streaming (SSE) responses for clients that send Accept-Encoding: gzip, flushing after each event")
+	fs.StringVar(&cfg.LogRedact, "log-redact", cfg.LogRedact, "Message text in --debug request dumps: none, truncate, or hash (base64 image/file data is always replaced with its size)")
+	fs.StringVar(&cfg.AccessToken, "access-token", cfg.AccessToken, "Require inbound Authorization bearer token for API routes")
+	fs.StringVar(&cfg.ReasoningEffort, "reasoning-effort", cfg.ReasoningEffort, "Reasoning effort level (minimal|low|medium|high|xhigh)")
+	fs.Func("reasoning-effort-model", "Per-model default reasoning effort as model=effort (repeatable), used when the request sets none; overrides --reasoning-effort", func(s string) error {
+		var err error
+		cfg.ReasoningEffortByModel, err = config.ParseReasoningEffortMap(cfg.ReasoningEffortByModel, s)
+		return err
+	})
+	fs.StringVar(&cfg.ReasoningSummary, "reasoning-summary", cfg.ReasoningSummary, "Reasoning summary (auto|concise|detailed|none)")
+	fs.StringVar(&cfg.ReasoningCompat, "reasoning-compat", cfg.ReasoningCompat, "Reasoning compat mode (think-tags|inline|o3|legacy|current)")
+	fs.StringVar(&cfg.DebugModel, "debug-model", cfg.DebugModel, "Force model name override")
+	fs.BoolVar(&cfg.ExposeReasoningModels, "expose-reasoning-models", cfg.ExposeReasoningModels, "Expose effort variants as separate models")
+	fs.BoolVar(&cfg.DefaultWebSearch, "enable-web-search", cfg.DefaultWebSearch, "Enable default web_search tool")
+	fs.StringVar(&cfg.ResponseFormat, "response-format", cfg.ResponseFormat, "Response format mode: 'route' (endpoint determines format) or 'input' (request body shape determines format)")
+	fs.StringVar(&cfg.EnforceToolChoice, "enforce-tool-choice", cfg.EnforceToolChoice, "When tool_choice forces a tool but the model answers with text: off (log only), error, or retry (one nudged retry); streaming responses are only logged")
+	fs.BoolVar(&cfg.CanonicalToolNames, "canonical-tool-names", cfg.CanonicalToolNames, "Rewrite tool names the upstream rejects (e.g. dotted names) and restore them in responses")
+	fs.BoolVar(&cfg.RequireJSONContentType, "require-json-content-type", cfg.RequireJSONContentType, "Reject POST requests without a JSON Content-Type (415); Ollama /api routes are exempt")
+	fs.BoolVar(&cfg.NoJSONNewlineFallback, "no-json-newline-fallback", cfg.NoJSONNewlineFallback, "Reject chat/responses bodies with raw newlines or other control characters inside strings (400 with the parse error position) instead of escaping them")
+	fs.BoolVar(&cfg.OmitPromptWithoutTools, "omit-prompt-without-tools", cfg.OmitPromptWithoutTools, "Skip the embedded Codex prompt for requests with no tools and no client instructions")
+	fs.BoolVar(&cfg.Warmup, "warmup", cfg.Warmup, "Send a small warm-up request upstream after startup to prime token, connections and models")
+	fs.StringVar(&cfg.RequestIDHeader, "request-id-header", cfg.RequestIDHeader, "Header used to read and echo the request correlation ID (Traceparent logs the W3C trace-id)")
+	fs.BoolVar(&cfg.RenumberOutputIndices, "renumber-output-indices", cfg.RenumberOutputIndices, "Rewrite streamed Responses output_index values to be contiguous on continuations")
+	fs.IntVar(&cfg.MaxSSEEventSize, "max-sse-event-size", cfg.MaxSSEEventSize, "Maximum size in bytes of a single upstream SSE event line")
+	fs.IntVar(&cfg.MaxParallelToolCalls, "max-parallel-tool-calls", cfg.MaxParallelToolCalls, "Forward at most this many tool calls per turn, holding back the rest in arrival order (0 forwards all)")
+	fs.IntVar(&cfg.MaxUpstreamAttempts, "max-upstream-attempts", cfg.MaxUpstreamAttempts, "Cap the upstream calls one client request may make across all retries; the last error is returned once spent (0 is unlimited)")
+	fs.IntVar(&cfg.MaxConcurrentRequests, "max-concurrent-requests", cfg.MaxConcurrentRequests, "Allow at most this many upstream calls in flight; --max-concurrent-backlog more wait, and the rest get 429 (0 is unlimited)")
+	fs.IntVar(&cfg.MaxConcurrentBacklog, "max-concurrent-backlog", cfg.MaxConcurrentBacklog, "How many upstream calls may wait for a --max-concurrent-requests slot before the rest get 429 (negative: same as --max-concurrent-requests)")
+	fs.IntVar(&cfg.ServerMaxOutputTokens, "server-max-output-tokens", cfg.ServerMaxOutputTokens, "Hard cap on output tokens per response, bounding the client's max; streams that reach it end with a length finish (0 is unlimited)")
+	fs.BoolVar(&cfg.RepairToolArgs, "repair-tool-args", cfg.RepairToolArgs, "Repair truncated or malformed tool-call argument JSON (falls back to {})")
+	fs.BoolVar(&cfg.EmitCostHeader, "emit-cost-header", cfg.EmitCostHeader, "Emit an X-Chatmock-Estimated-Cost header on non-streaming responses (requires --cost-price-table)")
+	fs.BoolVar(&cfg.ForwardObfuscation, "forward-obfuscation", cfg.ForwardObfuscation, "Forward the random obfuscation padding on streamed /v1/responses delta events instead of stripping it")
+	fs.BoolVar(&cfg.EmitSystemFingerprint, "system-fingerprint", cfg.EmitSystemFingerprint, "Report a system_fingerprint derived from the model, reasoning defaults and embedded prompt on chat completions and responses")
+	fs.BoolVar(&cfg.StripEmptyToolResults, "strip-empty-tool-results", cfg.StripEmptyToolResults, "Send empty tool outputs upstream as \"(no output)\" instead of an empty string")
+	fs.BoolVar(&cfg.StrictTools, "strict-tools", cfg.StrictTools, "Reject function/custom tools without a name with 400 instead of silently dropping them")
+	fs.BoolVar(&cfg.StrictSamplingParams, "strict-sampling-params", cfg.StrictSamplingParams, "Reject out-of-range temperature, top_p and frequency/presence penalties with 400 instead of clamping them")
+	fs.BoolVar(&cfg.AckToolResults, "ack-tool-results", cfg.AckToolResults, "Insert a short assistant acknowledgement between a tool output and a user message that directly follows it (normalized routes only)")
+	fs.DurationVar(&cfg.SSEFlushInterval, "sse-flush-interval", cfg.SSEFlushInterval, "Batch streamed chunks and flush them on this interval (or every 32KiB) instead of after each chunk; tool-call boundaries and the stream end still flush at once (0 flushes per chunk)")
+	fs.BoolVar(&cfg.ReportUpstreamModel, "report-upstream-model", cfg.ReportUpstreamModel, "Report the normalized upstream model in responses instead of the model name the client requested")
+	fs.StringVar(&cfg.AllowedIncludes, "allowed-includes", cfg.AllowedIncludes, "Comma-separated Responses include values forwarded upstream; others are dropped, including the forced reasoning.encrypted_content (empty allows all)")
+	fs.DurationVar(&cfg.MaxConversationAge, "max-conversation-age", cfg.MaxConversationAge, "Start fresh instead of auto-linking a conversation id whose latest response was stored longer ago than this, even before it expires (0 disables)")
+	fs.StringVar(&cfg.DefaultModel, "default-model", cfg.DefaultModel, "Model used when a request omits model (unlike --debug-model, an explicit model still wins)")
+	fs.StringVar(&cfg.LegacyModelTarget, "legacy-model-target", cfg.LegacyModelTarget, "Serve legacy OpenAI models (gpt-3.5*, gpt-4*, ...) with this model and report the remap in an X-Chatmock-Deprecation header")
+	fs.StringVar(&cfg.EmbeddingsPassthroughURL, "embeddings-passthrough-url", cfg.EmbeddingsPassthroughURL, "Forward POST /v1/embeddings to this embeddings provider URL with the client's Authorization header (unset answers 501)")
+	fs.DurationVar(&cfg.StartupTimeout, "startup-timeout", cfg.StartupTimeout, "Bound the blocking first models fetch; on expiry the disk cache or static model list is used and a warning is logged (0 waits indefinitely)")
+	fs.DurationVar(&cfg.UpstreamIdleTimeout, "upstream-idle-timeout", cfg.UpstreamIdleTimeout, "End a stream whose upstream has been silent this long; output already sent is closed as truncated (0 disables)")
+	fs.DurationVar(&cfg.ResponsesHeartbeat, "responses-heartbeat", cfg.ResponsesHeartbeat, "Send a synthetic response.in_progress event after this much upstream silence on Responses streams until output starts (0 disables)")
+	fs.DurationVar(&cfg.StateConversationTTL, "state-conversation-ttl", cfg.StateConversationTTL, "How long an idle conversation-id link is kept; set above the 60m response-entry TTL to detect expired context on resume")
+	fs.StringVar(&cfg.StateSpillDir, "state-spill-dir", cfg.StateSpillDir, "Write state entries evicted for capacity to this directory and load them back on lookup, so previous_response_id chains survive eviction")
+	fs.StringVar(&cfg.OllamaVersion, "ollama-version", cfg.OllamaVersion, "Version reported by the Ollama GET /api/version endpoint")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "Serve HTTPS with this PEM certificate file (requires --tls-key)")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "PEM private key file for --tls-cert")
+	fs.StringVar(&cfg.TLSMinVersion, "tls-min-version", cfg.TLSMinVersion, "Minimum TLS version for HTTPS: 1.2 or 1.3")
+	fs.StringVar(&cfg.TLSCipherSuites, "tls-cipher-suites", cfg.TLSCipherSuites, "Comma-separated TLS 1.2 cipher suite names (default: ECDHE AEAD suites only)")
+	fs.StringVar(&cfg.EmptyResponseBehavior, "empty-response-behavior", cfg.EmptyResponseBehavior, "When upstream returns no output: retry (once, then error), error, or empty (a valid empty reply)")
+	fs.BoolVar(&cfg.TruncationNotice, "truncation-notice", cfg.TruncationNotice, "Add an X-Chatmock-Truncated header naming the reason when a non-streaming response was cut short")
+	fs.StringVar(&cfg.ModelTemperatureDefault, "model-temperature-default", cfg.ModelTemperatureDefault, "Comma-separated model=temperature rules applied when the client sends no temperature (trailing * matches a prefix); /v1/responses passthrough only, the route that forwards temperature")
+	fs.StringVar(&cfg.ModelTemperatureOverride, "model-temperature-override", cfg.ModelTemperatureOverride, "Comma-separated model=temperature rules that replace the client's temperature (trailing * matches a prefix); /v1/responses passthrough only")
+	fs.StringVar(&cfg.PromptMap, "prompt-map", cfg.PromptMap, "Comma-separated model=prompt rules (prompt: base, codex, none; trailing * matches a prefix), checked before the built-in codex rules")
+	fs.StringVar(&cfg.CostPriceTable, "cost-price-table", cfg.CostPriceTable, "JSON file with per-model USD prices per 1M tokens for --emit-cost-header")
+	fs.StringVar(&cfg.CapabilitiesFile, "capabilities-file", cfg.CapabilitiesFile, "JSON file of per-model capabilities (context window, max output, reasoning levels, web_search and sampling param support) merged over the built-in defaults")
+	fs.IntVar(&cfg.StateConversationCapacity, "state-conversation-capacity", cfg.StateConversationCapacity, "Maximum number of conversation-id links kept in the responses-state store")
+	fs.DurationVar(&cfg.StateSweepInterval, "state-sweep-interval", cfg.StateSweepInterval, "How often expired responses-state entries are evicted")
+	if err := fs.Parse(args); err != nil {
+		return nil, checkOnly, err
+	}
+
+	var problems []error
+	if envNumErr != nil {
+		problems = append(problems, envNumErr)
+	}
+	if envEffortErr != nil {
+		problems = append(problems, fmt.Errorf("invalid CHATGPT_LOCAL_REASONING_BY_MODEL: %w", envEffortErr))
+	}
+	switch cfg.EnforceToolChoice {
+	case "off", "error", "retry":
+	default:
+		problems = append(problems, fmt.Errorf("invalid --enforce-tool-choice %q; expected off, error, or retry", cfg.EnforceToolChoice))
+	}
+	switch cfg.LogRedact {
+	case "none", "truncate", "hash":
+	default:
+		problems = append(problems, fmt.Errorf("invalid --log-redact %q; expected none, truncate, or hash", cfg.LogRedact))
+	}
+	switch cfg.EmptyResponseBehavior {
+	case "retry", "error", "empty":
+	default:
+		problems = append(problems, fmt.Errorf("invalid --empty-response-behavior %q; expected retry, error, or empty", cfg.EmptyResponseBehavior))
+	}
+	if _, err := server.TLSConfig(cfg.TLSMinVersion, cfg.TLSCipherSuites); err != nil {
+		problems = append(problems, fmt.Errorf("invalid TLS settings: %w", err))
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problems = append(problems, errors.New("--tls-cert and --tls-key must be set together"))
+	} else if cfg.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile); err != nil {
+			problems = append(problems, fmt.Errorf("failed to load --tls-cert/--tls-key: %w", err))
+		}
+	}
+	if cfg.StateSweepInterval < state.MinSweepInterval {
+		problems = append(problems, fmt.Errorf("invalid --state-sweep-interval %s; minimum is %s", cfg.StateSweepInterval, state.MinSweepInterval))
+	}
+	if cfg.SSEFlushInterval < 0 {
+		problems = append(problems, fmt.Errorf("invalid --sse-flush-interval %s; must not be negative", cfg.SSEFlushInterval))
+	}
+	if cfg.MaxConversationAge < 0 {
+		problems = append(problems, fmt.Errorf("invalid --max-conversation-age %s; must not be negative", cfg.MaxConversationAge))
+	}
+	if cfg.StartupTimeout < 0 {
+		problems = append(problems, fmt.Errorf("invalid --startup-timeout %s; must not be negative", cfg.StartupTimeout))
+	}
+	if cfg.UpstreamIdleTimeout < 0 {
+		problems = append(problems, fmt.Errorf("invalid --upstream-idle-timeout %s; must not be negative", cfg.UpstreamIdleTimeout))
+	}
+	if cfg.ResponsesHeartbeat < 0 {
+		problems = append(problems, fmt.Errorf("invalid --responses-heartbeat %s; must not be negative", cfg.ResponsesHeartbeat))
+	}
+	if cfg.StateConversationTTL <= 0 {
+		problems = append(problems, fmt.Errorf("invalid --state-conversation-ttl %s; must be positive", cfg.StateConversationTTL))
+	}
+	if cfg.EmbeddingsPassthroughURL != "" {
+		if u, err := url.Parse(cfg.EmbeddingsPassthroughURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Errorf("invalid --embeddings-passthrough-url %q; must be an http or https URL", cfg.EmbeddingsPassthroughURL))
+		}
+	}
+	if cfg.StateSpillDir != "" {
+		if err := os.MkdirAll(cfg.StateSpillDir, 0o700); err != nil {
+			problems = append(problems, fmt.Errorf("invalid --state-spill-dir: %w", err))
+		}
+	}
+	if cfg.MaxParallelToolCalls < 0 {
+		problems = append(problems, fmt.Errorf("invalid --max-parallel-tool-calls %d; must not be negative", cfg.MaxParallelToolCalls))
+	}
+	if cfg.MaxUpstreamAttempts < 0 {
+		problems = append(problems, fmt.Errorf("invalid --max-upstream-attempts %d; must not be negative", cfg.MaxUpstreamAttempts))
+	}
+	if cfg.MaxConcurrentRequests < 0 {
+		problems = append(problems, fmt.Errorf("invalid --max-concurrent-requests %d; must not be negative", cfg.MaxConcurrentRequests))
+	}
+	if cfg.ServerMaxOutputTokens < 0 {
+		problems = append(problems, fmt.Errorf("invalid --server-max-output-tokens %d; must not be negative", cfg.ServerMaxOutputTokens))
+	}
+	if cfg.MaxSSEEventSize < stream.MinMaxEventSize {
+		problems = append(problems, fmt.Errorf("invalid --max-sse-event-size %d; minimum is %d", cfg.MaxSSEEventSize, stream.MinMaxEventSize))
+	}
+
+	if cfg.EmitCostHeader {
+		if cfg.CostPriceTable == "" {
+			problems = append(problems, errors.New("--emit-cost-header requires --cost-price-table"))
+		} else if prices, err := pricing.LoadTable(cfg.CostPriceTable); err != nil {
+			problems = append(problems, fmt.Errorf("failed to load --cost-price-table: %w", err))
+		} else {
+			cfg.CostPrices = prices
+		}
+	}
+
+	if cfg.CapabilitiesFile != "" {
+		if caps, err := config.LoadCapabilities(cfg.CapabilitiesFile); err != nil {
+			problems = append(problems, fmt.Errorf("failed to load --capabilities-file: %w", err))
+		} else {
+			cfg.Capabilities = caps
+		}
+	}
+
+	if rules, err := config.ParsePromptMap(cfg.PromptMap); err != nil {
+		problems = append(problems, fmt.Errorf("invalid --prompt-map: %w", err))
+	} else {
+		cfg.PromptRules = rules
+	}
+
+	if rules, err := config.ParseTemperatureMap(cfg.ModelTemperatureDefault); err != nil {
+		problems = append(problems, fmt.Errorf("invalid --model-temperature-default: %w", err))
+	} else {
+		cfg.TemperatureDefaults = rules
+	}
+	if rules, err := config.ParseTemperatureMap(cfg.ModelTemperatureOverride); err != nil {
+		problems = append(problems, fmt.Errorf("invalid --model-temperature-override: %w", err))
+	} else {
+		cfg.TemperatureOverrides = rules
+	}
+
+	cfg.BaseInstructions = promptMD
+	cfg.CodexInstructions = promptGPT5CodexMD
+	return cfg, checkOnly, errors.Join(problems...)
+}
+
 func cmdInfo() int {
 	fs := flag.NewFlagSet("info", flag.ExitOnError)
 	jsonOut := fs.Bool("json", false, "Output service info as JSON")
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfigValid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"gpt-5":{"input":1.25,"output":10}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	code := runServe([]string{"--check-config", "--port", "1", "--emit-cost-header", "--cost-price-table", path, "--prompt-map", "gpt-5-pro=codex"}, &out)
+	if code != 0 {
+		t.Fatalf("exit code got %d, want 0 (output %q)", code, out.String())
+	}
+	if !strings.Contains(out.String(), "configuration OK") {
+		t.Errorf("output got %q, want configuration OK", out.String())
+	}
+}
+
+func TestCheckConfigReportsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"gpt-5":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	code := runServe([]string{"--check-config", "--emit-cost-header", "--cost-price-table", path, "--enforce-tool-choice", "always"}, &out)
+	if code == 0 {
+		t.Fatalf("exit code got 0, want non-zero (output %q)", out.String())
+	}
+	for _, want := range []string{"configuration invalid", "--cost-price-table", path, "--enforce-tool-choice"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should mention %q, got %q", want, out.String())
+		}
+	}
+}
+
+func TestCheckConfigReportsMalformedEffortEnv(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_REASONING_BY_MODEL", "gpt-5=high,gpt-5-codex")
+
+	var out bytes.Buffer
+	code := runServe([]string{"--check-config", "--port", "1"}, &out)
+	if code == 0 {
+		t.Fatalf("exit code got 0, want non-zero (output %q)", out.String())
+	}
+	if !strings.Contains(out.String(), "CHATGPT_LOCAL_REASONING_BY_MODEL") {
+		t.Errorf("output should mention CHATGPT_LOCAL_REASONING_BY_MODEL, got %q", out.String())
+	}
+}
+
+func TestCheckConfigReportsMalformedNumericEnv(t *testing.T) {
+	t.Setenv("CHATGPT_LOCAL_MAX_SSE_EVENT_SIZE", "16MB")
+	t.Setenv("CHATGPT_LOCAL_UPSTREAM_IDLE_TIMEOUT", "90")
+
+	var out bytes.Buffer
+	code := runServe([]string{"--check-config", "--port", "1"}, &out)
+	if code == 0 {
+		t.Fatalf("exit code got 0, want non-zero (output %q)", out.String())
+	}
+	for _, want := range []string{"CHATGPT_LOCAL_MAX_SSE_EVENT_SIZE", "CHATGPT_LOCAL_UPSTREAM_IDLE_TIMEOUT"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output should mention %q, got %q", want, out.String())
+		}
+	}
+}
+
+func TestServeHelpExitsZero(t *testing.T) {
+	var out bytes.Buffer
+	if code := runServe([]string{"--help"}, &out); code != 0 {
+		t.Errorf("exit code got %d, want 0", code)
+	}
+}